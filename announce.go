@@ -0,0 +1,21 @@
+package main
+
+// announceAddress tells the switch and neighbours of the device's new address
+// straight away with a gratuitous ARP for each IPv4 address and an unsolicited
+// neighbour advertisement for each IPv6 one, rather than leaving the device
+// unreachable until their caches expire.
+func (r *rotation) announceAddress(settings settings) {
+	if !settings.announce {
+		return
+	}
+	if settings.dryRun {
+		r.logger.Info("would announce the new address to neighbours")
+		return
+	}
+
+	if err := announce(r.deviceName); err != nil {
+		r.logger.Warn("could not announce the new address to neighbours", "err", err)
+		return
+	}
+	r.logger.Debug("announced the new address to neighbours")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+const (
+	ethernetTypeARP  = 0x0806
+	ethernetTypeIPv4 = 0x0800
+
+	arpHardwareEthernet = 1
+	arpOpRequest        = 1
+
+	icmpv6NeighborAdvertisement = 136
+	ndOptionTargetLinkLayer     = 2
+	ndFlagOverride              = 0x20
+
+	// ndHopLimit is the only hop limit that neighbours accept neighbour
+	// discovery messages with, proving they came from the link itself.
+	ndHopLimit = 255
+)
+
+// htons puts a value into network order for kernel structures that expect it
+// in host order.
+func htons(v uint16) uint16 {
+	return binary.NativeEndian.Uint16(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func announce(deviceName string) error {
+	iface, err := net.InterfaceByName(deviceName)
+	if err != nil {
+		return err
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return fmt.Errorf("%s has no Ethernet address to announce", deviceName)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			errs = append(errs, sendGratuitousARP(iface, ip))
+		} else if ipNet.IP.IsGlobalUnicast() || ipNet.IP.IsLinkLocalUnicast() {
+			errs = append(errs, sendNeighborAdvertisement(iface, ipNet.IP))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendGratuitousARP broadcasts an ARP request for the device's own IPv4
+// address, which neighbours take as the address's new owner.
+func sendGratuitousARP(iface *net.Interface, ip net.IP) error {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, int(htons(ethernetTypeARP)))
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+
+	packet := binary.BigEndian.AppendUint16(nil, arpHardwareEthernet)
+	packet = binary.BigEndian.AppendUint16(packet, ethernetTypeIPv4)
+	packet = append(packet, 6, 4)
+	packet = binary.BigEndian.AppendUint16(packet, arpOpRequest)
+	packet = append(packet, iface.HardwareAddr...)
+	packet = append(packet, ip...)
+	packet = append(packet, make([]byte, 6)...)
+	packet = append(packet, ip...)
+
+	to := &syscall.SockaddrLinklayer{
+		Protocol: htons(ethernetTypeARP),
+		Ifindex:  iface.Index,
+		Halen:    6,
+		Addr:     [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	if err := syscall.Sendto(fd, packet, 0, to); err != nil {
+		return os.NewSyscallError("sendto", err)
+	}
+	return nil
+}
+
+// sendNeighborAdvertisement multicasts an unsolicited neighbour advertisement
+// overriding what the link's nodes have cached for the IPv6 address.
+func sendNeighborAdvertisement(iface *net.Interface, ip net.IP) error {
+	packet := []byte{icmpv6NeighborAdvertisement, 0, 0, 0, ndFlagOverride, 0, 0, 0}
+	packet = append(packet, ip.To16()...)
+	packet = append(packet, ndOptionTargetLinkLayer, 1)
+	packet = append(packet, iface.HardwareAddr...)
+
+	return sendNeighborDiscovery(iface, ip, net.IPv6linklocalallnodes, packet)
+}
+
+// sendNeighborDiscovery sends an ICMPv6 message on the link, from the address
+// if given, or whichever the kernel picks otherwise. The kernel fills in the
+// checksum of ICMPv6 raw sockets.
+func sendNeighborDiscovery(iface *net.Interface, from, to net.IP, packet []byte) error {
+	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.IPPROTO_ICMPV6)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, ndHopLimit); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, iface.Index); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+
+	if from != nil {
+		source := &syscall.SockaddrInet6{ZoneId: uint32(iface.Index)}
+		copy(source.Addr[:], from.To16())
+		if err := syscall.Bind(fd, source); err != nil {
+			return os.NewSyscallError("bind", err)
+		}
+	}
+
+	destination := &syscall.SockaddrInet6{ZoneId: uint32(iface.Index)}
+	copy(destination.Addr[:], to.To16())
+	if err := syscall.Sendto(fd, packet, 0, destination); err != nil {
+		return os.NewSyscallError("sendto", err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func announce(string) error {
+	return errors.New("new addresses can only be announced to neighbours on Linux")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// dashboard is a page for watching and steering the daemon from a browser,
+// such as on a phone. It holds no data itself, so it is served without the
+// token, which it asks for instead.
+//
+//go:embed dashboard.html
+var dashboard []byte
+
+const (
+	apiShutdownTimeout = 5 * time.Second
+	apiReadTimeout     = 10 * time.Second
+)
+
+// serveAPI answers the HTTP API for home-lab automation and dashboards, with
+// requests authenticated by a bearer token, along with the built-in dashboard
+// at /. Changes accept device query parameters, defaulting to every device:
+//
+//	GET  /status
+//	GET  /history?since=<RFC 3339 time>
+//	GET  /events, a stream of server-sent events
+//	POST /rotate
+//	POST /pause
+//	POST /resume
+//	POST /restore?to=original|permanent
+func serveAPI(ctx context.Context, d *daemon, listener net.Listener, token string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", d.handleAPIStatus)
+	mux.HandleFunc("GET /history", d.handleAPIHistory)
+	mux.HandleFunc("GET /events", d.handleAPIEvents(ctx))
+	for _, verb := range []string{"rotate", "pause", "resume", "restore"} {
+		mux.HandleFunc("POST /"+verb, d.handleAPIControl(verb))
+	}
+
+	root := http.NewServeMux()
+	root.HandleFunc("GET /{$}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		w.Write(dashboard)
+	})
+	root.Handle("/", requireToken(token, mux))
+
+	server := &http.Server{
+		Handler:           root,
+		ReadHeaderTimeout: apiReadTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	go func() {
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("stopped serving the API", "err", err)
+		}
+	}()
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (d *daemon) handleAPIStatus(w http.ResponseWriter, req *http.Request) {
+	rotations, err := d.selectRotations(req.URL.Query()["device"])
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+
+	statuses := make([]status, len(rotations))
+	for i, r := range rotations {
+		statuses[i] = r.currentStatus()
+	}
+	writeAPIJSON(w, http.StatusOK, statuses)
+}
+
+func (d *daemon) handleAPIHistory(w http.ResponseWriter, req *http.Request) {
+	var since time.Time
+	if value := req.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, d.history.since(since))
+}
+
+// handleAPIControl runs a request of the control protocol, so that the API
+// and ctl behave alike.
+func (d *daemon) handleAPIControl(verb string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		words := []string{verb}
+		if to := req.URL.Query().Get("to"); verb == "restore" && to != "" {
+			words = append(words, to)
+		}
+		words = append(words, req.URL.Query()["device"]...)
+
+		if _, err := d.control(req.Context(), words); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}
+}
+
+// handleAPIEvents streams each event concerning the devices as it happens,
+// as server-sent events of the JSON objects that ctl watch prints, until the
+// client goes or the daemon stops.
+func (d *daemon) handleAPIEvents(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		deviceNames := req.URL.Query()["device"]
+		if _, err := d.selectRotations(deviceNames); err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeAPIError(w, http.StatusInternalServerError, errors.New("the connection cannot stream events"))
+			return
+		}
+
+		subscribed, unsubscribe := events.subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-req.Context().Done():
+				return
+			case event := <-subscribed:
+				if !event.concerns(deviceNames) {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
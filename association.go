@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// associationPolicy decides what happens when a rotation comes due while a
+// device is associated with a wireless network. Changing addresses mid-
+// association drops the connection abruptly, and some drivers refuse it, so
+// the rotation can instead wait for the device to disassociate, or briefly
+// disassociate it around the change.
+type associationPolicy string
+
+const (
+	associationIgnore      associationPolicy = "ignore"
+	associationWait                          = "wait"
+	associationReassociate                   = "reassociate"
+)
+
+func parseAssociationPolicy(value string) (associationPolicy, error) {
+	switch policy := associationPolicy(value); policy {
+	case associationIgnore, associationWait, associationReassociate:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown association policy %q", value)
+	}
+}
+
+// prepareAssociation readies a device for a change according to the policy,
+// returning the network to rejoin afterwards, if any. Devices that are not
+// wireless stations are left alone.
+func (r *rotation) prepareAssociation(ctx context.Context, settings settings) (network, error) {
+	if mode := wirelessModeOf(r.deviceName); mode != "" && mode != modeStation {
+		return network{}, nil
+	}
+	if settings.associationPolicy != associationReassociate && forcesDisassociation(r.deviceName) {
+		r.logger.Info("this version of macOS only takes new Wi-Fi addresses while disassociated, so disassociating whatever the -association-policy")
+		settings.associationPolicy = associationReassociate
+	}
+	if settings.associationPolicy == associationIgnore {
+		return network{}, nil
+	}
+
+	current, err := currentNetwork(r.deviceName)
+	if err != nil || !current.associated() {
+		return network{}, nil
+	}
+
+	switch settings.associationPolicy {
+	case associationWait:
+		return network{}, r.waitForDisassociation(ctx, current)
+	case associationReassociate:
+		if settings.dryRun {
+			r.logger.Info("would disassociate", "network", current)
+			return current, nil
+		}
+		r.logger.Info("disassociating for the change", "network", current)
+		r.mu.Lock()
+		r.disassociatedAt = time.Now()
+		r.mu.Unlock()
+		return current, disassociate(r.deviceName)
+	}
+	return network{}, nil
+}
+
+func (r *rotation) waitForDisassociation(ctx context.Context, current network) error {
+	r.logger.Info("deferring the rotation until disassociated", "network", current)
+
+	ticker := time.NewTicker(networkPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current, err := currentNetwork(r.deviceName)
+		if err != nil || !current.associated() {
+			return nil
+		}
+	}
+}
+
+func (r *rotation) finishAssociation(settings settings, previous network) {
+	if !previous.associated() {
+		return
+	}
+	if settings.dryRun {
+		r.logger.Info("would reassociate", "network", previous)
+		return
+	}
+
+	if err := reassociate(r.deviceName, previous); err != nil {
+		r.logger.Warn("could not reassociate", "network", previous, "err", err)
+	}
+}
+
+// rejoinTimeout bounds how long a device is held off its network waiting for
+// the rotation its disassociation requested, in case the rotation is put off.
+const rejoinTimeout = 30 * time.Second
+
+// watchAssociationTrigger rotates a device each time it disassociates, so
+// that every association, even with the same network, has its own address.
+// Where wpa_supplicant runs, it is held off rejoining until the change has
+// been made, as it would otherwise rejoin straight away with the old address.
+func watchAssociationTrigger(ctx context.Context, d *daemon, r *rotation) error {
+	var joined network
+
+	return watchNetworks(ctx, r.deviceName, func(current network) {
+		previous := joined
+		joined = current
+		if current.associated() || !previous.associated() || !d.currentFlags().rotatePerAssociation {
+			return
+		}
+
+		// Disassociating for a change of address is not an association
+		// ending of the device's own accord.
+		r.mu.Lock()
+		disassociatedAt := r.disassociatedAt
+		r.mu.Unlock()
+		if time.Since(disassociatedAt) < linkSettleTime {
+			return
+		}
+
+		if r.isPaused() {
+			return
+		}
+		held := !r.currentSettings().dryRun && holdAssociation(r.deviceName)
+		before := r.currentStatus().lastChange
+		r.requestRotation("it disassociated from " + previous.String())
+		if !held {
+			return
+		}
+
+		r.awaitChange(ctx, before, rejoinTimeout)
+		if err := reassociate(r.deviceName, previous); err != nil {
+			r.logger.Warn("could not reassociate", "network", previous, "err", err)
+		}
+	})
+}
+
+// awaitChange waits for a change since the one made at before, or for the
+// timeout.
+func (r *rotation) awaitChange(ctx context.Context, before time.Time, timeout time.Duration) {
+	ticker := time.NewTicker(time.Second / 2)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for r.currentStatus().lastChange.Equal(before) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			r.logger.Warn("the rotation did not happen in time, so reassociating with the old address")
+			return
+		case <-ticker.C:
+		}
+	}
+}
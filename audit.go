@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	defaultAuditLog = "audit.jsonl"
+	auditLogPerm    = 0o600
+)
+
+// The results an audit record can have.
+const (
+	auditSucceeded = "succeeded"
+	auditFailed    = "failed"
+)
+
+// auditRecord is a line of the audit log, for reconciling the addresses seen
+// by switches and DHCP servers with what was changed when, and why.
+type auditRecord struct {
+	At          time.Time      `json:"at"`
+	Device      string         `json:"device"`
+	PreviousMac rotator.MAC    `json:"previous_mac"`
+	Mac         rotator.MAC    `json:"mac"`
+	Vendor      rotator.Vendor `json:"vendor"`
+	Trigger     string         `json:"trigger"`
+	Result      string         `json:"result"`
+	Error       string         `json:"error,omitempty"`
+}
+
+func newAuditRecord(entry historyEntry) auditRecord {
+	result := auditSucceeded
+	if entry.Error != "" {
+		result = auditFailed
+	}
+	return auditRecord{
+		At:          entry.At,
+		Device:      entry.Device,
+		PreviousMac: entry.Previous,
+		Mac:         entry.Mac,
+		Vendor:      entry.Vendor,
+		Trigger:     entry.Trigger,
+		Result:      result,
+		Error:       entry.Error,
+	}
+}
+
+// auditLog only ever appends, separately from the main log so that it stays
+// free of chatter and survives changes to log settings. A nil one records
+// nothing, as for dry runs. With a key file, each record is chained to the
+// one before it.
+type auditLog struct {
+	path    string
+	keyFile string
+	mu      sync.Mutex
+}
+
+func auditLogPath(flags flags) string {
+	if flags.auditLog != "" {
+		return flags.auditLog
+	}
+	return filepath.Join(flags.stateDir, defaultAuditLog)
+}
+
+func newAuditLog(flags flags) *auditLog {
+	if flags.dryRun {
+		return nil
+	}
+	a := &auditLog{path: auditLogPath(flags)}
+	if flags.auditChain {
+		a.keyFile = auditKeyPath(flags)
+	}
+	return a
+}
+
+func (a *auditLog) record(record auditRecord) {
+	if a == nil {
+		return
+	}
+	if err := a.append(record); err != nil {
+		slog.Error("could not write to the audit log", "path", a.path, "err", err)
+	}
+}
+
+// recordRestore notes a device being given back an address of its own, which
+// matters to reconciling addresses as much as a random one does.
+func (a *auditLog) recordRestore(deviceName string, previous rotator.MAC, mac rotator.MAC, trigger string, err error) {
+	record := auditRecord{
+		At:          time.Now(),
+		Device:      deviceName,
+		PreviousMac: previous,
+		Mac:         mac,
+		Trigger:     trigger,
+		Result:      auditSucceeded,
+	}
+	if err != nil {
+		record.Result = auditFailed
+		record.Error = err.Error()
+	}
+	a.record(record)
+}
+
+func (a *auditLog) append(record auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.path), stateDirPerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(a.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, auditLogPerm)
+	if err != nil {
+		return err
+	}
+	// The mutex only keeps out this process's own writers; the lock keeps
+	// out the daemon and one-off commands alike, from reading the last tag
+	// until the record chained to it is written.
+	if err := lockExclusive(file); err != nil {
+		file.Close()
+		return err
+	}
+	if a.keyFile != "" {
+		if line, err = a.chain(file, line); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// runAudit works with the audit log: exporting it, verifying its chain, or
+// reporting on its entropy.
+func runAudit(args []string) error {
+	if len(args) != 0 && args[0] == "entropy" {
+		return runAuditEntropy(args[1:])
+	}
+	if len(args) != 0 && args[0] == "verify" {
+		return runAuditVerify(args[1:])
+	}
+	if len(args) == 0 || args[0] != "export" {
+		return errors.New("usage: audit export [-format csv|json] [-since time] [device...], audit verify [flags], or audit entropy [flags] [-min-bits n]")
+	}
+
+	flagSet := flag.NewFlagSet("audit export", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var format string
+	var since time.Time
+
+	flagSet.StringVar(
+		&format,
+		"format",
+		"csv",
+		"the output format: csv or json",
+	)
+	flagSet.Func(
+		"since",
+		"only export changes from this RFC 3339 time onwards",
+		func(value string) (err error) {
+			since, err = time.Parse(time.RFC3339, value)
+			return err
+		},
+	)
+
+	if err := parseFlags(flagSet, flags, args[1:]); err != nil {
+		return err
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	records, err := readAuditLog(auditLogPath(*flags))
+	if err != nil {
+		return err
+	}
+	records = slices.DeleteFunc(records, func(record auditRecord) bool {
+		return record.At.Before(since) || 0 < flagSet.NArg() && !slices.Contains(flagSet.Args(), record.Device)
+	})
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+
+	out := csv.NewWriter(os.Stdout)
+	out.Write([]string{"at", "device", "previous_mac", "mac", "vendor", "trigger", "result", "error"})
+	for _, record := range records {
+		out.Write([]string{
+			record.At.Format(time.RFC3339Nano),
+			record.Device,
+			string(record.PreviousMac),
+			string(record.Mac),
+			string(record.Vendor),
+			record.Trigger,
+			record.Result,
+			record.Error,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func readAuditLog(path string) ([]auditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []auditRecord{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultAuditKeyFile = "audit.key"
+
+	// auditTagField is added to the end of each chained record's line.
+	auditTagField = `,"tag":"`
+
+	// auditTailSize is how much of the end of the log is read for the tag
+	// of its last record, which is far longer than any record.
+	auditTailSize = 64 << 10
+)
+
+// auditKeyPath is the -audit-key-file, by default in the state directory.
+func auditKeyPath(flags flags) string {
+	if flags.auditKeyFile != "" {
+		return flags.auditKeyFile
+	}
+	return filepath.Join(flags.stateDir, defaultAuditKeyFile)
+}
+
+// loadAuditKey reads the key that -audit-chain tags records with, creating it
+// on first use if asked to. Whoever has it can forge the chain, so it is kept
+// to root, and is best copied somewhere safe for verifying with.
+func loadAuditKey(path string, create bool) ([]byte, error) {
+	creation := keyMustExist
+	if create {
+		creation = keyForRoot
+	}
+	return loadKey(path, "the key for chaining the audit log", creation)
+}
+
+// auditTag chains a record to the one before it: an HMAC of the previous
+// record's tag and the record's own line without a tag, so that editing,
+// removing, or reordering any record breaks every tag after it.
+func auditTag(key []byte, previousTag string, untagged []byte) string {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, previousTag+"\n")
+	mac.Write(untagged)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// splitAuditTag gives a line without its tag, as it was tagged, and the tag,
+// which is empty for records written without -audit-chain.
+func splitAuditTag(line []byte) ([]byte, string) {
+	i := bytes.LastIndex(line, []byte(auditTagField))
+	if i < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return line, ""
+	}
+	tag := string(line[i+len(auditTagField) : len(line)-2])
+	return append(line[:i:i], '}'), tag
+}
+
+// lastAuditTag reads the tag of the log's last record, which the next record
+// is chained to. Reading it from the file each time, rather than keeping it,
+// under the lock that append holds, keeps the chain whole when the once and
+// restore commands write to the log alongside the daemon.
+func lastAuditTag(file *os.File) (string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := max(0, info.Size()-auditTailSize)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	tail = bytes.TrimRight(tail, "\n")
+	last := tail[bytes.LastIndexByte(tail, '\n')+1:]
+	_, tag := splitAuditTag(last)
+	return tag, nil
+}
+
+// chain tags the record's line, in the open log it will be appended to.
+func (a *auditLog) chain(file *os.File, line []byte) ([]byte, error) {
+	key, err := loadAuditKey(a.keyFile, true)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := lastAuditTag(file)
+	if err != nil {
+		return nil, err
+	}
+	tag := auditTag(key, previous, line)
+	return append(line[:len(line)-1:len(line)-1], []byte(auditTagField+tag+`"}`)...), nil
+}
+
+// runAuditVerify checks every tag of the chain in the audit log, from the
+// first record written with -audit-chain, naming the first line that does not
+// follow from the ones before it.
+func runAuditVerify(args []string) error {
+	flagSet := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	key, err := loadAuditKey(auditKeyPath(*flags), false)
+	if err != nil {
+		return err
+	}
+	path := auditLogPath(*flags)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	unchained, chained := 0, 0
+	previous := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, auditTailSize)
+	for line := 1; scanner.Scan(); line++ {
+		untagged, tag := splitAuditTag(scanner.Bytes())
+		if !json.Valid(untagged) {
+			return fmt.Errorf("%s:%d: not a record of the audit log", path, line)
+		}
+		switch {
+		case tag == "" && chained == 0:
+			unchained++
+		case tag == "":
+			return fmt.Errorf("%s:%d: the record is not chained, though those before it are", path, line)
+		case !hmac.Equal([]byte(tag), []byte(auditTag(key, previous, untagged))):
+			return fmt.Errorf("%s:%d: the record's tag does not follow from those before it, so it or an earlier one was changed", path, line)
+		default:
+			chained++
+			previous = tag
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if chained == 0 {
+		return fmt.Errorf("%s has no chained records; write it with -audit-chain", path)
+	}
+
+	if unchained != 0 {
+		fmt.Printf("%d records from before -audit-chain cannot be verified\n", unchained)
+	}
+	fmt.Printf("%d chained records verified\n", chained)
+	// Records removed from the end leave the chain whole, so only a copy
+	// of the last tag kept elsewhere can show that.
+	fmt.Println("last tag:", previous)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentAuditAppendsKeepTheChain(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv(envName("config"), os.DevNull)
+
+	flags := flags{stateDir: stateDir, auditChain: true}
+	const writers, records = 8, 100
+
+	// Each writer stands for a process of its own, such as the daemon and a
+	// restore run alongside it, sharing nothing but the files.
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*records)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			audit := newAuditLog(flags)
+			for j := range records {
+				errs <- audit.append(auditRecord{
+					At:      time.Now(),
+					Device:  fmt.Sprintf("rma-test%d", i),
+					Mac:     "02:00:00:00:00:01",
+					Trigger: fmt.Sprintf("test %d", j),
+					Result:  auditSucceeded,
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written, err := readAuditLog(auditLogPath(flags))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != writers*records {
+		t.Errorf("got %d records, want %d", len(written), writers*records)
+	}
+	if err := runAuditVerify([]string{"-state-dir", stateDir}); err != nil {
+		t.Errorf("the chain did not verify: %v", err)
+	}
+}
+
+func TestAuditAppendWaitsForTheLock(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv(envName("config"), os.DevNull)
+
+	flags := flags{stateDir: stateDir, auditChain: true}
+	audit := newAuditLog(flags)
+	record := auditRecord{At: time.Now(), Device: "rma-test0", Mac: "02:00:00:00:00:01", Result: auditSucceeded}
+	if err := audit.append(record); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the lock as another process appending would, between reading
+	// the last tag and writing the record chained to it.
+	file, err := os.OpenFile(auditLogPath(flags), os.O_RDWR|os.O_APPEND, auditLogPerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lockExclusive(file); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- newAuditLog(flags).append(record)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("appended while the log was locked: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	line, err := audit.chain(file, []byte(`{"device":"rma-test1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := runAuditVerify([]string{"-state-dir", stateDir}); err != nil {
+		t.Errorf("the chain did not verify: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	daemonizedEnv    = "ROTATE_MAC_ADDRESS_DAEMONIZED"
+	defaultDaemonLog = "daemon.log"
+	pidFilePerm      = 0o644
+)
+
+func isDaemonized() bool {
+	return os.Getenv(daemonizedEnv) != ""
+}
+
+// writePidFile refuses to clobber the PID file of another copy that is still
+// running.
+func writePidFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && pid != os.Getpid() && processExists(pid) {
+			return fmt.Errorf("another copy is already running with PID %d, per %s", pid, path)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), stateDirPerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), pidFilePerm)
+}
+
+func processExists(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// daemonize starts a detached copy of the process in a new session with its
+// output redirected to the log file, for systems with no service manager to do
+// that for it. Go cannot fork, so the copy is a fresh execution told by the
+// environment that it is already the background one.
+func daemonize(flags flags) error {
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+
+	if err := os.MkdirAll(flags.stateDir, stateDirPerm); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(flags.daemonLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, stateFilePerm)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonizedEnv+"=1")
+	cmd.Stdin = devNull
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.Dir = "/"
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	fmt.Printf("started in the background with PID %d, logging to %s\n", cmd.Process.Pid, flags.daemonLog)
+	return cmd.Process.Release()
+}
@@ -0,0 +1,7 @@
+package main
+
+import "errors"
+
+func daemonize(flags) error {
+	return errors.New("-daemon is not supported on Windows")
+}
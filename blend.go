@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// blendMinNeighbors is how many neighbours must be seen to blend in with
+// them, as copying the prefix of one or two would stand out more, and say
+// more about whom the device is near, than the usual vendors.
+const blendMinNeighbors = 3
+
+// blendVendors weights the vendors towards the prefixes of the neighbours'
+// addresses, so that generated addresses resemble the segment's own. Each
+// prefix counts once for each neighbour with it, and each of the usual
+// vendors once, so that they stay in the running. The addresses that phones
+// randomise, and group addresses, say nothing of any vendor, so are left out.
+func blendVendors(vendors []rotator.VendorPrefix, neighbors []net.HardwareAddr) []rotator.VendorPrefix {
+	var observed []rotator.VendorPrefix
+	for _, addr := range neighbors {
+		if addr[0]&0x03 != 0 {
+			continue
+		}
+		prefix := rotator.MAC(addr[:3].String())
+		vendor := rotator.VendorOf(rotator.MAC(addr.String()))
+		if vendor == "" {
+			vendor = rotator.Vendor(prefix)
+		}
+		observed = append(observed, rotator.VendorPrefix{Vendor: vendor, Prefix: prefix})
+	}
+	if len(observed) < blendMinNeighbors {
+		return vendors
+	}
+	return append(observed, vendors...)
+}
+
+// blendIn gives the vendors to generate an address of with -blend-in, from the
+// neighbours seen on the device's segment since the last change.
+func (r *rotation) blendIn(settings settings) []rotator.VendorPrefix {
+	if !settings.blendIn {
+		return settings.vendors
+	}
+
+	neighbors, err := neighborMacs(r.deviceName)
+	if err != nil {
+		r.logger.Warn("could not list the neighbours to blend in with", "err", err)
+		return settings.vendors
+	}
+	vendors := blendVendors(settings.vendors, neighbors)
+	if len(vendors) == len(settings.vendors) {
+		r.logger.Debug("too few neighbours to blend in with", "neighbours", len(neighbors))
+		return vendors
+	}
+	r.logger.Debug("blending in with the neighbours", "neighbours", len(vendors)-len(settings.vendors))
+	return vendors
+}
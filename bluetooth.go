@@ -0,0 +1,26 @@
+package main
+
+import "gitlab.com/louis.jackman/rotate-mac-address/rotator"
+
+// rotateBluetoothAddress gives the Bluetooth controller a fresh public
+// address alongside each new network address, as it otherwise tracks a
+// laptop every bit as well. Most controllers only take a new address while
+// powered off, so it is briefly powered off around the change.
+func (r *rotation) rotateBluetoothAddress(settings settings) {
+	if settings.btDevice == "" {
+		return
+	}
+
+	logger := r.logger.With("bt_device", settings.btDevice)
+	vendor, mac := rotator.RandomMAC(r.rng, settings.vendors)
+	if settings.dryRun {
+		logger.Info("would change the Bluetooth address", "new_mac", mac, "vendor", vendor)
+		return
+	}
+
+	if err := setBluetoothAddress(settings.btDevice, mac); err != nil {
+		logger.Warn("could not change the Bluetooth address", "new_mac", mac, "err", err)
+		return
+	}
+	logger.Info("changed the Bluetooth address", "new_mac", mac, "vendor", vendor)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+func runBtmgmt(btDevice string, args ...string) error {
+	args = append([]string{"--index", btDevice}, args...)
+	out, err := exec.Command("btmgmt", args...).CombinedOutput()
+	trimmed := strings.TrimSpace(string(out))
+	if err != nil {
+		return fmt.Errorf("btmgmt %s: %w: %s", strings.Join(args, " "), err, trimmed)
+	}
+
+	// btmgmt exits successfully even when the kernel refuses a command,
+	// reporting it only in its output.
+	if strings.Contains(trimmed, "failed") {
+		return fmt.Errorf("btmgmt %s: %s", strings.Join(args, " "), trimmed)
+	}
+	return nil
+}
+
+// setBluetoothAddress goes through BlueZ's management interface, which can
+// only set public addresses on controllers whose drivers support doing so,
+// such as most Intel, Qualcomm, and Broadcom ones.
+func setBluetoothAddress(btDevice string, mac rotator.MAC) error {
+	if err := runBtmgmt(btDevice, "power", "off"); err != nil {
+		return err
+	}
+	setErr := runBtmgmt(btDevice, "public-addr", string(mac))
+
+	// Power the controller back on even when the address was refused, so a
+	// failure leaves Bluetooth as it was rather than off.
+	return errors.Join(setErr, runBtmgmt(btDevice, "power", "on"))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+func setBluetoothAddress(string, rotator.MAC) error {
+	return errors.New("Bluetooth addresses can only be changed on Linux")
+}
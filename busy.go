@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+const busySampleInterval = 2 * time.Second
+
+// traffic holds a device's cumulative counters.
+type traffic struct {
+	rxBytes   uint64
+	txBytes   uint64
+	rxPackets uint64
+	txPackets uint64
+}
+
+func (t traffic) bytes() uint64 {
+	return t.rxBytes + t.txBytes
+}
+
+func (t traffic) packets() uint64 {
+	return t.rxPackets + t.txPackets
+}
+
+// vpnPrefixes name the tunnel devices of WireGuard, OpenVPN, macOS's utun, PPP,
+// and IPsec.
+var vpnPrefixes = []string{"wg", "tun", "tap", "utun", "ppp", "ipsec"}
+
+// activeVpn finds a tunnel that is up, which is presumably running over the
+// device being rotated and would be torn down by the change.
+func activeVpn() (string, bool) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", false
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		for _, prefix := range vpnPrefixes {
+			if strings.HasPrefix(iface.Name, prefix) {
+				// macOS always has a few utun devices for its own services,
+				// so only count those carrying addresses.
+				if prefix == "utun" {
+					if addrs, err := iface.Addrs(); err != nil || len(addrs) == 0 {
+						continue
+					}
+				}
+				return iface.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// sampleThroughput measures bytes per second over a short interval.
+func sampleThroughput(ctx context.Context, deviceName string) (uint64, error) {
+	before, err := readTraffic(deviceName)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(busySampleInterval):
+	}
+
+	after, err := readTraffic(deviceName)
+	if err != nil {
+		return 0, err
+	}
+
+	// The counters start again if the device is recreated in between.
+	if after.bytes() < before.bytes() {
+		return 0, nil
+	}
+	return (after.bytes() - before.bytes()) / uint64(busySampleInterval/time.Second), nil
+}
+
+// busyReason explains why the device should not be rotated yet, or is empty
+// if it is idle enough, given how long the rotation has been deferred for.
+func (r *rotation) busyReason(ctx context.Context, settings settings, deferred time.Duration) (string, error) {
+	if settings.deferOnVpn {
+		if vpn, ok := activeVpn(); ok {
+			return "the VPN " + vpn + " is up", nil
+		}
+	}
+
+	if settings.busyBytesPerSec != 0 {
+		throughput, err := sampleThroughput(ctx, r.deviceName)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err == nil && settings.busyBytesPerSec <= throughput {
+			return "it is busy", nil
+		}
+	}
+
+	// A session in use for hours on end must not hold the address forever.
+	if settings.deferActiveSecs != 0 && deferred < settings.deferActiveMax {
+		inUse, err := sessionInUse(time.Duration(settings.deferActiveSecs) * time.Second)
+		if err != nil {
+			r.logger.Warn("could not tell whether the session is in use", "err", err)
+		} else if inUse {
+			return "the session is in use", nil
+		}
+	}
+	return "", nil
+}
+
+// deferWhileBusy postpones a due rotation by the grace period for as long as
+// the device is busy, a VPN is up, or someone is at the desktop, so a long
+// download, tunnel, or call is not killed by the change.
+func (r *rotation) deferWhileBusy(ctx context.Context, settings settings) error {
+	started := time.Now()
+	for {
+		reason, err := r.busyReason(ctx, settings, time.Since(started))
+		if err != nil || reason == "" {
+			return err
+		}
+
+		grace := time.Duration(settings.deferGraceSecs) * time.Second
+		r.logger.Info(
+			"deferring the rotation",
+			"defer_secs", int(grace/time.Second),
+			"reason", reason,
+		)
+
+		r.recordNextRotation(time.Now().Add(grace))
+		if err := r.waitUntil(ctx, time.Now().Add(grace), nil); err != nil {
+			return err
+		}
+		settings = r.currentSettings()
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	captivePageMaxSize  = 1 << 20
+	captiveFormTimeout  = 20 * time.Second
+	captiveProbeRetries = 3
+)
+
+var (
+	captiveFormPattern  = regexp.MustCompile(`(?is)<form\b([^>]*)>(.*?)</form>`)
+	captiveInputPattern = regexp.MustCompile(`(?is)<(input|button)\b([^>]*)>`)
+	captiveAttrPattern  = regexp.MustCompile(`(?s)([\w-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// probeCaptivePortal is behindCaptivePortal, also giving the portal's address:
+// where it redirected to, or the probe's own address for portals serving
+// their page in its place.
+func probeCaptivePortal(ctx context.Context, probeURL string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, captiveProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return "", false, nil
+	}
+	portal := probeURL
+	if location, err := resp.Location(); err == nil {
+		portal = location.String()
+	}
+	return portal, true, nil
+}
+
+// reauthCaptivePortal checks whether a change has left the device behind a
+// captive portal, as networks gating access by address do to addresses they
+// have not seen, and signs in again with the -captive-hook, or by submitting
+// the portal's form with -captive-accept, rather than leaving it offline
+// until someone notices.
+func (r *rotation) reauthCaptivePortal(ctx context.Context, settings settings, change *successfulMacChange) {
+	if settings.captiveHook == "" && !settings.captiveAccept {
+		return
+	}
+	if settings.dryRun {
+		r.logger.Info("would check for a captive portal and sign in again")
+		return
+	}
+
+	// Give DHCP a moment on the new address before probing.
+	var portal string
+	var captive bool
+	var err error
+	for attempt := 1; attempt <= captiveProbeRetries; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(captiveProbeSettleTime):
+		}
+		if portal, captive, err = probeCaptivePortal(ctx, settings.captiveProbeURL); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		r.logger.Warn("could not check for a captive portal", "err", err)
+		return
+	}
+	if !captive {
+		return
+	}
+
+	logger := r.logger.With("portal", portal)
+	logger.Info("the new address is behind a captive portal, so signing in again")
+	if settings.captiveHook != "" {
+		env := []string{
+			"HOOK=captive",
+			"DEVICE=" + r.deviceName,
+			"NEW_MAC=" + string(change.mac),
+			"PORTAL_URL=" + portal,
+		}
+		err = r.runHook(ctx, settings, "captive", settings.captiveHook, env)
+	} else {
+		err = acceptCaptivePortal(ctx, portal)
+	}
+	if err != nil {
+		logger.Warn("could not sign in to the captive portal", "err", err)
+		return
+	}
+
+	if _, captive, err := probeCaptivePortal(ctx, settings.captiveProbeURL); err != nil || captive {
+		logger.Warn("still behind the captive portal after signing in", "err", err)
+		return
+	}
+	logger.Info("signed in to the captive portal")
+}
+
+// acceptCaptivePortal submits the first form of the portal's page with the
+// values it already has, ticking its checkboxes, which is all that the
+// accept-the-terms pages of hotels and airports need.
+func acceptCaptivePortal(ctx context.Context, portal string) error {
+	ctx, cancel := context.WithTimeout(ctx, captiveFormTimeout)
+	defer cancel()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	page, pageURL, err := fetchCaptivePage(ctx, client, portal)
+	if err != nil {
+		return err
+	}
+
+	form := captiveFormPattern.FindStringSubmatch(page)
+	if form == nil {
+		return errors.New("the portal's page has no form to submit")
+	}
+	attrs := captiveAttrs(form[1])
+	action, err := pageURL.Parse(attrs["action"])
+	if err != nil {
+		return fmt.Errorf("the portal's form has an unusable action: %w", err)
+	}
+
+	values := url.Values{}
+	submitted := false
+	for _, input := range captiveInputPattern.FindAllStringSubmatch(form[2], -1) {
+		attrs := captiveAttrs(input[2])
+		name := attrs["name"]
+		if name == "" {
+			continue
+		}
+		switch kind := strings.ToLower(attrs["type"]); {
+		case kind == "checkbox":
+			value, ok := attrs["value"]
+			if !ok {
+				value = "on"
+			}
+			values.Add(name, value)
+		case kind == "submit" || kind == "image" || strings.EqualFold(input[1], "button"):
+			// Only the first button is pressed.
+			if !submitted {
+				values.Add(name, attrs["value"])
+				submitted = true
+			}
+		case kind == "radio" || kind == "reset" || kind == "file":
+		default:
+			values.Add(name, attrs["value"])
+		}
+	}
+
+	var req *http.Request
+	if strings.EqualFold(attrs["method"], http.MethodPost) {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, action.String(), strings.NewReader(values.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		action.RawQuery = values.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, action.String(), nil)
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if 400 <= resp.StatusCode {
+		return fmt.Errorf("the portal answered the form with %s", resp.Status)
+	}
+	return nil
+}
+
+func fetchCaptivePage(ctx context.Context, client *http.Client, portal string) (string, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, portal, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, captivePageMaxSize))
+	if err != nil {
+		return "", nil, err
+	}
+	// Relative actions are relative to wherever the redirects ended.
+	return string(page), resp.Request.URL, nil
+}
+
+// captiveAttrs reads the attributes of a tag, by lower-cased name.
+func captiveAttrs(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range captiveAttrPattern.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+	}
+	return attrs
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	defaultCarrierTimeoutSecs = 30
+	carrierAwaitInterval      = 250 * time.Millisecond
+)
+
+// hasCarrier is whether the device's link is operational, with a cable
+// negotiated or an access point associated with.
+func hasCarrier(deviceName string) bool {
+	iface, err := net.InterfaceByName(deviceName)
+	return err == nil && iface.Flags&net.FlagRunning != 0
+}
+
+// awaitCarrier waits for the link to come back after a change, as wired
+// drivers renegotiate and Wi-Fi reassociates, before anything relies on it:
+// renewing the lease, checking connectivity, or counting down to the next
+// rotation. Links that were down before the change are not waited for.
+// Taking longer than -carrier-timeout-secs is the change's failure.
+func (r *rotation) awaitCarrier(ctx context.Context, settings settings, hadCarrier bool) error {
+	if !hadCarrier || settings.carrierTimeoutSecs == 0 || settings.dryRun {
+		return nil
+	}
+
+	timeout := time.Duration(settings.carrierTimeoutSecs) * time.Second
+	ticker := time.NewTicker(carrierAwaitInterval)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	started := time.Now()
+	for !hasCarrier(r.deviceName) {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline:
+			return fmt.Errorf("the link did not come back within %s of the change", timeout)
+		case <-ticker.C:
+		}
+	}
+	r.logger.Debug("the link is up after the change", "wait", time.Since(started).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// command is a subcommand, named by the first argument. Without one, the
+// arguments are the flags of "run", as they were before there were any
+// subcommands.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"run", "[flags]", "rotate the devices until stopped, which running without a command also does", runRun},
+	{"once", "[flags]", "rotate each device once, then exit", runOnce},
+	{"nm-dispatcher", "[flags] [device action]", "rotate a device as NetworkManager's dispatcher brings up a connection on it, from a pre-up.d script", runNMDispatcher},
+	{"panic", "[flags]", "get a new network identity right now: rotate every device, randomise the hostname, renew leases, and flush neighbour caches", runPanic},
+	{"list-interfaces", "[flags] [-o json] [device...]", "describe each device and whether its address can be changed", runListInterfaces},
+	{"plan", "[flags] [-count n] [-seed n] [-simulate span]", "preview upcoming rotations, or play out a span of them in seconds, without changing anything", runPlan},
+	{"generate", "[-count n] [-vendors list]", "print random addresses without changing anything", runGenerate},
+	{"version", "[-o json]", "print the version, commit, build date, and Go version", runVersion},
+	{"lookup", "[flags] mac...", "name the vendor of each address, from those built in and the registry cached by oui update", runLookup},
+	{"oui", "update [flags]", "download the IEEE's registry of vendors' prefixes into the state directory, for lookup to name", runOUI},
+	{"restore", "[flags] [-to permanent|time] [device...]", "put back the addresses saved in the state directory, or those the devices had at a time", runRestore},
+	{"compare", "[flags] [-o json] [device...]", "show whether each device's address differs from its permanent one, and since when, failing if any does not", runCompare},
+	{"status", "[flags] [-o json] [device...]", "show how each device is getting on", runStatus},
+	{"history", "[query] [-n count] [-at time] [-o json] [device...]", "show the running daemon's recent changes, or each device's address at a time, or with query search every change in the -audit-log", runHistory},
+	{"statusbar", "[-format waybar|i3status-rs|polybar|text] [device...]", "print each device's address and countdown for a status bar's custom module", runStatusBar},
+	{"tray", "[flags]", "show the running daemon in the system tray or menu bar, with a menu to rotate, pause, resume, or restore", runTray},
+	{"tui", "[flags]", "watch how each device is getting on live", runTUI},
+	{"monitor", "[flags] [-interval-secs n] [-allow-changes] [-exit-on-alert]", "change nothing, but alert through the log and -webhooks when a device's address changes or goes back to the permanent one", runMonitor},
+	{"healthcheck", "[flags]", "succeed only if each device's last change succeeded and its next is not overdue", runHealthcheck},
+	{"ctl", "rotate|pause|resume|status|history|watch|restore [device...]", "control the running daemon through its -control-socket, or with watch follow its events", runCtl},
+	{"helper", "[-socket path] [-group name] [-allow-devices list]", "as root, set addresses for a daemon running unprivileged with -helper-socket, and do nothing else", runHelper},
+	{"doctor", "[flags] [-fix]", "check that the environment can rotate the devices, and with -fix stop network managers undoing rotations", runDoctor},
+	{"self-test", "[-v]", "on Linux as root, rotate and restore a throwaway veth pair in a network namespace of its own, to check the binary against the kernel", runSelfTest},
+	{"audit", "export|verify|entropy [flags]", "export the -audit-log of every change as CSV or JSON, verify its -audit-chain, or report how identifiable the generated addresses are", runAudit},
+	{"config", "validate|show [flags]", "check the -config file, or print the settings in effect", runConfig},
+	{"install-systemd", "[flags] [-timer]", "install and start a systemd service with the flags, or with -timer a timer rotating once per cycle", runInstallSystemd},
+	{"install-launchd", "[flags]", "install and start a launchd service with the flags", runInstallLaunchd},
+	{"uninstall-launchd", "", "undo install-launchd", runUninstallLaunchd},
+	{"install-openrc", "[flags]", "install and start an OpenRC service with the flags", runInstallOpenrc},
+	{"install-polkit", "[-group name]", "install the polkit action that -control-polkit asks about, letting a group control the daemon", runInstallPolkit},
+	{"install-procd", "[flags]", "install and start an OpenWrt procd service with the flags", runInstallProcd},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, command := range commands {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return command{}, false
+}
+
+func printCommands() {
+	fmt.Println("Commands:")
+	for _, command := range commands {
+		if command.summary == "" {
+			continue
+		}
+		fmt.Printf("  %s\n", strings.TrimSpace(command.name+" "+command.args))
+		fmt.Printf("    \t%s\n", command.summary)
+	}
+}
+
+// commandLineFlags are the daemon's flags as given on the command line, for
+// parsing again on reloads.
+func commandLineFlags() []string {
+	args := os.Args[1:]
+	if 0 < len(args) && args[0] == "run" {
+		args = args[1:]
+	}
+	return args
+}
+
+// runRun exits itself once logging is set up, so that the errors from then on
+// are logged the way the flags ask.
+func runRun(args []string) error {
+	flags, err := loadFlags(flag.CommandLine, args)
+	if err != nil {
+		return err
+	}
+	// Whatever is left is a mistyped command or a stray word, which must not
+	// go on to rotate the default devices.
+	if flag.CommandLine.NArg() != 0 {
+		return &rotator.ExitError{
+			Code: rotator.ExitUsage,
+			Err:  fmt.Errorf("unknown command %q; pass -h for the commands", flag.CommandLine.Arg(0)),
+		}
+	}
+	if err := pickDevicesIfUnset(flag.CommandLine, &flags); err != nil {
+		return err
+	}
+	if err := setUpLogging(setUpStatusLine(flags), flags); err != nil {
+		return err
+	}
+	setUpOutput(flags.output)
+
+	if err := checkPrivileges(flags); err != nil {
+		fatal(err)
+	}
+	if err := checkTools(flags); err != nil {
+		fatal(err)
+	}
+
+	if flags.daemon && !isDaemonized() {
+		if err := daemonize(flags); err != nil {
+			fatal(err)
+		}
+		return nil
+	}
+
+	warnOfManagers(flags.deviceNames, flags.backend)
+	if err := runDaemon(flags); err != nil {
+		fatal(err)
+	}
+	return nil
+}
+
+func runOnce(args []string) error {
+	flagSet := flag.NewFlagSet("once", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	if err := pickDevicesIfUnset(flagSet, flags); err != nil {
+		return err
+	}
+	if err := setUpLogging(os.Stderr, *flags); err != nil {
+		return err
+	}
+	setUpOutput(flags.output)
+
+	if err := checkPrivileges(*flags); err != nil {
+		return err
+	}
+	if err := checkTools(*flags); err != nil {
+		return err
+	}
+	warnOfManagers(flags.deviceNames, flags.backend)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	audit := newAuditLog(*flags)
+	var errs []error
+	for _, deviceName := range flags.deviceNames {
+		r := newRotation(deviceName, *flags, chooseSetMacCmd(*flags))
+		r.audit = audit
+		if err := rotateOnceLocked(ctx, r, *flags); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", deviceName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rotateOnceLocked holds the device's lock, unless only pretending, so that
+// a one-off rotation cannot fight a running daemon.
+func rotateOnceLocked(ctx context.Context, r *rotation, flags flags) error {
+	if !flags.dryRun {
+		lock, err := lockDevice(flags.stateDir, r.deviceName)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+	}
+	return rotateOnce(ctx, r)
+}
+
+func runGenerate(args []string) error {
+	flagSet := flag.NewFlagSet("generate", flag.ExitOnError)
+
+	count := uint(1)
+	vendors := rotator.Vendors
+	var seed int64
+
+	flagSet.UintVar(
+		&count,
+		"count",
+		count,
+		"the number of addresses to generate",
+	)
+	flagSet.Func(
+		"vendors",
+		"a comma-separated list of vendors to generate addresses for (default every vendor)",
+		func(value string) (err error) {
+			vendors, err = rotator.ParseVendors(value)
+			return err
+		},
+	)
+	flagSet.Int64Var(
+		&seed,
+		"seed",
+		0,
+		"the random seed to generate with; 0 picks a fresh one",
+	)
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	for range count {
+		vendor, mac := rotator.RandomMAC(rng, vendors)
+		fmt.Printf("%s\t%s\n", mac, vendor)
+	}
+	return nil
+}
+
+func runLookup(args []string) error {
+	flagSet := flag.NewFlagSet("lookup", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	macs := flagSet.Args()
+	if len(macs) == 0 {
+		return &rotator.ExitError{Code: rotator.ExitUsage, Err: errors.New("usage: lookup [flags] mac...")}
+	}
+
+	// The registry is wherever oui update put it, in the -state-dir.
+	registry := loadOUIRegistry(flags.stateDir)
+	var errs []error
+	for _, arg := range macs {
+		hardwareAddr, err := net.ParseMAC(arg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		mac := rotator.MAC(hardwareAddr.String())
+		vendor := string(registry.vendorOf(mac))
+		if vendor == "" {
+			vendor = "unknown"
+		}
+		fmt.Printf("%s\t%s\n", mac, vendor)
+	}
+	return errors.Join(errs...)
+}
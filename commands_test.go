@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+func TestRunRejectsUnknownCommands(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv(envName("config"), os.DevNull)
+
+	err := runRun([]string{"-state-dir", stateDir, "-device-name", "rma-test0", "bogus"})
+
+	var exitErr *rotator.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != rotator.ExitUsage {
+		t.Fatalf("got %v, want a usage error", err)
+	}
+	if want := `unknown command "bogus"; pass -h for the commands`; exitErr.Err.Error() != want {
+		t.Errorf("got %q, want %q", exitErr.Err, want)
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("the state directory has %d entries, but nothing should have been written", len(entries))
+	}
+}
+
+func TestLookupUsesTheStateDir(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv(envName("config"), os.DevNull)
+
+	var registry strings.Builder
+	registry.WriteString("Registry,Assignment,Organization Name,Organization Address\n")
+	for i := range ouiRegistryMinSize {
+		fmt.Fprintf(&registry, "MA-L,A0%04X,Vendor %d,Somewhere\n", i, i)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, ouiRegistryCache), []byte(registry.String()), stateFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	read, write, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = write
+	err = runLookup([]string{"-state-dir", stateDir, "a0:00:2a:12:34:56"})
+	os.Stdout = stdout
+	write.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := io.ReadAll(read)
+	if want := "a0:00:2a:12:34:56\tVendor 42\n"; string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// comparison is whether a device is wearing an address other than its own.
+type comparison struct {
+	Device          string         `json:"device"`
+	Mac             rotator.MAC    `json:"mac"`
+	Vendor          rotator.Vendor `json:"vendor,omitempty"`
+	PermanentMac    rotator.MAC    `json:"permanent_mac,omitempty"`
+	PermanentVendor rotator.Vendor `json:"permanent_vendor,omitempty"`
+	Spoofed         bool           `json:"spoofed"`
+
+	// AppliedAt is when the audit log last has the address being set, if
+	// it has it at all.
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+func compareDevice(flags flags, registry ouiRegistry, deviceName string) (comparison, error) {
+	mac, err := rotator.CurrentMAC(deviceName)
+	if err != nil {
+		return comparison{}, err
+	}
+	permanent, err := permanentMac(deviceName)
+	if err != nil {
+		state, _ := loadDeviceState(flags.stateDir, deviceName)
+		permanent = state.PermanentMac
+	}
+	if permanent == "" {
+		return comparison{}, errors.New("the permanent MAC address is unknown, as neither the hardware nor the state directory say")
+	}
+
+	c := comparison{
+		Device:          deviceName,
+		Mac:             mac,
+		Vendor:          registry.vendorOf(mac),
+		PermanentMac:    permanent,
+		PermanentVendor: registry.vendorOf(permanent),
+		Spoofed:         mac != permanent,
+	}
+	records, _ := queryAuditLog(auditLogPath(flags), historyQuery{devices: []string{deviceName}})
+	for _, record := range records {
+		if record.Mac == mac && record.Result == auditSucceeded {
+			c.AppliedAt = &record.At
+		}
+	}
+	return c, nil
+}
+
+// runCompare shows whether each device is on an address other than its
+// permanent one, failing if any is not, for scripts to check with.
+func runCompare(args []string) error {
+	flagSet := flag.NewFlagSet("compare", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var output string
+	flagSet.StringVar(
+		&output,
+		"o",
+		"text",
+		"the output format: text or json",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	deviceNames := flagSet.Args()
+	if len(deviceNames) == 0 {
+		deviceNames = flags.deviceNames
+	}
+
+	registry := loadOUIRegistry(flags.stateDir)
+	comparisons := []comparison{}
+	var errs []error
+	for _, deviceName := range deviceNames {
+		c, err := compareDevice(*flags, registry, deviceName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", deviceName, err))
+			continue
+		}
+		comparisons = append(comparisons, c)
+		if !c.Spoofed {
+			errs = append(errs, fmt.Errorf("%s is on its permanent MAC address", deviceName))
+		}
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(comparisons); err != nil {
+			return err
+		}
+		return errors.Join(errs...)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "DEVICE\tMAC\tVENDOR\tPERMANENT MAC\tVENDOR\tSPOOFED\tAPPLIED")
+	for _, c := range comparisons {
+		applied := "-"
+		if c.AppliedAt != nil {
+			applied = c.AppliedAt.Local().Format(time.DateTime)
+		}
+		spoofed := "no"
+		if c.Spoofed {
+			spoofed = "yes"
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Device,
+			c.Mac,
+			orDash(string(c.Vendor)),
+			c.PermanentMac,
+			orDash(string(c.PermanentVendor)),
+			spoofed,
+			applied,
+		)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+const bashCompletion = `# bash completion for %[1]s; load it with:
+#   source <(%[1]s completion bash)
+_rotate_mac_address() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	local prev=${COMP_WORDS[COMP_CWORD-1]}
+
+	case $prev in
+	-device-name|--device-name)
+		COMPREPLY=($(compgen -W "$(%[1]s __devices 2>/dev/null)" -- "$cur"))
+		return
+		;;
+	esac
+
+	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+		COMPREPLY=($(compgen -W "%[2]s" -- "$cur"))
+	else
+		COMPREPLY=($(compgen -W "%[3]s" -- "$cur"))
+	fi
+}
+complete -F _rotate_mac_address %[1]s
+`
+
+const zshCompletion = `#compdef %[1]s
+# zsh completion for %[1]s; load it with:
+#   source <(%[1]s completion zsh)
+_rotate_mac_address() {
+	case $words[CURRENT-1] in
+	-device-name|--device-name)
+		compadd -- ${(f)"$(%[1]s __devices 2>/dev/null)"}
+		return
+		;;
+	esac
+
+	if (( CURRENT == 2 )) && [[ $words[CURRENT] != -* ]]; then
+		compadd -- %[2]s
+	else
+		compadd -- %[3]s
+	fi
+}
+compdef _rotate_mac_address %[1]s
+`
+
+// The completion command is added on starting up, as it lists the commands
+// itself.
+func init() {
+	commands = append(
+		commands,
+		command{"completion", "bash|zsh|fish", "print a script completing the commands, flags, and devices", runCompletion},
+		command{"__devices", "", "", runDevices},
+	)
+}
+
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: completion bash|zsh|fish")
+	}
+
+	var commandNames []string
+	for _, command := range commands {
+		if command.summary != "" {
+			commandNames = append(commandNames, command.name)
+		}
+	}
+
+	flagSet := flag.NewFlagSet("completion", flag.ContinueOnError)
+	defineFlags(flagSet)
+	var flagNames []string
+	flagSet.VisitAll(func(f *flag.Flag) {
+		flagNames = append(flagNames, "-"+f.Name)
+	})
+
+	switch args[0] {
+	case "bash":
+		fmt.Printf(bashCompletion, programName, strings.Join(commandNames, " "), strings.Join(flagNames, " "))
+	case "zsh":
+		fmt.Printf(zshCompletion, programName, strings.Join(commandNames, " "), strings.Join(flagNames, " "))
+	case "fish":
+		writeFishCompletion(os.Stdout, flagSet)
+	default:
+		return fmt.Errorf("unknown shell %q", args[0])
+	}
+	return nil
+}
+
+// writeFishCompletion describes each command and flag, which fish shows
+// alongside the candidates.
+func writeFishCompletion(out io.Writer, flagSet *flag.FlagSet) {
+	fmt.Fprintf(out, "# fish completion for %[1]s; load it with:\n#   %[1]s completion fish | source\n", programName)
+	fmt.Fprintf(out, "complete -c %s -f\n", programName)
+
+	for _, command := range commands {
+		if command.summary == "" {
+			continue
+		}
+		fmt.Fprintf(
+			out,
+			"complete -c %s -n __fish_use_subcommand -a %s -d %s\n",
+			programName,
+			command.name,
+			fishQuote(command.summary),
+		)
+	}
+
+	flagSet.VisitAll(func(f *flag.Flag) {
+		option := "complete -c " + programName + " -o " + f.Name
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			option += " -r"
+		}
+		if f.Name == "device-name" {
+			option += " -a '(" + programName + " __devices 2>/dev/null)'"
+		}
+		fmt.Fprintln(out, option+" -d "+fishQuote(f.Usage))
+	})
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// runDevices lists the names of the machine's devices, one per line, for
+// completing -device-name with.
+func runDevices([]string) error {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 {
+			fmt.Println(iface.Name)
+		}
+	}
+	return nil
+}
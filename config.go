@@ -0,0 +1,518 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// config is a TOML file setting the same things as the flags, each key named
+// after its flag, with underscores allowed in place of hyphens:
+//
+//	device-name = ["wlan0", "eth0"]
+//	cycle_secs = 1800
+//	dry-run = true
+//
+// Only the subset of TOML that the flags need is supported: strings,
+// numbers, booleans, and arrays of them on a single line.
+type config struct {
+	path   string
+	values []configValue
+}
+
+// configValue is a key's value in the form its flag takes, with arrays joined
+// by commas, and the table and line it comes from for reporting errors.
+type configValue struct {
+	table []string
+	key   string
+	value string
+	line  int
+}
+
+// configStdin is the -config that reads the file from stdin, so that one
+// holding secrets such as the -api-token can be piped from a secrets manager
+// rather than kept on disk.
+const configStdin = "-"
+
+// readStdinConfig reads stdin once, for every reload to parse again, as
+// there is nothing more to read from it after the first time.
+var readStdinConfig = sync.OnceValues(func() ([]byte, error) {
+	return io.ReadAll(os.Stdin)
+})
+
+func readConfig(path string) (config, error) {
+	if path == configStdin {
+		text, err := readStdinConfig()
+		if err != nil {
+			return config{}, fmt.Errorf("could not read the config from stdin: %w", err)
+		}
+		return parseConfig("stdin", string(text))
+	}
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return config{}, err
+	}
+	return parseConfig(path, string(text))
+}
+
+func parseConfig(path, text string) (config, error) {
+	c := config{path: path}
+	var table []string
+
+	for i, line := range strings.Split(text, "\n") {
+		lineNo := i + 1
+		fail := func(err error) (config, error) {
+			return config{}, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+
+		line, err := stripConfigComment(line)
+		if err != nil {
+			return fail(err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return fail(errors.New("only [table] headers are supported"))
+			}
+			if table, err = parseConfigTable(strings.TrimSpace(line[1 : len(line)-1])); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+
+		rawKey, rawValue, ok := strings.Cut(line, "=")
+		if !ok {
+			return fail(errors.New("expected key = value"))
+		}
+		key := strings.TrimSpace(rawKey)
+		if !isBareConfigKey(key) {
+			return fail(fmt.Errorf("%q is not a valid key", key))
+		}
+		value, err := parseConfigValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", key, err))
+		}
+
+		c.values = append(c.values, configValue{table, key, value, lineNo})
+	}
+	return c, nil
+}
+
+// stripConfigComment cuts a line off at the # starting a comment, if any,
+// leaving any inside strings alone.
+func stripConfigComment(line string) (string, error) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i], nil
+		}
+	}
+	if quote != 0 {
+		return "", errors.New("unterminated string")
+	}
+	return line, nil
+}
+
+func isBareConfigKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseConfigTable splits a table's name into its dotted parts, which may be
+// quoted to hold dots of their own, as SSIDs can.
+func parseConfigTable(name string) ([]string, error) {
+	var parts []string
+	for {
+		name = strings.TrimSpace(name)
+
+		var part string
+		if name != "" && (name[0] == '"' || name[0] == '\'') {
+			end := strings.IndexByte(name[1:], name[0]) + 1
+			if end == 0 {
+				return nil, errors.New("unterminated table name")
+			}
+			var err error
+			if part, err = parseConfigString(name[:end+1]); err != nil {
+				return nil, err
+			}
+			name = strings.TrimSpace(name[end+1:])
+		} else {
+			end := strings.IndexByte(name, '.')
+			if end == -1 {
+				end = len(name)
+			}
+			if part = strings.TrimSpace(name[:end]); !isBareConfigKey(part) {
+				return nil, fmt.Errorf("%q is not a valid table name", part)
+			}
+			name = name[end:]
+		}
+		parts = append(parts, part)
+
+		if name == "" {
+			return parts, nil
+		}
+		rest, ok := strings.CutPrefix(name, ".")
+		if !ok {
+			return nil, errors.New("expected a dot between the parts of a table name")
+		}
+		name = rest
+	}
+}
+
+func formatConfigTable(parts []string) string {
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		if isBareConfigKey(part) {
+			quoted[i] = part
+		} else {
+			quoted[i] = strconv.Quote(part)
+		}
+	}
+	return strings.Join(quoted, ".")
+}
+
+func parseConfigString(raw string) (string, error) {
+	switch {
+	case len(raw) < 2 || raw[0] != raw[len(raw)-1]:
+		return "", fmt.Errorf("malformed string %s", raw)
+	case raw[0] == '\'':
+		return raw[1 : len(raw)-1], nil
+	default:
+		return strconv.Unquote(raw)
+	}
+}
+
+func parseConfigValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", errors.New("missing value")
+	case raw[0] == '"' || raw[0] == '\'':
+		return parseConfigString(raw)
+	case raw[0] == '[':
+		return parseConfigArray(raw)
+	case raw == "true" || raw == "false":
+		return raw, nil
+	}
+
+	number := strings.ReplaceAll(raw, "_", "")
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", fmt.Errorf("%s is not a string, number, boolean, or array; quote strings", raw)
+	}
+	return number, nil
+}
+
+func parseConfigArray(raw string) (string, error) {
+	if !strings.HasSuffix(raw, "]") {
+		return "", errors.New("arrays must close on the line they open")
+	}
+
+	var items []string
+	var quote byte
+	start := 1
+	inner := raw[:len(raw)-1]
+	for i := 1; i <= len(inner); i++ {
+		if i < len(inner) {
+			switch c := inner[i]; {
+			case quote == '"' && c == '\\':
+				i++
+				continue
+			case quote != 0 && c == quote:
+				quote = 0
+				continue
+			case quote != 0:
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c == '[':
+				return "", errors.New("arrays cannot be nested")
+			case c != ',':
+				continue
+			}
+		}
+
+		item := strings.TrimSpace(inner[start:i])
+		start = i + 1
+		if item == "" {
+			// Allow a trailing comma, as TOML does.
+			if i == len(inner) {
+				continue
+			}
+			return "", errors.New("empty array item")
+		}
+		value, err := parseConfigValue(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// apply sets each flag that the config has a value for, and the network
+// profiles from its [network."SSID"] tables. Flags already set are
+// overwritten, so the command line should be parsed again afterwards to take
+// precedence. Profiles are merged by what they match instead, so that a
+// -config-url applied over the local config only replaces the profiles it
+// defines itself. It reports every bad value rather than only the first.
+func (c config) apply(flagSet *flag.FlagSet, flags *flags) error {
+	var errs []error
+	var profiles []networkProfile
+	profileValues := make(map[string][]configValue)
+
+	for _, v := range c.values {
+		if len(v.table) == 2 && v.table[0] == "network" {
+			match := v.table[1]
+			if _, ok := profileValues[match]; !ok {
+				profiles = append(profiles, networkProfile{match: match})
+			}
+			profileValues[match] = append(profileValues[match], v)
+			continue
+		}
+		if len(v.table) != 0 {
+			errs = append(errs, fmt.Errorf("%s:%d: unknown table [%s]", c.path, v.line, formatConfigTable(v.table)))
+			continue
+		}
+
+		name := strings.ReplaceAll(v.key, "_", "-")
+		switch {
+		case name == "config" || name == "config-url":
+			errs = append(errs, fmt.Errorf("%s:%d: a config file cannot name another", c.path, v.line))
+		case name == "config-url-key":
+			errs = append(errs, fmt.Errorf("%s:%d: the key verifying the -config-url cannot come from a config file", c.path, v.line))
+		case flagSet.Lookup(name) == nil:
+			errs = append(errs, fmt.Errorf("%s:%d: unknown setting %q", c.path, v.line, v.key))
+		default:
+			if err := flagSet.Set(name, v.value); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %s: %w", c.path, v.line, v.key, err))
+			}
+		}
+	}
+
+	for i, profile := range profiles {
+		var err error
+		if profiles[i], err = parseNetworkProfile(c.path, profile.match, profileValues[profile.match]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	flags.networkProfiles = mergeNetworkProfiles(flags.networkProfiles, profiles)
+	return errors.Join(errs...)
+}
+
+// mergeNetworkProfiles replaces each earlier profile with the later one for
+// the same match, where there is one, keeping its place, and adds the rest.
+func mergeNetworkProfiles(earlier, later []networkProfile) []networkProfile {
+	merged := slices.Clone(earlier)
+	for _, profile := range later {
+		i := slices.IndexFunc(merged, func(p networkProfile) bool { return p.match == profile.match })
+		if i == -1 {
+			merged = append(merged, profile)
+		} else {
+			merged[i] = profile
+		}
+	}
+	return merged
+}
+
+// lookup finds where the config sets a top-level key, if it does.
+func (c config) lookup(name string) (configValue, bool) {
+	for _, v := range c.values {
+		if len(v.table) == 0 && strings.ReplaceAll(v.key, "_", "-") == name {
+			return v, true
+		}
+	}
+	return configValue{}, false
+}
+
+func runConfig(args []string) error {
+	const usage = "usage: config validate|show [flags]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	default:
+		return errors.New(usage)
+	}
+}
+
+// runConfigValidate checks the config file, along with the rest of the
+// flags, without rotating anything, for checking configs in CI.
+func runConfigValidate(args []string) error {
+	flagSet := flag.NewFlagSet("config validate", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var checkDevices bool
+	flagSet.BoolVar(
+		&checkDevices,
+		"check-devices",
+		false,
+		"also check that each device exists on this machine",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	if flags.config == "" {
+		return errors.New("there is no config file to validate; name one with -config")
+	}
+	c, err := readConfig(flags.config)
+	if err != nil {
+		return err
+	}
+
+	// Blame the config file for the devices only if nothing overrode them.
+	where := "-device-name"
+	if v, ok := c.lookup("device-name"); ok {
+		if fromConfig, err := parseDeviceNames(v.value); err == nil && slices.Equal(fromConfig, flags.deviceNames) {
+			where = fmt.Sprintf("%s:%d: %s", c.path, v.line, v.key)
+		}
+	}
+	var errs []error
+	for _, deviceName := range flags.deviceNames {
+		if err := checkDeviceName(deviceName); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+		} else if checkDevices {
+			if _, err := net.InterfaceByName(deviceName); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", where, deviceName, err))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	fmt.Println(flags.config, "is valid")
+	return nil
+}
+
+// checkDeviceName catches device names that no platform would accept, such
+// as those too long for Linux or with path separators in them.
+func checkDeviceName(deviceName string) error {
+	const maxLinuxDeviceNameLen = 15
+
+	if (runtime.GOOS == "linux" || runtime.GOOS == "android") && maxLinuxDeviceNameLen < len(deviceName) {
+		return fmt.Errorf("%q is longer than the %d characters that Linux allows", deviceName, maxLinuxDeviceNameLen)
+	}
+	if strings.ContainsAny(deviceName, "/\\") || strings.IndexFunc(deviceName, unicode.IsControl) != -1 {
+		return fmt.Errorf("%q is not a valid device name", deviceName)
+	}
+	return nil
+}
+
+// runConfigShow prints the settings in effect after layering the config
+// file, flags file, environment, and command line, as a config file of their
+// own. Settings whose defaults cannot be shown are left out.
+func runConfigShow(args []string) error {
+	flagSet := flag.NewFlagSet("config show", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	// Many flags parse their values into forms that cannot be printed, so
+	// keep the last value that each was set to as given.
+	given := make(map[string]string)
+	flagSet.VisitAll(func(f *flag.Flag) {
+		f.Value = givenValue{f.Value, f.Name, given}
+	})
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	flagSet.VisitAll(func(f *flag.Flag) {
+		value, ok := given[f.Name]
+		if !ok {
+			value = f.DefValue
+		}
+		if f.Name == "config" || (!ok && value == "") {
+			return
+		}
+		if slices.Contains(secretSettings, f.Name) && value != "" {
+			value = "<redacted>"
+		}
+		fmt.Println(f.Name, "=", formatConfigValue(value))
+	})
+
+	if flags.config == "" {
+		return nil
+	}
+	c, err := readConfig(flags.config)
+	if err != nil {
+		return err
+	}
+	var table []string
+	for _, v := range c.values {
+		if len(v.table) == 0 {
+			continue
+		}
+		if !slices.Equal(table, v.table) {
+			table = v.table
+			fmt.Printf("\n[%s]\n", formatConfigTable(table))
+		}
+		fmt.Println(v.key, "=", formatConfigValue(v.value))
+	}
+	return nil
+}
+
+type givenValue struct {
+	flag.Value
+	name  string
+	given map[string]string
+}
+
+func (v givenValue) Set(value string) error {
+	if err := v.Value.Set(value); err != nil {
+		return err
+	}
+	v.given[v.name] = value
+	return nil
+}
+
+func (v givenValue) IsBoolFlag() bool {
+	b, ok := v.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// formatConfigValue writes a value back out as TOML, leaving booleans and
+// numbers bare and quoting everything else. Lists stay as comma-separated
+// strings, which read back the same.
+func formatConfigValue(value string) string {
+	if value == "true" || value == "false" {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return strconv.Quote(value)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestLaterConfigsMergeNetworkProfiles(t *testing.T) {
+	local, err := parseConfig("local.toml", `
+[network.home]
+trust = "trusted"
+
+[network.cafe]
+cycle-secs = 600
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := parseConfig("remote.toml", `
+cycle-secs = 1800
+
+[network.cafe]
+cycle-secs = 300
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bare, err := parseConfig("bare.toml", "cycle-secs = 900\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := defineFlags(flagSet)
+	for _, c := range []config{local, remote, bare} {
+		if err := c.apply(flagSet, flags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(flags.networkProfiles) != 2 {
+		t.Fatalf("got %d profiles, want the local two", len(flags.networkProfiles))
+	}
+	home, cafe := flags.networkProfiles[0], flags.networkProfiles[1]
+	if home.match != "home" || home.trust != trustTrusted {
+		t.Errorf("the local profile for home was lost: %+v", home)
+	}
+	if cafe.match != "cafe" || cafe.cycleSecs == nil || *cafe.cycleSecs != 300 {
+		t.Errorf("the remote profile for cafe did not replace the local one: %+v", cafe)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"slices"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	defaultConnectivityTimeoutSecs = 30
+	connectivityGateway            = "gateway"
+	connectivityProbeInterval      = 2 * time.Second
+	connectivityProbeTimeout       = 2 * time.Second
+	maxBadMacs                     = 32
+)
+
+// connectivityTarget gives what -connectivity-check probes for the device,
+// resolving the gateway before the change as renewing the lease can drop the
+// route for a while, or nothing if there is no checking or the target does
+// not answer even now, as it is then no sign of a change gone wrong.
+func (r *rotation) connectivityTarget(ctx context.Context, settings settings) string {
+	if settings.connectivityCheck == "" || settings.dryRun {
+		return ""
+	}
+
+	target := settings.connectivityCheck
+	if target == connectivityGateway {
+		gateway, err := defaultGateway(r.deviceName)
+		if err != nil {
+			r.logger.Warn("not checking connectivity after the change, as the default gateway is unknown", "err", err)
+			return ""
+		}
+		target = gateway
+	}
+	if err := probeConnectivity(ctx, target); err != nil {
+		r.logger.Warn("not checking connectivity after the change, as the target does not answer beforehand", "target", target, "err", err)
+		return ""
+	}
+	return target
+}
+
+// probeConnectivity connects over TCP to targets with ports, and pings the
+// rest.
+func probeConnectivity(ctx context.Context, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, connectivityProbeTimeout)
+	defer cancel()
+
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	var args []string
+	switch runtime.GOOS {
+	case "windows":
+		args = []string{"-n", "1", "-w", "1000", target}
+	case "linux", "android":
+		args = []string{"-c", "1", "-W", "1", target}
+	default:
+		args = []string{"-c", "1", "-t", "1", target}
+	}
+	if err := exec.CommandContext(ctx, "ping", args...).Run(); err != nil {
+		return fmt.Errorf("%s did not answer a ping: %w", target, err)
+	}
+	return nil
+}
+
+// checkConnectivity waits for the target to answer after a change, and rolls
+// the device back to its previous address if it does not in time, marking the
+// new one as bad so that it is not tried again. The error, if any, is the
+// change's failure, so that it is retried later as any other.
+func (r *rotation) checkConnectivity(ctx context.Context, settings settings, target string, state *deviceState, change *successfulMacChange) error {
+	if target == "" {
+		return nil
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, time.Duration(settings.connectivityTimeoutSecs)*time.Second)
+	defer cancel()
+
+	ticker := time.NewTicker(connectivityProbeInterval)
+	defer ticker.Stop()
+
+	var err error
+	for {
+		if err = probeConnectivity(checkCtx, target); err == nil {
+			r.logger.Debug("the device still has connectivity after the change", "target", target)
+			return nil
+		}
+		select {
+		case <-checkCtx.Done():
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+
+	// Stopping midway is no sign that the address is to blame.
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	lost := fmt.Errorf("lost connectivity to %s after changing to %s: %w", target, change.mac, err)
+	state.BadMacs = append(state.BadMacs, change.mac)
+	if len(state.BadMacs) > maxBadMacs {
+		state.BadMacs = slices.Clone(state.BadMacs[len(state.BadMacs)-maxBadMacs:])
+	}
+	r.saveState(*state)
+
+	if change.previous == "" {
+		return fmt.Errorf("%w, and cannot roll back, as the previous address is unknown", lost)
+	}
+	r.logger.Warn("lost connectivity after the change, so rolling back", "target", target, "mac", change.mac, "previous_mac", change.previous)
+
+	if err := r.setter(settings).Apply(ctx, r.logger, r.deviceName, change.previous); err != nil {
+		return fmt.Errorf("%w, and could not roll back to %s: %w", lost, change.previous, err)
+	}
+
+	r.mu.Lock()
+	r.status.mac = change.previous
+	r.status.vendor = rotator.VendorOf(change.previous)
+	r.mu.Unlock()
+
+	r.renewDhcpLease(settings)
+	r.flushNeighbors(settings)
+	r.announceAddress(settings)
+	return fmt.Errorf("%w, so rolled back to %s", lost, change.previous)
+}
+
+// isBadMac reports whether an address lost a device its connectivity before.
+func (state deviceState) isBadMac(mac rotator.MAC) bool {
+	return slices.Contains(state.BadMacs, mac)
+}
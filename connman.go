@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// connmanRun is only there while ConnMan is running.
+const connmanRun = "/run/connman"
+
+// connmanWaitSecs is how long ConnMan is given to reconnect the service
+// after the address changes.
+const connmanWaitSecs = 10
+
+// connmanRunning reports whether ConnMan manages the network, and can be
+// asked to through connmanctl.
+func connmanRunning() bool {
+	if _, err := os.Stat(connmanRun); err != nil {
+		return false
+	}
+	_, err := exec.LookPath("connmanctl")
+	return err == nil
+}
+
+// setMacConnMan disconnects the device's connected service through ConnMan
+// before changing the address, and connects it again afterwards, rather than
+// changing it under ConnMan, which may reset it as it reconnects. ConnMan
+// names services after the address of their device, so the service to connect
+// again is looked for under the new address first.
+func setMacConnMan(deviceName string, mac rotator.MAC) (string, []string) {
+	prog, args := rotator.DefaultSetCommand()(deviceName, mac)
+	set := shellQuote(prog)
+	for _, arg := range args {
+		set += " " + shellQuote(arg)
+	}
+	newIdent := strings.ToLower(strings.ReplaceAll(string(mac), ":", ""))
+
+	script := []string{
+		"set -e",
+		"old=$(tr -d : < /sys/class/net/" + shellQuote(deviceName) + "/address)",
+		// The first three columns flag favourites, autoconnection, and
+		// whether the service is ready or online.
+		`service=$(connmanctl services | awk -v ident="_${old}_" 'index($NF, ident) && substr($0, 3, 1) ~ /[RO]/ { print $NF; exit }')`,
+		`[ -z "$service" ] || connmanctl disconnect "$service" >/dev/null`,
+		set,
+		`[ -n "$service" ] || exit 0`,
+		`renamed=$(printf '%s' "$service" | sed "s/_${old}_/_` + newIdent + `_/")`,
+		fmt.Sprintf(
+			`for i in $(seq %d); do connmanctl connect "$renamed" >/dev/null 2>&1 && exit 0; connmanctl connect "$service" >/dev/null 2>&1 && exit 0; sleep 1; done`,
+			connmanWaitSecs,
+		),
+		`echo "ConnMan did not connect $service again" >&2`,
+		"exit 1",
+	}
+	return "sh", []string{"-c", strings.Join(script, "\n")}
+}
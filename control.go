@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	controlSocketPerm = 0o600
+	controlTimeout    = 30 * time.Second
+)
+
+// The control protocol is a line of words per connection, such as "rotate
+// eth0", answered by lines of output and then a final "ok" or "error: ...".
+// Requests with output take a -json option, putting a JSON object on each
+// line instead.
+const (
+	controlOk          = "ok"
+	controlErrorPrefix = "error: "
+	controlJSON        = "-json"
+)
+
+// listenControl replaces any socket left behind by a copy that died, but not
+// one that is still being listened on.
+func listenControl(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another copy is already listening on %s", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, controlSocketPerm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func serveControl(ctx context.Context, d *daemon, listener net.Listener) {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("stopped accepting control connections", "err", err)
+				}
+				return
+			}
+			go d.serveControlConn(ctx, conn)
+		}
+	}()
+}
+
+func (d *daemon) serveControlConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return
+	}
+
+	words := strings.Fields(line)
+	withOriginal := true
+	if d.currentFlags().controlPolkit && 0 < len(words) {
+		if needsControlAuthorization(words[0]) {
+			if err := authorizeControl(ctx, conn); err != nil {
+				slog.Warn("refused a control request", "request", strings.Join(words, " "), "err", err)
+				fmt.Fprintln(conn, controlErrorPrefix+err.Error())
+				return
+			}
+		} else {
+			withOriginal = controlPeerPrivileged(conn)
+		}
+	}
+	if 0 < len(words) && words[0] == "watch" {
+		d.watchControl(ctx, conn, words[1:])
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+	defer cancel()
+
+	var out []string
+	if !withOriginal && words[0] == "status" {
+		out, err = d.controlStatus(words[1:], false)
+	} else {
+		out, err = d.control(ctx, words)
+	}
+	for _, line := range out {
+		fmt.Fprintln(conn, line)
+	}
+	if err != nil {
+		fmt.Fprintln(conn, controlErrorPrefix+err.Error())
+	} else {
+		fmt.Fprintln(conn, controlOk)
+	}
+}
+
+// controlStatus answers a status request, leaving out the addresses that the
+// devices had before rotating unless withOriginal.
+func (d *daemon) controlStatus(args []string, withOriginal bool) ([]string, error) {
+	asJSON, args := controlJSONOption(args)
+	rotations, err := d.selectRotations(args)
+	var out []string
+	for _, r := range rotations {
+		status := r.currentStatus()
+		if !withOriginal {
+			status.originalMac = ""
+		}
+		out = append(out, formatControlLine(status, asJSON))
+	}
+	return out, err
+}
+
+// control runs a control request, returning its output. Cancelling the
+// context cancels any command it runs.
+func (d *daemon) control(ctx context.Context, words []string) ([]string, error) {
+	if len(words) == 0 {
+		return nil, errors.New("empty request")
+	}
+	verb, args := words[0], words[1:]
+
+	switch verb {
+	case "rotate":
+		rotations, err := d.selectRotations(args)
+		for _, r := range rotations {
+			r.requestRotation("of a control request")
+		}
+		return nil, err
+
+	case "pause":
+		rotations, err := d.selectRotations(args)
+		for _, r := range rotations {
+			r.pause()
+		}
+		return nil, err
+
+	case "resume":
+		rotations, err := d.selectRotations(args)
+		for _, r := range rotations {
+			r.resume()
+		}
+		return nil, err
+
+	case "status":
+		return d.controlStatus(args, true)
+
+	case "history":
+		asJSON, args := controlJSONOption(args)
+		if _, err := d.selectRotations(args); err != nil {
+			return nil, err
+		}
+		var out []string
+		for _, entry := range d.history.since(time.Time{}) {
+			if len(args) == 0 || slices.Contains(args, entry.Device) {
+				out = append(out, formatControlLine(entry, asJSON))
+			}
+		}
+		return out, nil
+
+	case "restore":
+		target := restoreTarget(restoreOriginal)
+		if len(args) != 0 {
+			if parsed, err := parseRestoreTarget(args[0]); err == nil && parsed != restoreNothing {
+				target = parsed
+				args = args[1:]
+			}
+		}
+
+		// Pause first, or the next rotation would undo the restoration.
+		rotations, err := d.selectRotations(args)
+		var errs []error
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, r := range rotations {
+			r.pause()
+			if err := r.restore(ctx, target, "of a control request"); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", r.deviceName, err))
+			}
+		}
+		return nil, errors.Join(errs...)
+
+	default:
+		return nil, fmt.Errorf("unknown request %q", verb)
+	}
+}
+
+// watchControl streams each event concerning the devices, or every event if
+// none are named, as a JSON object per line, until the watcher hangs up or
+// the daemon stops, which it answers ok to.
+func (d *daemon) watchControl(ctx context.Context, conn net.Conn, deviceNames []string) {
+	if _, err := d.selectRotations(deviceNames); err != nil {
+		fmt.Fprintln(conn, controlErrorPrefix+err.Error())
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	subscribed, unsubscribe := events.subscribe()
+	defer unsubscribe()
+
+	// Only reading shows the watcher hanging up.
+	hungUp := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(hungUp)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(conn, controlOk)
+			return
+		case <-hungUp:
+			return
+		case event := <-subscribed:
+			if !event.concerns(deviceNames) {
+				continue
+			}
+			line, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := conn.Write(append(line, '\n')); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func controlJSONOption(args []string) (bool, []string) {
+	if 0 < len(args) && args[0] == controlJSON {
+		return true, args[1:]
+	}
+	return false, args
+}
+
+func formatControlLine(value fmt.Stringer, asJSON bool) string {
+	if !asJSON {
+		return value.String()
+	}
+	// Neither statuses nor history entries can fail to encode.
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// selectRotations picks the named devices, or all of them if none are named,
+// along with an error for any that aren't being rotated.
+func (d *daemon) selectRotations(deviceNames []string) ([]*rotation, error) {
+	if len(deviceNames) == 0 {
+		statuses := d.statuses()
+		deviceNames = make([]string, len(statuses))
+		for i, status := range statuses {
+			deviceNames[i] = status.deviceName
+		}
+	}
+
+	var rotations []*rotation
+	var errs []error
+	for _, deviceName := range deviceNames {
+		if r, ok := d.rotation(deviceName); ok {
+			rotations = append(rotations, r)
+		} else {
+			errs = append(errs, fmt.Errorf("%s is not being rotated", deviceName))
+		}
+	}
+	return rotations, errors.Join(errs...)
+}
+
+// runCtl sends a request to the running daemon and prints its answer.
+func runCtl(args []string) error {
+	flagSet := flag.NewFlagSet("ctl", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(flagSet.Output(), "Usage: ctl [-socket path] rotate|pause|resume|status [-json]|history [-json]|watch|restore [original|permanent] [device...]")
+		flagSet.PrintDefaults()
+	}
+
+	var socket string
+	flagSet.StringVar(
+		&socket,
+		"socket",
+		defaultControlSocket,
+		"the daemon's control socket",
+	)
+	flagSet.Parse(args)
+
+	words := flagSet.Args()
+	if len(words) == 0 {
+		flagSet.Usage()
+		return errors.New("no request given")
+	}
+
+	// Watching prints each event as it comes, for as long as it takes.
+	if words[0] == "watch" {
+		return streamControl(socket, words, 0, func(line string) {
+			fmt.Println(line)
+		})
+	}
+
+	out, err := requestControl(socket, words)
+	for _, line := range out {
+		fmt.Println(line)
+	}
+	return err
+}
+
+// requestControl sends a request to the daemon listening on the socket,
+// returning its output.
+func requestControl(socket string, words []string) ([]string, error) {
+	var out []string
+	err := streamControl(socket, words, controlTimeout, func(line string) {
+		out = append(out, line)
+	})
+	return out, err
+}
+
+// streamControl sends a request to the daemon listening on the socket,
+// passing on each line of output as it comes, until the answer or the
+// timeout, if there is one.
+func streamControl(socket string, words []string, timeout time.Duration, onLine func(string)) error {
+	conn, err := net.DialTimeout("unix", socket, controlTimeout)
+	if err != nil {
+		return fmt.Errorf("could not reach the daemon: %w", err)
+	}
+	defer conn.Close()
+	if timeout != 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if _, err := fmt.Fprintln(conn, strings.Join(words, " ")); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == controlOk:
+			return nil
+		case strings.HasPrefix(line, controlErrorPrefix):
+			return errors.New(strings.TrimPrefix(line, controlErrorPrefix))
+		default:
+			onLine(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("the daemon hung up without answering")
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// daemon runs a rotation loop for each device, and retunes them while they run
+// when the flags are reloaded.
+type daemon struct {
+	newSetMacCmd rotator.SetCommand
+
+	mu              sync.Mutex
+	flags           flags
+	rotations       map[string]*runningRotation
+	startedTriggers map[string]bool
+
+	reloads   chan flags
+	failures  chan error
+	wg        sync.WaitGroup
+	readyOnce sync.Once
+	history   history
+	audit     *auditLog
+	scheduler *scheduler
+	otlp      *otlpExporter
+
+	// originalHostname and originalMdnsName are those to restore on exit
+	// after -hostname-pattern and -mdns-pattern change them.
+	originalHostname string
+	originalMdnsName string
+}
+
+type runningRotation struct {
+	rotation        *rotation
+	ctx             context.Context
+	cancel          context.CancelFunc
+	startedTriggers map[string]bool
+}
+
+func newDaemon(initial flags, newSetMacCmd rotator.SetCommand) *daemon {
+	originalHostname, _ := os.Hostname()
+	originalMdnsName, _ := currentMdnsName()
+
+	d := &daemon{
+		newSetMacCmd:    newSetMacCmd,
+		flags:           initial,
+		rotations:       make(map[string]*runningRotation),
+		startedTriggers: make(map[string]bool),
+		reloads:         make(chan flags),
+		failures:        make(chan error),
+		audit:           newAuditLog(initial),
+		scheduler:       newScheduler(rotator.SystemClock, initial.maxParallelChanges),
+
+		originalHostname: originalHostname,
+		originalMdnsName: originalMdnsName,
+	}
+	if !initial.dryRun {
+		d.history.load(auditLogPath(initial))
+	}
+	return d
+}
+
+// run rotates every device until the context is cancelled or any one of them
+// fails too often, in which case the rest are stopped too.
+func (d *daemon) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		d.wg.Wait()
+
+		if flags := d.currentFlags(); flags.restoreOnExit != restoreNothing {
+			restoreHostname(flags, d.originalHostname)
+			restoreMdnsName(flags, d.originalMdnsName)
+		}
+	}()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.scheduler.run(ctx)
+	}()
+
+	d.mu.Lock()
+	for _, deviceName := range d.flags.deviceNames {
+		if err := d.start(ctx, deviceName); err != nil {
+			d.mu.Unlock()
+			return err
+		}
+	}
+	d.startTriggers(ctx)
+	d.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-d.failures:
+			return err
+		case flags := <-d.reloads:
+			d.apply(ctx, flags)
+		}
+	}
+}
+
+// start must be called with the lock held. It fails if another process is
+// already rotating the device.
+func (d *daemon) start(ctx context.Context, deviceName string) error {
+	// Dry runs change nothing, so they can't fight anything.
+	var lock *deviceLock
+	if !d.flags.dryRun {
+		var err error
+		if lock, err = lockDevice(d.flags.stateDir, deviceName); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := newRotation(deviceName, d.flags, d.newSetMacCmd)
+	r.onStatusChange = d.notifyStatus
+	r.history = &d.history
+	r.audit = d.audit
+	r.scheduler = d.scheduler
+	r.otlp = d.otlp
+	d.rotations[deviceName] = &runningRotation{
+		rotation:        r,
+		ctx:             ctx,
+		cancel:          cancel,
+		startedTriggers: make(map[string]bool),
+	}
+
+	flags := d.flags
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		if lock != nil {
+			defer lock.unlock()
+		}
+
+		// Check for trust up front; otherwise the trust trigger would only
+		// catch up after the first rotation.
+		if flags.hasTrustedNetworks() || len(flags.networkProfiles) != 0 {
+			if current, err := currentNetwork(deviceName); err == nil {
+				r.setNetwork(current)
+				if flags.trusts(current) {
+					r.trust(current)
+					r.logger.Info("suspending rotation while on a trusted network", "network", current)
+				}
+			}
+		}
+
+		r.randomiseProbes(flags)
+
+		err := rotateMacAddrs(ctx, r)
+
+		var tooMany *rotator.TooManyFailuresError
+		if errors.As(err, &tooMany) && d.currentFlags().onGiveUp == giveUpDown {
+			r.logger.Error("gave up rotating the device", "err", err)
+			r.holdDown(ctx)
+			return
+		}
+
+		if target := d.currentFlags().restoreOnExit; target != restoreNothing {
+			if err := r.restore(context.WithoutCancel(ctx), target, "it is stopping"); err != nil {
+				r.logger.Error("could not restore the MAC address", "target", target, "err", err)
+			}
+		}
+
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+
+		select {
+		case d.failures <- fmt.Errorf("%s: %w", deviceName, err):
+		case <-ctx.Done():
+		}
+	}()
+	return nil
+}
+
+func (d *daemon) apply(ctx context.Context, flags flags) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if flags.stateDir != d.flags.stateDir {
+		slog.Warn("the state directory cannot change without a restart; keeping the old one")
+		flags.stateDir = d.flags.stateDir
+	}
+	d.flags = flags
+	logLevel.Set(flags.effectiveLogLevel())
+
+	for deviceName, running := range d.rotations {
+		if slices.Contains(flags.deviceNames, deviceName) {
+			running.rotation.updateSettings(flags.settings())
+		} else {
+			slog.Info("no longer rotating", "device", deviceName)
+			running.cancel()
+			delete(d.rotations, deviceName)
+		}
+	}
+
+	for _, deviceName := range flags.deviceNames {
+		if _, ok := d.rotations[deviceName]; !ok {
+			if err := d.start(ctx, deviceName); err != nil {
+				slog.Error("not rotating", "device", deviceName, "err", err)
+			} else {
+				slog.Info("now rotating", "device", deviceName)
+			}
+		}
+	}
+
+	d.startTriggers(ctx)
+}
+
+func (d *daemon) currentFlags() flags {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.flags
+}
+
+func (d *daemon) rotation(deviceName string) (*rotation, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	running, ok := d.rotations[deviceName]
+	if !ok {
+		return nil, false
+	}
+	return running.rotation, true
+}
+
+// reload hands freshly loaded flags to the running daemon.
+func (d *daemon) reload(ctx context.Context, flags flags) {
+	select {
+	case d.reloads <- flags:
+	case <-ctx.Done():
+	}
+}
+
+func (d *daemon) rotateAll(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, running := range d.rotations {
+		running.rotation.requestRotation(reason)
+	}
+}
+
+// rotate does nothing if the device is not being rotated.
+func (d *daemon) rotate(deviceName string, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if running, ok := d.rotations[deviceName]; ok {
+		running.rotation.requestRotation(reason)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	defaultDailyKeyFile = "daily.key"
+	dailyKeyLabel       = "the key for daily addresses"
+)
+
+// dailyKeyPath is the -daily-key-file, by default in the state directory.
+func dailyKeyPath(stateDir string, settings settings) string {
+	if settings.dailyKeyFile != "" {
+		return settings.dailyKeyFile
+	}
+	return filepath.Join(stateDir, defaultDailyKeyFile)
+}
+
+// dailyGenerator derives today's address for the device, on the network it
+// is on if -daily-per-network.
+func (r *rotation) dailyGenerator(settings settings) (rotator.DailyGenerator, error) {
+	// Whoever has the key can work out every day's address.
+	key, err := loadKey(dailyKeyPath(r.stateDir, settings), dailyKeyLabel, keyForRootUnless(settings.dryRun))
+	if err != nil {
+		return rotator.DailyGenerator{}, err
+	}
+
+	generator := rotator.DailyGenerator{Key: key, Vendors: settings.vendors}
+	if settings.dailyPerNetwork {
+		generator.Network = r.currentStatus().network.ssid
+	}
+	return generator, nil
+}
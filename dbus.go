@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The daemon's D-Bus service on the system bus, for desktop applets and
+// dispatcher scripts. Owning the name needs the policy in
+// dbus/org.rotatemac.Rotator.conf installed into /etc/dbus-1/system.d/.
+const (
+	dbusName      = "org.rotatemac.Rotator"
+	dbusPath      = "/org/rotatemac/Rotator"
+	dbusInterface = "org.rotatemac.Rotator"
+	dbusErrorName = "org.rotatemac.Rotator.Error"
+
+	defaultSystemBusAddress = "unix:path=/var/run/dbus/system_bus_socket"
+
+	dbusStatusSignature = "a(sssxxb)"
+)
+
+const dbusIntrospection = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>
+  <interface name="org.rotatemac.Rotator">
+    <!-- Each method takes device names, acting on every device if none are given. -->
+    <method name="Rotate"><arg name="devices" type="as" direction="in"/></method>
+    <method name="Pause"><arg name="devices" type="as" direction="in"/></method>
+    <method name="Resume"><arg name="devices" type="as" direction="in"/></method>
+    <!-- Device, MAC, vendor, last change and next rotation in Unix seconds or 0, and whether paused. -->
+    <property name="Status" type="a(sssxxb)" access="read"/>
+    <signal name="MacChanged">
+      <arg name="device" type="s"/>
+      <arg name="mac" type="s"/>
+      <arg name="vendor" type="s"/>
+    </signal>
+  </interface>
+  <interface name="org.freedesktop.DBus.Properties">
+    <method name="Get">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="property" type="s" direction="in"/>
+      <arg name="value" type="v" direction="out"/>
+    </method>
+    <method name="GetAll">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="properties" type="a{sv}" direction="out"/>
+    </method>
+  </interface>
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect"><arg name="xml" type="s" direction="out"/></method>
+  </interface>
+  <interface name="org.freedesktop.DBus.Peer">
+    <method name="Ping"/>
+  </interface>
+</node>
+`
+
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignal       = 4
+
+	dbusNoReplyExpected = 0x1
+
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSender      = 7
+	dbusFieldSignature   = 8
+
+	dbusNameFlagDoNotQueue = 0x4
+	dbusNamePrimaryOwner   = 1
+
+	dbusMaxMessageSize = 1 << 27
+)
+
+// dbusEncoder marshals values, aligning them relative to the start of its
+// buffer, which must itself be 8-aligned within the message.
+type dbusEncoder struct {
+	buf []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *dbusEncoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *dbusEncoder) int64(v int64) {
+	e.align(8)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *dbusEncoder) bool(v bool) {
+	if v {
+		e.uint32(1)
+	} else {
+		e.uint32(0)
+	}
+}
+
+// string also encodes object paths.
+func (e *dbusEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *dbusEncoder) signature(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// array encodes its elements with elements, which are aligned to elemAlign.
+func (e *dbusEncoder) array(elemAlign int, elements func()) {
+	e.align(4)
+	lengthAt := len(e.buf)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	e.align(elemAlign)
+
+	start := len(e.buf)
+	elements()
+	binary.LittleEndian.PutUint32(e.buf[lengthAt:], uint32(len(e.buf)-start))
+}
+
+func (e *dbusEncoder) structure(fields func()) {
+	e.align(8)
+	fields()
+}
+
+func (e *dbusEncoder) variant(signature string, value func()) {
+	e.signature(signature)
+	value()
+}
+
+type dbusDecoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+	err   error
+}
+
+var errBadDbus = errors.New("malformed D-Bus message")
+
+func (d *dbusDecoder) take(n int) []byte {
+	if d.err != nil || len(d.buf) < d.pos+n {
+		d.err = errBadDbus
+		return make([]byte, n)
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *dbusDecoder) align(n int) {
+	if rem := d.pos % n; rem != 0 {
+		d.take(n - rem)
+	}
+}
+
+func (d *dbusDecoder) byte() byte {
+	return d.take(1)[0]
+}
+
+func (d *dbusDecoder) uint32() uint32 {
+	d.align(4)
+	return d.order.Uint32(d.take(4))
+}
+
+func (d *dbusDecoder) string() string {
+	n := d.uint32()
+	if dbusMaxMessageSize < n {
+		d.err = errBadDbus
+		return ""
+	}
+	s := string(d.take(int(n)))
+	d.take(1)
+	return s
+}
+
+func (d *dbusDecoder) signature() string {
+	n := d.byte()
+	s := string(d.take(int(n)))
+	d.take(1)
+	return s
+}
+
+func (d *dbusDecoder) strings() []string {
+	n := d.uint32()
+	end := d.pos + int(n)
+	var values []string
+	for d.err == nil && d.pos < end {
+		values = append(values, d.string())
+	}
+	return values
+}
+
+// headerValue decodes the variant value of a header field, all of which are
+// strings, signatures, or serials.
+func (d *dbusDecoder) headerValue() any {
+	switch signature := d.signature(); signature {
+	case "s", "o":
+		return d.string()
+	case "g":
+		return d.signature()
+	case "u":
+		return d.uint32()
+	default:
+		d.err = fmt.Errorf("unexpected header field type %q", signature)
+		return nil
+	}
+}
+
+type dbusMessage struct {
+	msgType     byte
+	flags       byte
+	serial      uint32
+	path        string
+	iface       string
+	member      string
+	sender      string
+	signature   string
+	replySerial uint32
+	order       binary.ByteOrder
+	body        []byte
+}
+
+func (m *dbusMessage) bodyDecoder() *dbusDecoder {
+	return &dbusDecoder{buf: m.body, order: m.order}
+}
+
+type dbusField struct {
+	code  byte
+	value any
+}
+
+type dbusConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	mu     sync.Mutex
+	serial uint32
+}
+
+// dialSystemBus connects and authenticates as the process's user, which is
+// all the system bus accepts.
+func dialSystemBus() (*dbusConn, error) {
+	address := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	if address == "" {
+		address = defaultSystemBusAddress
+	}
+
+	path, ok := strings.CutPrefix(address, "unix:path=")
+	if !ok {
+		return nil, fmt.Errorf("unsupported bus address %q", address)
+	}
+	path, _, _ = strings.Cut(path, ",")
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &dbusConn{conn: conn, reader: bufio.NewReader(conn)}
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := fmt.Fprintf(conn, "\x00AUTH EXTERNAL %s\r\n", uid); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := c.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(reply, "OK ") {
+		conn.Close()
+		return nil, fmt.Errorf("the bus refused authentication: %s", strings.TrimSpace(reply))
+	}
+	if _, err := io.WriteString(conn, "BEGIN\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *dbusConn) send(msgType byte, flags byte, fields []dbusField, signature string, body []byte) (uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.serial++
+	if signature != "" {
+		fields = append(fields, dbusField{dbusFieldSignature, signature})
+	}
+
+	var e dbusEncoder
+	e.byte('l')
+	e.byte(msgType)
+	e.byte(flags)
+	e.byte(1)
+	e.uint32(uint32(len(body)))
+	e.uint32(c.serial)
+	e.array(8, func() {
+		for _, field := range fields {
+			e.structure(func() {
+				e.byte(field.code)
+				switch value := field.value.(type) {
+				case uint32:
+					e.variant("u", func() { e.uint32(value) })
+				case string:
+					switch field.code {
+					case dbusFieldPath:
+						e.variant("o", func() { e.string(value) })
+					case dbusFieldSignature:
+						e.variant("g", func() { e.signature(value) })
+					default:
+						e.variant("s", func() { e.string(value) })
+					}
+				}
+			})
+		}
+	})
+	e.align(8)
+
+	_, err := c.conn.Write(append(e.buf, body...))
+	return c.serial, err
+}
+
+func (c *dbusConn) read() (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if fixed[0] == 'B' {
+		order = binary.BigEndian
+	}
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	if dbusMaxMessageSize < bodyLen || dbusMaxMessageSize < fieldsLen {
+		return nil, errBadDbus
+	}
+
+	headerLen := (16 + int(fieldsLen) + 7) &^ 7
+	rest := make([]byte, headerLen-16+int(bodyLen))
+	if _, err := io.ReadFull(c.reader, rest); err != nil {
+		return nil, err
+	}
+
+	msg := &dbusMessage{
+		msgType: fixed[1],
+		flags:   fixed[2],
+		serial:  order.Uint32(fixed[8:]),
+		order:   order,
+		body:    rest[headerLen-16:],
+	}
+
+	d := &dbusDecoder{buf: append(fixed, rest[:headerLen-16]...), pos: 16, order: order}
+	for d.err == nil && d.pos < 16+int(fieldsLen) {
+		d.align(8)
+		code := d.byte()
+		value := d.headerValue()
+		switch code {
+		case dbusFieldPath:
+			msg.path, _ = value.(string)
+		case dbusFieldInterface:
+			msg.iface, _ = value.(string)
+		case dbusFieldMember:
+			msg.member, _ = value.(string)
+		case dbusFieldSender:
+			msg.sender, _ = value.(string)
+		case dbusFieldSignature:
+			msg.signature, _ = value.(string)
+		case dbusFieldReplySerial:
+			msg.replySerial, _ = value.(uint32)
+		}
+	}
+	return msg, d.err
+}
+
+// call makes a method call on the bus itself, waiting for the reply.
+func (c *dbusConn) callBus(member string, signature string, body []byte) (*dbusMessage, error) {
+	serial, err := c.send(dbusMethodCall, 0, []dbusField{
+		{dbusFieldPath, "/org/freedesktop/DBus"},
+		{dbusFieldInterface, "org.freedesktop.DBus"},
+		{dbusFieldMember, member},
+		{dbusFieldDestination, "org.freedesktop.DBus"},
+	}, signature, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if msg.replySerial != serial {
+			continue
+		}
+		if msg.msgType == dbusError {
+			return nil, fmt.Errorf("%s failed: %s", member, msg.bodyDecoder().string())
+		}
+		return msg, nil
+	}
+}
+
+// claimDbusName owns the service's name on the system bus, which the policy
+// only allows root to do.
+func claimDbusName() (*dbusConn, error) {
+	c, err := dialSystemBus()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.callBus("Hello", "", nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	var request dbusEncoder
+	request.string(dbusName)
+	request.uint32(dbusNameFlagDoNotQueue)
+	reply, err := c.callBus("RequestName", "su", request.buf)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if result := reply.bodyDecoder().uint32(); result != dbusNamePrimaryOwner {
+		c.Close()
+		return nil, fmt.Errorf("could not own %s, which may already be taken", dbusName)
+	}
+	return c, nil
+}
+
+// serveDbus answers calls and emits signals until the context is cancelled.
+func serveDbus(ctx context.Context, d *daemon, c *dbusConn) {
+	go func() {
+		<-ctx.Done()
+		c.Close()
+	}()
+
+	go d.emitDbusSignals(ctx, c)
+
+	go func() {
+		for {
+			msg, err := c.read()
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("lost the D-Bus connection", "err", err)
+				}
+				return
+			}
+			if msg.msgType == dbusMethodCall {
+				d.answerDbus(ctx, c, msg)
+			}
+		}
+	}()
+}
+
+func (d *daemon) emitDbusSignals(ctx context.Context, c *dbusConn) {
+	entries, unsubscribe := d.history.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry := <-entries:
+			if entry.Error != "" {
+				continue
+			}
+
+			var body dbusEncoder
+			body.string(entry.Device)
+			body.string(string(entry.Mac))
+			body.string(string(entry.Vendor))
+			c.send(dbusSignal, 0, []dbusField{
+				{dbusFieldPath, dbusPath},
+				{dbusFieldInterface, dbusInterface},
+				{dbusFieldMember, "MacChanged"},
+			}, "sss", body.buf)
+		}
+	}
+}
+
+func (d *daemon) answerDbus(ctx context.Context, c *dbusConn, msg *dbusMessage) {
+	signature, body, err := d.dbusMethod(ctx, msg)
+	if msg.flags&dbusNoReplyExpected != 0 {
+		return
+	}
+
+	fields := []dbusField{
+		{dbusFieldReplySerial, msg.serial},
+		{dbusFieldDestination, msg.sender},
+	}
+	if err != nil {
+		var errBody dbusEncoder
+		errBody.string(err.Error())
+		errorName := dbusErrorName
+		var unknown *dbusUnknownError
+		if errors.As(err, &unknown) {
+			errorName = "org.freedesktop.DBus.Error.UnknownMethod"
+		}
+		c.send(dbusError, 0, append(fields, dbusField{dbusFieldErrorName, errorName}), "s", errBody.buf)
+		return
+	}
+	c.send(dbusMethodReturn, 0, fields, signature, body)
+}
+
+type dbusUnknownError struct {
+	msg *dbusMessage
+}
+
+func (err *dbusUnknownError) Error() string {
+	return fmt.Sprintf("no method %s.%s on %s", err.msg.iface, err.msg.member, err.msg.path)
+}
+
+// dbusMethod runs a method call, returning the signature and body of its
+// reply.
+func (d *daemon) dbusMethod(ctx context.Context, msg *dbusMessage) (string, []byte, error) {
+	if msg.path != dbusPath {
+		return "", nil, &dbusUnknownError{msg}
+	}
+
+	args := msg.bodyDecoder()
+	var reply dbusEncoder
+
+	switch msg.iface + "." + msg.member {
+	case "org.freedesktop.DBus.Introspectable.Introspect":
+		reply.string(dbusIntrospection)
+		return "s", reply.buf, nil
+
+	case "org.freedesktop.DBus.Peer.Ping":
+		return "", nil, nil
+
+	case "org.freedesktop.DBus.Properties.Get":
+		iface, property := args.string(), args.string()
+		if args.err != nil || msg.signature != "ss" {
+			return "", nil, errBadDbus
+		}
+		if iface != dbusInterface || property != "Status" {
+			return "", nil, fmt.Errorf("no property %s.%s", iface, property)
+		}
+		reply.variant(dbusStatusSignature, func() { d.encodeDbusStatus(&reply) })
+		return "v", reply.buf, nil
+
+	case "org.freedesktop.DBus.Properties.GetAll":
+		iface := args.string()
+		if args.err != nil || msg.signature != "s" {
+			return "", nil, errBadDbus
+		}
+		reply.array(8, func() {
+			if iface != dbusInterface {
+				return
+			}
+			reply.structure(func() {
+				reply.string("Status")
+				reply.variant(dbusStatusSignature, func() { d.encodeDbusStatus(&reply) })
+			})
+		})
+		return "a{sv}", reply.buf, nil
+
+	case dbusInterface + ".Rotate", dbusInterface + ".Pause", dbusInterface + ".Resume":
+		var deviceNames []string
+		if msg.signature == "as" {
+			deviceNames = args.strings()
+		}
+		if args.err != nil {
+			return "", nil, args.err
+		}
+		_, err := d.control(ctx, append([]string{strings.ToLower(msg.member)}, deviceNames...))
+		return "", nil, err
+
+	default:
+		return "", nil, &dbusUnknownError{msg}
+	}
+}
+
+func (d *daemon) encodeDbusStatus(e *dbusEncoder) {
+	unix := func(s status, next bool) int64 {
+		t := s.lastChange
+		if next {
+			t = s.nextRotation
+		}
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+
+	e.array(8, func() {
+		for _, s := range d.statuses() {
+			e.structure(func() {
+				e.string(s.deviceName)
+				e.string(string(s.mac))
+				e.string(string(s.vendor))
+				e.int64(unix(s, false))
+				e.int64(unix(s, true))
+				e.bool(s.paused)
+			})
+		}
+	})
+}
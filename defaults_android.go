@@ -0,0 +1,21 @@
+package main
+
+import "os"
+
+// Android has no /run or /var/lib, so the daemon keeps everything where
+// root-only files of rooted phones usually go.
+const (
+	defaultDeviceName    = "wlan0"
+	defaultStateDir      = "/data/adb/rotate-mac-address"
+	defaultPidFile       = defaultStateDir + "/rotate-mac-address.pid"
+	defaultControlSocket = defaultStateDir + "/rotate-mac-address.sock"
+)
+
+// defaultEscalator is su when run from an unprivileged shell such as Termux's,
+// as that is how rooted phones grant root.
+func defaultEscalator() escalator {
+	if os.Geteuid() != 0 {
+		return escalateSu
+	}
+	return escalateNever
+}
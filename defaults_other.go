@@ -0,0 +1,14 @@
+//go:build !android
+
+package main
+
+const (
+	defaultDeviceName    = "eth0"
+	defaultStateDir      = "/var/lib/rotate-mac-address"
+	defaultPidFile       = "/run/rotate-mac-address.pid"
+	defaultControlSocket = "/run/rotate-mac-address.sock"
+)
+
+func defaultEscalator() escalator {
+	return escalateNever
+}
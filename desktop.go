@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// desktopNotifications picks which changes pop up on the desktop, so that
+// laptop users notice when their connection is about to blip, or when
+// rotation silently stopped working.
+type desktopNotifications string
+
+const (
+	desktopNever    desktopNotifications = "never"
+	desktopFailures                      = "failures"
+	desktopAlways                        = "always"
+)
+
+func parseDesktopNotifications(value string) (desktopNotifications, error) {
+	switch notifications := desktopNotifications(value); notifications {
+	case desktopNever, desktopFailures, desktopAlways:
+		return notifications, nil
+	default:
+		return "", fmt.Errorf("unknown desktop notifications %q", value)
+	}
+}
+
+const desktopAppName = "rotate-mac-address"
+
+// serveDesktopNotifications shows changes on the desktops of those logged in.
+func serveDesktopNotifications(ctx context.Context, d *daemon, notifications desktopNotifications) {
+	entries, unsubscribe := d.history.subscribe()
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry := <-entries:
+				var err error
+				switch {
+				case entry.Error != "":
+					err = notifyDesktop(
+						"MAC address rotation failed",
+						fmt.Sprintf("%s could not be rotated: %s", entry.Device, entry.Error),
+						true,
+					)
+				case notifications == desktopAlways:
+					err = notifyDesktop(
+						"MAC address rotated",
+						fmt.Sprintf("%s is now %s of vendor %s, so its connection may briefly drop.", entry.Device, entry.Mac, entry.Vendor),
+						false,
+					)
+				}
+				if err != nil {
+					slog.Warn("could not show a desktop notification", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// abortDesktopNotifications warns that the daemon has given up.
+func abortDesktopNotifications(err error) {
+	if err := notifyDesktop("MAC address rotation stopped", err.Error(), true); err != nil {
+		slog.Warn("could not show a desktop notification", "err", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// notifyDesktop has osascript display the notification, in the session of
+// whoever is at the console when running as root from launchd.
+func notifyDesktop(summary string, body string, urgent bool) error {
+	script := "display notification " + appleScriptQuote(body) + " with title " + appleScriptQuote(summary)
+	if urgent {
+		script += ` sound name "Basso"`
+	}
+
+	if os.Geteuid() != 0 {
+		return exec.Command("osascript", "-e", script).Run()
+	}
+
+	info, err := os.Stat("/dev/console")
+	if err != nil {
+		return err
+	}
+	uid := info.Sys().(*syscall.Stat_t).Uid
+	if uid == 0 {
+		// No one is logged in, and so there is no one to tell.
+		return nil
+	}
+	consoleUser, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return err
+	}
+
+	return exec.Command(
+		"launchctl", "asuser", consoleUser.Uid,
+		"sudo", "-u", consoleUser.Username,
+		"osascript", "-e", script,
+	).Run()
+}
+
+func appleScriptQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
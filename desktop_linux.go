@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+const userRuntimeDirs = "/run/user"
+
+// notifyDesktop runs notify-send in the session of each user logged in, given
+// an unprivileged daemon can only reach its own.
+func notifyDesktop(summary string, body string, urgent bool) error {
+	urgency := "normal"
+	if urgent {
+		urgency = "critical"
+	}
+	args := []string{"--app-name", desktopAppName, "--urgency", urgency, summary, body}
+
+	if os.Geteuid() != 0 {
+		return exec.Command("notify-send", args...).Run()
+	}
+
+	// Each session bus lives in its user's runtime directory.
+	dirs, err := os.ReadDir(userRuntimeDirs)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, dir := range dirs {
+		uid, err := strconv.ParseUint(dir.Name(), 10, 32)
+		if err != nil || uid == 0 {
+			continue
+		}
+		bus := filepath.Join(userRuntimeDirs, dir.Name(), "bus")
+		info, err := os.Stat(bus)
+		if err != nil {
+			continue
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			continue
+		}
+
+		cmd := exec.Command("notify-send", args...)
+		cmd.Env = append(os.Environ(), "DBUS_SESSION_BUS_ADDRESS=unix:path="+bus)
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: uint32(uid), Gid: stat.Gid},
+		}
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, fmt.Errorf("user %d: %w", uid, err))
+		}
+	}
+	return errors.Join(errs...)
+}
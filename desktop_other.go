@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func notifyDesktop(summary string, body string, urgent bool) error {
+	return errors.New("desktop notifications are only supported on Linux and macOS")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// dhcpClient is which DHCP client to give a fresh client identifier with each
+// rotation. A client that keeps sending the same identifier, or DUID, ties
+// every new address straight back to the old ones.
+type dhcpClient string
+
+const (
+	dhcpClientNone           dhcpClient = "none"
+	dhcpClientNetworkManager            = "networkmanager"
+	dhcpClientDhclient                  = "dhclient"
+)
+
+var errNoDhcpClientSupport = errors.New("DHCP client identifiers can only be changed on Linux")
+
+func parseDhcpClient(value string) (dhcpClient, error) {
+	switch client := dhcpClient(value); client {
+	case dhcpClientNone, dhcpClientNetworkManager, dhcpClientDhclient:
+		return client, nil
+	default:
+		return "", fmt.Errorf("unknown DHCP client %q", value)
+	}
+}
+
+func runDhcpCommand(prog string, args ...string) (string, error) {
+	out, err := exec.Command(prog, args...).CombinedOutput()
+	trimmed := strings.TrimSpace(string(out))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %s", prog, err, trimmed)
+	}
+	return trimmed, nil
+}
+
+// dhcpClientID is the client identifier for an address: a hardware type of
+// Ethernet followed by the address itself, as most clients send by default,
+// so the identifier says no more than the address already does.
+func dhcpClientID(mac rotator.MAC) string {
+	return "01:" + string(mac)
+}
+
+// rotateDhcpClientID rewrites the DHCP client's identifier to follow the new
+// address, restarting the client so it asks for a lease with it. It reports
+// whether it did, which leaves no need to renew the lease separately.
+func (r *rotation) rotateDhcpClientID(settings settings, mac rotator.MAC) bool {
+	if settings.dhcpClient == dhcpClientNone {
+		return false
+	}
+
+	clientID := dhcpClientID(mac)
+	if settings.dryRun {
+		r.logger.Info("would change the DHCP client identifier", "client", settings.dhcpClient, "client_id", clientID)
+		return true
+	}
+
+	var err error
+	switch settings.dhcpClient {
+	case dhcpClientNetworkManager:
+		err = setNetworkManagerClientID(r.deviceName, clientID)
+	case dhcpClientDhclient:
+		err = setDhclientClientID(r.stateDir, r.deviceName, clientID)
+	}
+	if err != nil {
+		r.logger.Warn("could not change the DHCP client identifier", "client", settings.dhcpClient, "err", err)
+		return false
+	}
+	r.logger.Info("changed the DHCP client identifier", "client", settings.dhcpClient, "client_id", clientID)
+	return true
+}
+
+// renewDhcpLease releases the lease taken with the old address and asks for
+// one with the new, rather than leaving the device on an address that the
+// network bound to its old identity until the lease runs out.
+func (r *rotation) renewDhcpLease(settings settings) {
+	if !settings.dhcpRenew {
+		return
+	}
+	if settings.dryRun {
+		r.logger.Info("would renew the DHCP lease")
+		return
+	}
+
+	if err := renewDhcpLease(r.deviceName); err != nil {
+		r.logger.Warn("could not renew the DHCP lease", "err", err)
+		return
+	}
+	r.logger.Info("renewed the DHCP lease")
+}
@@ -0,0 +1,16 @@
+package main
+
+func setNetworkManagerClientID(string, string) error {
+	return errNoDhcpClientSupport
+}
+
+func setDhclientClientID(string, string, string) error {
+	return errNoDhcpClientSupport
+}
+
+// renewDhcpLease has configd drop the device's lease and negotiate another,
+// as renewing from the Network settings does.
+func renewDhcpLease(deviceName string) error {
+	_, err := runDhcpCommand("ipconfig", "set", deviceName, "DHCP")
+	return err
+}
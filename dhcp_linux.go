@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// setNetworkManagerClientID changes the identifiers of the connection active
+// on the device, both the IPv4 client identifier and the DUID that DHCPv6
+// sends, then brings it up again to take a lease with them.
+func setNetworkManagerClientID(deviceName, clientID string) error {
+	connection, err := runDhcpCommand("nmcli", "--get-values", "GENERAL.CONNECTION", "device", "show", deviceName)
+	if err != nil {
+		return err
+	}
+	if connection == "" {
+		return errors.New("no NetworkManager connection is active on the device")
+	}
+
+	// A DUID-LL: type 3, for a link-layer address of hardware type 1.
+	duid := "00:03:00:01:" + strings.TrimPrefix(clientID, "01:")
+
+	if _, err := runDhcpCommand(
+		"nmcli", "connection", "modify", connection,
+		"ipv4.dhcp-client-id", clientID,
+		"ipv6.dhcp-duid", duid,
+	); err != nil {
+		return err
+	}
+	_, err = runDhcpCommand("nmcli", "connection", "up", connection, "ifname", deviceName)
+	return err
+}
+
+// setDhclientClientID writes a configuration of the daemon's own for the
+// device's dhclient, which has no drop-in directory to add to, then restarts
+// dhclient with it in the background.
+func setDhclientClientID(stateDir, deviceName, clientID string) error {
+	path := filepath.Join(stateDir, "dhclient-"+deviceName+".conf")
+	conf := fmt.Sprintf(
+		"# Written by rotate-mac-address on each rotation.\nsend dhcp-client-identifier %s;\n",
+		clientID,
+	)
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		return err
+	}
+
+	// Releasing also stops the running dhclient, which would otherwise keep
+	// its old identifier.
+	if _, err := runDhcpCommand("dhclient", "-r", "-cf", path, deviceName); err != nil {
+		return err
+	}
+	_, err := runDhcpCommand("dhclient", "-nw", "-cf", path, deviceName)
+	return err
+}
+
+// renewDhcpLease goes through NetworkManager when it manages the device, and
+// otherwise through whichever of dhcpcd or dhclient is installed.
+func renewDhcpLease(deviceName string) error {
+	connection, err := runDhcpCommand("nmcli", "--get-values", "GENERAL.CONNECTION", "device", "show", deviceName)
+	if err == nil && connection != "" {
+		_, err := runDhcpCommand("nmcli", "connection", "up", connection, "ifname", deviceName)
+		return err
+	}
+
+	if _, err := exec.LookPath("dhcpcd"); err == nil {
+		_, err := runDhcpCommand("dhcpcd", "-n", deviceName)
+		return err
+	}
+
+	// Releasing also stops the running dhclient, so start another.
+	if _, err := runDhcpCommand("dhclient", "-r", deviceName); err != nil {
+		return err
+	}
+	_, err = runDhcpCommand("dhclient", "-4", "-nw", deviceName)
+	return err
+}
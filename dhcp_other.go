@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+func setNetworkManagerClientID(string, string) error {
+	return errNoDhcpClientSupport
+}
+
+func setDhclientClientID(string, string, string) error {
+	return errNoDhcpClientSupport
+}
+
+// renewDhcpLease restarts dhclient, which the BSDs all ship, for the device.
+func renewDhcpLease(deviceName string) error {
+	_, err := runDhcpCommand("dhclient", deviceName)
+	return err
+}
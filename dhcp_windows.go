@@ -0,0 +1,17 @@
+package main
+
+func setNetworkManagerClientID(string, string) error {
+	return errNoDhcpClientSupport
+}
+
+func setDhclientClientID(string, string, string) error {
+	return errNoDhcpClientSupport
+}
+
+func renewDhcpLease(deviceName string) error {
+	if _, err := runDhcpCommand("ipconfig", "/release", deviceName); err != nil {
+		return err
+	}
+	_, err := runDhcpCommand("ipconfig", "/renew", deviceName)
+	return err
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// diagnosis is the outcome of one check by the doctor. A hint is only shown
+// alongside a problem, which doctor -fix solves with the fix, if there is one,
+// describing what it did.
+type diagnosis struct {
+	name    string
+	ok      bool
+	skipped bool
+	detail  string
+	hint    string
+	fix     func() (string, error)
+}
+
+func (d diagnosis) String() string {
+	verdict := "PASS"
+	if d.skipped {
+		verdict = "SKIP"
+	} else if !d.ok {
+		verdict = "FAIL"
+	}
+
+	formatted := fmt.Sprintf("%s  %s: %s", verdict, d.name, d.detail)
+	if !d.ok && d.hint != "" {
+		formatted += "\n      hint: " + d.hint
+	}
+	if !d.ok && d.fix != nil {
+		formatted += "\n      fix: doctor -fix does this"
+	}
+	return formatted
+}
+
+// runDoctor checks the environment end to end for what rotating the given
+// devices with the given flags needs, without changing any address. With
+// -fix, it reconfigures the network managers that would undo rotations.
+func runDoctor(args []string) error {
+	flagSet := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var fix bool
+	flagSet.BoolVar(
+		&fix,
+		"fix",
+		false,
+		"write the overrides that stop network managers undoing rotations, where the doctor knows how",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	diagnoses := []diagnosis{
+		diagnosePrivileges(*flags),
+		diagnoseTools(*flags),
+		diagnoseStateDir(*flags),
+	}
+	diagnoses = append(diagnoses, diagnoseManagers(flags.deviceNames, flags.backend)...)
+	for _, deviceName := range flags.deviceNames {
+		diagnoses = append(
+			diagnoses,
+			diagnoseDevice(deviceName),
+			diagnoseDriver(*flags, deviceName),
+		)
+	}
+
+	failures := 0
+	for _, diagnosis := range diagnoses {
+		fmt.Println(diagnosis)
+		if diagnosis.ok || diagnosis.skipped {
+			continue
+		}
+
+		if fix && diagnosis.fix != nil {
+			if done, err := diagnosis.fix(); err != nil {
+				fmt.Printf("      could not fix it: %v\n", err)
+			} else {
+				fmt.Printf("      fixed: %s\n", done)
+				continue
+			}
+		}
+		failures++
+	}
+
+	if failures != 0 {
+		return fmt.Errorf("%d of %d checks failed", failures, len(diagnoses))
+	}
+	return nil
+}
+
+func diagnosePrivileges(flags flags) diagnosis {
+	d := diagnosis{name: "privileges"}
+	if flags.helperSocket != "" {
+		if _, err := loadHelperKey(flags.helperKeyFile, -1, false); err != nil {
+			d.detail = err.Error()
+			d.hint = "run the helper command as root first, and make its key readable by this user"
+			return d
+		}
+		d.ok = true
+		d.detail = "setting addresses through the helper at " + flags.helperSocket
+		return d
+	}
+	if flags.escalate != escalateNever {
+		d.ok = true
+		d.detail = fmt.Sprintf("escalating set commands with %s", flags.escalate)
+		return d
+	}
+
+	if err := missingPrivileges(); err != nil {
+		d.detail = err.Error()
+		d.hint = "or pass -escalate sudo to escalate just the set commands"
+		return d
+	}
+
+	d.ok = true
+	d.detail = "sufficient to change addresses"
+	return d
+}
+
+func diagnoseTools(flags flags) diagnosis {
+	d := diagnosis{name: "tools"}
+
+	prog, _ := chooseSetMacCmd(flags)(defaultDeviceName, rotator.PrefixIntel)
+	path, err := exec.LookPath(prog)
+	if err != nil {
+		d.detail = fmt.Sprintf("%s is missing", prog)
+		d.hint = fmt.Sprintf("install the package providing %s", prog)
+		return d
+	}
+
+	d.ok = true
+	d.detail = fmt.Sprintf("found %s", path)
+	return d
+}
+
+func diagnoseStateDir(flags flags) diagnosis {
+	d := diagnosis{name: "state directory"}
+	hint := fmt.Sprintf("pass a -state-dir the daemon can write to, or fix the permissions of %s", flags.stateDir)
+
+	if err := os.MkdirAll(flags.stateDir, stateDirPerm); err != nil {
+		d.detail = err.Error()
+		d.hint = hint
+		return d
+	}
+
+	file, err := os.CreateTemp(flags.stateDir, ".doctor-*")
+	if err != nil {
+		d.detail = err.Error()
+		d.hint = hint
+		return d
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	d.ok = true
+	d.detail = fmt.Sprintf("%s is writable", flags.stateDir)
+	return d
+}
+
+func diagnoseDevice(deviceName string) diagnosis {
+	d := diagnosis{name: deviceName + " device"}
+
+	iface, err := net.InterfaceByName(deviceName)
+	if err != nil {
+		d.detail = err.Error()
+		d.hint = "pass an existing device to -device-name; list them with the list-interfaces command"
+		return d
+	}
+	if len(iface.HardwareAddr) != 6 {
+		d.detail = "has no Ethernet-style hardware address to rotate"
+		d.hint = "pick an Ethernet or Wi-Fi device rather than a tunnel or loopback"
+		return d
+	}
+
+	d.ok = true
+	d.detail = fmt.Sprintf("%s, currently %s", deviceKind(deviceName), iface.HardwareAddr)
+	return d
+}
+
+func deviceKind(deviceName string) string {
+	kind := deviceType(deviceName)
+	if driver := deviceDriver(deviceName); driver != "" {
+		kind += " with driver " + driver
+	}
+	return kind
+}
+
+// diagnoseDriver sets the device's current address again, which exercises the
+// same path as a rotation without changing anything.
+func diagnoseDriver(flags flags, deviceName string) diagnosis {
+	d := diagnosis{name: deviceName + " driver"}
+
+	switch {
+	case flags.dryRun:
+		d.skipped = true
+		d.detail = "not trying to set an address in a dry run"
+		return d
+	case isWindows():
+		d.skipped = true
+		d.detail = "not trying to set an address, as that restarts the adapter on Windows"
+		return d
+	}
+
+	mac, err := rotator.CurrentMAC(deviceName)
+	if err != nil || mac == "" {
+		d.skipped = true
+		d.detail = "the device's address could not be read"
+		return d
+	}
+
+	prog, args := chooseSetMacCmd(flags)(deviceName, mac)
+	var out bytes.Buffer
+	cmd := exec.Command(prog, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err = runPrivileged(cmd)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		d.detail = fmt.Sprintf("refused to set an address: %s", strings.TrimSpace(out.String()))
+		d.hint = "the driver may not support changing addresses; try a different adapter"
+		return d
+	} else if err != nil {
+		d.detail = err.Error()
+		return d
+	}
+
+	d.ok = true
+	d.detail = "accepts address changes"
+	return d
+}
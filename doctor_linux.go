@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// deviceType is wired, wireless, or virtual, for devices with no hardware
+// behind them.
+func deviceType(deviceName string) string {
+	sysDir := filepath.Join("/sys/class/net", deviceName)
+
+	if _, err := os.Stat(filepath.Join(sysDir, "wireless")); err == nil {
+		return "wireless"
+	} else if _, err := os.Stat(filepath.Join(sysDir, "device")); err != nil {
+		return "virtual"
+	}
+	return "wired"
+}
+
+func deviceDriver(deviceName string) string {
+	driver, err := os.Readlink(filepath.Join("/sys/class/net", deviceName, "device", "driver"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(driver)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+func deviceType(deviceName string) string {
+	if _, err := currentNetwork(deviceName); err == nil {
+		return "wireless"
+	}
+	return "wired"
+}
+
+// deviceDriver is unknown here.
+func deviceDriver(string) string {
+	return ""
+}
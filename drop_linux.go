@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetKeepCaps           = 8
+	linuxCapabilityVersion3 = 0x20080522
+)
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// dropPrivileges switches to the -user, keeping only CAP_NET_ADMIN, so that a
+// compromise of the long-running daemon doesn't yield full root. The state
+// directory is handed over first so the daemon can still save its schedule.
+func dropPrivileges(flags flags) error {
+	if flags.user == "" || os.Geteuid() != 0 {
+		return nil
+	}
+
+	u, err := user.Lookup(flags.user)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+
+	if err := chownTree(flags.stateDir, uid, gid); err != nil {
+		return fmt.Errorf("could not hand the state directory to %s: %w", flags.user, err)
+	}
+
+	// Every thread must keep its capabilities across the change of user,
+	// which needs the runtime's help to reach them all.
+	_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetKeepCaps, 1, 0)
+	if errno == syscall.ENOTSUP {
+		return errors.New("-user needs a build without cgo, such as with CGO_ENABLED=0")
+	} else if errno != 0 {
+		return errno
+	}
+
+	if err := syscall.Setgroups(nil); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return err
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return err
+	}
+
+	header := capHeader{version: linuxCapabilityVersion3}
+	data := [2]capData{{
+		effective:   1 << capNetAdmin,
+		permitted:   1 << capNetAdmin,
+		inheritable: 1 << capNetAdmin,
+	}}
+	_, _, errno = syscall.AllThreadsSyscall(
+		syscall.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&header)),
+		uintptr(unsafe.Pointer(&data[0])),
+		0,
+	)
+	if errno != 0 {
+		return fmt.Errorf("could not keep CAP_NET_ADMIN: %w", errno)
+	}
+	return nil
+}
+
+func chownTree(root string, uid int, gid int) error {
+	if err := os.MkdirAll(root, stateDirPerm); err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func dropPrivileges(flags flags) error {
+	if flags.user == "" {
+		return nil
+	}
+	return errors.New("-user is only supported on Linux")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	eapAuthTimeout      = 30 * time.Second
+	eapAuthPollInterval = time.Second
+)
+
+// eapPolicy is what to do about rotations on 802.1X networks, wired or
+// enterprise Wi-Fi, whose switches and controllers often shut the port of a
+// session whose address changes under it.
+type eapPolicy string
+
+const (
+	eapPause          eapPolicy = "pause"
+	eapReauthenticate           = "reauthenticate"
+	eapIgnore                   = "ignore"
+)
+
+func parseEAPPolicy(value string) (eapPolicy, error) {
+	switch policy := eapPolicy(value); policy {
+	case eapPause, eapReauthenticate, eapIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown 802.1X policy %q", value)
+	}
+}
+
+// eapSkipReason says why the device should not be rotated on its current
+// network, if it should not.
+func (r *rotation) eapSkipReason(settings settings) string {
+	if settings.eapPolicy != eapPause || !usesEAP(r.deviceName) {
+		return ""
+	}
+	return "the device is on an 802.1X network, where changing address mid-session often gets the port shut; pass -on-8021x reauthenticate to log off and authenticate again around the change"
+}
+
+// pauseEAP logs the device off its 802.1X session for the change, so that
+// the network sees the session end rather than an address changing within
+// it. It gives what logs on again, waiting for the new address to be
+// authenticated.
+func (r *rotation) pauseEAP(ctx context.Context, settings settings) (func(), error) {
+	if settings.eapPolicy != eapReauthenticate || !usesEAP(r.deviceName) {
+		return func() {}, nil
+	}
+	if settings.dryRun {
+		r.logger.Info("would log off 802.1X for the change, and authenticate again after")
+		return func() {}, nil
+	}
+
+	if err := eapLogoff(r.deviceName); err != nil {
+		return nil, fmt.Errorf("could not log off 802.1X: %w", err)
+	}
+	r.logger.Info("logged off 802.1X for the change")
+	return func() {
+		if err := eapLogon(r.deviceName); err != nil {
+			r.logger.Error("could not authenticate with 802.1X again", "err", err)
+			return
+		}
+		if err := awaitEAPAuth(ctx, r.deviceName); err != nil {
+			r.logger.Warn("the new address has not been authenticated with 802.1X", "err", err)
+			return
+		}
+		r.logger.Info("authenticated the new address with 802.1X")
+	}, nil
+}
+
+func awaitEAPAuth(ctx context.Context, deviceName string) error {
+	ctx, cancel := context.WithTimeout(ctx, eapAuthTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(eapAuthPollInterval)
+	defer ticker.Stop()
+
+	for {
+		authorized, err := eapAuthorized(deviceName)
+		if err != nil {
+			return err
+		}
+		if authorized {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not authorized after %s", eapAuthTimeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// usesEAP asks wpa_supplicant, which runs 802.1X for wired devices as well as
+// wireless ones, whether the device's network authenticates with it.
+func usesEAP(deviceName string) bool {
+	conn, err := dialWpa(deviceName)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	reply, err := conn.request("STATUS")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(parseWpaStatus(reply)["key_mgmt"], "802.1X")
+}
+
+func eapLogoff(deviceName string) error {
+	return requestWpaOK(deviceName, "LOGOFF")
+}
+
+// eapLogon starts a fresh authentication, rather than waiting for the
+// supplicant's own timers.
+func eapLogon(deviceName string) error {
+	if err := requestWpaOK(deviceName, "LOGON"); err != nil {
+		return err
+	}
+	return requestWpaOK(deviceName, "REAUTHENTICATE")
+}
+
+func eapAuthorized(deviceName string) (bool, error) {
+	conn, err := dialWpa(deviceName)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	reply, err := conn.request("STATUS")
+	if err != nil {
+		return false, err
+	}
+	status := parseWpaStatus(reply)
+	return status["suppPortStatus"] == "Authorized" || status["EAP state"] == "SUCCESS", nil
+}
+
+func requestWpaOK(deviceName string, cmd string) error {
+	conn, err := dialWpa(deviceName)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reply, err := conn.request(cmd)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(reply) != "OK" {
+		return fmt.Errorf("wpa_supplicant refused %s: %s", cmd, strings.TrimSpace(reply))
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var errNoEAPSupport = errors.New("802.1X sessions cannot be managed on this platform")
+
+// usesEAP cannot tell elsewhere, so rotations go ahead as before.
+func usesEAP(string) bool {
+	return false
+}
+
+func eapLogoff(string) error {
+	return errNoEAPSupport
+}
+
+func eapLogon(string) error {
+	return errNoEAPSupport
+}
+
+func eapAuthorized(string) (bool, error) {
+	return false, errNoEAPSupport
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// weakAddressBits is below the randomness which a tracker watching a busy
+// network would struggle to link addresses across.
+const weakAddressBits = 24
+
+// entropyReport is how identifiable the addresses generated under some
+// settings are.
+type entropyReport struct {
+	vendors   []rotator.VendorPrefix
+	addresses float64
+	bits      float64
+	warnings  []string
+	hints     []string
+}
+
+func reportEntropy(settings settings) entropyReport {
+	report := entropyReport{
+		vendors:   settings.vendors,
+		addresses: rotator.AddressCount(settings.vendors),
+	}
+	if settings.slap != "" {
+		report.vendors = nil
+		report.addresses = rotator.SLAPAddressCount(settings.slap)
+		report.bits = math.Log2(report.addresses)
+		return report
+	}
+	if len(settings.macPool) != 0 {
+		report.vendors = nil
+		report.addresses = float64(len(settings.macPool))
+		report.bits = math.Log2(report.addresses)
+		report.warnings = append(report.warnings, fmt.Sprintf(
+			"addresses come from a -mac-pool of %d, which anyone who sees them all can recognise",
+			len(settings.macPool),
+		))
+		return report
+	}
+	report.bits = math.Log2(report.addresses)
+
+	for _, vendorPrefix := range settings.vendors {
+		if _, bits, err := rotator.ParsePrefix(vendorPrefix.Prefix); err == nil && weakAddressBits < bits {
+			report.warnings = append(report.warnings, fmt.Sprintf(
+				"the %d-bit prefix %s leaves only %d bits of each address to chance",
+				bits,
+				vendorPrefix.Prefix,
+				48-bits,
+			))
+		}
+	}
+
+	switch len(settings.vendors) {
+	case 1:
+		report.warnings = append(report.warnings, fmt.Sprintf(
+			"every address is from %s, so the device is singled out by its vendor as much as by its address",
+			settings.vendors[0].Vendor,
+		))
+		report.hints = append(report.hints, "pass more -vendors, such as all of them by leaving it unset")
+	case len(rotator.Vendors):
+	default:
+		report.hints = append(report.hints, "leave -vendors unset to draw from every vendor")
+	}
+
+	if report.bits < weakAddressBits {
+		report.warnings = append(report.warnings, fmt.Sprintf(
+			"with %.1f bits, a repeated address becomes likely after about %.0f rotations",
+			report.bits,
+			math.Sqrt(report.addresses),
+		))
+		if settings.cycleSecs != 0 && settings.cycleSecs < defaultCycleSecs {
+			report.hints = append(report.hints, fmt.Sprintf(
+				"a longer -cycle-secs than %d makes repeats take longer to come around",
+				settings.cycleSecs,
+			))
+		}
+	}
+	return report
+}
+
+func (report entropyReport) String() string {
+	var s strings.Builder
+
+	vendorNames := make([]string, len(report.vendors))
+	for i, vendorPrefix := range report.vendors {
+		vendorNames[i] = string(vendorPrefix.Vendor)
+	}
+	if len(report.vendors) != 0 {
+		fmt.Fprintf(&s, "vendors: %d (%s)\n", len(report.vendors), strings.Join(vendorNames, ", "))
+	}
+	fmt.Fprintf(&s, "distinct addresses: %.0f\n", report.addresses)
+	fmt.Fprintf(&s, "randomness per address: %.1f bits\n", report.bits)
+
+	for _, warning := range report.warnings {
+		fmt.Fprintf(&s, "\nwarning: %s", warning)
+	}
+	for _, hint := range report.hints {
+		fmt.Fprintf(&s, "\nhint: %s", hint)
+	}
+	return strings.TrimRight(s.String(), "\n")
+}
+
+// runAuditEntropy reports how many bits of randomness the generator settings
+// give each address, failing below -min-bits, if given, for checking configs
+// in CI.
+func runAuditEntropy(args []string) error {
+	flagSet := flag.NewFlagSet("audit entropy", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var minBits float64
+	flagSet.Float64Var(
+		&minBits,
+		"min-bits",
+		0,
+		"fail if the addresses have fewer bits of randomness than this",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	report := reportEntropy(flags.settings())
+	fmt.Println(report)
+	if report.bits < minBits {
+		return fmt.Errorf("the addresses have %.1f bits of randomness, short of the %.1f required", report.bits, minBits)
+	}
+	return nil
+}
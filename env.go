@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix starts the environment variable for each flag, which is named
+// after it in upper case with underscores, such as ROTATE_MAC_DRY_RUN.
+const envPrefix = "ROTATE_MAC_"
+
+// envAliases are shorter names for the most common flags' variables, which
+// their full names take precedence over.
+var envAliases = []struct{ env, flag string }{
+	{"ROTATE_MAC_DEVICE", "device-name"},
+	{"ROTATE_MAC_CYCLE", "cycle-secs"},
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets each flag whose variable is set, so that containers and
+// service managers can configure the tool without templating files.
+func applyEnv(flagSet *flag.FlagSet) error {
+	set := func(env, flagName string) error {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return nil
+		}
+		if err := flagSet.Set(flagName, value); err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		return nil
+	}
+
+	for _, alias := range envAliases {
+		if err := set(alias.env, alias.flag); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if err == nil {
+			err = set(envName(f.Name), f.Name)
+		}
+	})
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// escalator wraps only the commands that set addresses, so that the rest of
+// the daemon can run unprivileged.
+type escalator string
+
+const (
+	escalateNever escalator = ""
+	escalateSudo            = "sudo"
+	escalateDoas            = "doas"
+	escalateSu              = "su"
+)
+
+func parseEscalator(value string) (escalator, error) {
+	switch escalator := escalator(value); escalator {
+	case escalateNever, escalateSudo, escalateDoas, escalateSu:
+		return escalator, nil
+	default:
+		return "", fmt.Errorf("unknown escalator %q", value)
+	}
+}
+
+// escalate runs the set commands non-interactively, as a daemon has no one to
+// answer a password prompt. The su of rooted Android, which asks its manager
+// app rather than for a password, takes the command as one string.
+func escalate(newSetMacCmd rotator.SetCommand, escalator escalator) rotator.SetCommand {
+	switch escalator {
+	case escalateNever:
+		return newSetMacCmd
+	case escalateSu:
+		return func(devName string, mac rotator.MAC) (string, []string) {
+			prog, args := newSetMacCmd(devName, mac)
+			return string(escalator), []string{"-c", strings.Join(quoteAll(append([]string{prog}, args...)), " ")}
+		}
+	}
+
+	return func(devName string, mac rotator.MAC) (string, []string) {
+		prog, args := newSetMacCmd(devName, mac)
+		return string(escalator), append([]string{"-n", prog}, args...)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// The event log's API, which the standard library also lacks.
+var (
+	procRegisterEventSourceW   = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource  = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW           = advapi32.NewProc("ReportEventW")
+	eventLogSourceRegistryPath = `HKLM\SYSTEM\CurrentControlSet\Services\EventLog\Application\` + serviceName
+)
+
+const (
+	eventLogError       = 0x1
+	eventLogWarning     = 0x2
+	eventLogInformation = 0x4
+
+	// EventCreate.exe carries a message for each ID from 1 to 1000 that
+	// shows just the text reported with it, sparing this a message file of
+	// its own.
+	eventLogMessageFile = `%SystemRoot%\System32\EventCreate.exe`
+)
+
+// eventLogIDs gives the events that Windows admins filter on IDs of their own.
+// Otherwise, only warnings and errors reach the event log, so that it is not
+// filled with every wait.
+var eventLogIDs = map[string]uint32{
+	"rotating MAC addresses":  1,
+	"stopping":                2,
+	"exiting":                 3,
+	"changed the MAC address": 10,
+	"could not change the MAC address; the program will stop if more errors occur sequentially": 11,
+	"restored the MAC address": 12,
+}
+
+const (
+	eventLogWarningID = 100
+	eventLogErrorID   = 101
+)
+
+// registerEventSource lets Event Viewer show the service's events as its own
+// rather than as ones it cannot find descriptions for.
+func registerEventSource() error {
+	if err := runReg("add", eventLogSourceRegistryPath, "/v", "EventMessageFile", "/t", "REG_EXPAND_SZ", "/d", eventLogMessageFile, "/f"); err != nil {
+		return err
+	}
+	types := fmt.Sprint(eventLogError | eventLogWarning | eventLogInformation)
+	return runReg("add", eventLogSourceRegistryPath, "/v", "TypesSupported", "/t", "REG_DWORD", "/d", types, "/f")
+}
+
+func unregisterEventSource() error {
+	return runReg("delete", eventLogSourceRegistryPath, "/f")
+}
+
+func runReg(args ...string) error {
+	if out, err := exec.Command("reg.exe", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("reg.exe %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// eventLogSink reports to the Application event log, formatting into a buffer
+// shared by every handler derived from the first.
+type eventLogSink struct {
+	mu     sync.Mutex
+	handle uintptr
+	buf    bytes.Buffer
+}
+
+// eventLogHandler passes records on to another handler, and reports the
+// notable ones to the event log too.
+type eventLogHandler struct {
+	inner  slog.Handler
+	format slog.Handler
+	sink   *eventLogSink
+}
+
+// setUpEventLog adds the event log to wherever the log already goes, which
+// for a service is a file that admins are unlikely to look for.
+func setUpEventLog() (func(), error) {
+	name, err := syscall.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	handle, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if handle == 0 {
+		return nil, fmt.Errorf("could not open the event log: %w", err)
+	}
+
+	sink := &eventLogSink{handle: handle}
+	format := slog.NewTextHandler(&sink.buf, &slog.HandlerOptions{
+		// The event itself records both.
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && (attr.Key == slog.TimeKey || attr.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+
+	slog.SetDefault(slog.New(&eventLogHandler{slog.Default().Handler(), format, sink}))
+	return func() { procDeregisterEventSource.Call(handle) }, nil
+}
+
+func (h *eventLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *eventLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	err := h.inner.Handle(ctx, record)
+
+	eventType, id := uint16(eventLogInformation), eventLogIDs[record.Message]
+	switch {
+	case slog.LevelError <= record.Level:
+		eventType = eventLogError
+		if id == 0 {
+			id = eventLogErrorID
+		}
+	case slog.LevelWarn <= record.Level:
+		eventType = eventLogWarning
+		if id == 0 {
+			id = eventLogWarningID
+		}
+	case id == 0:
+		return err
+	}
+
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+
+	h.sink.buf.Reset()
+	if formatErr := h.format.Handle(ctx, record); formatErr != nil {
+		return formatErr
+	}
+	text, convErr := syscall.UTF16PtrFromString(strings.TrimSpace(h.sink.buf.String()))
+	if convErr != nil {
+		return convErr
+	}
+	strs := []*uint16{text}
+	ok, _, reportErr := procReportEventW.Call(
+		h.sink.handle,
+		uintptr(eventType),
+		0,
+		uintptr(id),
+		0,
+		uintptr(len(strs)),
+		0,
+		uintptr(unsafe.Pointer(&strs[0])),
+		0,
+	)
+	if ok == 0 && err == nil {
+		err = fmt.Errorf("could not report to the event log: %w", reportErr)
+	}
+	return err
+}
+
+func (h *eventLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &eventLogHandler{h.inner.WithAttrs(attrs), h.format.WithAttrs(attrs), h.sink}
+}
+
+func (h *eventLogHandler) WithGroup(name string) slog.Handler {
+	return &eventLogHandler{h.inner.WithGroup(name), h.format.WithGroup(name), h.sink}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// defaultGateway reads the device's default IPv4 route from the kernel's
+// routing table, which prints addresses as hex integers in the host's byte
+// order.
+func defaultGateway(deviceName string) (string, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != deviceName || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != net.IPv4len {
+			continue
+		}
+		gateway := make(net.IP, net.IPv4len)
+		binary.NativeEndian.PutUint32(gateway, binary.BigEndian.Uint32(raw))
+		return gateway.String(), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no default route", deviceName)
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// defaultGateway asks route for the default route, as macOS and the BSDs
+// have no routing table to read as a file.
+func defaultGateway(deviceName string) (string, error) {
+	if isWindows() {
+		return "", errors.New("finding the default gateway is unsupported on Windows; give -connectivity-check a host instead")
+	}
+
+	output, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not find the default gateway: %w", err)
+	}
+
+	var gateway, iface string
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch value = strings.TrimSpace(value); key {
+		case "gateway":
+			gateway = value
+		case "interface":
+			iface = value
+		}
+	}
+	if net.ParseIP(gateway) == nil || iface != deviceName {
+		return "", fmt.Errorf("%s has no default gateway", deviceName)
+	}
+	return gateway, nil
+}
@@ -0,0 +1,3 @@
+module gitlab.com/louis.jackman/rotate-mac-address
+
+go 1.24
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	grpcServicePrefix  = "/rotatemac.v1.Rotator/"
+	grpcMaxMessageSize = 4 << 20
+)
+
+// The gRPC status codes used.
+const (
+	grpcOk              = 0
+	grpcUnknown         = 2
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+	grpcUnauthenticated = 16
+)
+
+type grpcError struct {
+	code int
+	err  error
+}
+
+func (err *grpcError) Error() string {
+	return err.err.Error()
+}
+
+// serveGRPC answers the service in proto/rotator.proto over unencrypted
+// HTTP/2, implementing just enough of gRPC to do so without dependencies.
+func serveGRPC(ctx context.Context, d *daemon, listener net.Listener, token string) {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+
+	server := &http.Server{
+		Handler:           d.handleGRPC(token),
+		Protocols:         &protocols,
+		ReadHeaderTimeout: apiReadTimeout,
+
+		// End event streams along with the daemon.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("stopped serving gRPC", "err", err)
+		}
+	}()
+}
+
+func (d *daemon) handleGRPC(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "only gRPC requests are accepted", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+
+		code, msg := grpcOk, ""
+		if err := d.grpcCall(w, req, token); err != nil {
+			code, msg = grpcUnknown, err.Error()
+			var grpcErr *grpcError
+			if errors.As(err, &grpcErr) {
+				code = grpcErr.code
+			}
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", grpcPercentEncode(msg))
+	}
+}
+
+func (d *daemon) grpcCall(w http.ResponseWriter, req *http.Request, token string) error {
+	given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return &grpcError{grpcUnauthenticated, errors.New("a valid bearer token is required")}
+	}
+
+	method, ok := strings.CutPrefix(req.URL.Path, grpcServicePrefix)
+	if !ok {
+		return &grpcError{grpcUnimplemented, fmt.Errorf("unknown service for %s", req.URL.Path)}
+	}
+
+	msg, err := readGRPCMessage(req.Body)
+	if err != nil {
+		return err
+	}
+	fields, err := decodeProto(msg)
+	if err != nil {
+		return &grpcError{grpcInvalidArgument, err}
+	}
+
+	switch method {
+	case "Rotate":
+		rotations, err := d.selectRotations(protoStrings(fields, 1))
+		if err != nil {
+			return &grpcError{grpcNotFound, err}
+		}
+		for _, r := range rotations {
+			r.requestRotation("of a gRPC request")
+		}
+		return writeGRPCMessage(w, nil)
+
+	case "GetStatus":
+		rotations, err := d.selectRotations(protoStrings(fields, 1))
+		if err != nil {
+			return &grpcError{grpcNotFound, err}
+		}
+		var response protoEncoder
+		for _, r := range rotations {
+			response.bytes(1, encodeStatus(r.currentStatus()))
+		}
+		return writeGRPCMessage(w, response.buf)
+
+	case "StreamEvents":
+		return d.streamGRPCEvents(w, req, protoStrings(fields, 1))
+
+	case "Restore":
+		target := restoreTarget(restoreOriginal)
+		for _, field := range fields {
+			if field.number == 1 && field.varint == 1 {
+				target = restorePermanent
+			}
+		}
+		words := append([]string{"restore", string(target)}, protoStrings(fields, 2)...)
+		if _, err := d.control(req.Context(), words); err != nil {
+			return err
+		}
+		return writeGRPCMessage(w, nil)
+
+	default:
+		return &grpcError{grpcUnimplemented, fmt.Errorf("unknown method %s", method)}
+	}
+}
+
+func (d *daemon) streamGRPCEvents(w http.ResponseWriter, req *http.Request, deviceNames []string) error {
+	if _, err := d.selectRotations(deviceNames); err != nil {
+		return &grpcError{grpcNotFound, err}
+	}
+	w.(http.Flusher).Flush()
+
+	entries, unsubscribe := d.history.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return nil
+		case entry := <-entries:
+			if len(deviceNames) != 0 && !slices.Contains(deviceNames, entry.Device) {
+				continue
+			}
+
+			var event protoEncoder
+			event.timestamp(1, entry.At)
+			event.string(2, entry.Device)
+			event.string(3, string(entry.Mac))
+			event.string(4, string(entry.Vendor))
+			event.string(5, entry.Error)
+			event.string(6, string(entry.Previous))
+			if err := writeGRPCMessage(w, event.buf); err != nil {
+				return err
+			}
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func encodeStatus(s status) []byte {
+	profile := "normal"
+	if s.aggressive {
+		profile = "aggressive"
+	}
+	trustedNetwork := ""
+	if s.trustedNetwork.associated() {
+		trustedNetwork = s.trustedNetwork.String()
+	}
+
+	var e protoEncoder
+	e.string(1, s.deviceName)
+	e.string(2, string(s.mac))
+	e.string(3, string(s.vendor))
+	e.timestamp(4, s.lastChange)
+	e.timestamp(5, s.nextRotation)
+	e.varint(6, uint64(s.consecutiveErrs))
+	e.bool(7, s.paused)
+	e.string(8, profile)
+	e.string(9, trustedNetwork)
+	return e.buf
+}
+
+func protoStrings(fields []protoField, number int) []string {
+	var values []string
+	for _, field := range fields {
+		if field.number == number {
+			values = append(values, string(field.bytes))
+		}
+	}
+	return values
+}
+
+// readGRPCMessage reads a unary request, framed by a compression flag and a
+// length.
+func readGRPCMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Errorf("could not read the request: %w", err)}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, errors.New("compressed requests are not supported")}
+	}
+
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if grpcMaxMessageSize < length {
+		return nil, &grpcError{grpcInvalidArgument, errors.New("the request is too large")}
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Errorf("could not read the request: %w", err)}
+	}
+	return msg, nil
+}
+
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+// grpcPercentEncode escapes a status message as gRPC requires.
+func grpcPercentEncode(msg string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(msg) {
+		if b < ' ' || '~' < b || b == '%' {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		} else {
+			encoded.WriteByte(b)
+		}
+	}
+	return encoded.String()
+}
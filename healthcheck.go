@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const defaultHealthGraceSecs = 5 * 60
+
+// runHealthcheck asks the running daemon how its devices are getting on,
+// failing unless each one's last change succeeded and its next one is not
+// overdue, as for container health checks and monitoring plugins.
+func runHealthcheck(args []string) error {
+	flagSet := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(flagSet.Output(), "Usage: healthcheck [-socket path] [-grace-secs n] [-max-age-secs n] [device...]")
+		flagSet.PrintDefaults()
+	}
+
+	var socket string
+	var graceSecs uint
+	var maxAgeSecs uint
+
+	flagSet.StringVar(
+		&socket,
+		"socket",
+		defaultControlSocket,
+		"the daemon's control socket",
+	)
+	flagSet.UintVar(
+		&graceSecs,
+		"grace-secs",
+		defaultHealthGraceSecs,
+		"the seconds a rotation can be overdue by, such as when deferred, before counting as unhealthy",
+	)
+	flagSet.UintVar(
+		&maxAgeSecs,
+		"max-age-secs",
+		0,
+		"also fail if a device that is neither paused nor trusted last changed longer ago than this; 0 doesn't check",
+	)
+	flagSet.Parse(args)
+
+	statuses, err := requestStatuses(socket, flagSet.Args())
+	if err != nil {
+		return fmt.Errorf("unhealthy: %w", err)
+	}
+
+	var problems, healthy []string
+	now := time.Now()
+	grace := time.Duration(graceSecs) * time.Second
+	maxAge := time.Duration(maxAgeSecs) * time.Second
+
+	for _, s := range statuses {
+		switch {
+		case 0 < s.ConsecutiveErrors:
+			problems = append(problems, fmt.Sprintf("%s failed its last %d changes", s.Device, s.ConsecutiveErrors))
+		case s.Paused:
+			healthy = append(healthy, s.Device+" is paused")
+		case s.TrustedNetwork != "":
+			healthy = append(healthy, s.Device+" is on trusted network "+s.TrustedNetwork)
+		case !s.NextRotation.IsZero() && s.NextRotation.Add(grace).Before(now):
+			problems = append(problems, fmt.Sprintf("%s is overdue by %s", s.Device, now.Sub(s.NextRotation).Round(time.Second)))
+		case maxAge != 0 && (s.LastChange.IsZero() || s.LastChange.Add(maxAge).Before(now)):
+			problems = append(problems, fmt.Sprintf("%s has not changed within %s", s.Device, maxAge))
+		default:
+			healthy = append(healthy, fmt.Sprintf("%s is %s", s.Device, s.Mac))
+		}
+	}
+	if len(statuses) == 0 {
+		problems = append(problems, "no devices are being rotated")
+	}
+
+	if len(problems) != 0 {
+		return errors.New("unhealthy: " + strings.Join(problems, "; "))
+	}
+	fmt.Println("healthy: " + strings.Join(healthy, "; "))
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	defaultHelperSocket  = "/run/rotate-mac-address-helper.sock"
+	defaultHelperKeyFile = systemConfigDir + "/helper.key"
+
+	helperSocketPerm = 0o660
+	helperKeyPerm    = 0o640
+	helperTimeout    = 30 * time.Second
+
+	// helperSetProg stands in for the set command when going through the
+	// helper, which picks the real one itself.
+	helperSetProg = "helper"
+)
+
+// The helper protocol answers each connection with a line of "challenge
+// <hex>", to which the client replies with "set <device> <mac> <hex HMAC>",
+// the HMAC-SHA256 under the shared key of the challenge and the request, and
+// gets the control protocol's "ok" or "error: ..." back. The challenge keeps
+// requests from being replayed.
+const helperChallengePrefix = "challenge "
+
+// helperOptions are what the helper checks requests against.
+type helperOptions struct {
+	key     []byte
+	devices []string
+	setter  rotator.Setter
+}
+
+// runHelper is the only part of the program needing privileges when the
+// daemon runs with -helper-socket: it sets addresses for the daemon and
+// nothing else, checking each request's device and address, so that the
+// scheduler, configuration, APIs, and logging can run as an unprivileged
+// user.
+func runHelper(args []string) error {
+	flagSet := flag.NewFlagSet("helper", flag.ExitOnError)
+
+	var socket, keyFile, group string
+	var devices []string
+	backend := backendAuto
+
+	flagSet.StringVar(
+		&socket,
+		"socket",
+		defaultHelperSocket,
+		"the socket to listen on for the daemon's requests",
+	)
+	flagSet.StringVar(
+		&keyFile,
+		"key-file",
+		defaultHelperKeyFile,
+		"the key that requests are signed with, created if missing; the daemon's user must be able to read it, but no one else",
+	)
+	flagSet.StringVar(
+		&group,
+		"group",
+		"",
+		"the group to give the socket and a new key file to, which the daemon's user should be in",
+	)
+	flagSet.Func(
+		"allow-devices",
+		"a comma-separated list of the only devices whose addresses may be set; any by default",
+		func(value string) error {
+			devices = parseList(value)
+			return nil
+		},
+	)
+	flagSet.Func(
+		"backend",
+		"how to set addresses: auto (default), direct, uci, or connman, as for run",
+		func(value string) (err error) {
+			backend, err = parseSetBackend(value)
+			return err
+		},
+	)
+	flagSet.Parse(args)
+
+	if err := missingPrivileges(); err != nil {
+		return err
+	}
+
+	gid := -1
+	if group != "" {
+		found, err := user.LookupGroup(group)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(found.Gid); err != nil {
+			return fmt.Errorf("the group %s has no numeric ID: %w", group, err)
+		}
+	}
+
+	key, err := loadHelperKey(keyFile, gid, true)
+	if err != nil {
+		return err
+	}
+
+	newSetMacCmd := rotator.DefaultSetCommand()
+	switch backend.resolve() {
+	case backendUCI:
+		newSetMacCmd = setMacUCI
+	case backendConnMan:
+		newSetMacCmd = setMacConnMan
+	}
+	options := helperOptions{
+		key:     key,
+		devices: devices,
+		setter:  rotator.Setter{Command: newSetMacCmd, Runner: rotator.ExecRunner{RunCmd: runPrivileged}},
+	}
+
+	listener, err := listenControl(socket)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(socket, helperSocketPerm); err != nil {
+		listener.Close()
+		return err
+	}
+	if gid != -1 {
+		if err := os.Chown(socket, -1, gid); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	slog.Info("setting addresses for the daemon", "socket", socket, "devices", strings.Join(devices, ","))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go options.serve(ctx, conn)
+	}
+}
+
+// loadHelperKey reads the shared key, which the helper creates if missing,
+// readable by the group given, if any, for the daemon to sign requests with.
+func loadHelperKey(path string, gid int, create bool) ([]byte, error) {
+	creation := keyMustExist
+	if create {
+		creation = keyCreation{perm: helperKeyPerm, dirPerm: 0o755}
+	}
+	info, statErr := os.Stat(path)
+	// Windows has no mode bits to go by, only ACLs.
+	if statErr == nil && runtime.GOOS != "windows" && info.Mode().Perm()&^helperKeyPerm != 0 {
+		return nil, fmt.Errorf("%s has mode %04o, but whoever can read it can drive the helper, so it must be %04o or stricter", path, info.Mode().Perm(), helperKeyPerm)
+	}
+	key, err := loadKey(path, "the helper's key", creation)
+	if err != nil || !create || !errors.Is(statErr, fs.ErrNotExist) {
+		return key, err
+	}
+
+	if gid != -1 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			return nil, err
+		}
+	}
+	slog.Info("created a key for the daemon to sign requests with", "path", path)
+	return key, nil
+}
+
+func signHelperRequest(key []byte, challenge, request string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(challenge + "\n" + request))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (options helperOptions) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(helperTimeout))
+
+	challenge := randomHex(keySize)
+	if _, err := fmt.Fprintln(conn, helperChallengePrefix+challenge); err != nil {
+		return
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helperTimeout)
+	defer cancel()
+
+	if err := options.handle(ctx, challenge, strings.Fields(line)); err != nil {
+		fmt.Fprintln(conn, controlErrorPrefix+err.Error())
+		return
+	}
+	fmt.Fprintln(conn, controlOk)
+}
+
+// handle checks that a request is signed, and for an allowed device and an
+// address it could have, before setting it; nothing else is ever run.
+func (options helperOptions) handle(ctx context.Context, challenge string, words []string) error {
+	if len(words) != 4 || words[0] != "set" {
+		return errors.New("the only request is set <device> <mac> <signature>")
+	}
+	request := strings.Join(words[:3], " ")
+	deviceName, mac, signature := words[1], words[2], words[3]
+
+	if !hmac.Equal([]byte(signature), []byte(signHelperRequest(options.key, challenge, request))) {
+		slog.Warn("refused a request with a bad signature", "request", request)
+		return errors.New("the request's signature does not match")
+	}
+
+	if len(options.devices) != 0 && !slices.Contains(options.devices, deviceName) {
+		return fmt.Errorf("%s is not among the allowed devices", deviceName)
+	}
+	if _, err := net.InterfaceByName(deviceName); err != nil {
+		return err
+	}
+	addr, err := net.ParseMAC(mac)
+	if err != nil || len(addr) != 6 {
+		return fmt.Errorf("%q is not an Ethernet address", mac)
+	}
+	if addr[0]&1 != 0 || slices.Equal(addr, make(net.HardwareAddr, 6)) {
+		return fmt.Errorf("%s is not an address a device can have", addr)
+	}
+
+	logger := slog.With("device", deviceName, "mac", addr.String())
+	if err := options.setter.Apply(ctx, logger, deviceName, rotator.MAC(addr.String())); err != nil {
+		logger.Warn("could not set the address for the daemon", "err", err)
+		return err
+	}
+	logger.Info("set the address for the daemon")
+	return nil
+}
+
+// helperSetCommand hands the device and address to the helperRunner rather
+// than naming a command to run.
+func helperSetCommand(deviceName string, mac rotator.MAC) (string, []string) {
+	return helperSetProg, []string{deviceName, string(mac)}
+}
+
+// helperRunner sets addresses through the helper listening on the socket, as
+// the daemon does when running unprivileged with -helper-socket.
+type helperRunner struct {
+	socket  string
+	keyFile string
+}
+
+func (runner helperRunner) Run(ctx context.Context, prog string, args ...string) ([]byte, error) {
+	if prog != helperSetProg || len(args) != 2 {
+		return nil, fmt.Errorf("only addresses can be set through the helper, not by running %s", prog)
+	}
+	// Reading the key for each request picks up a new one without a
+	// restart.
+	key, err := loadHelperKey(runner.keyFile, -1, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", runner.socket)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the helper: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(helperTimeout))
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	challenge, ok := strings.CutPrefix(strings.TrimSpace(line), helperChallengePrefix)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("the helper did not offer a challenge: %q", line)
+	}
+
+	request := strings.Join([]string{"set", args[0], args[1]}, " ")
+	if _, err := fmt.Fprintln(conn, request, signHelperRequest(key, challenge, request)); err != nil {
+		return nil, err
+	}
+
+	line, err = reader.ReadString('\n')
+	switch line = strings.TrimSpace(line); {
+	case line == controlOk:
+		return nil, nil
+	case strings.HasPrefix(line, controlErrorPrefix):
+		// The helper's error carries the set command's output, for
+		// classifying as if it had been run here.
+		return []byte(strings.TrimPrefix(line, controlErrorPrefix)), errors.New("the helper could not set the address")
+	case err != nil:
+		return nil, err
+	default:
+		return nil, fmt.Errorf("the helper answered %q", line)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestHelperKeysMustBeKeptFromOthers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no mode bits to check")
+	}
+
+	path := filepath.Join(t.TempDir(), "helper.key")
+	key := make([]byte, keySize)
+	rand.Read(key)
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		perm fs.FileMode
+		ok   bool
+	}{
+		{0o600, true},
+		{0o640, true},
+		{0o644, false},
+		{0o660, false},
+	} {
+		if err := os.Chmod(path, test.perm); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadHelperKey(path, -1, false)
+		if test.ok && err != nil {
+			t.Errorf("a key of mode %04o was refused: %v", test.perm, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("a key of mode %04o was accepted", test.perm)
+		}
+	}
+}
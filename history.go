@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const historySize = 256
+
+// historyEntry is one attempted change, kept in memory so that the API can
+// show recent activity.
+type historyEntry struct {
+	At     time.Time      `json:"at"`
+	Device string         `json:"device"`
+	Mac    rotator.MAC    `json:"mac,omitempty"`
+	Vendor rotator.Vendor `json:"vendor,omitempty"`
+	Error  string         `json:"error,omitempty"`
+
+	// Previous is the address the device had beforehand, whether or not the
+	// change succeeded.
+	Previous rotator.MAC `json:"previous_mac,omitempty"`
+
+	// Trigger is why the change was made: the schedule, starting up, or
+	// whatever requested it early.
+	Trigger string `json:"trigger,omitempty"`
+}
+
+const subscriberBuffer = 16
+
+// history keeps the latest historySize entries across all devices, and
+// passes new ones on to subscribers.
+type history struct {
+	mu          sync.Mutex
+	entries     []historyEntry
+	subscribers map[chan historyEntry]bool
+}
+
+func (h *history) record(entry historyEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = append(h.entries, entry)
+	if historySize < len(h.entries) {
+		h.entries = h.entries[len(h.entries)-historySize:]
+	}
+
+	// A subscriber too slow to keep up misses entries rather than holding
+	// up the rotations.
+	for subscriber := range h.subscribers {
+		select {
+		case subscriber <- entry:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel of new entries, and a function to stop them.
+func (h *history) subscribe() (<-chan historyEntry, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscriber := make(chan historyEntry, subscriberBuffer)
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan historyEntry]bool)
+	}
+	h.subscribers[subscriber] = true
+
+	return subscriber, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers, subscriber)
+	}
+}
+
+// since lists the entries from the given time onwards, oldest first.
+func (h *history) since(at time.Time) []historyEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := []historyEntry{}
+	for _, entry := range h.entries {
+		if !entry.At.Before(at) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (entry historyEntry) String() string {
+	if entry.Error != "" {
+		return fmt.Sprintf(
+			"at=%s device=%s previous_mac=%s error=%q",
+			entry.At.Format(time.RFC3339),
+			entry.Device,
+			entry.Previous,
+			entry.Error,
+		)
+	}
+	return fmt.Sprintf(
+		"at=%s device=%s previous_mac=%s mac=%s vendor=%s",
+		entry.At.Format(time.RFC3339),
+		entry.Device,
+		entry.Previous,
+		entry.Mac,
+		entry.Vendor,
+	)
+}
+
+// parseHistoryTime reads a -at time as RFC 3339, a local date and time, or a
+// local time of day today.
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{time.TimeOnly, "15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time such as 14:32, 2006-01-02 14:32, or RFC 3339", value)
+}
+
+// macAt finds what address the device had at the time from its history,
+// which is the last one it changed to beforehand, or else the one it changed
+// from afterwards.
+func macAt(entries []historyEntry, deviceName string, at time.Time) (historyEntry, bool) {
+	var found historyEntry
+	ok := false
+	for _, entry := range entries {
+		if entry.Device != deviceName || entry.Error != "" {
+			continue
+		}
+		if !entry.At.After(at) {
+			found, ok = entry, true
+			continue
+		}
+		if !ok {
+			return historyEntry{Device: deviceName, Mac: entry.Previous, Vendor: rotator.VendorOf(entry.Previous)}, entry.Previous != ""
+		}
+		break
+	}
+	return found, ok
+}
+
+// runHistory prints the daemon's recent changes, or with -at, each device's
+// address at a given time.
+func runHistory(args []string) error {
+	if len(args) != 0 && args[0] == "query" {
+		return runHistoryQuery(args[1:])
+	}
+
+	flagSet := flag.NewFlagSet("history", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(flagSet.Output(), "Usage: history [-socket path] [-n count] [-at time] [-o text|json] [device...], or history query [flags] [-since time] [-until time] [-vendor name] [-mac address] [device...]")
+		flagSet.PrintDefaults()
+	}
+
+	var socket string
+	var count uint
+	var at string
+	var output string
+
+	flagSet.StringVar(
+		&socket,
+		"socket",
+		defaultControlSocket,
+		"the daemon's control socket",
+	)
+	flagSet.UintVar(
+		&count,
+		"n",
+		50,
+		"the number of most recent changes to show; 0 shows all the daemon remembers",
+	)
+	flagSet.StringVar(
+		&at,
+		"at",
+		"",
+		"show the address each device had at this time, such as 14:32 today, rather than the changes",
+	)
+	flagSet.StringVar(
+		&output,
+		"o",
+		"text",
+		"the output format: text or json",
+	)
+	flagSet.Parse(args)
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	lines, err := requestControl(socket, append([]string{"history", controlJSON}, flagSet.Args()...))
+	if err != nil {
+		return err
+	}
+	entries := make([]historyEntry, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			return fmt.Errorf("the daemon sent an unreadable history entry: %w", err)
+		}
+	}
+
+	if at != "" {
+		t, err := parseHistoryTime(at)
+		if err != nil {
+			return err
+		}
+		var deviceNames []string
+		for _, entry := range entries {
+			if !slices.Contains(deviceNames, entry.Device) {
+				deviceNames = append(deviceNames, entry.Device)
+			}
+		}
+		found := []historyEntry{}
+		for _, deviceName := range deviceNames {
+			if entry, ok := macAt(entries, deviceName, t); ok {
+				found = append(found, entry)
+			}
+		}
+		entries = found
+	} else if count != 0 && count < uint(len(entries)) {
+		entries = entries[uint(len(entries))-count:]
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if at != "" {
+		fmt.Fprintln(out, "DEVICE\tMAC\tVENDOR\tSINCE")
+		for _, entry := range entries {
+			since := "before the daemon's history"
+			if !entry.At.IsZero() {
+				since = entry.At.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", entry.Device, entry.Mac, orDash(string(entry.Vendor)), since)
+		}
+		return out.Flush()
+	}
+
+	fmt.Fprintln(out, "TIME\tDEVICE\tPREVIOUS MAC\tMAC\tVENDOR\tTRIGGER")
+	for _, entry := range entries {
+		mac := string(entry.Mac)
+		if entry.Error != "" {
+			mac = "failed: " + entry.Error
+		}
+		fmt.Fprintf(
+			out,
+			"%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.At.Local().Format(time.DateTime),
+			entry.Device,
+			orDash(string(entry.Previous)),
+			orDash(mac),
+			orDash(string(entry.Vendor)),
+			orDash(entry.Trigger),
+		)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// historyQuery picks out audit records, with zero values matching anything.
+type historyQuery struct {
+	since, until time.Time
+	devices      []string
+	vendor       string
+	mac          rotator.MAC
+}
+
+func (q historyQuery) matches(record auditRecord) bool {
+	switch {
+	case !q.since.IsZero() && record.At.Before(q.since):
+	case !q.until.IsZero() && record.At.After(q.until):
+	case len(q.devices) != 0 && !slices.Contains(q.devices, record.Device):
+	case q.vendor != "" && !strings.EqualFold(string(record.Vendor), q.vendor):
+	case q.mac != "" && record.Mac != q.mac && record.PreviousMac != q.mac:
+	default:
+		return true
+	}
+	return false
+}
+
+// queryAuditLog reads the records matching the query. The log only ever
+// has records appended as they happen, so it is in order of time, which
+// lets a bisection of the file skip straight to the start of the range,
+// serving as its index on time without keeping one.
+func queryAuditLog(path string, q historyQuery) ([]auditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	offset, err := seekAuditLog(file, q.since)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	records := []auditRecord{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if !q.until.IsZero() && record.At.After(q.until) {
+			break
+		}
+		if q.matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// seekAuditLog finds the offset of the first line at or after the time, by
+// bisecting on the offsets whose next line is.
+func seekAuditLog(file *os.File, at time.Time) (int64, error) {
+	if at.IsZero() {
+		return 0, nil
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	low, high := int64(0), info.Size()
+	for low < high {
+		mid := low + (high-low)/2
+		start, record, err := auditLineFrom(file, mid)
+		if err != nil {
+			return 0, err
+		}
+		if start < 0 || !record.At.Before(at) {
+			high = mid
+		} else {
+			// Every offset up to the line's start leads to the same line.
+			low = start + 1
+		}
+	}
+	start, _, err := auditLineFrom(file, low)
+	if err != nil || start < 0 {
+		return info.Size(), err
+	}
+	return start, nil
+}
+
+// auditLineFrom reads the record on the first line starting at or after the
+// offset, giving -1 if there is none.
+func auditLineFrom(file *os.File, offset int64) (int64, auditRecord, error) {
+	var record auditRecord
+	start := offset
+	if offset != 0 {
+		start = offset - 1
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return 0, record, err
+	}
+	reader := bufio.NewReader(file)
+	if offset != 0 {
+		skipped, err := reader.ReadBytes('\n')
+		if err != nil {
+			return -1, record, nil
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadBytes('\n')
+	if len(line) == 0 {
+		return -1, record, nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, record, err
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return 0, record, fmt.Errorf("%s: %w", file.Name(), err)
+	}
+	return start, record, nil
+}
+
+func (record auditRecord) historyEntry() historyEntry {
+	return historyEntry{
+		At:       record.At,
+		Device:   record.Device,
+		Mac:      record.Mac,
+		Vendor:   record.Vendor,
+		Error:    record.Error,
+		Previous: record.PreviousMac,
+		Trigger:  record.Trigger,
+	}
+}
+
+// load fills the daemon's history with the latest changes in the
+// audit log, so that restarting does not forget them.
+func (h *history) load(path string) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		slog.Warn("could not load the history from the audit log", "path", path, "err", err)
+		return
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		entries = append(entries, record.historyEntry())
+		if 2*historySize <= len(entries) {
+			entries = slices.Clone(entries[len(entries)-historySize:])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Warn("could not load the history from the audit log", "path", path, "err", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(entries[max(0, len(entries)-historySize):], h.entries...)
+}
+
+// runHistoryQuery searches every change in the audit log, however long ago,
+// rather than just what the running daemon remembers.
+func runHistoryQuery(args []string) error {
+	flagSet := flag.NewFlagSet("history query", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var q historyQuery
+	var output string
+
+	flagSet.Func(
+		"since",
+		"only show changes from this time onwards, such as 14:32 today, 2006-01-02 14:32, or RFC 3339",
+		func(value string) (err error) {
+			q.since, err = parseHistoryTime(value)
+			return err
+		},
+	)
+	flagSet.Func(
+		"until",
+		"only show changes up to this time",
+		func(value string) (err error) {
+			q.until, err = parseHistoryTime(value)
+			return err
+		},
+	)
+	flagSet.StringVar(
+		&q.vendor,
+		"vendor",
+		"",
+		"only show changes to addresses of this vendor, such as Intel",
+	)
+	flagSet.Func(
+		"mac",
+		"only show changes to or from this address",
+		func(value string) error {
+			addr, err := net.ParseMAC(value)
+			if err != nil {
+				return err
+			}
+			q.mac = rotator.MAC(addr.String())
+			return nil
+		},
+	)
+	flagSet.StringVar(
+		&output,
+		"o",
+		"text",
+		"the output format: text or json",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	q.devices = flagSet.Args()
+
+	records, err := queryAuditLog(auditLogPath(*flags), q)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "TIME\tDEVICE\tPREVIOUS MAC\tMAC\tVENDOR\tTRIGGER")
+	for _, record := range records {
+		mac := string(record.Mac)
+		if record.Error != "" {
+			mac = "failed: " + record.Error
+		}
+		fmt.Fprintf(
+			out,
+			"%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.At.Local().Format(time.DateTime),
+			record.Device,
+			orDash(string(record.PreviousMac)),
+			orDash(mac),
+			orDash(string(record.Vendor)),
+			orDash(record.Trigger),
+		)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const defaultHookTimeoutSecs = 30
+
+// hookFailurePolicy decides what a failing -pre-hook does to the rotation it
+// comes before: warn goes ahead with it anyway, and skip leaves the address
+// as it is until the next one. A failing -post-hook can only be warned about.
+type hookFailurePolicy string
+
+const (
+	hookFailureWarn hookFailurePolicy = "warn"
+	hookFailureSkip                   = "skip"
+)
+
+func parseHookFailurePolicy(value string) (hookFailurePolicy, error) {
+	switch policy := hookFailurePolicy(value); policy {
+	case hookFailureWarn, hookFailureSkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown hook failure policy %q", value)
+	}
+}
+
+// runHook runs the executable with the details of the change in its
+// environment, killing it if it outlives the timeout.
+func (r *rotation) runHook(ctx context.Context, settings settings, hook, path string, env []string) error {
+	logger := r.logger.With("hook", hook, "path", path)
+	if settings.dryRun {
+		logger.Info("would run a hook", "env", strings.Join(env, " "))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.hookTimeoutSecs)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+
+	trimmed := strings.TrimSpace(string(out))
+	logger.Debug("ran a hook", "output", trimmed, "err", err)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %d seconds", settings.hookTimeoutSecs)
+	}
+	if err != nil && trimmed != "" {
+		return fmt.Errorf("%w: %s", err, trimmed)
+	}
+	return err
+}
+
+// runPreHook reports whether the rotation should go ahead.
+func (r *rotation) runPreHook(ctx context.Context, settings settings, trigger string) bool {
+	if settings.preHook == "" {
+		return true
+	}
+
+	current, _ := rotator.CurrentMAC(r.deviceName)
+	env := []string{
+		"HOOK=pre",
+		"DEVICE=" + r.deviceName,
+		"OLD_MAC=" + string(current),
+		"TRIGGER=" + trigger,
+	}
+	span := startSpan(ctx, "pre-hook")
+	err := r.runHook(ctx, settings, "pre", settings.preHook, env)
+	span.end(err)
+	if err == nil {
+		return true
+	}
+
+	if settings.hookFailure == hookFailureSkip {
+		r.logger.Warn("skipping the rotation as the pre-hook failed", "err", err)
+		return false
+	}
+	r.logger.Warn("the pre-hook failed; rotating anyway", "err", err)
+	return true
+}
+
+func (r *rotation) runPostHook(ctx context.Context, settings settings, trigger string, change macChange) {
+	if settings.postHook == "" {
+		return
+	}
+
+	env := []string{
+		"HOOK=post",
+		"DEVICE=" + r.deviceName,
+		"TRIGGER=" + trigger,
+	}
+	switch change := change.(type) {
+	case *successfulMacChange:
+		env = append(
+			env,
+			"OLD_MAC="+string(change.previous),
+			"NEW_MAC="+string(change.mac),
+			"VENDOR="+string(change.vendor),
+			"RESULT=succeeded",
+		)
+	case *failedMacChange:
+		env = append(
+			env,
+			"OLD_MAC="+string(change.previous),
+			"RESULT=failed",
+			"ERROR="+change.err.Error(),
+		)
+	}
+
+	// Hooks should still hear of a change cut short by stopping.
+	span := startSpan(ctx, "post-hook")
+	err := r.runHook(context.WithoutCancel(ctx), settings, "post", settings.postHook, env)
+	span.end(err)
+	if err != nil {
+		r.logger.Warn("the post-hook failed", "err", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// maxHostnameLen is the longest a single DNS label, and so a hostname that
+// DHCP clients send, can be.
+const maxHostnameLen = 63
+
+// defaultHostnameWords are common enough as hostnames to blend in with, for
+// the * in a -hostname-pattern when no -hostname-words are given.
+var defaultHostnameWords = []string{
+	"android", "desktop", "galaxy", "ipad", "iphone", "laptop", "macbook",
+	"pixel", "surface", "thinkpad", "workstation", "xps",
+}
+
+// isHostnameChar says whether the character can appear in a hostname that
+// every DHCP server and resolver accepts.
+func isHostnameChar(c rune) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-'
+}
+
+// parseHostnamePattern checks that a -hostname-pattern can only make valid
+// hostnames: # becomes a random digit, ? a random letter, and * a random word,
+// with anything else kept as it is.
+func parseHostnamePattern(value string) (string, error) {
+	for _, c := range value {
+		if !isHostnameChar(c) && c != '#' && c != '?' && c != '*' {
+			return "", fmt.Errorf("hostname pattern %q has %q, which is not allowed in hostnames", value, c)
+		}
+	}
+	if strings.HasPrefix(value, "-") {
+		return "", fmt.Errorf("hostname pattern %q cannot start with a hyphen", value)
+	}
+	return value, nil
+}
+
+func readHostnameWords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		if strings.IndexFunc(word, func(c rune) bool { return !isHostnameChar(c) }) != -1 {
+			return nil, fmt.Errorf("%s: %q is not allowed in hostnames", path, word)
+		}
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%s has no words", path)
+	}
+	return words, nil
+}
+
+func generateHostname(rng *rand.Rand, pattern string, words []string) string {
+	if len(words) == 0 {
+		words = defaultHostnameWords
+	}
+
+	var hostname strings.Builder
+	for _, c := range pattern {
+		switch c {
+		case '#':
+			hostname.WriteByte(byte('0' + rng.Intn(10)))
+		case '?':
+			hostname.WriteByte(byte('a' + rng.Intn(26)))
+		case '*':
+			hostname.WriteString(words[rng.Intn(len(words))])
+		default:
+			hostname.WriteRune(c)
+		}
+	}
+
+	name := hostname.String()
+	return strings.TrimRight(name[:min(len(name), maxHostnameLen)], "-")
+}
+
+// rotateHostname gives the machine a fresh transient hostname alongside each
+// new address, since the hostname that DHCP clients send would otherwise tie
+// the new address straight back to the old one. The hostname is the
+// machine's rather than the device's, so with several devices it changes
+// whenever any of them does.
+func (r *rotation) rotateHostname(settings settings) {
+	if settings.hostnamePattern == "" {
+		return
+	}
+
+	hostname := generateHostname(r.rng, settings.hostnamePattern, settings.hostnameWords)
+	if settings.dryRun {
+		r.logger.Info("would change the hostname", "hostname", hostname)
+		return
+	}
+	if err := setHostname(hostname); err != nil {
+		r.logger.Warn("could not change the hostname", "hostname", hostname, "err", err)
+		return
+	}
+	r.logger.Info("changed the hostname", "hostname", hostname)
+}
+
+// restoreHostname puts back the hostname the machine had before rotating.
+func restoreHostname(flags flags, original string) {
+	if flags.hostnamePattern == "" || original == "" || flags.dryRun {
+		return
+	}
+
+	if err := setHostname(original); err != nil {
+		slog.Error("could not restore the hostname", "hostname", original, "err", err)
+		return
+	}
+	slog.Info("restored the hostname", "hostname", original)
+}
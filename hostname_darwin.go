@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// setHostname changes the HostName preference, which DHCP and the shell
+// prompt use; the ComputerName and LocalHostName that users set stay as they
+// are.
+func setHostname(hostname string) error {
+	if out, err := exec.Command("scutil", "--set", "HostName", hostname).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// setHostname changes only the transient hostname where systemd-hostnamed
+// runs, leaving the static one to come back on reboot, and falls back to the
+// hostname command, which is just as transient, where it does not.
+func setHostname(hostname string) error {
+	prog, args := "hostnamectl", []string{"set-hostname", "--transient", hostname}
+	if _, err := exec.LookPath(prog); err != nil {
+		prog, args = "hostname", []string{hostname}
+	}
+
+	if out, err := exec.Command(prog, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// setHostname is refused, as renaming a Windows machine only takes effect on
+// reboot, which is hardly in lockstep with its address.
+func setHostname(string) error {
+	return errors.New("the hostname cannot be changed without a reboot on Windows")
+}
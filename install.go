@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// serviceArgs are the flags an installed service should run with: those given
+// to the installer, minus ones that make no sense for a supervised process or
+// that the installer itself handles.
+func serviceArgs(flagSet *flag.FlagSet, args []string, skipped ...string) []string {
+	skipped = append(skipped, "daemon", "pid-file", "daemon-log")
+
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		f := flagSet.Lookup(name)
+		takesValue := f != nil && !isBoolFlag(f) && !hasValue
+
+		if slices.Contains(skipped, name) {
+			if takesValue {
+				i++
+			}
+			continue
+		}
+
+		kept = append(kept, arg)
+		if takesValue && i+1 < len(args) {
+			i++
+			kept = append(kept, args[i])
+		}
+	}
+	return kept
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// installedExecutable is where services should find the running program,
+// resolved so that they keep working if a symlink to it later moves.
+func installedExecutable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const (
+	launchdLabel          = "com.gitlab.louis-jackman.rotate-mac-address"
+	defaultLaunchdDir     = "/Library/LaunchDaemons"
+	defaultLaunchdLogPath = "/var/log/rotate-mac-address.log"
+	launchdPlistPerm      = 0o644
+)
+
+var launchdPlist = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, []byte(s))
+		return escaped.String()
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+{{- range .ProgramArguments}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogPath}}</string>
+</dict>
+</plist>
+`))
+
+func launchdPlistPath(dir string) string {
+	return filepath.Join(dir, launchdLabel+".plist")
+}
+
+// runInstallLaunchd writes a LaunchDaemon running the daemon with the given
+// flags, then loads it so that it starts now and at every boot.
+func runInstallLaunchd(args []string) error {
+	flagSet := flag.NewFlagSet("install-launchd", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var launchdDir string
+	var logPath string
+	var printOnly bool
+
+	flagSet.StringVar(
+		&launchdDir,
+		"launchd-dir",
+		defaultLaunchdDir,
+		"the directory in which to write the property list",
+	)
+	flagSet.StringVar(
+		&logPath,
+		"log-path",
+		defaultLaunchdLogPath,
+		"where launchd sends the log",
+	)
+	flagSet.BoolVar(
+		&printOnly,
+		"print",
+		false,
+		"print the property list instead of installing it",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	executable, err := installedExecutable()
+	if err != nil {
+		return err
+	}
+
+	programArgs := append(
+		[]string{executable},
+		serviceArgs(flagSet, args, "launchd-dir", "log-path", "print")...,
+	)
+
+	var plist strings.Builder
+	err = launchdPlist.Execute(&plist, struct {
+		Label            string
+		ProgramArguments []string
+		LogPath          string
+	}{launchdLabel, programArgs, logPath})
+	if err != nil {
+		return err
+	}
+
+	if printOnly {
+		fmt.Print(plist.String())
+		return nil
+	}
+
+	path := launchdPlistPath(launchdDir)
+
+	// Replace any earlier installation, which launchd would otherwise keep
+	// running with its old flags.
+	if _, err := os.Stat(path); err == nil {
+		runLaunchctl("bootout", "system/"+launchdLabel)
+	}
+
+	if err := os.WriteFile(path, []byte(plist.String()), launchdPlistPerm); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", path)
+
+	if err := runLaunchctl("bootstrap", "system", path); err != nil {
+		return err
+	}
+	fmt.Printf("loaded %s\n", launchdLabel)
+	return nil
+}
+
+// runUninstallLaunchd stops the LaunchDaemon and removes its property list.
+func runUninstallLaunchd(args []string) error {
+	flagSet := flag.NewFlagSet("uninstall-launchd", flag.ExitOnError)
+
+	var launchdDir string
+	flagSet.StringVar(
+		&launchdDir,
+		"launchd-dir",
+		defaultLaunchdDir,
+		"the directory the property list was written to",
+	)
+	flagSet.Parse(args)
+
+	path := launchdPlistPath(launchdDir)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s is not installed", path)
+	}
+
+	if err := runLaunchctl("bootout", "system/"+launchdLabel); err != nil {
+		fmt.Fprintf(os.Stderr, "could not unload %s, so removing it anyway: %s\n", launchdLabel, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Printf("removed %s\n", path)
+	return nil
+}
+
+func runLaunchctl(args ...string) error {
+	cmd := exec.Command("launchctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("launchctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultOpenrcScript  = "/etc/init.d/rotate-mac-address"
+	defaultOpenrcLogPath = "/var/log/rotate-mac-address.log"
+	openrcScriptPerm     = 0o755
+)
+
+// openrcScript has supervise-daemon respawn the daemon if it dies, and orders
+// it before networking so the first address is random too.
+var openrcScript = template.Must(template.New("script").Parse(`#!/sbin/openrc-run
+
+description="Rotate MAC addresses on an interval"
+
+supervisor=supervise-daemon
+command={{.Command}}
+# OpenRC evaluates this, so each argument is quoted again within it.
+command_args={{.CommandArgs}}
+output_log={{.LogPath}}
+error_log={{.LogPath}}
+respawn_delay=5
+respawn_max=0
+
+depend() {
+	need localmount
+	after bootmisc
+	before net
+}
+`))
+
+// shellQuote quotes an argument for a POSIX shell.
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// runInstallOpenrc writes an init script running the daemon with the given
+// flags, adds it to the default runlevel, and starts it.
+func runInstallOpenrc(args []string) error {
+	flagSet := flag.NewFlagSet("install-openrc", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var scriptPath string
+	var logPath string
+	var printOnly bool
+
+	flagSet.StringVar(
+		&scriptPath,
+		"script",
+		defaultOpenrcScript,
+		"where to write the init script",
+	)
+	flagSet.StringVar(
+		&logPath,
+		"log-path",
+		defaultOpenrcLogPath,
+		"where supervise-daemon sends the log",
+	)
+	flagSet.BoolVar(
+		&printOnly,
+		"print",
+		false,
+		"print the init script instead of installing it",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	executable, err := installedExecutable()
+	if err != nil {
+		return err
+	}
+
+	commandArgs := serviceArgs(flagSet, args, "script", "log-path", "print")
+
+	var script strings.Builder
+	err = openrcScript.Execute(&script, struct {
+		Command     string
+		CommandArgs string
+		LogPath     string
+	}{
+		shellQuote(executable),
+		shellDoubleQuote(strings.Join(quoteAll(commandArgs), " ")),
+		shellQuote(logPath),
+	})
+	if err != nil {
+		return err
+	}
+
+	if printOnly {
+		fmt.Print(script.String())
+		return nil
+	}
+
+	if err := os.WriteFile(scriptPath, []byte(script.String()), openrcScriptPerm); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", scriptPath)
+
+	name := strings.TrimPrefix(scriptPath, "/etc/init.d/")
+	if err := runOpenrcCmd("rc-update", "add", name, "default"); err != nil {
+		return err
+	}
+	if err := runOpenrcCmd("rc-service", name, "restart"); err != nil {
+		return err
+	}
+	fmt.Printf("added %s to the default runlevel and started it\n", name)
+	return nil
+}
+
+// shellDoubleQuote quotes a string for a POSIX shell, leaving any single quotes
+// in it easy to read.
+func shellDoubleQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s) + `"`
+}
+
+func quoteAll(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return quoted
+}
+
+func runOpenrcCmd(prog string, args ...string) error {
+	cmd := exec.Command(prog, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", prog, strings.Join(args, " "), err)
+	}
+	return nil
+}
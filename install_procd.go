@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const defaultProcdScript = "/etc/init.d/rotate-mac-address"
+
+// procdScript has procd respawn the daemon if it dies, and starts it just
+// before netifd's network script, so the first address is random too. procd
+// passes its log on to logd.
+var procdScript = template.Must(template.New("script").Parse(`#!/bin/sh /etc/rc.common
+
+START=19
+STOP=90
+USE_PROCD=1
+
+start_service() {
+	procd_open_instance
+	procd_set_param command {{.Command}}
+	procd_set_param respawn 3600 5 0
+	procd_set_param stdout 1
+	procd_set_param stderr 1
+	procd_close_instance
+}
+`))
+
+// runInstallProcd writes an OpenWrt init script running the daemon with the
+// given flags under procd, enables it, and starts it.
+func runInstallProcd(args []string) error {
+	flagSet := flag.NewFlagSet("install-procd", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var scriptPath string
+	var printOnly bool
+
+	flagSet.StringVar(
+		&scriptPath,
+		"script",
+		defaultProcdScript,
+		"where to write the init script",
+	)
+	flagSet.BoolVar(
+		&printOnly,
+		"print",
+		false,
+		"print the init script instead of installing it",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	executable, err := installedExecutable()
+	if err != nil {
+		return err
+	}
+
+	command := append([]string{executable}, serviceArgs(flagSet, args, "script", "print")...)
+
+	var script strings.Builder
+	err = procdScript.Execute(&script, struct{ Command string }{strings.Join(quoteAll(command), " ")})
+	if err != nil {
+		return err
+	}
+
+	if printOnly {
+		fmt.Print(script.String())
+		return nil
+	}
+
+	if err := os.WriteFile(scriptPath, []byte(script.String()), openrcScriptPerm); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", scriptPath)
+
+	if err := runOpenrcCmd(scriptPath, "enable"); err != nil {
+		return err
+	}
+	if err := runOpenrcCmd(scriptPath, "restart"); err != nil {
+		return err
+	}
+	fmt.Printf("enabled %s and started it\n", scriptPath)
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	defaultSystemdUnitDir = "/etc/systemd/system"
+	systemdUnitName       = "rotate-mac-address@.service"
+	systemdOnceUnitName   = "rotate-mac-address-once@.service"
+	systemdTimerName      = "rotate-mac-address-once@.timer"
+	systemdUnitPerm       = 0o644
+	systemdControlSocket  = "/run/rotate-mac-address/%I/control.sock"
+)
+
+// systemdUnit is a template unit with the device as its instance, so that
+// each device is supervised, and can be stopped, on its own. With -timer, it
+// is instead a oneshot rotating the device once each time its timer fires.
+var systemdUnit = template.Must(template.New("unit").Parse(`[Unit]
+Description=Rotate the MAC address of %i
+BindsTo=sys-subsystem-net-devices-%i.device
+After=sys-subsystem-net-devices-%i.device
+{{- if not .Oneshot}}
+Before=network-pre.target
+Wants=network-pre.target
+{{- end}}
+
+[Service]
+{{- if .Oneshot}}
+Type=oneshot
+ExecStart={{.ExecStart}}
+StateDirectory=rotate-mac-address
+{{- else}}
+Type=notify
+NotifyAccess=main
+ExecStart={{.ExecStart}}
+Restart=on-failure
+# Restarting cannot fix bad flags, missing privileges, or missing tools.
+RestartPreventExitStatus={{range $i, $code := .PermanentExitCodes}}{{if $i}} {{end}}{{$code}}{{end}}
+WatchdogSec=2min
+StateDirectory=rotate-mac-address
+RuntimeDirectory=rotate-mac-address/%i
+{{- end}}
+
+CapabilityBoundingSet=CAP_NET_ADMIN{{range .Capabilities}} {{.}}{{end}}
+NoNewPrivileges=yes
+ProtectSystem=strict
+# Desktop notifications go through the session buses in /run/user.
+ProtectHome={{if .NotifiesDesktop}}read-only{{else}}yes{{end}}
+# Not PrivateTmp, as wpa_supplicant replies to a socket bound in /tmp.
+ReadWritePaths=/tmp{{range .ReadWritePaths}} {{.}}{{end}}
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+RestrictAddressFamilies=AF_UNIX AF_NETLINK AF_INET AF_INET6
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+{{- if not .Oneshot}}
+
+[Install]
+WantedBy=multi-user.target
+{{- end}}
+`))
+
+// systemdTimer fires the oneshot unit of a device around each cycle, varying
+// each gap as the bounded schedule does, as RandomizedDelaySec= delays each
+// firing by up to its value.
+var systemdTimer = template.Must(template.New("timer").Parse(`[Unit]
+Description=Rotate the MAC address of %i on a randomised schedule
+
+[Timer]
+OnActiveSec=0
+OnUnitActiveSec={{.MinGapSecs}}s
+RandomizedDelaySec={{.SpreadSecs}}s
+AccuracySec=1s
+
+[Install]
+WantedBy=timers.target
+`))
+
+// systemdQuote quotes an argument for ExecStart, escaping the specifiers and
+// variables that systemd would otherwise expand.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// runInstallSystemd writes a unit running the daemon with the given flags,
+// then enables and starts an instance of it for each device. With -timer, it
+// writes a oneshot unit rotating once and a timer running it, leaving systemd
+// to schedule the rotations with no process left running between them.
+func runInstallSystemd(args []string) error {
+	flagSet := flag.NewFlagSet("install-systemd", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var unitDir string
+	var printOnly, timer bool
+
+	flagSet.StringVar(
+		&unitDir,
+		"unit-dir",
+		defaultSystemdUnitDir,
+		"the directory in which to write the unit",
+	)
+	flagSet.BoolVar(
+		&printOnly,
+		"print",
+		false,
+		"print the unit instead of installing it",
+	)
+	flagSet.BoolVar(
+		&timer,
+		"timer",
+		false,
+		"install a timer running a oneshot unit that rotates once per -cycle-secs, rather than a long-running daemon",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	executable, err := installedExecutable()
+	if err != nil {
+		return err
+	}
+
+	if timer && flags.cycleSecs == 0 {
+		return errors.New("-timer needs a -cycle-secs to fire the timer on")
+	}
+
+	execStart := []string{systemdQuote(executable)}
+	if timer {
+		execStart = append(execStart, "once")
+	}
+	execStart = append(execStart, "-device-name", "%I")
+	for _, arg := range serviceArgs(flagSet, args, "device-name", "unit-dir", "print", "timer") {
+		execStart = append(execStart, systemdQuote(arg))
+	}
+
+	// Give each instance its own control socket, as they can't share one.
+	controlSocketSet := false
+	flagSet.Visit(func(f *flag.Flag) {
+		controlSocketSet = controlSocketSet || f.Name == "control-socket"
+	})
+	if !controlSocketSet && !timer {
+		execStart = append(execStart, "-control-socket", systemdControlSocket)
+	}
+
+	var readWritePaths []string
+	if flags.stateDir != defaultStateDir {
+		readWritePaths = append(readWritePaths, systemdQuote(flags.stateDir))
+	}
+
+	// Dropping privileges needs to change users and hand over the state,
+	// whereas notifying desktops needs to act as each user logged in.
+	var capabilities []string
+	if flags.user != "" {
+		capabilities = append(capabilities, "CAP_SETUID", "CAP_SETGID", "CAP_CHOWN")
+	} else if flags.desktopNotifications != desktopNever {
+		capabilities = append(capabilities, "CAP_SETUID", "CAP_SETGID")
+	}
+
+	var unit strings.Builder
+	err = systemdUnit.Execute(&unit, struct {
+		ExecStart       string
+		ReadWritePaths  []string
+		Capabilities    []string
+		NotifiesDesktop bool
+		Oneshot         bool
+
+		PermanentExitCodes []int
+	}{
+		strings.Join(execStart, " "),
+		readWritePaths,
+		capabilities,
+		flags.desktopNotifications != desktopNever,
+		timer,
+		[]int{rotator.ExitUsage, rotator.ExitPrivileges, rotator.ExitMissingTool},
+	})
+	if err != nil {
+		return err
+	}
+
+	units := []struct{ name, text string }{{systemdUnitName, unit.String()}}
+	enabled := systemdUnitName
+	if timer {
+		var timerUnit strings.Builder
+		spreadSecs := uint(float64(flags.cycleSecs) * flags.variance)
+		err := systemdTimer.Execute(&timerUnit, struct {
+			MinGapSecs uint
+			SpreadSecs uint
+		}{max(1, flags.cycleSecs-spreadSecs/2), spreadSecs})
+		if err != nil {
+			return err
+		}
+		units = []struct{ name, text string }{
+			{systemdOnceUnitName, unit.String()},
+			{systemdTimerName, timerUnit.String()},
+		}
+		enabled = systemdTimerName
+	}
+
+	if printOnly {
+		for i, unit := range units {
+			if 1 < len(units) {
+				if i != 0 {
+					fmt.Println()
+				}
+				fmt.Printf("# %s\n", unit.name)
+			}
+			fmt.Print(unit.text)
+		}
+		return nil
+	}
+
+	for _, unit := range units {
+		path := filepath.Join(unitDir, unit.name)
+		if err := os.WriteFile(path, []byte(unit.text), systemdUnitPerm); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s\n", path)
+	}
+
+	if err := runSystemctl("daemon-reload"); err != nil {
+		return err
+	}
+	for _, deviceName := range flags.deviceNames {
+		instance := strings.Replace(enabled, "@", "@"+deviceName, 1)
+		if err := runSystemctl("enable", "--now", instance); err != nil {
+			return err
+		}
+		fmt.Printf("enabled and started %s\n", instance)
+	}
+	return nil
+}
+
+func runSystemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// deviceListing is what is worth knowing about a device before configuring
+// its rotation.
+type deviceListing struct {
+	Name         string      `json:"name"`
+	Type         string      `json:"type"`
+	Driver       string      `json:"driver,omitempty"`
+	Up           bool        `json:"up"`
+	Mac          rotator.MAC `json:"mac,omitempty"`
+	PermanentMac rotator.MAC `json:"permanent_mac,omitempty"`
+	Eligible     bool        `json:"eligible"`
+
+	// Changeable is "yes", "no", or why it is unknown, such as lacking the
+	// privileges to try.
+	Changeable string `json:"changeable"`
+}
+
+func listDevice(flags flags, iface net.Interface, tryDrivers bool) deviceListing {
+	listing := deviceListing{
+		Name:     iface.Name,
+		Type:     deviceType(iface.Name),
+		Driver:   deviceDriver(iface.Name),
+		Up:       iface.Flags&net.FlagUp != 0,
+		Mac:      rotator.MAC(iface.HardwareAddr.String()),
+		Eligible: iface.Flags&net.FlagLoopback == 0 && len(iface.HardwareAddr) == 6,
+	}
+	if iface.Flags&net.FlagLoopback != 0 {
+		listing.Type = "loopback"
+	}
+	if permanent, err := permanentMac(iface.Name); err == nil {
+		listing.PermanentMac = permanent
+	}
+
+	switch {
+	case !listing.Eligible:
+		listing.Changeable = "no"
+	case !tryDrivers:
+		listing.Changeable = "unknown without privileges"
+	default:
+		switch d := diagnoseDriver(flags, iface.Name); {
+		case d.ok:
+			listing.Changeable = "yes"
+		case d.skipped:
+			listing.Changeable = "unknown, " + d.detail
+		default:
+			listing.Changeable = "no"
+		}
+	}
+	return listing
+}
+
+// runListInterfaces describes every device, or just those named, along with
+// whether each can be rotated. Finding out whether drivers accept new
+// addresses means setting their current ones again, which needs the usual
+// privileges.
+func runListInterfaces(args []string) error {
+	flagSet := flag.NewFlagSet("list-interfaces", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var output string
+	flagSet.StringVar(
+		&output,
+		"o",
+		"text",
+		"the output format: text or json",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	tryDrivers := checkPrivileges(*flags) == nil
+
+	var listings []deviceListing
+	for _, iface := range ifaces {
+		if flagSet.NArg() == 0 || slices.Contains(flagSet.Args(), iface.Name) {
+			listings = append(listings, listDevice(*flags, iface, tryDrivers))
+		}
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listings)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "NAME\tTYPE\tDRIVER\tSTATE\tMAC\tPERMANENT MAC\tCHANGEABLE")
+	for _, listing := range listings {
+		state := "down"
+		if listing.Up {
+			state = "up"
+		}
+		fmt.Fprintf(
+			out,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			listing.Name,
+			listing.Type,
+			orDash(listing.Driver),
+			state,
+			orDash(string(listing.Mac)),
+			orDash(string(listing.PermanentMac)),
+			listing.Changeable,
+		)
+	}
+	return out.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	ipv4WaitTimeout      = 30 * time.Second
+	ipv4WaitPollInterval = time.Second
+)
+
+// ipv4Of gives the device's first IPv4 address, or nothing if it has none.
+func ipv4Of(deviceName string) string {
+	iface, err := net.InterfaceByName(deviceName)
+	if err != nil {
+		return ""
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+	return ""
+}
+
+// checkIPv4 makes sure that a device that had an IPv4 address before a
+// change still has one after it, waiting for DHCP, and warns when it came
+// off the original address with a different IPv4 one, as a DHCP reservation
+// keyed to the original address no longer applies. The result goes into the
+// status and the -output events, rather than being left for someone to
+// notice they are offline.
+func (r *rotation) checkIPv4(ctx context.Context, settings settings, before string, change *successfulMacChange) {
+	if before == "" || settings.dryRun {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ipv4WaitTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(ipv4WaitPollInterval)
+	defer ticker.Stop()
+
+	after := ipv4Of(r.deviceName)
+	for after == "" {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			after = ipv4Of(r.deviceName)
+			continue
+		}
+		break
+	}
+
+	warning := ""
+	switch {
+	case after == "":
+		warning = fmt.Sprintf("the device has had no IPv4 address since the change, having had %s before it, so may be offline", before)
+	case after != before && change.previous != "" && change.previous == r.currentStatus().originalMac:
+		warning = fmt.Sprintf("the device's IPv4 address changed from %s to %s, so any DHCP reservation for its original address no longer applies", before, after)
+	}
+
+	r.mu.Lock()
+	r.status.ipv4 = after
+	r.status.ipv4Warning = warning
+	r.mu.Unlock()
+
+	event := outputEvent{Event: eventAddress, Device: r.deviceName, IPv4: after, PreviousIPv4: before, Error: warning}
+	events.emit(event)
+	if warning != "" {
+		r.logger.Warn("the device's IPv4 address did not carry over", "reason", warning, "ipv4", after, "previous_ipv4", before)
+		return
+	}
+	r.logger.Debug("the device has an IPv4 address after the change", "ipv4", after, "previous_ipv4", before)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// eui64 is the modified EUI-64 interface identifier that SLAAC derives from an
+// address, the last half of every IPv6 address it generates with it.
+func eui64(mac rotator.MAC) []byte {
+	hardwareAddr, err := net.ParseMAC(string(mac))
+	if err != nil || len(hardwareAddr) != 6 {
+		return nil
+	}
+	return []byte{
+		hardwareAddr[0] ^ 0x02, hardwareAddr[1], hardwareAddr[2], 0xff,
+		0xfe, hardwareAddr[3], hardwareAddr[4], hardwareAddr[5],
+	}
+}
+
+// regenerateIPv6 replaces the IPv6 addresses derived from the device's old
+// address, which would otherwise give away its old identity for as long as
+// the kernel keeps them, with ones derived from its new address.
+func (r *rotation) regenerateIPv6(settings settings, previous rotator.MAC) {
+	if !settings.regenerateIPv6 {
+		return
+	}
+	if settings.dryRun {
+		r.logger.Info("would regenerate the IPv6 addresses", "old_mac", previous)
+		return
+	}
+
+	if err := regenerateIPv6(r.deviceName, previous); err != nil {
+		r.logger.Warn("could not regenerate the IPv6 addresses", "err", err)
+		return
+	}
+	r.logger.Info("regenerated the IPv6 addresses")
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// regenerateIPv6 has configd restart IPv6 configuration for the device, which
+// regenerates its link-local address and solicits routers afresh.
+func regenerateIPv6(deviceName string, _ rotator.MAC) error {
+	if out, err := exec.Command("ipconfig", "set", deviceName, "AUTOMATIC-V6").CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const icmpv6RouterSolicitation = 133
+
+// allRouters is the multicast group that routers listen for solicitations on.
+var allRouters = net.ParseIP("ff02::2")
+
+// regenerateIPv6 deletes the addresses with the old address's EUI-64
+// interface identifier, adds a link-local address with the new one if it
+// deleted the old, and solicits router advertisements so SLAAC derives
+// global addresses afresh. Devices generating stable-privacy or temporary
+// addresses have none derived from their address, so are left as they are.
+func regenerateIPv6(deviceName string, previous rotator.MAC) error {
+	iface, err := net.InterfaceByName(deviceName)
+	if err != nil {
+		return err
+	}
+	oldID := eui64(previous)
+	newID := eui64(rotator.MAC(iface.HardwareAddr.String()))
+	if oldID == nil || newID == nil {
+		return fmt.Errorf("%s has no Ethernet address to derive IPv6 addresses from", deviceName)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	deletedLinkLocal := false
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() != nil || !bytes.Equal(ipNet.IP[8:], oldID) {
+			continue
+		}
+		if err := runIP("-6", "addr", "del", ipNet.String(), "dev", deviceName); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ipNet.IP.IsLinkLocalUnicast() {
+			deletedLinkLocal = true
+		}
+	}
+
+	if deletedLinkLocal {
+		linkLocal := append(net.IP{0xfe, 0x80, 0, 0, 0, 0, 0, 0}, newID...)
+		if err := runIP("-6", "addr", "add", linkLocal.String()+"/64", "dev", deviceName, "scope", "link"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Solicitations from the unspecified address must leave out the source
+	// link-layer option, and the new link-local address is too fresh to send
+	// from.
+	solicitation := []byte{icmpv6RouterSolicitation, 0, 0, 0, 0, 0, 0, 0}
+	errs = append(errs, sendNeighborDiscovery(iface, nil, allRouters, solicitation))
+
+	return errors.Join(errs...)
+}
+
+func runIP(args ...string) error {
+	if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ip %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+func regenerateIPv6(string, rotator.MAC) error {
+	return errors.New("IPv6 addresses can only be regenerated on Linux and macOS")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalFieldNames overrides the field names that would otherwise be derived
+// from attribute keys, for the sake of fields that read well together.
+var journalFieldNames = map[string]string{
+	"old_mac": "MAC_OLD",
+	"new_mac": "MAC_NEW",
+}
+
+// stderrIsJournal reports whether systemd connected stderr to the journal,
+// as it notes in JOURNAL_STREAM, rather than it having been redirected since.
+func stderrIsJournal() bool {
+	var dev, ino uint64
+	if _, err := fmt.Sscanf(os.Getenv("JOURNAL_STREAM"), "%d:%d", &dev, &ino); err != nil {
+		return false
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(int(os.Stderr.Fd()), &stat); err != nil {
+		return false
+	}
+	return uint64(stat.Dev) == dev && uint64(stat.Ino) == ino
+}
+
+// journalHandler writes records to the journal natively, with each attribute
+// as a field of its own, so that they can be matched and exported as such.
+type journalHandler struct {
+	conn    net.Conn
+	options *slog.HandlerOptions
+	fields  []byte
+	prefix  string
+}
+
+func newJournalHandler(options *slog.HandlerOptions) (slog.Handler, error) {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the journal: %w", err)
+	}
+	return &journalHandler{conn: conn, options: options}, nil
+}
+
+func (h *journalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minimum := slog.LevelInfo
+	if h.options.Level != nil {
+		minimum = h.options.Level.Level()
+	}
+	return minimum <= level
+}
+
+func (h *journalHandler) Handle(_ context.Context, record slog.Record) error {
+	entry := appendJournalField(nil, "MESSAGE", record.Message)
+	entry = appendJournalField(entry, "PRIORITY", strconv.Itoa(syslogSeverity(record.Level)))
+	entry = appendJournalField(entry, "SYSLOG_IDENTIFIER", syslogAppName)
+	entry = append(entry, h.fields...)
+	record.Attrs(func(attr slog.Attr) bool {
+		entry = appendJournalAttr(entry, h.prefix, attr)
+		return true
+	})
+
+	_, err := h.conn.Write(entry)
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := h.fields[:len(h.fields):len(h.fields)]
+	for _, attr := range attrs {
+		fields = appendJournalAttr(fields, h.prefix, attr)
+	}
+	return &journalHandler{h.conn, h.options, fields, h.prefix}
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	return &journalHandler{h.conn, h.options, h.fields, h.prefix + name + "_"}
+}
+
+func appendJournalAttr(entry []byte, prefix string, attr slog.Attr) []byte {
+	value := attr.Value.Resolve()
+	if attr.Key == "" {
+		return entry
+	}
+
+	switch value.Kind() {
+	case slog.KindGroup:
+		for _, member := range value.Group() {
+			entry = appendJournalAttr(entry, prefix+attr.Key+"_", member)
+		}
+		return entry
+	case slog.KindTime:
+		return appendJournalField(entry, journalFieldName(prefix+attr.Key), value.Time().Format(time.RFC3339Nano))
+	default:
+		return appendJournalField(entry, journalFieldName(prefix+attr.Key), value.String())
+	}
+}
+
+// journalFieldName upper-cases a key, replacing anything the journal doesn't
+// allow in field names.
+func journalFieldName(key string) string {
+	if name, ok := journalFieldNames[key]; ok {
+		return name
+	}
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	return strings.TrimLeft(name, "_0123456789")
+}
+
+// appendJournalField uses the binary form for values spanning lines, which
+// the simple KEY=value form cannot hold.
+func appendJournalField(entry []byte, name string, value string) []byte {
+	if name == "" {
+		return entry
+	}
+	if !strings.Contains(value, "\n") {
+		return fmt.Appendf(entry, "%s=%s\n", name, value)
+	}
+
+	entry = append(entry, name...)
+	entry = append(entry, '\n')
+	entry = binary.LittleEndian.AppendUint64(entry, uint64(len(value)))
+	entry = append(entry, value...)
+	return append(entry, '\n')
+}
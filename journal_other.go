@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+func stderrIsJournal() bool {
+	return false
+}
+
+func newJournalHandler(options *slog.HandlerOptions) (slog.Handler, error) {
+	return nil, errors.New("the journal is only on Linux")
+}
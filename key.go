@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	keySize = 32
+	keyPerm = 0o600
+)
+
+// keyCreation is what loadKey does about a key that does not exist yet.
+type keyCreation struct {
+	// perm is the mode of a created key's file, and dirPerm that of any
+	// directories made for it. Keys are only created when perm is set.
+	perm, dirPerm fs.FileMode
+
+	// throwaway makes up a key without saving it, as dry runs create
+	// nothing.
+	throwaway bool
+}
+
+var (
+	keyMustExist = keyCreation{}
+	keyForRoot   = keyCreation{perm: keyPerm, dirPerm: stateDirPerm}
+)
+
+// keyForRootUnless creates a key kept to root, or only makes one up during a
+// dry run.
+func keyForRootUnless(dryRun bool) keyCreation {
+	create := keyForRoot
+	create.throwaway = dryRun
+	return create
+}
+
+// loadKey reads a key of hex-encoded bytes, such as the one that -daily-mac
+// addresses are derived under, creating it as asked if it does not exist.
+// The label names the key in errors.
+func loadKey(path, label string, create keyCreation) ([]byte, error) {
+	encoded, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && (create.perm != 0 || create.throwaway) {
+		key := make([]byte, keySize)
+		rand.Read(key)
+		if create.throwaway {
+			return key, nil
+		}
+		if err := os.MkdirAll(filepath.Dir(path), create.dirPerm); err != nil {
+			return nil, fmt.Errorf("could not create %s: %w", label, err)
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), create.perm); err != nil {
+			return nil, fmt.Errorf("could not create %s: %w", label, err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", label, err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || len(key) < keySize {
+		return nil, fmt.Errorf("could not load %s: %s does not hold a key of at least %d hex-encoded bytes", label, path, keySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// giveUpPolicy decides what happens to a device once its error budget runs
+// out.
+type giveUpPolicy string
+
+const (
+	giveUpExit giveUpPolicy = "exit"
+	giveUpDown              = "down"
+)
+
+func parseGiveUpPolicy(value string) (giveUpPolicy, error) {
+	switch policy := giveUpPolicy(value); policy {
+	case giveUpExit, giveUpDown:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown policy on giving up %q", value)
+	}
+}
+
+// holdDownInterval is how often a device held down is checked for having
+// been brought back up, such as by a network manager.
+const holdDownInterval = 2 * time.Second
+
+// holdDown takes the device down and keeps it down until stopped, for those
+// who would rather have no network than one with a stale address.
+func (r *rotation) holdDown(ctx context.Context) {
+	settings := r.currentSettings()
+	r.logger.Error("taking the device down and holding it down until restarted")
+
+	ticker := time.NewTicker(holdDownInterval)
+	defer ticker.Stop()
+
+	for {
+		if iface, err := net.InterfaceByName(r.deviceName); err == nil && iface.Flags&net.FlagUp != 0 {
+			if settings.dryRun {
+				r.logger.Info("would take the device down")
+			} else if err := setLinkDown(r.deviceName); err != nil {
+				r.logger.Error("could not take the device down", "err", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+// setLinkDown takes the device down administratively.
+func setLinkDown(deviceName string) error {
+	return runIP("link", "set", "dev", deviceName, "down")
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// setLinkDown takes the device down administratively.
+func setLinkDown(deviceName string) error {
+	if out, err := exec.Command("ifconfig", deviceName, "down").CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// setLinkDown disables the adapter, which is how Windows takes it down.
+func setLinkDown(deviceName string) error {
+	script := "Disable-NetAdapter -Confirm:$false -Name '" + strings.ReplaceAll(deviceName, "'", "''") + "'"
+	if out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const defaultLibvirtURI = "qemu:///system"
+
+// libvirtInterface is a guest's interface on a libvirt network or bridge,
+// which the host rotates through virsh, as guests cannot be relied on to
+// rotate their own.
+type libvirtInterface struct {
+	domain string
+	source string
+}
+
+func parseLibvirtInterfaces(value string) ([]libvirtInterface, error) {
+	var ifaces []libvirtInterface
+	for _, item := range parseList(value) {
+		domain, source, ok := strings.Cut(item, "/")
+		if !ok || domain == "" || source == "" {
+			return nil, fmt.Errorf("%q is not a guest's interface of the form domain/network", item)
+		}
+		ifaces = append(ifaces, libvirtInterface{domain, source})
+	}
+	return ifaces, nil
+}
+
+// String names the interface in the log, history, and audit log alongside
+// the host's own devices.
+func (iface libvirtInterface) String() string {
+	return "libvirt:" + iface.domain + "/" + iface.source
+}
+
+// guestNic is what virsh domiflist says of an interface, which is what
+// attaching it again needs.
+type guestNic struct {
+	kind  string
+	model string
+	mac   rotator.MAC
+}
+
+type virsh struct {
+	uri string
+}
+
+func (v virsh) run(ctx context.Context, args ...string) (string, error) {
+	args = append([]string{"-c", v.uri}, args...)
+	out, err := exec.CommandContext(ctx, "virsh", args...).CombinedOutput()
+	trimmed := strings.TrimSpace(string(out))
+	if err != nil {
+		return "", fmt.Errorf("virsh %s: %w: %s", args[2], err, trimmed)
+	}
+	return trimmed, nil
+}
+
+// nic finds the guest's interface on the network or bridge. The table
+// virsh prints is the interface, its type, source, model, and address, with
+// the interface a dash while the guest is shut off.
+func (v virsh) nic(ctx context.Context, iface libvirtInterface) (guestNic, error) {
+	out, err := v.run(ctx, "domiflist", iface.domain)
+	if err != nil {
+		return guestNic{}, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 5 && fields[2] == iface.source {
+			return guestNic{kind: fields[1], model: fields[3], mac: rotator.MAC(fields[4])}, nil
+		}
+	}
+	return guestNic{}, fmt.Errorf("%s has no interface on %s", iface.domain, iface.source)
+}
+
+// scope is whether to change the running guest as well as its definition.
+func (v virsh) scope(ctx context.Context, domain string) ([]string, error) {
+	state, err := v.run(ctx, "domstate", domain)
+	if err != nil {
+		return nil, err
+	}
+	if state == "shut off" {
+		return []string{"--config"}, nil
+	}
+	return []string{"--live", "--config"}, nil
+}
+
+// replace unplugs the interface and plugs in one just like it but for the
+// address, as libvirt refuses to change the address of an interface in place.
+// If the new one cannot be plugged in, the old one is put back.
+func (v virsh) replace(ctx context.Context, iface libvirtInterface, nic guestNic, mac rotator.MAC) error {
+	scope, err := v.scope(ctx, iface.domain)
+	if err != nil {
+		return err
+	}
+
+	attach := func(mac rotator.MAC) error {
+		args := []string{"attach-interface", iface.domain, nic.kind, iface.source, "--mac", string(mac)}
+		if nic.model != "-" {
+			args = append(args, "--model", nic.model)
+		}
+		_, err := v.run(ctx, append(args, scope...)...)
+		return err
+	}
+
+	if _, err := v.run(ctx, append([]string{"detach-interface", iface.domain, nic.kind, "--mac", string(nic.mac)}, scope...)...); err != nil {
+		return err
+	}
+	if err := attach(mac); err != nil {
+		if restoreErr := attach(nic.mac); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("could not put the old interface back: %w", restoreErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// serveLibvirt rotates each guest's interface on the schedule of the host's
+// own devices, recording the changes in the same history and audit log.
+func serveLibvirt(ctx context.Context, d *daemon, flags flags) {
+	v := virsh{flags.libvirtURI}
+	for _, iface := range flags.libvirtInterfaces {
+		go rotateGuest(ctx, d, v, iface)
+	}
+}
+
+func rotateGuest(ctx context.Context, d *daemon, v virsh, iface libvirtInterface) {
+	logger := slog.With("device", iface.String())
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	trigger := "startup"
+	if !d.currentFlags().rotateOnStart {
+		trigger = ""
+	}
+	for {
+		settings := d.currentFlags().settings()
+		if trigger == "" {
+			due := time.Now().Add(rotator.NextGap(rng, settings.schedule, settings.cycleSecs, settings.variance))
+			logger.Info("waiting until the next rotation", "next_rotation", due)
+			if err := rotator.WaitUntil(ctx, logger, due, nil); err != nil {
+				return
+			}
+			trigger = "schedule"
+		}
+
+		entry := rotateGuestOnce(ctx, logger, rng, v, iface, settings)
+		entry.Trigger = trigger
+		if !settings.dryRun {
+			d.history.record(entry)
+			d.audit.record(newAuditRecord(entry))
+		}
+		events.emitChange(entry)
+		trigger = ""
+	}
+}
+
+func rotateGuestOnce(ctx context.Context, logger *slog.Logger, rng *rand.Rand, v virsh, iface libvirtInterface, settings settings) historyEntry {
+	entry := historyEntry{At: time.Now(), Device: iface.String()}
+
+	nic, err := v.nic(ctx, iface)
+	if err != nil {
+		logger.Warn("could not find the guest's interface", "err", err)
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.Previous = nic.mac
+
+	// Guests are QEMU's, so matching the hypervisor means its own range.
+	vendors := settings.vendors
+	if prefix, ok := rotator.VirtualVendor(rotator.VendorQEMU); ok && settings.vmVendors == vmVendorsMatch {
+		vendors = []rotator.VendorPrefix{prefix}
+	}
+	vendor, mac := rotator.RandomMAC(rng, vendors)
+	if settings.dryRun {
+		logger.Info("would replace the guest's interface", "old_mac", nic.mac, "new_mac", mac, "vendor", vendor)
+		return entry
+	}
+	if err := v.replace(ctx, iface, nic, mac); err != nil {
+		logger.Warn("could not change the guest's MAC address", "err", err)
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.Mac = mac
+	entry.Vendor = vendor
+	logger.Info("changed the MAC address", "old_mac", nic.mac, "new_mac", mac, "vendor", vendor)
+	return entry
+}
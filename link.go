@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// linkSettleTime is how long after a change to ignore the link going down,
+// as some drivers briefly drop the link when their address is changed.
+const linkSettleTime = 10 * time.Second
+
+// watchLinkTrigger rotates a device as soon as its link goes down, so that
+// every new cable plug-in or reconnection starts with a fresh identity.
+func watchLinkTrigger(ctx context.Context, d *daemon) error {
+	return watchCarrier(ctx, func(deviceName string, up bool) {
+		if up || !d.currentFlags().rotateOnLinkDown {
+			return
+		}
+
+		r, ok := d.rotation(deviceName)
+		if !ok || time.Since(r.currentStatus().lastChange) < linkSettleTime {
+			return
+		}
+		r.requestRotation("its link went down")
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// watchCarrier reports carrier changes as the kernel announces them over
+// netlink, until the context is cancelled.
+func watchCarrier(ctx context.Context, onChange func(deviceName string, up bool)) error {
+	fd, err := syscall.Socket(
+		syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK,
+		syscall.NETLINK_ROUTE,
+	)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: 1 << (syscall.RTNLGRP_LINK - 1),
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return os.NewSyscallError("bind", err)
+	}
+
+	// Wrapping the non-blocking socket in a file hands it to the runtime
+	// poller, so closing it unblocks the read below.
+	sock := os.NewFile(uintptr(fd), "netlink")
+	go func() {
+		<-ctx.Done()
+		sock.Close()
+	}()
+
+	carriers := make(map[string]bool)
+	buf := make([]byte, os.Getpagesize()*4)
+
+	for {
+		n, err := sock.Read(buf)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		for _, msg := range msgs {
+			deviceName, up, ok := parseLinkMessage(&msg)
+			if !ok {
+				continue
+			}
+
+			if was, seen := carriers[deviceName]; !seen || was != up {
+				carriers[deviceName] = up
+				if seen {
+					onChange(deviceName, up)
+				}
+			}
+		}
+	}
+}
+
+func parseLinkMessage(msg *syscall.NetlinkMessage) (deviceName string, up bool, ok bool) {
+	if msg.Header.Type != syscall.RTM_NEWLINK || len(msg.Data) < syscall.SizeofIfInfomsg {
+		return "", false, false
+	}
+	info := (*syscall.IfInfomsg)(unsafe.Pointer(&msg.Data[0]))
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(msg)
+	if err != nil {
+		return "", false, false
+	}
+
+	for _, attr := range attrs {
+		if attr.Attr.Type == syscall.IFLA_IFNAME {
+			deviceName = string(attr.Value[:clen(attr.Value)])
+			up = info.Flags&syscall.IFF_RUNNING != 0
+			return deviceName, up, true
+		}
+	}
+	return "", false, false
+}
+
+func clen(b []byte) int {
+	for i, c := range b {
+		if c == 0 {
+			return i
+		}
+	}
+	return len(b)
+}
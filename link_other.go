@@ -0,0 +1,43 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+const carrierPollInterval = 2 * time.Second
+
+// watchCarrier polls for carrier changes, as there is no netlink to announce
+// them here.
+func watchCarrier(ctx context.Context, onChange func(deviceName string, up bool)) error {
+	carriers := make(map[string]bool)
+
+	ticker := time.NewTicker(carrierPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ifaces, err := net.Interfaces()
+		if err != nil {
+			return err
+		}
+
+		for _, iface := range ifaces {
+			up := iface.Flags&net.FlagRunning != 0
+			if was, seen := carriers[iface.Name]; !seen || was != up {
+				carriers[iface.Name] = up
+				if seen {
+					onChange(iface.Name, up)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
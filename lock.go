@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// deviceLock stops two copies from rotating the same device and fighting
+// each other. It is held for as long as the device is being rotated.
+type deviceLock struct {
+	file *os.File
+}
+
+type lockedError struct {
+	deviceName string
+	pid        int
+}
+
+func (err *lockedError) Error() string {
+	if err.pid == 0 {
+		return fmt.Sprintf("%s is already being rotated by another process", err.deviceName)
+	}
+	return fmt.Sprintf("%s is already being rotated by PID %d", err.deviceName, err.pid)
+}
+
+func deviceLockPath(stateDir string, deviceName string) string {
+	return filepath.Join(stateDir, deviceName+".lock")
+}
+
+func lockDevice(stateDir string, deviceName string) (*deviceLock, error) {
+	if err := os.MkdirAll(stateDir, stateDirPerm); err != nil {
+		return nil, err
+	}
+
+	path := deviceLockPath(stateDir, deviceName)
+	file, err := openLocked(path)
+	if err == errAlreadyLocked {
+		return nil, &lockedError{deviceName, readLockHolder(path)}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Record the holder for the error message of the next copy to try.
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &deviceLock{file}, nil
+}
+
+func readLockHolder(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// unlock leaves the file in place, as removing it could race with another
+// copy that has just opened it.
+func (lock *deviceLock) unlock() {
+	lock.file.Close()
+}
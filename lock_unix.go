@@ -0,0 +1,39 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var errAlreadyLocked = errors.New("already locked")
+
+func openLocked(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, stateFilePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+		return nil, errAlreadyLocked
+	} else if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// lockExclusive waits until no other process holds a lock on the open file,
+// then holds one until the file is closed.
+func lockExclusive(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
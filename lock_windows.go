@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var errAlreadyLocked = errors.New("already locked")
+
+const (
+	errorSharingViolation syscall.Errno = 32
+	lockfileExclusiveLock               = 2
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// openLocked opens the file without sharing it, which Windows enforces for as
+// long as the handle stays open.
+func openLocked(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := syscall.CreateFile(
+		name,
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		0,
+		nil,
+		syscall.OPEN_ALWAYS,
+		syscall.FILE_ATTRIBUTE_NORMAL,
+		0,
+	)
+	if errors.Is(err, errorSharingViolation) {
+		return nil, errAlreadyLocked
+	} else if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
+
+// lockExclusive waits until no other process holds a lock on the open file,
+// then holds one until the file is closed. Windows locks are mandatory, so
+// the lock is on a byte far past the end rather than on the contents, which
+// stay readable by everyone else.
+func lockExclusive(file *os.File) error {
+	overlapped := syscall.Overlapped{Offset: ^uint32(0), OffsetHigh: ^uint32(0) >> 1}
+	ok, _, err := procLockFileEx.Call(file.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if ok == 0 {
+		return &os.PathError{Op: "lock", Path: file.Name(), Err: err}
+	}
+	return nil
+}
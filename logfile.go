@@ -0,0 +1,156 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogMaxSizeMB  = 10
+	defaultLogMaxAgeDays = 30
+	logFilePerm          = 0o640
+	rotatedLogTimeFormat = "20060102T150405"
+)
+
+// rotatingLog appends to a file, moving it aside once it grows past maxSize,
+// compressing what was moved aside, and deleting it once older than maxAge,
+// so that a daemon left running for months needs no logrotate setup.
+type rotatingLog struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	compress bool
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openRotatingLog(path string, maxSizeMB uint, maxAgeDays uint, compress bool) (*rotatingLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), stateDirPerm); err != nil {
+		return nil, err
+	}
+
+	l := &rotatingLog{
+		path:     path,
+		maxSize:  int64(maxSizeMB) << 20,
+		maxAge:   time.Duration(maxAgeDays) * 24 * time.Hour,
+		compress: compress,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	go l.prune()
+	return l, nil
+}
+
+func (l *rotatingLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFilePerm)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if 0 < l.maxSize && 0 < l.size && l.maxSize < l.size+int64(len(p)) {
+		if err := l.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not rotate %s: %s\n", l.path, err)
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *rotatingLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := l.path + "." + time.Now().Format(rotatedLogTimeFormat)
+	renameErr := os.Rename(l.path, rotated)
+
+	// Carry on logging into a fresh file regardless.
+	if err := l.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	go func() {
+		if l.compress {
+			if err := compressLog(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "could not compress %s: %s\n", rotated, err)
+			}
+		}
+		l.prune()
+	}()
+	return nil
+}
+
+func compressLog(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, logFilePerm)
+	if err != nil {
+		return err
+	}
+	compressor := gzip.NewWriter(out)
+
+	_, err = io.Copy(compressor, in)
+	if closeErr := compressor.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune deletes the logs moved aside longer ago than maxAge.
+func (l *rotatingLog) prune() {
+	if l.maxAge == 0 {
+		return
+	}
+
+	rotated, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return
+	}
+	for _, path := range rotated {
+		stamp, _ := strings.CutSuffix(strings.TrimPrefix(path, l.path+"."), ".gz")
+		if _, err := time.Parse(rotatedLogTimeFormat, stamp); err != nil {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && l.maxAge < time.Since(info.ModTime()) {
+			os.Remove(path)
+		}
+	}
+}
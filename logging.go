@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+)
+
+// logFormat picks how log records are written: as key=value text for people
+// and grep, or as JSON objects for log aggregators such as Loki or ELK.
+type logFormat string
+
+const (
+	logText logFormat = "text"
+	logJSON           = "json"
+)
+
+func parseLogFormat(value string) (logFormat, error) {
+	switch format := logFormat(value); format {
+	case logText, logJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q", value)
+	}
+}
+
+// logTimestamps picks how records are timed: in the machine's own time zone
+// as slog does, in UTC so that logs from hosts in different zones line up, or
+// not at all, for when journald or another collector adds its own.
+type logTimestamps string
+
+const (
+	logTimeLocal logTimestamps = "local"
+	logTimeUTC                 = "utc"
+	logTimeNone                = "none"
+)
+
+func parseLogTimestamps(value string) (logTimestamps, error) {
+	switch timestamps := logTimestamps(value); timestamps {
+	case logTimeLocal, logTimeUTC, logTimeNone:
+		return timestamps, nil
+	default:
+		return "", fmt.Errorf("unknown log timestamps %q", value)
+	}
+}
+
+// replaceTime rewrites each record's RFC 3339 timestamp as the -log-timestamps
+// ask.
+func (timestamps logTimestamps) replaceTime(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) != 0 || attr.Key != slog.TimeKey {
+		return attr
+	}
+	switch timestamps {
+	case logTimeUTC:
+		return slog.Time(slog.TimeKey, attr.Value.Time().UTC())
+	case logTimeNone:
+		return slog.Attr{}
+	default:
+		return attr
+	}
+}
+
+// logLevel is shared by every handler, so that reloading the flags can change
+// it in place.
+var logLevel slog.LevelVar
+
+// setUpLogging sends the log to out, or to the -log-file or -log-target
+// instead, in the given format and with the given timestamps, including the messages of anything still using
+// the standard log package. Under systemd, it writes to the journal directly
+// rather than through stderr, so that each attribute becomes a field of its
+// own.
+func setUpLogging(out io.Writer, flags flags) error {
+	if flags.logFile != "" {
+		file, err := openRotatingLog(flags.logFile, flags.logMaxSizeMB, flags.logMaxAgeDays, flags.logCompress)
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+
+	logLevel.Set(flags.effectiveLogLevel())
+	options := &slog.HandlerOptions{Level: &logLevel}
+	if flags.logTimestamps != logTimeLocal {
+		options.ReplaceAttr = flags.logTimestamps.replaceTime
+	}
+
+	newHandler := func(out io.Writer, options *slog.HandlerOptions) slog.Handler {
+		return slog.NewTextHandler(out, options)
+	}
+	if flags.logFormat == logJSON {
+		newHandler = func(out io.Writer, options *slog.HandlerOptions) slog.Handler {
+			return slog.NewJSONHandler(out, options)
+		}
+	}
+
+	handler := newHandler(out, options)
+	switch {
+	case flags.logTarget == "stderr":
+	case flags.logTarget == "journald" || flags.logTarget == "" && out == os.Stderr && stderrIsJournal():
+		journal, err := newJournalHandler(options)
+		if err != nil {
+			return err
+		}
+		handler = journal
+	case flags.logTarget != "":
+		target, err := url.Parse(flags.logTarget)
+		if err != nil {
+			return err
+		}
+		sink, err := newSyslogSink(target)
+		if err != nil {
+			return err
+		}
+		handler = newSyslogHandler(sink, newHandler, options)
+	}
+	if flags.logMac == logMacHash {
+		hashing, err := newMacHashHandler(handler, flags)
+		if err != nil {
+			return err
+		}
+		handler = hashing
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// effectiveLogLevel is the -log-level, unless -quiet asks for failures only.
+func (flags flags) effectiveLogLevel() slog.Level {
+	if flags.quiet {
+		return slog.LevelError
+	}
+	return flags.logLevel
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// logMacPolicy decides how addresses appear in the log: plain as they are,
+// or hash, as salted hashes that tell addresses apart without giving them
+// away, so that logs shipped elsewhere cannot track the device. The status,
+// history, and audit log keep the real addresses either way.
+type logMacPolicy string
+
+const (
+	logMacPlain logMacPolicy = "plain"
+	logMacHash               = "hash"
+)
+
+func parseLogMacPolicy(value string) (logMacPolicy, error) {
+	switch policy := logMacPolicy(value); policy {
+	case logMacPlain, logMacHash:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown MAC address logging %q", value)
+	}
+}
+
+const (
+	logMacSaltFile = "log-mac.key"
+
+	// logMacHashLen is the hexadecimal digits of the hash kept, plenty to
+	// tell a device's addresses apart while keeping lines short.
+	logMacHashLen = 12
+)
+
+var macPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?:[:-][0-9a-f]{2}){5}\b`)
+
+// macHashHandler hashes every address in the records it passes on, wherever
+// they appear: as attributes, within messages, or within errors.
+type macHashHandler struct {
+	inner slog.Handler
+	salt  []byte
+}
+
+// newMacHashHandler hashes addresses under the salt in the state directory,
+// which stays the same between runs so that the hashes can be followed from
+// one to the next.
+func newMacHashHandler(inner slog.Handler, flags flags) (slog.Handler, error) {
+	salt, err := loadKey(filepath.Join(flags.stateDir, logMacSaltFile), "the salt for -log-mac hash", keyForRootUnless(flags.dryRun))
+	if err != nil {
+		return nil, err
+	}
+	return &macHashHandler{inner, salt}, nil
+}
+
+func (h *macHashHandler) hash(mac string) string {
+	digest := hmac.New(sha256.New, h.salt)
+	digest.Write([]byte(strings.ToLower(strings.ReplaceAll(mac, "-", ":"))))
+	return "hash:" + hex.EncodeToString(digest.Sum(nil))[:logMacHashLen]
+}
+
+func (h *macHashHandler) hashAll(s string) string {
+	return macPattern.ReplaceAllStringFunc(s, h.hash)
+}
+
+func (h *macHashHandler) hashAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.hashAll(value.String()))
+	case slog.KindGroup:
+		members := value.Group()
+		hashed := make([]any, len(members))
+		for i, member := range members {
+			hashed[i] = h.hashAttr(member)
+		}
+		return slog.Group(attr.Key, hashed...)
+	case slog.KindAny:
+		if mac, ok := value.Any().(rotator.MAC); ok {
+			return slog.String(attr.Key, h.hash(string(mac)))
+		}
+		if s := fmt.Sprint(value.Any()); macPattern.MatchString(s) {
+			return slog.String(attr.Key, h.hashAll(s))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+func (h *macHashHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *macHashHandler) Handle(ctx context.Context, record slog.Record) error {
+	hashed := slog.NewRecord(record.Time, record.Level, h.hashAll(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		hashed.AddAttrs(h.hashAttr(attr))
+		return true
+	})
+	return h.inner.Handle(ctx, hashed)
+}
+
+func (h *macHashHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hashed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		hashed[i] = h.hashAttr(attr)
+	}
+	return &macHashHandler{h.inner.WithAttrs(hashed), h.salt}
+}
+
+func (h *macHashHandler) WithGroup(name string) slog.Handler {
+	return &macHashHandler{h.inner.WithGroup(name), h.salt}
+}
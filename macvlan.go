@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	macvlanSetProg = "macvlan"
+	macvlanPrefix  = "mv"
+
+	// maxDeviceNameLen is Linux's IFNAMSIZ, less the terminating NUL.
+	maxDeviceNameLen = 15
+)
+
+// macvlanName names the child that carries a parent's traffic with -macvlan.
+func macvlanName(parent string) string {
+	name := macvlanPrefix + parent
+	return name[:min(len(name), maxDeviceNameLen)]
+}
+
+// splitMacvlans has each device rotated through a macvlan child of its own
+// with -macvlan, leaving the devices given as their parents.
+func (flags *flags) splitMacvlans() {
+	if !flags.macvlan {
+		return
+	}
+	flags.macvlanParents = make(map[string]string, len(flags.deviceNames))
+	for i, parent := range flags.deviceNames {
+		child := macvlanName(parent)
+		flags.macvlanParents[child] = parent
+		flags.deviceNames[i] = child
+	}
+}
+
+// macvlanSetCommand hands the child and address to the macvlanRunner, which
+// replaces the child rather than changing an address in place.
+func macvlanSetCommand(deviceName string, mac rotator.MAC) (string, []string) {
+	return macvlanSetProg, []string{deviceName, string(mac)}
+}
+
+// macvlanRunner gives a child its new address by deleting it and creating it
+// afresh on its parent, so that nothing of the old identity, such as its
+// addresses and neighbours, carries over, and the parent's driver is never
+// asked to change anything.
+type macvlanRunner struct {
+	parents map[string]string
+	runner  rotator.Runner
+}
+
+func (runner macvlanRunner) Run(ctx context.Context, prog string, args ...string) ([]byte, error) {
+	if prog != macvlanSetProg || len(args) != 2 {
+		return nil, fmt.Errorf("only macvlan children can be replaced with -macvlan, not by running %s", prog)
+	}
+	child, mac := args[0], args[1]
+	parent, ok := runner.parents[child]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a macvlan child of any device being rotated", child)
+	}
+
+	if _, err := net.InterfaceByName(child); err == nil {
+		if out, err := runner.runner.Run(ctx, "ip", "link", "delete", child); err != nil {
+			return out, err
+		}
+	}
+	if out, err := runner.runner.Run(ctx, "ip", "link", "add", "link", parent, "name", child, "address", mac, "type", "macvlan", "mode", "bridge"); err != nil {
+		return out, err
+	}
+	return runner.runner.Run(ctx, "ip", "link", "set", child, "up")
+}
+
+// setUpMacvlan creates the device's child with a random address if it does
+// not exist yet, and moves the parent's traffic onto it by taking the
+// parent's IPv4 addresses, and so its routes, away and asking for a lease on
+// the child instead.
+func (r *rotation) setUpMacvlan(ctx context.Context, settings settings) error {
+	parent, ok := settings.macvlanParents[r.deviceName]
+	if !ok {
+		return nil
+	}
+	if _, err := net.InterfaceByName(r.deviceName); err == nil {
+		return nil
+	}
+	if _, err := net.InterfaceByName(parent); err != nil {
+		return fmt.Errorf("the parent of %s: %w", r.deviceName, err)
+	}
+	if deviceType(parent) == "wireless" {
+		return fmt.Errorf("%s is wireless, and a Wi-Fi station can only send from the one address it associated with, so macvlan children cannot replace it", parent)
+	}
+
+	logger := r.logger.With("parent", parent)
+	if settings.dryRun {
+		logger.Info("would create a macvlan child and move the parent's traffic onto it")
+		return nil
+	}
+
+	_, mac, err := r.setter(settings).SetRandom(ctx, logger, r.rng, r.deviceName, settings.vendors)
+	if err != nil {
+		return fmt.Errorf("could not create a macvlan child: %w", err)
+	}
+	if out, err := exec.CommandContext(ctx, "ip", "-4", "address", "flush", "dev", parent, "scope", "global").CombinedOutput(); err != nil {
+		logger.Warn("could not move the parent's addresses onto the macvlan child", "err", err, "output", strings.TrimSpace(string(out)))
+	}
+	if err := renewDhcpLease(r.deviceName); err != nil {
+		logger.Warn("could not take a DHCP lease on the macvlan child", "err", err)
+	}
+	logger.Info("created a macvlan child to carry the parent's traffic", "mac", mac)
+	return nil
+}
+
+// removeMacvlan deletes the device's child, handing its traffic back to the
+// parent, which is what restoring means for a child that only ever had
+// generated addresses.
+func (r *rotation) removeMacvlan(ctx context.Context, settings settings, reason string) error {
+	parent := settings.macvlanParents[r.deviceName]
+	logger := r.logger.With("parent", parent)
+	if settings.dryRun {
+		logger.Info("would delete the macvlan child and move its traffic back onto the parent")
+		return nil
+	}
+
+	previous, _ := rotator.CurrentMAC(r.deviceName)
+	out, err := exec.CommandContext(ctx, "ip", "link", "delete", r.deviceName).CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("could not delete the macvlan child: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	parentMac, _ := rotator.CurrentMAC(parent)
+	r.audit.recordRestore(r.deviceName, previous, parentMac, reason, err)
+	if err != nil {
+		return err
+	}
+
+	if err := renewDhcpLease(parent); err != nil {
+		logger.Warn("could not take a DHCP lease on the parent again", "err", err)
+	}
+	logger.Info("deleted the macvlan child, moving its traffic back onto the parent")
+	return nil
+}
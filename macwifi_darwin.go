@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// restrictedWifiMajor is the first version of macOS, Sonoma, that only lets
+// Wi-Fi adapters change address between powering on and associating.
+const restrictedWifiMajor = 14
+
+const (
+	confirmAttempts = 3
+	confirmInterval = 500 * time.Millisecond
+)
+
+func macosMajor() (int, error) {
+	out, err := exec.Command("sw_vers", "-productVersion").Output()
+	if err != nil {
+		return 0, err
+	}
+	major, _, _ := strings.Cut(strings.TrimSpace(string(out)), ".")
+	return strconv.Atoi(major)
+}
+
+// isWifiPort asks which device is the Wi-Fi hardware port, as adapters of
+// other kinds are not restricted.
+func isWifiPort(deviceName string) bool {
+	out, err := exec.Command("networksetup", "-listallhardwareports").Output()
+	if err != nil {
+		return false
+	}
+
+	wifi := false
+	for _, line := range strings.Split(string(out), "\n") {
+		if port, ok := strings.CutPrefix(line, "Hardware Port: "); ok {
+			wifi = port == "Wi-Fi" || port == "AirPort"
+		} else if device, ok := strings.CutPrefix(line, "Device: "); ok && wifi && device == deviceName {
+			return true
+		}
+	}
+	return false
+}
+
+// forcesDisassociation reports whether the device only accepts new addresses
+// while disassociated, whatever the -association-policy says.
+func forcesDisassociation(deviceName string) bool {
+	major, err := macosMajor()
+	return err == nil && restrictedWifiMajor <= major && isWifiPort(deviceName)
+}
+
+// confirmMac reads the address back, as macOS can accept the command to set a
+// Wi-Fi adapter's address and then ignore it.
+func confirmMac(deviceName string, mac rotator.MAC) error {
+	var current rotator.MAC
+	for attempt := 1; ; attempt++ {
+		var err error
+		if current, err = rotator.CurrentMAC(deviceName); err == nil && strings.EqualFold(string(current), string(mac)) {
+			return nil
+		}
+		if confirmAttempts <= attempt {
+			break
+		}
+		time.Sleep(confirmInterval)
+	}
+
+	if !isWifiPort(deviceName) {
+		return fmt.Errorf("%s kept %s rather than taking %s", deviceName, current, mac)
+	}
+	return fmt.Errorf(
+		"macOS kept %s on %s rather than taking %s; Wi-Fi adapters since Sonoma only take new addresses between powering on and associating, which -association-policy reassociate does, and some refuse them altogether",
+		current,
+		deviceName,
+		mac,
+	)
+}
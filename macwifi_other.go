@@ -0,0 +1,15 @@
+//go:build !darwin
+
+package main
+
+import "gitlab.com/louis.jackman/rotate-mac-address/rotator"
+
+func forcesDisassociation(string) bool {
+	return false
+}
+
+// confirmMac trusts the set command, which fails outright when an address is
+// not taken.
+func confirmMac(string, rotator.MAC) error {
+	return nil
+}
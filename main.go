@@ -1,256 +1,1070 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math"
+	"log/slog"
 	"math/rand"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
 )
 
 var description = `
 Rotate MAC addresses on a specified interval, with a bit of variation added.
-Requires superuser privileges. Supports macOS and Linux.`
+Requires superuser privileges. Supports macOS, Linux, and Windows.
+
+Running without a command is the same as "run". Send the running process
+SIGUSR1 to rotate immediately, SIGHUP to reload its flags and flags file,
+SIGUSR2 to log the status of each device, or SIGTSTP to pause rotation until
+SIGCONT. Resuming schedules the next rotation afresh rather than rotating
+immediately.`
+
+// programName is the name the program is installed under, which shells
+// complete and versions are reported for.
+const programName = "rotate-mac-address"
 
 const (
-	defaultDeviceName = "eth0"
-	defaultCycleSecs  = 30 * 60
+	defaultCycleSecs = 30 * 60
+
+	defaultDeferGraceSecs     = 5 * 60
+	defaultDeferActiveMaxSecs = 4 * 60 * 60
 )
 
 const (
-	cycleVariance = .25
-	maxErrs       = 3
+	defaultCycleVariance = .25
+	defaultMaxErrs       = 3
 )
 
-type vendor string
+type macChange interface {
+	handle(logger *slog.Logger, errs []error, maxErrs uint) []error
+}
 
-const (
-	vendorIntel          vendor = "Intel"
-	vendorHewlettPackard        = "HP"
-	vendorFoxconn               = "Foxconn"
-	vendorCisco                 = "Cisco"
-	vendorAmd                   = "AMD"
-)
+// Both kinds of change carry the address the device had beforehand, if it
+// could be read, for matching up with what switches and DHCP servers saw.
+type successfulMacChange struct {
+	vendor   rotator.Vendor
+	mac      rotator.MAC
+	previous rotator.MAC
+}
 
-type macAddr string
+func (change *successfulMacChange) handle(logger *slog.Logger, _ []error, _ uint) []error {
+	logger.Info(
+		"changed the MAC address",
+		"old_mac", change.previous,
+		"new_mac", change.mac,
+		"vendor", change.vendor,
+	)
+	return nil
+}
 
-const (
-	macAddrIntel          macAddr = "00:1b:77"
-	macAddrHewlettPackard         = "00:1b:78"
-	macAddrFoxconn                = "00:01:6c"
-	macAddrCisco                  = "00:10:29"
-	macAddrAmd                    = "00:0c:87"
-)
+type failedMacChange struct {
+	err      error
+	previous rotator.MAC
+}
+
+func (change failedMacChange) handle(logger *slog.Logger, errs []error, maxErrs uint) []error {
+	if hint := rotator.Hint(change.err); hint != "" {
+		logger = logger.With("hint", hint)
+	}
+
+	if maxErrs == 0 {
+		logger.Error(
+			"could not change the MAC address; the program will keep retrying",
+			"old_mac", change.previous,
+			"err", change.err,
+			"consecutive_errors", len(errs)+1,
+		)
+		return append(errs, error(change.err))
+	}
 
-type vendorMac struct {
-	vendor vendor
-	mac    macAddr
+	remaining := int(maxErrs) - len(errs)
+	logger.Error(
+		"could not change the MAC address; the program will stop if more errors occur sequentially",
+		"old_mac", change.previous,
+		"err", change.err,
+		"errors_remaining", remaining,
+	)
+	return append(errs, error(change.err))
 }
 
-var vendors = []vendorMac{
-	{vendorIntel, macAddrIntel},
-	{vendorHewlettPackard, macAddrHewlettPackard},
-	{vendorFoxconn, macAddrFoxconn},
-	{vendorCisco, macAddrCisco},
-	{vendorAmd, macAddrAmd},
+func isWindows() bool {
+	return runtime.GOOS == "windows"
 }
 
-func pickVendor() (vendor, macAddr) {
-	n := rand.Intn(len(vendors))
-	vendorMac := vendors[n]
-	return vendorMac.vendor, vendorMac.mac
+func setMac(ctx context.Context, logger *slog.Logger, rng *rand.Rand, deviceName string, vendors []rotator.VendorPrefix, setter rotator.Setter) macChange {
+	previous, err := rotator.CurrentMAC(deviceName)
+	if err != nil {
+		logger.Debug("could not read the current MAC address", "err", err)
+	}
+
+	vendor, mac, err := setter.SetRandom(ctx, logger, rng, deviceName, vendors)
+	if err != nil {
+		return &failedMacChange{err, previous}
+	}
+	return &successfulMacChange{vendor, mac, previous}
 }
 
-type newSetMacCmd func(devName string, mac macAddr) (string, []string)
+// changeMac gives the device its next address, checking that it took where the
+// platform can silently ignore it.
+func (r *rotation) changeMac(ctx context.Context, settings settings, state *deviceState) macChange {
+	reset := startSpan(ctx, "reset")
+	err := r.resetDevice(ctx, settings)
+	reset.end(err)
+	if err != nil {
+		previous, _ := rotator.CurrentMAC(r.deviceName)
+		return &failedMacChange{err, previous}
+	}
+
+	if r.scheduler != nil {
+		done, err := r.scheduler.startChange(ctx)
+		if err != nil {
+			previous, _ := rotator.CurrentMAC(r.deviceName)
+			return &failedMacChange{err, previous}
+		}
+		defer done()
+	}
+
+	resume, err := r.pauseAccessPoint(settings, wirelessModeOf(r.deviceName))
+	if err != nil {
+		previous, _ := rotator.CurrentMAC(r.deviceName)
+		return &failedMacChange{err, previous}
+	}
+	defer resume()
+
+	logon, err := r.pauseEAP(ctx, settings)
+	if err != nil {
+		previous, _ := rotator.CurrentMAC(r.deviceName)
+		return &failedMacChange{err, previous}
+	}
+	defer logon()
 
-func newSetMacUnixCmd(devName string, mac macAddr) (string, []string) {
-	cmd := "ifconfig"
-	args := []string{devName, "ether", string(mac)}
-	return cmd, args
+	settings.vendors = r.blendIn(settings)
+	settings.vendors = r.vendorsForDevice(settings)
+	set := startSpan(ctx, "set")
+	change := r.applyNextMac(ctx, settings, state)
+	if failed, ok := change.(*failedMacChange); ok {
+		set.end(failed.err)
+	} else {
+		set.end(nil)
+	}
+	if succeeded, ok := change.(*successfulMacChange); ok && !settings.dryRun {
+		verify := startSpan(ctx, "verify")
+		err := confirmMac(r.deviceName, succeeded.mac)
+		verify.end(err)
+		if err != nil {
+			return &failedMacChange{err, succeeded.previous}
+		}
+	}
+	return change
 }
 
-func newSetMacLinuxCmd(devName string, mac macAddr) (string, []string) {
-	cmd := "ip"
-	args := []string{"link", "set", "dev", devName, "addr", string(mac)}
-	return cmd, args
+// followChange brings the rest of the machine's identity along with the
+// device's new address.
+func (r *rotation) followChange(ctx context.Context, settings settings, change *successfulMacChange) {
+	ipv4 := ipv4Of(r.deviceName)
+	r.rotateHostname(settings)
+	r.rotateMdnsName(settings)
+	r.rotateBluetoothAddress(settings)
+	if !r.rotateDhcpClientID(settings, change.mac) {
+		r.renewDhcpLease(settings)
+	}
+	r.regenerateIPv6(settings, change.previous)
+	r.flushNeighbors(settings)
+	r.announceAddress(settings)
+	r.checkIPv4(ctx, settings, ipv4, change)
+	r.reauthCaptivePortal(ctx, settings, change)
 }
 
-func newRandomMac() (vendor, macAddr) {
-	var fragments [4]string
+// settings are the tunables of a rotation that can change while it runs.
+type settings struct {
+	cycleSecs uint
+	variance  float64
+	schedule  rotator.Schedule
+	vendors   []rotator.VendorPrefix
+	dryRun    bool
+	maxErrs   uint
 
-	vendor, addr := pickVendor()
-	fragments[0] = string(addr)
+	rotateOnStart bool
+	startupJitter time.Duration
 
-	for i := 1; i < 4; i++ {
-		fragments[i] = fmt.Sprintf(
-			"%d%d",
-			rand.Intn(9),
-			rand.Intn(9),
-		)
+	macPool      []rotator.MAC
+	poolStrategy poolStrategy
+	slap         rotator.SLAPQuadrant
+	slapCID      rotator.MAC
+
+	dailyMac        bool
+	dailyPerNetwork bool
+	dailyKeyFile    string
+	macvlanParents  map[string]string
+	blendIn         bool
+	resetMethods    map[string]resetMethod
+	vmVendors       vmVendorPolicy
+
+	maxErrsWindowSecs uint
+	missingDevice     missingDevicePolicy
+	apMode            apModePolicy
+	eapPolicy         eapPolicy
+
+	associationPolicy associationPolicy
+	busyBytesPerSec   uint64
+	deferOnVpn        bool
+	deferGraceSecs    uint
+	deferActiveSecs   uint
+	deferActiveMax    time.Duration
+
+	aggressiveCycleSecs uint
+	aggressiveSchedule  rotator.Schedule
+	networkProfiles     []networkProfile
+
+	hostnamePattern string
+	hostnameWords   []string
+	mdnsPattern     string
+	btDevice        string
+	dhcpClient      dhcpClient
+	dhcpRenew       bool
+	announce        bool
+	regenerateIPv6  bool
+	flushNeighbors  bool
+
+	preHook         string
+	postHook        string
+	hookTimeoutSecs uint
+	hookFailure     hookFailurePolicy
+	policy          string
+
+	captiveProbeURL string
+	captiveHook     string
+	captiveAccept   bool
+
+	connectivityCheck       string
+	connectivityTimeoutSecs uint
+	carrierTimeoutSecs      uint
+}
+
+// rotation is everything a rotation loop needs to run against a single
+// device.
+type rotation struct {
+	deviceName   string
+	newSetMacCmd rotator.SetCommand
+	stateDir     string
+	logger       *slog.Logger
+
+	mu           sync.Mutex
+	settings     settings
+	status       status
+	originalMac  rotator.MAC
+	permanentMac rotator.MAC
+
+	// runner runs the set commands, or sends them to the helper.
+	runner rotator.Runner
+
+	// rng is safe for concurrent use, so that nothing acting on the device
+	// from outside its rotation loop can race the loop drawing from it.
+	rng       *rand.Rand
+	rotateNow chan struct{}
+	history   *history
+	audit     *auditLog
+
+	// scheduler is shared by the daemon's rotations, which are otherwise
+	// timed on their own, as single rotations are.
+	scheduler *scheduler
+
+	// otlp, if set, is sent a trace of each rotation.
+	otlp *otlpExporter
+
+	// trigger is why the next rotation was requested early, if it was.
+	trigger string
+
+	// policyNext is the wait until the next rotation that the -policy asked
+	// for, if it did.
+	policyNext time.Duration
+
+	// disassociatedAt is when the device was last disassociated for a
+	// change, which should not count as disassociating of its own accord.
+	disassociatedAt time.Time
+
+	// onStatusChange is told whether the loop has settled, having either
+	// rotated successfully or chosen to wait without rotating.
+	onStatusChange func(settled bool)
+}
+
+func newRotation(deviceName string, flags flags, newSetMacCmd rotator.SetCommand) *rotation {
+	logger := slog.With("device", deviceName)
+
+	return &rotation{
+		deviceName:   deviceName,
+		newSetMacCmd: newSetMacCmd,
+		stateDir:     flags.stateDir,
+		logger:       logger,
+		settings:     flags.settings(),
+		runner:       newSetRunner(flags),
+		rng:          rotator.NewLockedRand(time.Now().UnixNano()),
+		rotateNow:    make(chan struct{}, 1),
+
+		onStatusChange: func(bool) {},
 	}
+}
 
-	mac := strings.Join(fragments[:], ":")
-	return vendor, macAddr(mac)
+func (r *rotation) currentSettings() settings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	settings := r.settings
+	if r.status.aggressive {
+		settings = settings.aggressive()
+	}
+	if profile, ok := findNetworkProfile(settings.networkProfiles, r.status.network); ok {
+		settings = settings.withProfile(profile)
+	}
+	return settings
 }
 
-func variate(seconds uint, variance float64) float64 {
-	delta := (rand.Float64() - .5) * variance
-	return float64(seconds) + (float64(seconds) * delta)
+// waitUntil waits until the time, or for the interrupt, on the daemon's shared
+// scheduler if there is one.
+func (r *rotation) waitUntil(ctx context.Context, due time.Time, interrupt <-chan struct{}) error {
+	if r.scheduler == nil {
+		return rotator.WaitUntil(ctx, r.logger, due, interrupt)
+	}
+	return r.scheduler.waitUntil(ctx, due, interrupt)
 }
 
-type macChange interface {
-	handle(errs []error) []error
+// updateSettings applies from the next rotation onwards; the one currently
+// being waited for keeps its time.
+func (r *rotation) updateSettings(settings settings) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings = settings
 }
 
-type successfulMacChange struct {
-	vendor vendor
-	mac    macAddr
+// wake has the loop look at its situation afresh, without asking it to rotate.
+func (r *rotation) wake() {
+	select {
+	case r.rotateNow <- struct{}{}:
+	default:
+	}
 }
 
-func (change *successfulMacChange) handle([]error) []error {
-	log.Printf(
-		"set to MAC address %s of vendor %s\n",
-		string(change.mac),
-		string(change.vendor),
-	)
-	return nil
+// requestRotation cuts the current wait short so the next rotation happens
+// immediately. Requests made while one is already pending are coalesced.
+func (r *rotation) requestRotation(reason string) {
+	if r.isPaused() {
+		r.logger.Info("not rotating early, as rotation is paused", "reason", reason)
+		return
+	}
+
+	select {
+	case r.rotateNow <- struct{}{}:
+		r.mu.Lock()
+		r.trigger = reason
+		r.mu.Unlock()
+		r.logger.Info("rotating early", "reason", reason)
+	default:
+	}
 }
 
-type failedMacChange struct {
-	err error
+// takeTrigger returns why this rotation is happening, ready for the next.
+func (r *rotation) takeTrigger() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	trigger := r.trigger
+	r.trigger = ""
+	if trigger == "" {
+		return "schedule"
+	}
+	return trigger
+}
+
+func (r *rotation) loadState() deviceState {
+	state, err := loadDeviceState(r.stateDir, r.deviceName)
+	if err != nil {
+		r.logger.Warn("could not load the saved state, so starting afresh", "err", err)
+		return deviceState{}
+	}
+	return state
+}
+
+func (r *rotation) saveState(state deviceState) {
+	if r.currentSettings().dryRun {
+		return
+	}
+	if err := saveDeviceState(r.stateDir, r.deviceName, state); err != nil {
+		r.logger.Warn("could not save the state", "err", err)
+	}
 }
 
-func (change failedMacChange) handle(errs []error) []error {
-	remaining := maxErrs - len(errs)
-	log.Printf("an error occured: %s", change.err)
-	log.Printf(
-		"the program wills top if %d more occur sequentially\n",
-		remaining,
+func (r *rotation) resumeSchedule(ctx context.Context, state deviceState) error {
+	remaining := time.Until(state.NextRotation)
+	if remaining <= 0 {
+		return nil
+	}
+
+	r.recordNextRotation(state.NextRotation)
+	r.onStatusChange(true)
+	r.logger.Info(
+		"resuming the saved schedule",
+		"next_rotation", state.NextRotation,
+		"wait_secs", int(remaining/time.Second),
 	)
-	return append(errs, error(change.err))
+	return r.waitUntil(ctx, state.NextRotation, r.rotateNow)
 }
 
-func isLinux() bool {
-	return runtime.GOOS == "linux"
+// waitStartupJitter holds off the first rotation for a random part of the
+// -startup-jitter, or until a trigger.
+func (r *rotation) waitStartupJitter(ctx context.Context) error {
+	jitter := r.currentSettings().startupJitter
+	if jitter <= 0 {
+		return nil
+	}
+
+	at := time.Now().Add(time.Duration(r.rng.Int63n(int64(jitter))))
+	r.recordNextRotation(at)
+	r.onStatusChange(true)
+	r.logger.Info(
+		"waiting a random time before the first rotation",
+		"next_rotation", at,
+		"wait_secs", int(time.Until(at)/time.Second),
+	)
+	return r.waitUntil(ctx, at, r.rotateNow)
 }
 
-func setMac(deviceName string, newSetMacCmd newSetMacCmd, dryRun bool) macChange {
-	vendor, addr := newRandomMac()
-	prog, args := newSetMacCmd(deviceName, addr)
+func (r *rotation) nextRotation(settings settings) time.Time {
+	if settings.dailyMac {
+		return rotator.NextMidnight(time.Now())
+	}
+	return rotator.NextRotation(r.logger, r.rng, r.deviceName, settings.schedule, settings.cycleSecs, settings.variance)
+}
 
-	if dryRun {
-		argsStr := strings.Join(args, " ")
-		log.Printf("would run `%s %s`\n", prog, argsStr)
-	} else {
-		cmd := exec.Command(prog, args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return &failedMacChange{err}
-		}
+// setter gives the device addresses with the privileges the daemon has.
+func (r *rotation) setter(settings settings) rotator.Setter {
+	return rotator.Setter{Command: r.newSetMacCmd, Runner: r.runner, DryRun: settings.dryRun}
+}
+
+func newSetRunner(flags flags) rotator.Runner {
+	if flags.helperSocket != "" {
+		return helperRunner{flags.helperSocket, flags.helperKeyFile}
+	}
+	if flags.macvlan {
+		return macvlanRunner{flags.macvlanParents, rotator.ExecRunner{RunCmd: runPrivileged}}
 	}
-	return &successfulMacChange{vendor, addr}
+	return rotator.ExecRunner{RunCmd: runPrivileged}
+}
+
+// dueRotation is what preparing a rotation hands on to making the change.
+type dueRotation struct {
+	settings    settings
+	trigger     string
+	traceCtx    context.Context
+	trace       *rotationTrace
+	association network
+	target      string
+	hadCarrier  bool
 }
 
-func newMacChangeErr(errs []error) error {
-	msgs := make([]string, len(errs))
-	for i, err := range errs {
-		msgs[i] = err.Error()
+// rotateMacAddrs runs the library's loop for the device, with hooks adding
+// the daemon's pausing, trust, deferral, hooks, and checks to each rotation.
+func rotateMacAddrs(ctx context.Context, r *rotation) error {
+	if err := r.setUpMacvlan(ctx, r.currentSettings()); err != nil {
+		return err
 	}
 
-	errMsg := strings.Join(msgs, "\n")
-	return errors.New("too many MAC change errors occured:\n" + errMsg)
+	state := r.loadState()
+	r.recordAddresses(&state)
+	r.saveState(state)
+
+	var loop *rotator.Rotator
+	var due dueRotation
+	restored := false
+	loop, err := rotator.NewRotator(rotator.Options{
+		Device: r.deviceName,
+		Hooks: rotator.Hooks{
+			First: func(ctx context.Context) error {
+				return r.waitForFirstRotation(ctx, &state)
+			},
+			Prepare: func(ctx context.Context) (bool, error) {
+				settings := r.currentSettings()
+				loop.SetMaxErrs(settings.maxErrs, time.Duration(settings.maxErrsWindowSecs)*time.Second)
+
+				var proceed bool
+				var err error
+				due, proceed, err = r.prepareRotation(ctx, &state, &restored)
+				return proceed, err
+			},
+			Change: func(ctx context.Context, errs []error) (rotator.MAC, rotator.MAC, error) {
+				return r.rotate(ctx, due, &state, errs)
+			},
+			Next: func(ctx context.Context) error {
+				return r.waitForNextRotation(ctx, &state, true)
+			},
+			Retry: r.waitToRetry,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return loop.Run(ctx)
 }
 
-func rotateMacAddrs(deviceName string, cycleSecs uint, newSetMacCmd newSetMacCmd, dryRun bool) error {
-	var errs []error
+// waitForFirstRotation waits out a saved schedule, or otherwise whatever the
+// daemon waits for on starting.
+func (r *rotation) waitForFirstRotation(ctx context.Context, state *deviceState) error {
+	// Without a saved schedule still to wait out, the first rotation is
+	// down to starting up, unless it waits for a cycle first.
+	if time.Now().Before(state.NextRotation) {
+		return r.resumeSchedule(ctx, *state)
+	}
+	if r.currentSettings().rotateOnStart {
+		r.mu.Lock()
+		r.trigger = "startup"
+		r.mu.Unlock()
+		return r.waitStartupJitter(ctx)
+	}
+	return r.waitForNextRotation(ctx, state, true)
+}
 
-	for {
-		change := setMac(deviceName, newSetMacCmd, dryRun)
+// prepareRotation decides whether a due rotation goes ahead, and when it does
+// not, waits for whatever should come first.
+func (r *rotation) prepareRotation(ctx context.Context, state *deviceState, restored *bool) (dueRotation, bool, error) {
+	settings := r.currentSettings()
 
-		errs = change.handle(errs)
-		if maxErrs <= len(errs) {
-			return newMacChangeErr(errs)
+	if r.isPaused() {
+		r.recordNextRotation(time.Time{})
+		r.onStatusChange(true)
+		if err := r.waitUntil(ctx, time.Time{}, r.rotateNow); err != nil {
+			return dueRotation{}, false, err
 		}
 
-		variation := variate(cycleSecs, cycleVariance)
-		duration := time.Second * time.Duration(math.Round(variation))
-		log.Printf(
-			"waiting for %d seconds until next rotation\n",
-			duration/time.Second,
-		)
-		time.Sleep(duration)
+		// Resuming starts a fresh wait rather than rotating straight
+		// away.
+		if !r.isPaused() {
+			return dueRotation{}, false, r.waitForNextRotation(ctx, state, true)
+		}
+		return dueRotation{}, false, nil
+	}
+
+	if present, err := r.awaitDevice(ctx, settings); err != nil || !present {
+		return dueRotation{}, false, err
+	}
+
+	if _, trusted := r.trustedNetwork(); trusted {
+		if !*restored {
+			if err := r.restorePermanentMac(ctx, settings); err != nil {
+				r.logger.Error("could not restore the MAC address", "target", restorePermanent, "err", err)
+			}
+			*restored = true
+		}
+
+		r.recordNextRotation(time.Time{})
+		r.onStatusChange(true)
+		return dueRotation{}, false, r.waitUntil(ctx, time.Time{}, r.rotateNow)
+	}
+	*restored = false
+
+	if err := r.deferWhileBusy(ctx, settings); err != nil {
+		return dueRotation{}, false, err
+	}
+	settings = r.currentSettings()
+
+	reason := modeSkipReason(settings, wirelessModeOf(r.deviceName))
+	if reason == "" {
+		reason = r.eapSkipReason(settings)
 	}
+	if reason != "" {
+		r.logger.Warn("not rotating", "reason", reason)
+		return dueRotation{}, false, r.waitForNextRotation(ctx, state, true)
+	}
+
+	trigger := r.takeTrigger()
+	settings, proceed := r.applyPolicy(ctx, settings, trigger)
+	if !proceed {
+		return dueRotation{}, false, r.waitForNextRotation(ctx, state, true)
+	}
+
+	traceCtx, trace := r.startTrace(ctx, trigger)
+	if !r.runPreHook(traceCtx, settings, trigger) {
+		trace.finish(nil, errors.New("the pre-rotation hook failed"))
+		return dueRotation{}, false, r.waitForNextRotation(ctx, state, true)
+	}
+
+	association, err := r.prepareAssociation(ctx, settings)
+	if err != nil {
+		trace.finish(nil, err)
+		return dueRotation{}, false, err
+	}
+	return dueRotation{
+		settings:    settings,
+		trigger:     trigger,
+		traceCtx:    traceCtx,
+		trace:       trace,
+		association: association,
+		target:      r.connectivityTarget(ctx, settings),
+		hadCarrier:  hasCarrier(r.deviceName),
+	}, true, nil
+}
+
+// rotate makes the change, with everything that goes along with it, given
+// the failures in a row before it.
+func (r *rotation) rotate(ctx context.Context, due dueRotation, state *deviceState, errs []error) (rotator.MAC, rotator.MAC, error) {
+	settings, trigger := due.settings, due.trigger
+	change := r.changeMac(due.traceCtx, settings, state)
+	r.finishAssociation(settings, due.association)
+
+	// A change cut short by stopping is no failure of the device's.
+	if failed, ok := change.(*failedMacChange); ok && ctx.Err() != nil {
+		due.trace.finish(change, nil)
+		return failed.previous, "", failed.err
+	}
+
+	streak := change.handle(r.logger, errs, settings.maxErrs)
+	r.recordChange(change, streak, trigger)
+	if succeeded, ok := change.(*successfulMacChange); ok {
+		err := r.awaitCarrier(ctx, settings, due.hadCarrier)
+		if err == nil {
+			r.followChange(ctx, settings, succeeded)
+			err = r.checkConnectivity(ctx, settings, due.target, state, succeeded)
+		}
+		if err != nil {
+			change = &failedMacChange{err, succeeded.mac}
+			streak = change.handle(r.logger, errs, settings.maxErrs)
+			r.recordChange(change, streak, trigger)
+		}
+	}
+	r.runPostHook(due.traceCtx, settings, trigger, change)
+	due.trace.finish(change, nil)
+
+	switch change := change.(type) {
+	case *successfulMacChange:
+		return change.previous, change.mac, nil
+	case *failedMacChange:
+		return change.previous, "", change.err
+	}
+	return "", "", nil
 }
 
-func initUsage() {
-	defaultUsage := flag.Usage
+// waitForNextRotation schedules the next rotation from now, and waits for it
+// or a trigger.
+func (r *rotation) waitForNextRotation(ctx context.Context, state *deviceState, settled bool) error {
+	settings := r.currentSettings()
+	if next := r.takePolicyNext(); next != 0 {
+		state.NextRotation = time.Now().Add(next)
+	} else if settings.cycleSecs == 0 {
+		state.NextRotation = time.Time{}
+	} else {
+		state.NextRotation = r.nextRotation(settings)
+	}
+	r.recordNextRotation(state.NextRotation)
+	r.saveState(*state)
+	r.onStatusChange(settled)
 
-	flag.Usage = func() {
-		defaultUsage()
-		fmt.Println(description)
+	if state.NextRotation.IsZero() {
+		r.logger.Info("the timer is off; waiting for a trigger")
+	} else {
+		r.logger.Info(
+			"waiting until the next rotation",
+			"next_rotation", state.NextRotation,
+			"wait_secs", int(time.Until(state.NextRotation)/time.Second),
+		)
+		if settings.dryRun {
+			r.logProjection(settings, state.NextRotation)
+		}
 	}
+	return r.waitUntil(ctx, state.NextRotation, r.rotateNow)
 }
 
-type flags struct {
-	deviceName string
-	cycleSecs  uint
-	dryRun     bool
+// dryRunProjections is how many rotations after the next a dry run projects.
+const dryRunProjections = 3
+
+// logProjection shows when the rotations after the next would happen, as the
+// plan command does. Later draws of the schedule differ, so these are only
+// indicative.
+func (r *rotation) logProjection(settings settings, next time.Time) {
+	rng := rand.New(rand.NewSource(r.rng.Int63()))
+
+	projected := make([]string, dryRunProjections)
+	at := next
+	for i := range projected {
+		at = at.Add(rotator.NextGap(rng, settings.schedule, settings.cycleSecs, settings.variance))
+		projected[i] = at.Format(time.RFC3339)
+	}
+	r.logger.Info("projected the rotations after that", "at", strings.Join(projected, ","))
 }
 
-func parseFlags() flags {
-	var deviceName string
-	var cycleSecs uint
-	var dryRun bool
+// waitToRetry backs off after a failure rather than leaving the device on its
+// old address for a whole cycle, or retrying so quickly that a lasting problem
+// uses up the allowed errors in moments.
+func (r *rotation) waitToRetry(ctx context.Context, failures int) error {
+	delay := rotator.RetryDelay(r.rng, failures)
+	at := time.Now().Add(delay)
+	r.mu.Lock()
+	r.trigger = "retry"
+	r.mu.Unlock()
+	r.recordNextRotation(at)
+	r.onStatusChange(false)
 
-	flag.StringVar(
-		&deviceName,
-		"device-name",
-		defaultDeviceName,
-		"the network device name",
+	r.logger.Info(
+		"retrying after a failure",
+		"next_rotation", at,
+		"wait_secs", int(delay/time.Second),
 	)
-	flag.UintVar(
-		&cycleSecs,
-		"cycle-secs",
-		defaultCycleSecs,
-		"the seconds between each rotation (with variance)",
-	)
-	flag.BoolVar(
-		&dryRun,
-		"dry-run",
-		false,
-		"display the commands to be run without running them",
+	return r.waitUntil(ctx, at, r.rotateNow)
+}
+
+// rotateOnce changes the device's address a single time, with everything
+// that goes along with a change in the loop, but without waiting for a
+// schedule or retrying.
+func rotateOnce(ctx context.Context, r *rotation) error {
+	if err := r.setUpMacvlan(ctx, r.currentSettings()); err != nil {
+		return err
+	}
+
+	state := r.loadState()
+	r.recordAddresses(&state)
+	r.saveState(state)
+
+	settings := r.currentSettings()
+	if err := r.pollForDevice(ctx, settings); err != nil {
+		return err
+	}
+	reason := modeSkipReason(settings, wirelessModeOf(r.deviceName))
+	if reason == "" {
+		reason = r.eapSkipReason(settings)
+	}
+	if reason != "" {
+		return errors.New(reason)
+	}
+
+	trigger := "once"
+	if !r.runPreHook(ctx, settings, trigger) {
+		return errors.New("the pre-rotation hook failed")
+	}
+
+	previous, err := r.prepareAssociation(ctx, settings)
+	if err != nil {
+		return err
+	}
+	target := r.connectivityTarget(ctx, settings)
+	hadCarrier := hasCarrier(r.deviceName)
+	change := r.changeMac(ctx, settings, &state)
+	r.finishAssociation(settings, previous)
+	r.saveState(state)
+
+	r.recordChange(change, nil, trigger)
+	succeeded, ok := change.(*successfulMacChange)
+	if ok {
+		succeeded.handle(r.logger, nil, settings.maxErrs)
+		err := r.awaitCarrier(ctx, settings, hadCarrier)
+		if err == nil {
+			r.followChange(ctx, settings, succeeded)
+			err = r.checkConnectivity(ctx, settings, target, &state, succeeded)
+		}
+		if err != nil {
+			change = &failedMacChange{err, succeeded.mac}
+			r.recordChange(change, []error{err}, trigger)
+		}
+	}
+	r.runPostHook(ctx, settings, trigger, change)
+
+	if failed, ok := change.(*failedMacChange); ok {
+		return failed.err
+	}
+	return nil
+}
+
+func chooseSetMacCmd(flags flags) rotator.SetCommand {
+	if flags.helperSocket != "" {
+		return helperSetCommand
+	}
+	if flags.macvlan {
+		return macvlanSetCommand
+	}
+	switch flags.backend.resolve() {
+	case backendUCI:
+		return escalate(setMacUCI, flags.escalate)
+	case backendConnMan:
+		return escalate(setMacConnMan, flags.escalate)
+	}
+	return escalate(rotator.DefaultSetCommand(), flags.escalate)
+}
+
+// runDaemon rotates until stopped by a signal, which is not an error, or until
+// rotation fails too often.
+func runDaemon(flags flags) error {
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
 	)
+	defer stop()
+
+	// Let a second signal kill the process outright, in case stopping
+	// gracefully hangs.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return runDaemonUntil(ctx, flags)
+}
+
+// runDaemonUntil rotates until the context is cancelled, for callers such as
+// service managers that stop the daemon by means other than signals.
+func runDaemonUntil(ctx context.Context, flags flags) error {
+	// Running out of time is stopping as a signal would, restoring
+	// addresses and all, rather than a failure. The deadline is by the wall
+	// clock, so that time spent suspended counts towards it.
+	if flags.maxRuntime != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		deadline := time.Now().Add(flags.maxRuntime)
+		go func() {
+			// The wait's own logging is about rotations, so is left out.
+			if rotator.WaitUntil(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), deadline, nil) == nil {
+				slog.Info("stopping, as the -max-runtime has passed", "max_runtime", flags.maxRuntime)
+				cancel()
+			}
+		}()
+	}
+
+	if flags.pidFile != "" {
+		if err := writePidFile(flags.pidFile); err != nil {
+			return err
+		}
+		defer os.Remove(flags.pidFile)
+	}
+
+	// Rotating matters more than being controllable, so carry on without.
+	var controlListener net.Listener
+	if flags.controlSocket != "" {
+		var err error
+		if controlListener, err = listenControl(flags.controlSocket); err != nil {
+			slog.Warn("not accepting control requests", "err", err)
+		} else {
+			defer os.Remove(flags.controlSocket)
+			if flags.controlPolkit {
+				if err := os.Chmod(flags.controlSocket, controlPolkitSocketPerm); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	var apiListener net.Listener
+	if flags.api != "" {
+		if flags.apiToken == "" {
+			return errors.New("-api needs an -api-token to authenticate requests with")
+		}
+		var err error
+		if apiListener, err = net.Listen("tcp", flags.api); err != nil {
+			return fmt.Errorf("could not listen for API requests: %w", err)
+		}
+	}
+
+	var grpcListener net.Listener
+	if flags.grpc != "" {
+		if flags.apiToken == "" {
+			return errors.New("-grpc needs an -api-token to authenticate requests with")
+		}
+		var err error
+		if grpcListener, err = net.Listen("tcp", flags.grpc); err != nil {
+			return fmt.Errorf("could not listen for gRPC requests: %w", err)
+		}
+	}
+
+	var bus *dbusConn
+	if flags.dbus {
+		var err error
+		if bus, err = claimDbusName(); err != nil {
+			slog.Warn("not serving on D-Bus", "err", err)
+		}
+	}
+
+	var mqttBroker *url.URL
+	if flags.mqtt != "" {
+		var err error
+		if mqttBroker, err = parseMQTTBroker(flags.mqtt); err != nil {
+			return err
+		}
+	}
 
-	flag.Parse()
-	return flags{deviceName, cycleSecs, dryRun}
+	var hooks *webhooks
+	if len(flags.webhooks) != 0 {
+		var err error
+		if hooks, err = newWebhooks(flags.webhooks, flags.webhookSecret); err != nil {
+			return err
+		}
+	}
+
+	var metrics *statsD
+	if flags.statsD != "" {
+		var err error
+		if metrics, err = newStatsD(flags); err != nil {
+			return err
+		}
+	}
+
+	var exporter *otlpExporter
+	if flags.otlp != "" {
+		var err error
+		if exporter, err = newOTLPExporter(flags); err != nil {
+			return err
+		}
+	}
+
+	var reporter *fleetReporter
+	if flags.reportURL != "" {
+		var err error
+		if reporter, err = newFleetReporter(flags); err != nil {
+			return err
+		}
+	}
+
+	if len(flags.libvirtInterfaces) != 0 {
+		if _, err := exec.LookPath("virsh"); err != nil {
+			return &rotator.ExitError{Code: rotator.ExitMissingTool, Err: errors.New("-libvirt-interfaces needs virsh, from libvirt")}
+		}
+	}
+
+	if flags.desktopNotifications != desktopNever && runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return errors.New("-desktop-notifications is only supported on Linux and macOS")
+	}
+
+	if err := dropPrivileges(flags); err != nil {
+		return fmt.Errorf("could not drop privileges: %w", err)
+	}
+
+	d := newDaemon(flags, chooseSetMacCmd(flags))
+	d.otlp = exporter
+	summary := serveSummary(ctx, d)
+	defer summary.log()
+	handleSignals(ctx, d)
+	if flags.watchConfig && flags.config != "" && flags.config != configStdin {
+		go watchConfig(ctx, d, flags.config)
+	}
+	if flags.configURL != "" && flags.configRefreshSecs != 0 {
+		go refreshRemoteConfig(ctx, d, flags)
+	}
+	if controlListener != nil {
+		serveControl(ctx, d, controlListener)
+	}
+	if apiListener != nil {
+		serveAPI(ctx, d, apiListener, flags.apiToken)
+	}
+	if grpcListener != nil {
+		serveGRPC(ctx, d, grpcListener, flags.apiToken)
+	}
+	if bus != nil {
+		serveDbus(ctx, d, bus)
+	}
+	if mqttBroker != nil {
+		// Give the broker the chance to hear that the daemon is going
+		// offline, however it stops.
+		mqttCtx, stopMQTT := context.WithCancel(ctx)
+		done := serveMQTT(mqttCtx, d, mqttBroker, flags.mqttTopic)
+		defer func() {
+			stopMQTT()
+			select {
+			case <-done:
+			case <-time.After(mqttTimeout):
+			}
+		}()
+	}
+	if hooks != nil {
+		serveWebhooks(ctx, d, hooks)
+	}
+	if metrics != nil {
+		serveStatsD(ctx, d, metrics)
+	}
+	if exporter != nil {
+		serveOTLP(ctx, d, exporter)
+	}
+	if reporter != nil {
+		// Send what has not been reported yet, however the daemon stops.
+		reportCtx, stopReports := context.WithCancel(ctx)
+		done := serveReports(reportCtx, d, reporter)
+		defer func() {
+			stopReports()
+			<-done
+		}()
+	}
+	if len(flags.libvirtInterfaces) != 0 {
+		serveLibvirt(ctx, d, flags)
+	}
+	if flags.ouiRefreshDays != 0 {
+		go refreshOUIRegistry(ctx, flags)
+	}
+	if flags.desktopNotifications != desktopNever {
+		serveDesktopNotifications(ctx, d, flags.desktopNotifications)
+	}
+	if liveStatus != nil {
+		// Clear the line before whatever is logged on stopping.
+		statusCtx, stopStatus := context.WithCancel(ctx)
+		done := serveStatusLine(statusCtx, d, liveStatus)
+		defer func() {
+			stopStatus()
+			<-done
+		}()
+	}
+	pingWatchdog(ctx, d)
+
+	slog.Info("rotating MAC addresses", "devices", strings.Join(flags.deviceNames, ","), "version", readBuildInfo().Version)
+	events.emit(outputEvent{Event: eventStartup, Devices: flags.deviceNames})
+	err := d.run(ctx)
+	sdNotify("STOPPING=1")
+
+	shutdown := outputEvent{Event: eventShutdown}
+	if !errors.Is(err, context.Canceled) {
+		shutdown.Error = err.Error()
+	}
+	events.emit(shutdown)
+	if errors.Is(err, context.Canceled) {
+		slog.Info("stopping")
+		return nil
+	}
+	if hooks != nil {
+		hooks.abort(err)
+	}
+	if flags.desktopNotifications != desktopNever {
+		abortDesktopNotifications(err)
+	}
+	return err
 }
 
 func main() {
 	initUsage()
-	flags := parseFlags()
 
-	var newSetMacCmd newSetMacCmd
-	if isLinux() {
-		newSetMacCmd = newSetMacLinuxCmd
-	} else {
-		newSetMacCmd = newSetMacUnixCmd
+	args := os.Args[1:]
+	run := runRun
+	if 0 < len(args) {
+		// The usual flags for the version work too, though it is a command.
+		if args[0] == "-version" || args[0] == "--version" {
+			args[0] = "version"
+		}
+		if command, ok := findCommand(args[0]); ok {
+			run, args = command.run, args[1:]
+		}
 	}
 
-	log.Println("rotating MAC address...")
-	err := rotateMacAddrs(
-		flags.deviceName,
-		flags.cycleSecs,
-		newSetMacCmd,
-		flags.dryRun,
-	)
-	if err != nil {
-		log.Fatalln(err)
+	if err := run(args); err != nil {
+		log.Println(err)
+		os.Exit(rotator.ExitCode(err))
 	}
 }
+
+func fatal(err error) {
+	slog.Error("exiting", "err", err, "exit_code", rotator.ExitCode(err))
+	os.Exit(rotator.ExitCode(err))
+}
@@ -0,0 +1,23 @@
+package main
+
+import "log/slog"
+
+// warnOfManagers logs the network managers that may undo rotations on
+// starting, as the first sign of them is otherwise an address quietly going
+// back.
+func warnOfManagers(deviceNames []string, backend setBackend) {
+	for _, d := range diagnoseManagers(deviceNames, backend) {
+		if d.ok || d.skipped {
+			continue
+		}
+
+		args := []any{"manager", d.name, "detail", d.detail}
+		if d.hint != "" {
+			args = append(args, "hint", d.hint)
+		}
+		if d.fix != nil {
+			args = append(args, "fix", "run the doctor command with -fix")
+		}
+		slog.Warn("a network manager may undo rotations", args...)
+	}
+}
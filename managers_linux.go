@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	networkManagerConfDir = "/etc/NetworkManager/conf.d"
+	systemdNetworkDir     = "/etc/systemd/network"
+)
+
+// diagnoseManagers looks for network managers that set addresses of their own
+// when they activate a connection, or whenever a device appears, undoing
+// rotations.
+func diagnoseManagers(deviceNames []string, backend setBackend) []diagnosis {
+	var diagnoses []diagnosis
+
+	if _, err := os.Stat("/run/NetworkManager"); err == nil {
+		diagnoses = append(diagnoses, diagnoseNetworkManager(deviceNames))
+	}
+	if _, err := os.Stat("/run/systemd/netif"); err == nil {
+		diagnoses = append(diagnoses, diagnoseNetworkd())
+	}
+	for _, deviceName := range deviceNames {
+		if d, ok := diagnoseLinkFile(deviceName); ok {
+			diagnoses = append(diagnoses, d)
+		}
+	}
+	if _, err := os.Stat(connmanRun); err == nil {
+		diagnoses = append(diagnoses, diagnoseConnMan(backend))
+	}
+	if _, err := os.Stat("/sbin/netifd"); err == nil {
+		diagnoses = append(diagnoses, diagnoseNetifd(backend))
+	}
+	if d, ok := diagnoseDhcpcd(); ok {
+		diagnoses = append(diagnoses, d)
+	}
+
+	if len(diagnoses) == 0 {
+		diagnoses = append(diagnoses, diagnosis{
+			name:   "network managers",
+			ok:     true,
+			detail: "none found that would fight over addresses",
+		})
+	}
+	return diagnoses
+}
+
+func diagnoseNetworkManager(deviceNames []string) diagnosis {
+	d := diagnosis{name: "NetworkManager"}
+	if networkManagerPreserves() {
+		d.ok = true
+		d.detail = "running, and configured to preserve addresses"
+		return d
+	}
+
+	var managed []string
+	for _, deviceName := range deviceNames {
+		out, err := exec.Command("nmcli", "--get-values", "GENERAL.STATE", "device", "show", deviceName).Output()
+		if err != nil || !strings.Contains(string(out), "unmanaged") {
+			managed = append(managed, deviceName)
+		}
+	}
+	if len(managed) == 0 {
+		d.ok = true
+		d.detail = "running, but not managing " + strings.Join(deviceNames, ", ")
+		return d
+	}
+
+	d.detail = fmt.Sprintf("running, and may reset the address of %s whenever it activates a connection", strings.Join(managed, ", "))
+	d.hint = "set ethernet.cloned-mac-address=preserve and wifi.cloned-mac-address=preserve under [connection] in " + networkManagerConfDir + "/, and unset cloned-mac-address in connections that set it"
+	d.fix = fixNetworkManager
+	return d
+}
+
+func networkManagerPreserves() bool {
+	paths, _ := filepath.Glob(networkManagerConfDir + "/*.conf")
+	paths = append(paths, "/etc/NetworkManager/NetworkManager.conf")
+
+	ethernet, wifi := false, false
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			switch strings.ReplaceAll(strings.TrimSpace(line), " ", "") {
+			case "ethernet.cloned-mac-address=preserve":
+				ethernet = true
+			case "wifi.cloned-mac-address=preserve":
+				wifi = true
+			}
+		}
+	}
+	return ethernet && wifi
+}
+
+func fixNetworkManager() (string, error) {
+	path := filepath.Join(networkManagerConfDir, "90-"+programName+".conf")
+	conf := "# Written by " + programName + " doctor -fix, so that NetworkManager leaves\n" +
+		"# rotated addresses alone.\n" +
+		"[connection]\n" +
+		"ethernet.cloned-mac-address=preserve\n" +
+		"wifi.cloned-mac-address=preserve\n"
+
+	if err := os.MkdirAll(networkManagerConfDir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		return "", err
+	}
+	if out, err := exec.Command("nmcli", "general", "reload", "conf").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("wrote %s, but NetworkManager could not reload it: %w: %s", path, err, strings.TrimSpace(string(out)))
+	}
+	return "wrote " + path, nil
+}
+
+// diagnoseNetworkd looks for .network files setting addresses, which
+// systemd-networkd applies whenever it configures a device.
+func diagnoseNetworkd() diagnosis {
+	d := diagnosis{name: "systemd-networkd"}
+
+	var setting []string
+	for _, dir := range []string{systemdNetworkDir, "/run/systemd/network"} {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.network"))
+		for _, path := range paths {
+			if sections, err := readUnitFile(path); err == nil && sections.value("Link", "MACAddress") != "" {
+				setting = append(setting, path)
+			}
+		}
+	}
+	if len(setting) == 0 {
+		d.ok = true
+		d.detail = "running, and setting no addresses"
+		return d
+	}
+
+	d.detail = "running, and setting addresses in " + strings.Join(setting, ", ")
+	d.hint = "remove MACAddress= from the [Link] sections of those that match the devices"
+	return d
+}
+
+// linkFileOf is the systemd .link file that udev applied to the device when
+// it appeared.
+func linkFileOf(deviceName string) string {
+	out, err := exec.Command("udevadm", "info", "--query=property", "--path=/sys/class/net/"+deviceName).Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if path, ok := strings.CutPrefix(line, "ID_NET_LINK_FILE="); ok {
+			return path
+		}
+	}
+	return ""
+}
+
+// diagnoseLinkFile checks whether udev gives the device an address of its
+// own whenever it appears, such as after being reset or plugged back in.
+func diagnoseLinkFile(deviceName string) (diagnosis, bool) {
+	path := linkFileOf(deviceName)
+	if path == "" {
+		return diagnosis{}, false
+	}
+	sections, err := readUnitFile(path)
+	if err != nil {
+		return diagnosis{}, false
+	}
+
+	d := diagnosis{name: deviceName + " link file"}
+	switch policy := sections.value("Link", "MACAddressPolicy"); {
+	case policy == "persistent" || policy == "random" || sections.value("Link", "MACAddress") != "":
+		d.detail = fmt.Sprintf("%s sets the address whenever the device appears, such as after being reset or plugged back in", path)
+		d.hint = "copy it to an earlier .link file in " + systemdNetworkDir + " that matches just this device, with MACAddressPolicy=none"
+		d.fix = func() (string, error) {
+			return fixLinkFile(deviceName, path, sections)
+		}
+	default:
+		d.ok = true
+		d.detail = fmt.Sprintf("%s leaves the address alone", path)
+	}
+	return d, true
+}
+
+// fixLinkFile copies the link file to one that sorts first and matches just
+// the device, without the address, as only the first link file to match a
+// device applies.
+func fixLinkFile(deviceName, original string, sections unitFile) (string, error) {
+	match := "OriginalName=" + deviceName
+	if permanent, err := permanentMac(deviceName); err == nil {
+		match = "PermanentMACAddress=" + string(permanent)
+	}
+
+	var conf strings.Builder
+	fmt.Fprintf(&conf, "# Written by %s doctor -fix from %s, so that udev leaves\n# rotated addresses alone.\n", programName, original)
+	fmt.Fprintf(&conf, "[Match]\n%s\n", match)
+	for _, section := range sections {
+		if section.name == "Match" {
+			continue
+		}
+		fmt.Fprintf(&conf, "\n[%s]\n", section.name)
+		for _, line := range section.lines {
+			key, _, _ := strings.Cut(line, "=")
+			if key = strings.TrimSpace(key); section.name == "Link" && (key == "MACAddressPolicy" || key == "MACAddress") {
+				continue
+			}
+			fmt.Fprintln(&conf, line)
+		}
+		if section.name == "Link" {
+			fmt.Fprintln(&conf, "MACAddressPolicy=none")
+		}
+	}
+
+	path := filepath.Join(systemdNetworkDir, "10-"+programName+"-"+deviceName+".link")
+	if err := os.MkdirAll(systemdNetworkDir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(conf.String()), 0o644); err != nil {
+		return "", err
+	}
+	if err := exec.Command("udevadm", "control", "--reload").Run(); err != nil {
+		return "", fmt.Errorf("wrote %s, but udev could not reload it: %w", path, err)
+	}
+	return "wrote " + path + ", which applies the next time the device appears", nil
+}
+
+func diagnoseConnMan(backend setBackend) diagnosis {
+	if backend.resolve() == backendConnMan {
+		return diagnosis{
+			name:   "ConnMan",
+			ok:     true,
+			detail: "running, and disconnected around each change",
+		}
+	}
+	return diagnosis{
+		name:   "ConnMan",
+		detail: "running, and may reset addresses whenever it connects",
+		hint:   "pass -backend connman to disconnect through ConnMan around each change, and make sure AddressConflictDetection and MAC randomisation are off in /etc/connman/main.conf",
+	}
+}
+
+func diagnoseNetifd(backend setBackend) diagnosis {
+	d := diagnosis{name: "netifd"}
+	if backend.resolve() == backendUCI {
+		d.ok = true
+		d.detail = "running, and given each new address through UCI"
+		return d
+	}
+
+	data, err := os.ReadFile("/etc/config/network")
+	if err == nil && strings.Contains(string(data), "option macaddr") {
+		d.detail = "running, and setting addresses in /etc/config/network whenever an interface comes up"
+		d.hint = "pass -backend uci to rotate addresses through UCI, or remove option macaddr from the sections of the devices in /etc/config/network"
+		return d
+	}
+
+	d.ok = true
+	d.detail = "running, and setting no addresses"
+	return d
+}
+
+// diagnoseDhcpcd looks for dhcpcd randomising addresses itself, or hooks of
+// its setting them.
+func diagnoseDhcpcd() (diagnosis, bool) {
+	d := diagnosis{name: "dhcpcd"}
+	const conf = "/etc/dhcpcd.conf"
+
+	data, err := os.ReadFile(conf)
+	if err != nil {
+		return d, false
+	}
+	if strings.Contains(string(data), "randomise_hwaddr") {
+		d.detail = conf + " has dhcpcd randomise addresses itself whenever it starts"
+		d.hint = "remove randomise_hwaddr from " + conf
+		return d, true
+	}
+
+	hooks, _ := filepath.Glob("/lib/dhcpcd/dhcpcd-hooks/*")
+	more, _ := filepath.Glob("/usr/lib/dhcpcd/dhcpcd-hooks/*")
+	hooks = append(append(hooks, more...), "/etc/dhcpcd.enter-hook", "/etc/dhcpcd.exit-hook")
+	for _, hook := range hooks {
+		data, err := os.ReadFile(hook)
+		if err == nil && strings.Contains(string(data), "link set") && strings.Contains(string(data), "address") {
+			d.detail = hook + " may set addresses whenever dhcpcd runs its hooks"
+			d.hint = "remove the command setting the address from " + hook
+			return d, true
+		}
+	}
+
+	d.ok = true
+	d.detail = "neither randomising addresses nor setting them in hooks"
+	return d, true
+}
+
+// unitFile is a systemd unit file's sections, in order, keeping their lines
+// as they were.
+type unitFile []unitSection
+
+type unitSection struct {
+	name  string
+	lines []string
+}
+
+func readUnitFile(path string) (unitFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sections unitFile
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			sections = append(sections, unitSection{name: strings.Trim(line, "[]")})
+		case len(sections) == 0:
+			return nil, errors.New(path + ": settings come before any section")
+		default:
+			last := &sections[len(sections)-1]
+			last.lines = append(last.lines, line)
+		}
+	}
+	return sections, scanner.Err()
+}
+
+// value is the last setting of the key in the section, which is the one that
+// applies.
+func (sections unitFile) value(section, key string) string {
+	value := ""
+	for _, s := range sections {
+		if s.name != section {
+			continue
+		}
+		for _, line := range s.lines {
+			if k, v, ok := strings.Cut(line, "="); ok && strings.TrimSpace(k) == key {
+				value = strings.TrimSpace(v)
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+func diagnoseManagers([]string, setBackend) []diagnosis {
+	return []diagnosis{{
+		name:    "network managers",
+		skipped: true,
+		detail:  "not checked on this platform",
+	}}
+}
@@ -0,0 +1,37 @@
+package main
+
+import "log/slog"
+
+// rotateMdnsName gives the machine a fresh name to advertise over multicast
+// DNS alongside each new address, since Bonjour and Avahi announcements
+// would otherwise tie the new address to the old advertised name within
+// seconds. As with the hostname, any device's rotation changes it.
+func (r *rotation) rotateMdnsName(settings settings) {
+	if settings.mdnsPattern == "" {
+		return
+	}
+
+	name := generateHostname(r.rng, settings.mdnsPattern, settings.hostnameWords)
+	if settings.dryRun {
+		r.logger.Info("would change the mDNS name", "mdns_name", name)
+		return
+	}
+	if err := setMdnsName(name); err != nil {
+		r.logger.Warn("could not change the mDNS name", "mdns_name", name, "err", err)
+		return
+	}
+	r.logger.Info("changed the mDNS name", "mdns_name", name)
+}
+
+// restoreMdnsName puts back the name the machine advertised before rotating.
+func restoreMdnsName(flags flags, original string) {
+	if flags.mdnsPattern == "" || original == "" || flags.dryRun {
+		return
+	}
+
+	if err := setMdnsName(original); err != nil {
+		slog.Error("could not restore the mDNS name", "mdns_name", original, "err", err)
+		return
+	}
+	slog.Info("restored the mDNS name", "mdns_name", original)
+}
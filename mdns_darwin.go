@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func currentMdnsName() (string, error) {
+	out, err := exec.Command("scutil", "--get", "LocalHostName").Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// setMdnsName changes the LocalHostName preference, which mDNSResponder
+// advertises as name.local, announcing the change straight away.
+func setMdnsName(name string) error {
+	if out, err := exec.Command("scutil", "--set", "LocalHostName", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
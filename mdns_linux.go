@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// currentMdnsName assumes Avahi advertises the hostname, as it does unless
+// avahi-daemon.conf sets host-name.
+func currentMdnsName() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	name, _, _ := strings.Cut(hostname, ".")
+	return name, nil
+}
+
+// setMdnsName has Avahi withdraw its records and announce them again under
+// the new name.
+func setMdnsName(name string) error {
+	if out, err := exec.Command("avahi-set-host-name", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+var errNoMdnsSupport = errors.New("the mDNS name can only be changed on Linux, with Avahi, and macOS")
+
+func currentMdnsName() (string, error) {
+	return "", errNoMdnsSupport
+}
+
+func setMdnsName(string) error {
+	return errNoMdnsSupport
+}
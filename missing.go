@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// missingDevicePolicy is what to do when a device does not exist, such as a
+// USB adapter that was unplugged or a dock that was removed.
+type missingDevicePolicy string
+
+const (
+	missingDeviceWait missingDevicePolicy = "wait"
+	missingDeviceFail                     = "fail"
+)
+
+func parseMissingDevicePolicy(value string) (missingDevicePolicy, error) {
+	switch policy := missingDevicePolicy(value); policy {
+	case missingDeviceWait, missingDeviceFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown missing device policy %q", value)
+	}
+}
+
+const devicePollInterval = 2 * time.Second
+
+func missingDeviceError(deviceName string) error {
+	return &rotator.ExitError{Code: rotator.ExitMissingDevice, Err: fmt.Errorf("the device %s does not exist", deviceName)}
+}
+
+func deviceExists(deviceName string) bool {
+	_, err := net.InterfaceByName(deviceName)
+	return err == nil
+}
+
+// awaitDevice reports whether the device is there to rotate, waiting for the
+// device trigger's word otherwise, or failing if the policy says to.
+func (r *rotation) awaitDevice(ctx context.Context, settings settings) (bool, error) {
+	if deviceExists(r.deviceName) {
+		return true, nil
+	}
+	if settings.missingDevice == missingDeviceFail {
+		return false, missingDeviceError(r.deviceName)
+	}
+
+	r.logger.Warn("the device is missing, so waiting for it to return")
+	r.recordNextRotation(time.Time{})
+	r.onStatusChange(true)
+	return false, r.waitUntil(ctx, time.Time{}, r.rotateNow)
+}
+
+// pollForDevice waits for the device to exist, for single rotations, which
+// have no triggers to wait on.
+func (r *rotation) pollForDevice(ctx context.Context, settings settings) error {
+	if deviceExists(r.deviceName) {
+		return nil
+	}
+	if settings.missingDevice == missingDeviceFail {
+		return missingDeviceError(r.deviceName)
+	}
+
+	r.logger.Warn("the device is missing, so waiting for it to return")
+	ticker := time.NewTicker(devicePollInterval)
+	defer ticker.Stop()
+	for !deviceExists(r.deviceName) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	r.logger.Info("the device has returned")
+	return nil
+}
+
+// watchDeviceTrigger rotates a device as soon as it returns after going
+// missing, as it comes back with its permanent address.
+func watchDeviceTrigger(ctx context.Context, d *daemon, r *rotation) error {
+	present := deviceExists(r.deviceName)
+	ticker := time.NewTicker(devicePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		switch now := deviceExists(r.deviceName); {
+		case now && !present:
+			if d.currentFlags().missingDevice == missingDeviceWait {
+				r.requestRotation("it returned after going missing")
+			}
+			present = true
+		case !now && present:
+			r.logger.Warn("the device went missing")
+			present = false
+		}
+	}
+}
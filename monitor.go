@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const defaultMonitorIntervalSecs = 5
+
+// The kinds of webhook event that monitor posts.
+const (
+	webhookDrifted  = "drifted"
+	webhookReverted = "reverted"
+)
+
+// watchedDevice is what monitor knows of a device: the address it last saw,
+// and the permanent one it must not go back to.
+type watchedDevice struct {
+	name      string
+	last      rotator.MAC
+	permanent rotator.MAC
+}
+
+// runMonitor changes nothing, but watches each device's address, alerting
+// when it changes or goes back to the permanent one. That checks on whatever
+// else rotates the addresses, such as a network manager's own randomisation,
+// and trips on anything else changing them.
+func runMonitor(args []string) error {
+	flagSet := flag.NewFlagSet("monitor", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var intervalSecs uint
+	var allowChanges, exitOnAlert bool
+	flagSet.UintVar(
+		&intervalSecs,
+		"interval-secs",
+		defaultMonitorIntervalSecs,
+		"the seconds between looking at each device's address",
+	)
+	flagSet.BoolVar(
+		&allowChanges,
+		"allow-changes",
+		false,
+		"only alert when a device goes back to its permanent address, for when something else rotates them",
+	)
+	flagSet.BoolVar(
+		&exitOnAlert,
+		"exit-on-alert",
+		false,
+		"exit with an error on the first alert, for a service manager or script to act on",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	if intervalSecs == 0 {
+		return fmt.Errorf("-interval-secs must be at least 1")
+	}
+	if err := pickDevicesIfUnset(flagSet, flags); err != nil {
+		return err
+	}
+	if err := setUpLogging(os.Stderr, *flags); err != nil {
+		return err
+	}
+
+	var hooks *webhooks
+	if len(flags.webhooks) != 0 {
+		var err error
+		if hooks, err = newWebhooks(flags.webhooks, flags.webhookSecret); err != nil {
+			return err
+		}
+	}
+
+	devices := make([]*watchedDevice, 0, len(flags.deviceNames))
+	for _, deviceName := range flags.deviceNames {
+		mac, err := rotator.CurrentMAC(deviceName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", deviceName, err)
+		}
+		device := &watchedDevice{name: deviceName, last: mac}
+		if device.permanent, err = permanentMac(deviceName); err != nil {
+			// The state directory has it from before the address was
+			// first changed, where the hardware cannot say.
+			state, _ := loadDeviceState(flags.stateDir, deviceName)
+			device.permanent = state.PermanentMac
+		}
+		devices = append(devices, device)
+		slog.Info("watching the device's MAC address", "device", deviceName, "mac", mac, "permanent_mac", orDash(string(device.permanent)))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	alert := func(device *watchedDevice, event webhookEvent) error {
+		slog.Warn(event.Text, "device", device.name, "old_mac", orDash(string(event.Previous)), "new_mac", event.Mac)
+		if hooks != nil {
+			hooks.post(ctx, event)
+		}
+		if exitOnAlert {
+			return fmt.Errorf("%s", event.Text)
+		}
+		return nil
+	}
+
+	// Being on the permanent address already is as much a reason to alert as
+	// going back to it.
+	for _, device := range devices {
+		if device.permanent != "" && device.last == device.permanent {
+			if err := alert(device, monitorEvent(webhookReverted, device, "")); err != nil {
+				return err
+			}
+		}
+	}
+
+	ticker := time.NewTicker(time.Duration(intervalSecs) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, device := range devices {
+			mac, err := rotator.CurrentMAC(device.name)
+			if err != nil {
+				slog.Warn("could not read the device's MAC address", "device", device.name, "err", err)
+				continue
+			}
+			if mac == device.last {
+				continue
+			}
+			previous := device.last
+			device.last = mac
+
+			var event webhookEvent
+			switch {
+			case device.permanent != "" && mac == device.permanent:
+				event = monitorEvent(webhookReverted, device, previous)
+			case allowChanges:
+				slog.Info("the device's MAC address changed", "device", device.name, "old_mac", previous, "new_mac", mac)
+				continue
+			default:
+				event = monitorEvent(webhookDrifted, device, previous)
+			}
+			if err := alert(device, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func monitorEvent(kind string, device *watchedDevice, previous rotator.MAC) webhookEvent {
+	entry := historyEntry{
+		At:       time.Now(),
+		Device:   device.name,
+		Mac:      device.last,
+		Vendor:   rotator.VendorOf(device.last),
+		Previous: previous,
+	}
+
+	var text string
+	switch {
+	case kind == webhookReverted && previous == "":
+		text = fmt.Sprintf("%s is on its permanent MAC address %s", device.name, device.last)
+	case kind == webhookReverted:
+		text = fmt.Sprintf("%s went back from %s to its permanent MAC address %s", device.name, previous, device.last)
+	default:
+		text = fmt.Sprintf("%s changed unexpectedly from %s to %s", device.name, previous, device.last)
+	}
+	return webhookEvent{kind, text, entry}
+}
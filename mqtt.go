@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	defaultMQTTTopic  = "rotate-mac-address"
+	mqttKeepAlive     = time.Minute
+	mqttTimeout       = 10 * time.Second
+	mqttMinRetryDelay = time.Second
+	mqttMaxRetryDelay = 5 * time.Minute
+)
+
+// The MQTT 3.1.1 packet types used.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPingreq    = 12
+	mqttDisconnect = 14
+)
+
+// The CONNECT flags used.
+const (
+	mqttCleanSession = 0x02
+	mqttWill         = 0x04
+	mqttWillRetain   = 0x20
+	mqttPassword     = 0x40
+	mqttUsername     = 0x80
+)
+
+const mqttRetain = 0x01
+
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad username or password",
+	5: "not authorised",
+}
+
+// The retained availability payloads, which Home Assistant expects by default.
+const (
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+)
+
+// parseMQTTBroker accepts mqtt:// and, for TLS, mqtts:// addresses, optionally
+// with user information for authenticating.
+func parseMQTTBroker(value string) (*url.URL, error) {
+	broker, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if broker.Scheme != "mqtt" && broker.Scheme != "mqtts" {
+		return nil, fmt.Errorf("MQTT brokers must be mqtt:// or mqtts:// addresses, not %q", value)
+	}
+	if broker.Hostname() == "" {
+		return nil, fmt.Errorf("no host in MQTT broker %q", value)
+	}
+	return broker, nil
+}
+
+// serveMQTT publishes each change as a retained JSON message to
+// <topic>/<device>/rotation, and whether the daemon is running to
+// <topic>/availability, reconnecting to the broker whenever the connection
+// drops. The returned channel closes once it has said goodbye to the broker.
+func serveMQTT(ctx context.Context, d *daemon, broker *url.URL, topic string) <-chan struct{} {
+	done := make(chan struct{})
+	entries, unsubscribe := d.history.subscribe()
+
+	go func() {
+		defer close(done)
+		defer unsubscribe()
+
+		delay := mqttMinRetryDelay
+		for {
+			connected := time.Now()
+			err := publishMQTTSession(ctx, broker, topic, entries)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if mqttMaxRetryDelay < time.Since(connected) {
+				delay = mqttMinRetryDelay
+			}
+			slog.Warn("lost the MQTT broker", "broker", broker.Redacted(), "err", err, "retry_in", delay)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, mqttMaxRetryDelay)
+		}
+	}()
+
+	return done
+}
+
+func publishMQTTSession(ctx context.Context, broker *url.URL, topic string, entries <-chan historyEntry) error {
+	conn, err := dialMQTT(ctx, broker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	availability := topic + "/availability"
+	if err := connectMQTT(conn, broker, availability); err != nil {
+		return err
+	}
+	if err := writeMQTT(conn, mqttPublish<<4|mqttRetain, mqttPublishBody(availability, []byte(mqttOnline))); err != nil {
+		return err
+	}
+
+	// Nothing is subscribed to, so all that comes back are ping responses,
+	// and the connection is lost once even those stop.
+	lost := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(conn)
+		for {
+			conn.SetReadDeadline(time.Now().Add(mqttKeepAlive + mqttTimeout))
+			if _, _, err := readMQTT(reader); err != nil {
+				lost <- err
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(mqttKeepAlive / 2)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Saying goodbye outright stops the broker from publishing the
+			// will, so go offline first.
+			writeMQTT(conn, mqttPublish<<4|mqttRetain, mqttPublishBody(availability, []byte(mqttOffline)))
+			writeMQTT(conn, mqttDisconnect<<4, nil)
+			return ctx.Err()
+
+		case err := <-lost:
+			return err
+
+		case <-ping.C:
+			if err := writeMQTT(conn, mqttPingreq<<4, nil); err != nil {
+				return err
+			}
+
+		case entry := <-entries:
+			payload, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			body := mqttPublishBody(topic+"/"+entry.Device+"/rotation", payload)
+			if err := writeMQTT(conn, mqttPublish<<4|mqttRetain, body); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func dialMQTT(ctx context.Context, broker *url.URL) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+
+	if broker.Scheme == "mqtts" {
+		port := broker.Port()
+		if port == "" {
+			port = "8883"
+		}
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    &tls.Config{ServerName: broker.Hostname()},
+		}
+		return tlsDialer.DialContext(ctx, "tcp", net.JoinHostPort(broker.Hostname(), port))
+	}
+
+	port := broker.Port()
+	if port == "" {
+		port = "1883"
+	}
+	return dialer.DialContext(ctx, "tcp", net.JoinHostPort(broker.Hostname(), port))
+}
+
+// connectMQTT starts a clean session, leaving a will that marks the daemon
+// offline should the connection drop without a goodbye.
+func connectMQTT(conn net.Conn, broker *url.URL, availability string) error {
+	hostname, _ := os.Hostname()
+	clientID := fmt.Sprintf("rotate-mac-address-%s-%d", hostname, os.Getpid())
+
+	var flags byte = mqttCleanSession | mqttWill | mqttWillRetain
+	if broker.User != nil {
+		flags |= mqttUsername
+		if _, ok := broker.User.Password(); ok {
+			flags |= mqttPassword
+		}
+	}
+
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	body = appendMQTTString(body, clientID)
+	body = appendMQTTString(body, availability)
+	body = appendMQTTString(body, mqttOffline)
+	if broker.User != nil {
+		body = appendMQTTString(body, broker.User.Username())
+		if password, ok := broker.User.Password(); ok {
+			body = appendMQTTString(body, password)
+		}
+	}
+
+	if err := writeMQTT(conn, mqttConnect<<4, body); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(mqttTimeout))
+	header, reply, err := readMQTT(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	if header>>4 != mqttConnack || len(reply) != 2 {
+		return errors.New("the broker did not acknowledge the connection")
+	}
+	if code := reply[1]; code != 0 {
+		if reason, ok := mqttConnackErrors[code]; ok {
+			return fmt.Errorf("the broker refused the connection: %s", reason)
+		}
+		return fmt.Errorf("the broker refused the connection with code %d", code)
+	}
+	return nil
+}
+
+func mqttPublishBody(topic string, payload []byte) []byte {
+	return append(appendMQTTString(nil, topic), payload...)
+}
+
+func appendMQTTString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+func writeMQTT(conn net.Conn, header byte, body []byte) error {
+	packet := []byte{header}
+
+	// The remaining length is seven bits at a time, least significant first.
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if 0 < length {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(mqttTimeout))
+	_, err := conn.Write(append(packet, body...))
+	return err
+}
+
+func readMQTT(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 0
+	for shift := 0; ; shift += 7 {
+		if 21 < shift {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+		digit, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// flushNeighbors forgets the host's cached link-layer addresses of its
+// neighbours on the device, which can otherwise blackhole traffic for a minute
+// after a change, especially when the change also brings a new lease.
+func (r *rotation) flushNeighbors(settings settings) {
+	if !settings.flushNeighbors {
+		return
+	}
+	if settings.dryRun {
+		r.logger.Info("would flush the neighbour cache")
+		return
+	}
+
+	if err := flushNeighborCache(r.deviceName); err != nil {
+		r.logger.Warn("could not flush the neighbour cache", "err", err)
+		return
+	}
+	r.logger.Debug("flushed the neighbour cache")
+}
+
+func flushNeighborCache(deviceName string) error {
+	var errs []string
+	for _, cmd := range flushNeighborsCmds(deviceName) {
+		if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v: %s", strings.Join(cmd, " "), err, strings.TrimSpace(string(out))))
+		}
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// neighborMacs lists the link-layer addresses of the device's neighbours that
+// the host has cached, in whichever form the platform's tool prints them.
+func neighborMacs(deviceName string) ([]net.HardwareAddr, error) {
+	cmd := listNeighborsCmd(deviceName)
+	out, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.Join(cmd, " "), err)
+	}
+
+	var addrs []net.HardwareAddr
+	for _, field := range strings.Fields(string(out)) {
+		if addr, ok := parseLooseMac(field); ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// parseLooseMac reads an address separated by colons or hyphens, allowing the
+// single digits that the BSDs' arp prints for octets below 0x10.
+func parseLooseMac(value string) (net.HardwareAddr, bool) {
+	octets := strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == '-' })
+	if len(octets) != 6 || strings.Count(value, ":")+strings.Count(value, "-") != 5 {
+		return nil, false
+	}
+	addr := make(net.HardwareAddr, 6)
+	for i, octet := range octets {
+		b, err := strconv.ParseUint(octet, 16, 8)
+		if err != nil || 2 < len(octet) {
+			return nil, false
+		}
+		addr[i] = byte(b)
+	}
+	if slices.Equal(addr, make(net.HardwareAddr, 6)) {
+		return nil, false
+	}
+	return addr, true
+}
@@ -0,0 +1,14 @@
+package main
+
+// flushNeighborsCmds clears the device's ARP entries, but all of the NDP
+// cache, which ndp cannot limit to one device when flushing.
+func flushNeighborsCmds(deviceName string) [][]string {
+	return [][]string{
+		{"arp", "-d", "-a", "-i", deviceName},
+		{"ndp", "-c"},
+	}
+}
+
+func listNeighborsCmd(deviceName string) []string {
+	return []string{"arp", "-a", "-n", "-i", deviceName}
+}
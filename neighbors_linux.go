@@ -0,0 +1,9 @@
+package main
+
+func flushNeighborsCmds(deviceName string) [][]string {
+	return [][]string{{"ip", "neigh", "flush", "dev", deviceName}}
+}
+
+func listNeighborsCmd(deviceName string) []string {
+	return []string{"ip", "neigh", "show", "dev", deviceName}
+}
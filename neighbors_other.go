@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+// flushNeighborsCmds clears the whole ARP and NDP caches, which the BSDs'
+// tools cannot limit to one device.
+func flushNeighborsCmds(string) [][]string {
+	return [][]string{{"arp", "-d", "-a"}, {"ndp", "-c"}}
+}
+
+func listNeighborsCmd(string) []string {
+	return []string{"arp", "-a", "-n"}
+}
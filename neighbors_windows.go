@@ -0,0 +1,14 @@
+package main
+
+func flushNeighborsCmds(deviceName string) [][]string {
+	return [][]string{
+		{"netsh", "interface", "ipv4", "delete", "neighbors", deviceName},
+		{"netsh", "interface", "ipv6", "delete", "neighbors", deviceName},
+	}
+}
+
+// listNeighborsCmd lists every device's neighbours, as arp cannot pick a
+// device by its name.
+func listNeighborsCmd(string) []string {
+	return []string{"arp", "-a"}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// networkTrust overrides whether a network counts as trusted, where rotation
+// is suspended, known, or untrusted, for -aggressive-on untrusted.
+type networkTrust string
+
+const (
+	trustUnset     networkTrust = ""
+	trustTrusted                = "trusted"
+	trustKnown                  = "known"
+	trustUntrusted              = "untrusted"
+)
+
+func parseNetworkTrust(value string) (networkTrust, error) {
+	switch trust := networkTrust(value); trust {
+	case trustTrusted, trustKnown, trustUntrusted:
+		return trust, nil
+	default:
+		return "", fmt.Errorf("unknown trust level %q", value)
+	}
+}
+
+// networkProfile overrides settings while a device is on a network, matched
+// by SSID or BSSID, given by a config table such as:
+//
+//	[network."CoffeeShop_Free"]
+//	cycle-secs = 600
+//	vendors = ["intel", "cisco"]
+//
+// Settings it leaves out keep their values from outside the table.
+type networkProfile struct {
+	match string
+	trust networkTrust
+
+	cycleSecs       *uint
+	variance        *float64
+	schedule        rotator.Schedule
+	vendors         []rotator.VendorPrefix
+	hostnamePattern *string
+	mdnsPattern     *string
+}
+
+// parseNetworkProfile reads the values of a config table, which can only set
+// what makes sense to vary between networks.
+func parseNetworkProfile(path, match string, values []configValue) (networkProfile, error) {
+	profile := networkProfile{match: match}
+
+	for _, v := range values {
+		var err error
+		switch strings.ReplaceAll(v.key, "_", "-") {
+		case "trust":
+			profile.trust, err = parseNetworkTrust(v.value)
+		case "cycle-secs":
+			var secs uint64
+			secs, err = strconv.ParseUint(v.value, 10, 0)
+			cycleSecs := uint(secs)
+			profile.cycleSecs = &cycleSecs
+		case "variance":
+			var variance float64
+			variance, err = strconv.ParseFloat(v.value, 64)
+			profile.variance = &variance
+		case "schedule":
+			profile.schedule, err = rotator.ParseSchedule(v.value)
+		case "vendors":
+			profile.vendors, err = rotator.ParseVendors(v.value)
+		case "hostname-pattern":
+			var pattern string
+			pattern, err = parseHostnamePattern(v.value)
+			profile.hostnamePattern = &pattern
+		case "mdns-pattern":
+			var pattern string
+			pattern, err = parseHostnamePattern(v.value)
+			profile.mdnsPattern = &pattern
+		default:
+			err = fmt.Errorf("not a setting that networks can override")
+		}
+		if err != nil {
+			return networkProfile{}, fmt.Errorf("%s:%d: %s: %w", path, v.line, v.key, err)
+		}
+	}
+	return profile, nil
+}
+
+func (p networkProfile) matches(n network) bool {
+	return n.associated() && (p.match == n.ssid || (n.bssid != "" && strings.EqualFold(p.match, n.bssid)))
+}
+
+// findNetworkProfile prefers a profile for the network's BSSID over one for
+// its SSID, as the more specific of the two.
+func findNetworkProfile(profiles []networkProfile, n network) (networkProfile, bool) {
+	found := false
+	var match networkProfile
+	for _, profile := range profiles {
+		if !profile.matches(n) {
+			continue
+		}
+		if n.bssid != "" && strings.EqualFold(profile.match, n.bssid) {
+			return profile, true
+		}
+		if !found {
+			match, found = profile, true
+		}
+	}
+	return match, found
+}
+
+func (settings settings) withProfile(profile networkProfile) settings {
+	if profile.cycleSecs != nil {
+		settings.cycleSecs = *profile.cycleSecs
+	}
+	if profile.variance != nil {
+		settings.variance = *profile.variance
+	}
+	if profile.schedule != "" {
+		settings.schedule = profile.schedule
+	}
+	if profile.vendors != nil {
+		settings.vendors = profile.vendors
+	}
+	if profile.hostnamePattern != nil {
+		settings.hostnamePattern = *profile.hostnamePattern
+	}
+	if profile.mdnsPattern != nil {
+		settings.mdnsPattern = *profile.mdnsPattern
+	}
+	return settings
+}
+
+// networkTrustOf is the trust that a profile gives the network, if any.
+func (flags flags) networkTrustOf(n network) networkTrust {
+	if profile, ok := findNetworkProfile(flags.networkProfiles, n); ok {
+		return profile.trust
+	}
+	return trustUnset
+}
+
+func (flags flags) hasTrustedNetworks() bool {
+	if len(flags.trustedNetworks) != 0 {
+		return true
+	}
+	for _, profile := range flags.networkProfiles {
+		if profile.trust == trustTrusted {
+			return true
+		}
+	}
+	return false
+}
+
+// watchNetworkProfileTrigger follows which network each device is on,
+// rotating it straight away under the settings of a profile when it joins or
+// leaves a network with one.
+func watchNetworkProfileTrigger(ctx context.Context, d *daemon, r *rotation) error {
+	return watchNetworks(ctx, r.deviceName, func(current network) {
+		if !current.associated() {
+			return
+		}
+
+		before, hadProfile := r.setNetwork(current)
+		profile, hasProfile := findNetworkProfile(d.currentFlags().networkProfiles, current)
+		switch {
+		case hasProfile && (!hadProfile || before.match != profile.match):
+			r.requestRotation("it joined " + current.String() + ", which has a network profile")
+		case !hasProfile && hadProfile:
+			r.requestRotation("it left the network with a profile for " + current.String())
+		}
+	})
+}
+
+// setNetwork notes the network the device is on, returning the profile it
+// had on the network before, if any.
+func (r *rotation) setNetwork(n network) (networkProfile, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := findNetworkProfile(r.settings.networkProfiles, r.status.network)
+	r.status.network = n
+	return before, ok
+}
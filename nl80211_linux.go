@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// The parts of generic netlink and nl80211 needed to ask for an interface's
+// type, from linux/genetlink.h and linux/nl80211.h.
+const (
+	genlIDCtrl           = 0x10
+	genlHdrLen           = 4
+	ctrlCmdGetFamily     = 3
+	ctrlAttrFamilyID     = 1
+	ctrlAttrFamilyName   = 2
+	nl80211CmdGetIface   = 5
+	nl80211AttrIfindex   = 3
+	nl80211AttrIftype    = 5
+	nl80211FamilyName    = "nl80211"
+	netlinkAttrHeaderLen = 4
+)
+
+// nl80211IfTypes are the interface types that rotation treats differently,
+// counting P2P clients and groups as stations and access points.
+var nl80211IfTypes = map[uint32]wirelessMode{
+	2: modeStation,
+	3: modeAP,
+	6: modeMonitor,
+	8: modeStation,
+	9: modeAP,
+}
+
+// wirelessModeOf asks nl80211 what type of interface the device is, giving an
+// empty mode for devices that are not wireless.
+func wirelessModeOf(deviceName string) wirelessMode {
+	iface, err := net.InterfaceByName(deviceName)
+	if err != nil {
+		return ""
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_GENERIC)
+	if err != nil {
+		return ""
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return ""
+	}
+
+	attrs, err := genlRequest(fd, genlIDCtrl, ctrlCmdGetFamily, ctrlAttrFamilyName, append([]byte(nl80211FamilyName), 0))
+	if err != nil || len(attrs[ctrlAttrFamilyID]) < 2 {
+		return ""
+	}
+	family := binary.NativeEndian.Uint16(attrs[ctrlAttrFamilyID])
+
+	ifindex := binary.NativeEndian.AppendUint32(nil, uint32(iface.Index))
+	attrs, err = genlRequest(fd, family, nl80211CmdGetIface, nl80211AttrIfindex, ifindex)
+	if err != nil || len(attrs[nl80211AttrIftype]) < 4 {
+		return ""
+	}
+
+	mode, ok := nl80211IfTypes[binary.NativeEndian.Uint32(attrs[nl80211AttrIftype])]
+	if !ok {
+		return modeOther
+	}
+	return mode
+}
+
+// genlRequest sends a generic netlink command with a single attribute, giving
+// the attributes of the reply.
+func genlRequest(fd int, family uint16, cmd uint8, attrType uint16, value []byte) (map[uint16][]byte, error) {
+	attrLen := netlinkAttrHeaderLen + len(value)
+	msgLen := syscall.NLMSG_HDRLEN + genlHdrLen + nlmsgAlign(attrLen)
+
+	msg := make([]byte, msgLen)
+	binary.NativeEndian.PutUint32(msg[0:], uint32(msgLen))
+	binary.NativeEndian.PutUint16(msg[4:], family)
+	binary.NativeEndian.PutUint16(msg[6:], syscall.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(msg[8:], 1)
+	msg[syscall.NLMSG_HDRLEN] = cmd
+	msg[syscall.NLMSG_HDRLEN+1] = 1
+
+	attr := msg[syscall.NLMSG_HDRLEN+genlHdrLen:]
+	binary.NativeEndian.PutUint16(attr[0:], uint16(attrLen))
+	binary.NativeEndian.PutUint16(attr[2:], attrType)
+	copy(attr[netlinkAttrHeaderLen:], value)
+
+	if err := syscall.Sendto(fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError("sendto", err)
+	}
+
+	buf := make([]byte, os.Getpagesize()*4)
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("recvfrom", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, reply := range msgs {
+		if reply.Header.Type == syscall.NLMSG_ERROR {
+			if 4 <= len(reply.Data) {
+				if errno := int32(binary.NativeEndian.Uint32(reply.Data)); errno != 0 {
+					return nil, syscall.Errno(-errno)
+				}
+			}
+			continue
+		}
+		if len(reply.Data) < genlHdrLen {
+			continue
+		}
+		return parseNetlinkAttrs(reply.Data[genlHdrLen:]), nil
+	}
+	return nil, errors.New("netlink: no reply")
+}
+
+func parseNetlinkAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for netlinkAttrHeaderLen <= len(b) {
+		length := int(binary.NativeEndian.Uint16(b[0:]))
+		attrType := binary.NativeEndian.Uint16(b[2:])
+		if length < netlinkAttrHeaderLen || len(b) < length {
+			break
+		}
+		attrs[attrType] = b[netlinkAttrHeaderLen:length]
+		b = b[min(nlmsgAlign(length), len(b)):]
+	}
+	return attrs
+}
+
+func nlmsgAlign(n int) int {
+	return (n + syscall.NLMSG_ALIGNTO - 1) &^ (syscall.NLMSG_ALIGNTO - 1)
+}
+
+// toggleAccessPoint disables or enables the access point that hostapd runs on
+// the device.
+func toggleAccessPoint(deviceName string, on bool) error {
+	command := "disable"
+	if on {
+		command = "enable"
+	}
+	out, err := exec.Command("hostapd_cli", "-i", deviceName, command).CombinedOutput()
+	trimmed := strings.TrimSpace(string(out))
+	if err != nil {
+		return fmt.Errorf("hostapd_cli %s: %w: %s", command, err, trimmed)
+	}
+
+	// hostapd_cli succeeds even when hostapd refuses.
+	if trimmed != "OK" {
+		return fmt.Errorf("hostapd_cli %s: %s", command, trimmed)
+	}
+	return nil
+}
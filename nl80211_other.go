@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// wirelessModeOf is unknown here, so devices are treated as stations.
+func wirelessModeOf(string) wirelessMode {
+	return ""
+}
+
+func toggleAccessPoint(string, bool) error {
+	return errors.New("access points can only be restarted on Linux")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	nmDispatcherTrigger = "nm-dispatcher"
+	nmDispatcherPreUp   = "pre-up"
+
+	// nmDispatcherTimeout keeps well within the time NetworkManager waits
+	// for a pre-up script before carrying on without it.
+	nmDispatcherTimeout = 20 * time.Second
+)
+
+// runNMDispatcher rotates a device as NetworkManager's dispatcher brings up
+// a connection on it, from a script in pre-up.d. The device and action come
+// from the environment NetworkManager gives, or else from its two arguments,
+// and a network profile or trusted network matching the connection's name
+// applies as it would to an SSID. It prints a single tab-separated line of
+// the device, what happened, and the details, for the script to log.
+func runNMDispatcher(args []string) error {
+	flagSet := flag.NewFlagSet("nm-dispatcher", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	deviceName, action := os.Getenv("DEVICE_IFACE"), os.Getenv("NM_DISPATCHER_ACTION")
+	if rest := flagSet.Args(); len(rest) == 2 {
+		deviceName = cmp.Or(deviceName, rest[0])
+		action = cmp.Or(action, rest[1])
+	}
+	if deviceName == "" || action == "" {
+		return &rotator.ExitError{
+			Code: rotator.ExitUsage,
+			Err:  errors.New("usage: nm-dispatcher [flags] [device action], with DEVICE_IFACE and NM_DISPATCHER_ACTION otherwise set by NetworkManager"),
+		}
+	}
+	connection := network{ssid: os.Getenv("CONNECTION_ID")}
+
+	skip := func(reason string) error {
+		fmt.Printf("%s\tskipped\t%s\n", deviceName, reason)
+		return nil
+	}
+	switch {
+	case action != nmDispatcherPreUp:
+		return skip("the action is " + action)
+	case isFlagSet(flagSet, "device-name") && !slices.Contains(flags.deviceNames, deviceName):
+		return skip("it is not one of the -device-name devices")
+	case flags.trusts(connection):
+		return skip(connection.String() + " is trusted")
+	}
+
+	if err := setUpLogging(os.Stderr, *flags); err != nil {
+		return err
+	}
+	if err := checkPrivileges(*flags); err != nil {
+		return err
+	}
+	if err := checkTools(*flags); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), nmDispatcherTimeout)
+	defer cancel()
+
+	r := newRotation(deviceName, *flags, chooseSetMacCmd(*flags))
+	r.audit = newAuditLog(*flags)
+	if connection.associated() {
+		r.setNetwork(connection)
+	}
+
+	if !flags.dryRun {
+		lock, err := lockDevice(flags.stateDir, deviceName)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+	}
+
+	state := r.loadState()
+	r.recordAddresses(&state)
+	change := r.changeMac(ctx, r.currentSettings(), &state)
+	r.saveState(state)
+	r.recordChange(change, nil, nmDispatcherTrigger)
+
+	switch change := change.(type) {
+	case *successfulMacChange:
+		fmt.Printf("%s\tchanged\t%s\t%s\n", deviceName, change.mac, orDash(string(change.vendor)))
+		return nil
+	case *failedMacChange:
+		fmt.Printf("%s\tfailed\t%s\n", deviceName, change.err)
+		return change.err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sdNotify tells systemd about the daemon's state, doing nothing when it isn't
+// running as a notify service.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval is how often to ping systemd's watchdog, being half of its
+// timeout as systemd recommends, or zero when the watchdog is off.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usecs, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(usecs) * time.Microsecond / 2
+}
+
+// pingWatchdog only pings while the daemon still answers for its rotations,
+// so that systemd restarts it if it deadlocks.
+func pingWatchdog(ctx context.Context, d *daemon) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.statuses()
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					slog.Warn("could not ping the systemd watchdog", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// notifyStatus reports every device's address and next rotation to systemd,
+// and reports being ready the first time a device settles.
+func (d *daemon) notifyStatus(settled bool) {
+	var summaries []string
+	for _, status := range d.statuses() {
+		next := "unscheduled"
+		if !status.nextRotation.IsZero() {
+			next = "next at " + status.nextRotation.Format(time.Kitchen)
+		}
+		summaries = append(summaries, fmt.Sprintf("%s %s, %s", status.deviceName, status.mac, next))
+	}
+
+	state := "STATUS=" + strings.Join(summaries, "; ")
+	if settled {
+		d.readyOnce.Do(func() {
+			state = "READY=1\n" + state
+		})
+	}
+
+	if err := sdNotify(state); err != nil {
+		slog.Warn("could not notify systemd", "err", err)
+	}
+}
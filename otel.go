@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	otlpTimeout        = 10 * time.Second
+	otlpMetricInterval = 30 * time.Second
+	otlpSpanBuffer     = 64
+	otlpServiceName    = "rotate-mac-address"
+
+	// The OTLP codes for internal spans and the outcomes of spans.
+	otlpSpanKindInternal = 1
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+// otlpValue, otlpAttribute, and the rest follow the JSON encoding of OTLP's
+// protobufs, in which IDs are hex and 64-bit integers are strings.
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             *string         `json:"asInt,omitempty"`
+	AsDouble          *float64        `json:"asDouble,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+// otlpCumulative is OTLP's AGGREGATION_TEMPORALITY_CUMULATIVE, counting
+// from the daemon starting.
+const otlpCumulative = 2
+
+func otlpAttributes(pairs ...string) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			attrs = append(attrs, otlpAttribute{pairs[i], otlpValue{pairs[i+1]}})
+		}
+	}
+	return attrs
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpResource() map[string]any {
+	return map[string]any{"attributes": otlpAttributes("service.name", otlpServiceName)}
+}
+
+func otlpScope() map[string]any {
+	return map[string]any{"name": otlpServiceName, "version": readBuildInfo().Version}
+}
+
+// parseOTLPHeaders reads a comma-separated list of name=value headers to send
+// with each export, such as an API key.
+func parseOTLPHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, header := range parseList(value) {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not a header of the form name=value", header)
+		}
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// otlpExporter sends a trace of each rotation, and metrics every so often, to
+// an OpenTelemetry collector over OTLP/HTTP in JSON.
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+	spans    chan []otlpSpan
+}
+
+func newOTLPExporter(flags flags) (*otlpExporter, error) {
+	parsed, err := url.Parse(flags.otlp)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("-otlp must be an http:// or https:// address, such as http://localhost:4318, not %q", flags.otlp)
+	}
+	return &otlpExporter{
+		endpoint: strings.TrimSuffix(flags.otlp, "/"),
+		headers:  flags.otlpHeaders,
+		client:   &http.Client{Timeout: otlpTimeout},
+		spans:    make(chan []otlpSpan, otlpSpanBuffer),
+	}, nil
+}
+
+// serveOTLP exports the spans of each rotation as it finishes, and each
+// device's counts of changes and failures, consecutive errors, and seconds
+// until its next rotation every otlpMetricInterval.
+func serveOTLP(ctx context.Context, d *daemon, exporter *otlpExporter) {
+	started := time.Now()
+
+	go func() {
+		ticker := time.NewTicker(otlpMetricInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case spans := <-exporter.spans:
+				exporter.post(ctx, "/v1/traces", map[string]any{
+					"resourceSpans": []any{map[string]any{
+						"resource":   otlpResource(),
+						"scopeSpans": []any{map[string]any{"scope": otlpScope(), "spans": spans}},
+					}},
+				})
+			case <-ticker.C:
+				exporter.post(ctx, "/v1/metrics", map[string]any{
+					"resourceMetrics": []any{map[string]any{
+						"resource":     otlpResource(),
+						"scopeMetrics": []any{map[string]any{"scope": otlpScope(), "metrics": otlpMetrics(d.statuses(), started)}},
+					}},
+				})
+			}
+		}
+	}()
+}
+
+func otlpMetrics(statuses []status, started time.Time) []otlpMetric {
+	now := otlpTime(time.Now())
+	counter := func(name string, value func(status) int) otlpMetric {
+		sum := &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		for _, s := range statuses {
+			count := strconv.Itoa(value(s))
+			sum.DataPoints = append(sum.DataPoints, otlpDataPoint{
+				Attributes:        otlpAttributes("device", s.deviceName),
+				StartTimeUnixNano: otlpTime(started),
+				TimeUnixNano:      now,
+				AsInt:             &count,
+			})
+		}
+		return otlpMetric{Name: name, Unit: "1", Sum: sum}
+	}
+	gauge := func(name, unit string, value func(status) (float64, bool)) otlpMetric {
+		g := &otlpGauge{DataPoints: []otlpDataPoint{}}
+		for _, s := range statuses {
+			if v, ok := value(s); ok {
+				g.DataPoints = append(g.DataPoints, otlpDataPoint{
+					Attributes:   otlpAttributes("device", s.deviceName),
+					TimeUnixNano: now,
+					AsDouble:     &v,
+				})
+			}
+		}
+		return otlpMetric{Name: name, Unit: unit, Gauge: g}
+	}
+
+	return []otlpMetric{
+		counter("rotate_mac_address.rotations", func(s status) int { return s.changes }),
+		counter("rotate_mac_address.failures", func(s status) int { return s.failures }),
+		gauge("rotate_mac_address.consecutive_errors", "1", func(s status) (float64, bool) {
+			return float64(s.consecutiveErrs), true
+		}),
+		gauge("rotate_mac_address.time_to_next_rotation", "s", func(s status) (float64, bool) {
+			if s.nextRotation.IsZero() {
+				return 0, false
+			}
+			return max(0, time.Until(s.nextRotation).Seconds()), true
+		}),
+	}
+}
+
+func (exporter *otlpExporter) post(ctx context.Context, path string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("could not encode an OTLP export", "err", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, exporter.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("could not export to OTLP", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rotate-mac-address")
+	for name, value := range exporter.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := exporter.client.Do(req)
+	if err != nil {
+		slog.Warn("could not export to OTLP", "path", path, "err", err)
+		return
+	}
+	resp.Body.Close()
+	if 300 <= resp.StatusCode {
+		slog.Warn("could not export to OTLP", "path", path, "err", "answered "+resp.Status)
+	}
+}
+
+type traceKey struct{}
+
+// rotationTrace gathers the spans of one rotation, with a root span for the
+// whole of it and a child for each step: the pre-hook, resetting the device,
+// generating and setting the address, verifying it, and the post-hook.
+type rotationTrace struct {
+	exporter *otlpExporter
+	id       string
+	root     *span
+
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+type span struct {
+	trace  *rotationTrace
+	id     string
+	parent string
+	name   string
+	start  time.Time
+	attrs  []string
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startTrace begins the trace of a rotation, if exporting, carrying it in
+// the context for the steps to add their spans to.
+func (r *rotation) startTrace(ctx context.Context, trigger string) (context.Context, *rotationTrace) {
+	if r.otlp == nil {
+		return ctx, nil
+	}
+	trace := &rotationTrace{exporter: r.otlp, id: randomHex(16)}
+	trace.root = &span{
+		trace: trace,
+		id:    randomHex(8),
+		name:  "rotation",
+		start: time.Now(),
+		attrs: []string{"device", r.deviceName, "trigger", trigger},
+	}
+	return context.WithValue(ctx, traceKey{}, trace), trace
+}
+
+// startSpan begins a step of the rotation traced in the context, if any.
+func startSpan(ctx context.Context, name string) *span {
+	trace, ok := ctx.Value(traceKey{}).(*rotationTrace)
+	if !ok || trace == nil {
+		return nil
+	}
+	return &span{trace: trace, id: randomHex(8), parent: trace.root.id, name: name, start: time.Now()}
+}
+
+func (s *span) end(err error, attrs ...string) {
+	if s == nil {
+		return
+	}
+	status := otlpStatus{Code: otlpStatusOk}
+	if err != nil {
+		status = otlpStatus{Code: otlpStatusError, Message: err.Error()}
+	}
+
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	s.trace.spans = append(s.trace.spans, otlpSpan{
+		TraceID:           s.trace.id,
+		SpanID:            s.id,
+		ParentSpanID:      s.parent,
+		Name:              s.name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(s.start),
+		EndTimeUnixNano:   otlpTime(time.Now()),
+		Attributes:        otlpAttributes(append(s.attrs, attrs...)...),
+		Status:            status,
+	})
+}
+
+// finish ends the root span with how the change went, and hands the trace to
+// the exporter, dropping it if the exporter has fallen far behind.
+func (t *rotationTrace) finish(change macChange, err error) {
+	if t == nil {
+		return
+	}
+	switch change := change.(type) {
+	case *successfulMacChange:
+		t.root.end(nil, "mac", string(change.mac), "previous_mac", string(change.previous), "vendor", string(change.vendor))
+	case *failedMacChange:
+		t.root.end(change.err, "previous_mac", string(change.previous))
+	default:
+		t.root.end(err)
+	}
+
+	t.mu.Lock()
+	spans := t.spans
+	t.mu.Unlock()
+	select {
+	case t.exporter.spans <- spans:
+	default:
+		slog.Debug("dropped the trace of a rotation, as OTLP exports have fallen behind")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	defaultOUIRegistryURL = "https://standards-oui.ieee.org/oui/oui.csv"
+	ouiRegistryCache      = "oui.csv"
+	ouiRegistryTimeout    = 2 * time.Minute
+	ouiRegistryMaxSize    = 32 << 20
+	ouiRefreshCheck       = time.Hour
+
+	// ouiRegistryMinSize is far fewer assignments than the registry has,
+	// but far more than an error page or a truncated download would.
+	ouiRegistryMinSize = 10_000
+)
+
+// ouiRegistry maps the six hexadecimal digits of each MA-L assignment to the
+// organisation it is assigned to.
+type ouiRegistry map[string]rotator.Vendor
+
+// parseOUIRegistry reads the IEEE's registry in the CSV form it publishes,
+// of the registry, assignment, organisation name, and organisation address.
+func parseOUIRegistry(data []byte) (ouiRegistry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 4
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("not the IEEE's OUI registry: %w", err)
+	}
+	if header[0] != "Registry" || header[1] != "Assignment" || header[2] != "Organization Name" {
+		return nil, errors.New("not the IEEE's OUI registry, as its header is not Registry,Assignment,Organization Name,Organization Address")
+	}
+
+	registry := make(ouiRegistry)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		assignment := strings.ToLower(record[1])
+		if _, err := hex.DecodeString(assignment); err != nil || len(assignment) != 6 {
+			return nil, fmt.Errorf("%q is not an MA-L assignment", record[1])
+		}
+		registry[assignment] = rotator.Vendor(strings.TrimSpace(record[2]))
+	}
+	if len(registry) < ouiRegistryMinSize {
+		return nil, fmt.Errorf("the OUI registry has only %d assignments, so is probably incomplete", len(registry))
+	}
+	return registry, nil
+}
+
+// loadOUIRegistry reads the copy of the registry cached by oui update, or
+// gives none, leaving the vendors built in, if there is no usable copy.
+func loadOUIRegistry(stateDir string) ouiRegistry {
+	data, err := os.ReadFile(filepath.Join(stateDir, ouiRegistryCache))
+	if err != nil {
+		return nil
+	}
+	registry, err := parseOUIRegistry(data)
+	if err != nil {
+		slog.Warn("ignoring the cached OUI registry", "err", err)
+		return nil
+	}
+	return registry
+}
+
+// vendorOf names the vendor of the address, from the vendors built in, and
+// then from the registry.
+func (registry ouiRegistry) vendorOf(mac rotator.MAC) rotator.Vendor {
+	if vendor := rotator.VendorOf(mac); vendor != "" {
+		return vendor
+	}
+	digits := strings.ReplaceAll(string(mac), ":", "")
+	if len(digits) < 6 {
+		return ""
+	}
+	return registry[digits[:6]]
+}
+
+// updateOUIRegistry downloads the registry, caching it in the state directory
+// only once it is known to be whole, so that a failed download leaves the
+// last copy in place.
+func updateOUIRegistry(ctx context.Context, stateDir, registryURL string) (ouiRegistry, error) {
+	ctx, cancel := context.WithTimeout(ctx, ouiRegistryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, registryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "rotate-mac-address")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", registryURL, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ouiRegistryMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if ouiRegistryMaxSize < len(data) {
+		return nil, fmt.Errorf("the OUI registry is larger than %d bytes", ouiRegistryMaxSize)
+	}
+	registry, err := parseOUIRegistry(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(stateDir, stateDirPerm); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(stateDir, ouiRegistryCache)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, stateFilePerm); err != nil {
+		return nil, err
+	}
+	return registry, os.Rename(tmp, path)
+}
+
+// refreshOUIRegistry downloads the registry again whenever the cached copy
+// is older than -oui-refresh-days, carrying on with the copy it has if the
+// download fails.
+func refreshOUIRegistry(ctx context.Context, flags flags) {
+	maxAge := time.Duration(flags.ouiRefreshDays) * 24 * time.Hour
+	path := filepath.Join(flags.stateDir, ouiRegistryCache)
+
+	ticker := time.NewTicker(ouiRefreshCheck)
+	defer ticker.Stop()
+	for {
+		if info, err := os.Stat(path); err != nil || maxAge < time.Since(info.ModTime()) {
+			if registry, err := updateOUIRegistry(ctx, flags.stateDir, flags.ouiRegistryURL); err != nil {
+				slog.Warn("could not refresh the OUI registry, so the last copy still applies", "url", flags.ouiRegistryURL, "err", err)
+			} else {
+				slog.Info("refreshed the OUI registry", "assignments", len(registry))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runOUI(args []string) error {
+	if len(args) == 0 || args[0] != "update" {
+		return errors.New("usage: oui update [flags]")
+	}
+
+	flagSet := flag.NewFlagSet("oui update", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+	if err := parseFlags(flagSet, flags, args[1:]); err != nil {
+		return err
+	}
+
+	registry, err := updateOUIRegistry(context.Background(), flags.stateDir, flags.ouiRegistryURL)
+	if err != nil {
+		return fmt.Errorf("could not update the OUI registry: %w", err)
+	}
+	fmt.Printf("cached %d assignments in %s\n", len(registry), filepath.Join(flags.stateDir, ouiRegistryCache))
+	return nil
+}
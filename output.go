@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// outputFormat picks what, besides the log, the daemon writes to stdout: by
+// default nothing, or with json an object per line for each event in its
+// lifecycle, for wrapper scripts and supervisors to follow without parsing
+// log messages.
+type outputFormat string
+
+const (
+	outputNone outputFormat = "none"
+	outputJSON              = "json"
+)
+
+func parseOutputFormat(value string) (outputFormat, error) {
+	switch format := outputFormat(value); format {
+	case outputNone, outputJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q", value)
+	}
+}
+
+// The kinds of events written with -output json.
+const (
+	eventStartup  = "startup"
+	eventRotation = "rotation"
+	eventFailure  = "failure"
+	eventWait     = "wait"
+	eventAddress  = "address"
+	eventShutdown = "shutdown"
+)
+
+type outputEvent struct {
+	At    time.Time `json:"at"`
+	Event string    `json:"event"`
+
+	Devices      []string       `json:"devices,omitempty"`
+	Device       string         `json:"device,omitempty"`
+	PreviousMac  rotator.MAC    `json:"previous_mac,omitempty"`
+	Mac          rotator.MAC    `json:"mac,omitempty"`
+	Vendor       rotator.Vendor `json:"vendor,omitempty"`
+	IPv4         string         `json:"ipv4,omitempty"`
+	PreviousIPv4 string         `json:"previous_ipv4,omitempty"`
+	Trigger      string         `json:"trigger,omitempty"`
+	NextRotation time.Time      `json:"next_rotation,omitzero"`
+	WaitSecs     *int           `json:"wait_secs,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// eventOutput writes events to stdout with -output json, and sends them to
+// whoever is watching them through ctl watch or the API.
+type eventOutput struct {
+	mu          sync.Mutex
+	out         io.Writer
+	subscribers map[chan outputEvent]bool
+}
+
+var events = &eventOutput{}
+
+func setUpOutput(format outputFormat) {
+	if format == outputJSON {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+		events.out = os.Stdout
+	}
+}
+
+// subscribe sends each event from now on until unsubscribed. Subscribers
+// that fall behind miss events rather than holding up the daemon.
+func (o *eventOutput) subscribe() (<-chan outputEvent, func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	subscriber := make(chan outputEvent, subscriberBuffer)
+	if o.subscribers == nil {
+		o.subscribers = make(map[chan outputEvent]bool)
+	}
+	o.subscribers[subscriber] = true
+
+	return subscriber, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.subscribers, subscriber)
+	}
+}
+
+func (o *eventOutput) emit(event outputEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for subscriber := range o.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+	if o.out == nil {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	o.out.Write(append(line, '\n'))
+}
+
+// concerns is whether the event is about any of the devices, or about the
+// daemon as a whole, which every watcher is told of.
+func (event outputEvent) concerns(deviceNames []string) bool {
+	return len(deviceNames) == 0 || event.Device == "" || slices.Contains(deviceNames, event.Device)
+}
+
+func (o *eventOutput) emitChange(entry historyEntry) {
+	event := outputEvent{
+		At:          entry.At,
+		Event:       eventRotation,
+		Device:      entry.Device,
+		PreviousMac: entry.Previous,
+		Mac:         entry.Mac,
+		Vendor:      entry.Vendor,
+		Trigger:     entry.Trigger,
+		Error:       entry.Error,
+	}
+	if entry.Error != "" {
+		event.Event = eventFailure
+	}
+	o.emit(event)
+}
+
+func (o *eventOutput) emitWait(deviceName string, at time.Time) {
+	event := outputEvent{Event: eventWait, Device: deviceName, NextRotation: at}
+	if !at.IsZero() {
+		waitSecs := int(time.Until(at) / time.Second)
+		event.WaitSecs = &waitSecs
+	}
+	o.emit(event)
+}
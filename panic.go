@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// defaultPanicHostnamePattern makes hostnames such as laptop-4821 for panic
+// when no -hostname-pattern is given.
+const defaultPanicHostnamePattern = "*-####"
+
+// panicDevice is what panic did to a device, each step being empty if it was
+// skipped, or saying how it went otherwise.
+type panicDevice struct {
+	name      string
+	previous  rotator.MAC
+	mac       rotator.MAC
+	vendor    rotator.Vendor
+	err       error
+	lease     string
+	neighbors string
+}
+
+// panicStep describes how a step went for the report.
+func panicStep(dryRun bool, done string, err error) string {
+	switch {
+	case dryRun:
+		return "would be " + done
+	case err != nil:
+		return "failed: " + err.Error()
+	default:
+		return done
+	}
+}
+
+// runPanic gives the machine a completely new network identity at once: a new
+// address on every device, a new hostname, fresh DHCP leases, and emptied
+// neighbour caches, whatever the flags say about each, followed by one
+// report of it all. Devices that a running daemon holds are rotated by it.
+func runPanic(args []string) error {
+	flagSet := flag.NewFlagSet("panic", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+	if err := setUpLogging(os.Stderr, *flags); err != nil {
+		return err
+	}
+	if err := checkPrivileges(*flags); err != nil {
+		return err
+	}
+	if err := checkTools(*flags); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The steps done for the whole report are left out of each rotation, so
+	// that they are done once and reported on.
+	pattern := flags.hostnamePattern
+	if pattern == "" {
+		pattern = defaultPanicHostnamePattern
+	}
+	rotationFlags := *flags
+	rotationFlags.hostnamePattern = ""
+	rotationFlags.dhcpRenew = false
+	rotationFlags.flushNeighbors = false
+
+	audit := newAuditLog(*flags)
+	var devices []panicDevice
+	var errs []error
+	for _, deviceName := range flags.deviceNames {
+		device := panicDevice{name: deviceName}
+		r := newRotation(deviceName, rotationFlags, chooseSetMacCmd(rotationFlags))
+		r.audit = audit
+		device.previous, _ = rotator.CurrentMAC(deviceName)
+
+		err := rotateOnceLocked(ctx, r, rotationFlags)
+		var locked *lockedError
+		if errors.As(err, &locked) && flags.controlSocket != "" {
+			if _, err = requestControl(flags.controlSocket, []string{"rotate", deviceName}); err == nil {
+				device.lease = "left to the running daemon"
+				device.neighbors = device.lease
+				devices = append(devices, device)
+				continue
+			}
+		}
+		if err != nil {
+			device.err = err
+			errs = append(errs, fmt.Errorf("%s: %w", deviceName, err))
+			devices = append(devices, device)
+			continue
+		}
+
+		status := r.currentStatus()
+		device.mac, device.vendor = status.mac, status.vendor
+
+		var leaseErr, neighborsErr error
+		if !flags.dryRun {
+			leaseErr = renewDhcpLease(deviceName)
+			neighborsErr = flushNeighborCache(deviceName)
+		}
+		device.lease = panicStep(flags.dryRun, "renewed", leaseErr)
+		device.neighbors = panicStep(flags.dryRun, "flushed", neighborsErr)
+		devices = append(devices, device)
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	hostname := generateHostname(rng, pattern, flags.hostnameWords)
+	var hostnameErr error
+	if !flags.dryRun {
+		hostnameErr = setHostname(hostname)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "DEVICE\tPREVIOUS MAC\tNEW MAC\tVENDOR\tDHCP LEASE\tNEIGHBOUR CACHE")
+	for _, device := range devices {
+		if device.err != nil {
+			fmt.Fprintf(out, "%s\t%s\tfailed: %v\t-\t-\t-\n", device.name, orDash(string(device.previous)), device.err)
+			continue
+		}
+		fmt.Fprintf(
+			out,
+			"%s\t%s\t%s\t%s\t%s\t%s\n",
+			device.name,
+			orDash(string(device.previous)),
+			orDash(string(device.mac)),
+			orDash(string(device.vendor)),
+			device.lease,
+			device.neighbors,
+		)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nhostname: %s, %s\n", hostname, panicStep(flags.dryRun, "set", hostnameErr))
+
+	if hostnameErr != nil {
+		errs = append(errs, fmt.Errorf("could not change the hostname: %w", hostnameErr))
+	}
+	return errors.Join(errs...)
+}
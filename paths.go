@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	pathsAppName = "rotate-mac-address"
+	configName   = "config.toml"
+
+	systemConfigDir = "/etc/rotate-mac-address"
+)
+
+// userMode is when running unprivileged, say with -escalate, where the
+// system's directories cannot be written to, so those of the XDG base
+// directory specification are used instead.
+func userMode() bool {
+	return runtime.GOOS != "windows" && os.Geteuid() != 0
+}
+
+// xdgDir is the XDG base directory in the environment variable, or its
+// fallback under the home directory.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, fallback)
+}
+
+// defaultStateDirForMode is /var/lib/rotate-mac-address for the system, and
+// under $XDG_STATE_HOME for a user.
+func defaultStateDirForMode() string {
+	switch {
+	case runtime.GOOS == "windows":
+		if programData := os.Getenv("ProgramData"); programData != "" {
+			return filepath.Join(programData, pathsAppName)
+		}
+	case userMode():
+		if dir := xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")); dir != "" {
+			return filepath.Join(dir, pathsAppName)
+		}
+	}
+	return defaultStateDir
+}
+
+// defaultConfigPath is /etc/rotate-mac-address/config.toml for the system,
+// and under $XDG_CONFIG_HOME for a user, but only if there is a file there.
+func defaultConfigPath() string {
+	var dir string
+	switch {
+	case runtime.GOOS == "windows":
+		dir = filepath.Join(os.Getenv("ProgramData"), pathsAppName)
+	case userMode():
+		if configHome := xdgDir("XDG_CONFIG_HOME", ".config"); configHome != "" {
+			dir = filepath.Join(configHome, pathsAppName)
+		}
+	default:
+		dir = systemConfigDir
+	}
+	if dir == "" {
+		return ""
+	}
+
+	path := filepath.Join(dir, configName)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,36 @@
+package main
+
+// pause suspends rotation, leaving the current address in place, until
+// resume. It reports whether the device was running before.
+func (r *rotation) pause() bool {
+	r.mu.Lock()
+	wasRunning := !r.status.paused
+	r.status.paused = true
+	r.mu.Unlock()
+
+	if wasRunning {
+		r.logger.Info("pausing rotation")
+		r.wake()
+	}
+	return wasRunning
+}
+
+// resume reports whether the device was paused before.
+func (r *rotation) resume() bool {
+	r.mu.Lock()
+	wasPaused := r.status.paused
+	r.status.paused = false
+	r.mu.Unlock()
+
+	if wasPaused {
+		r.logger.Info("resuming rotation")
+		r.wake()
+	}
+	return wasPaused
+}
+
+func (r *rotation) isPaused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status.paused
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// permanentMac asks networksetup, which reports the hardware's own address
+// rather than the one in use.
+func permanentMac(deviceName string) (rotator.MAC, error) {
+	out, err := exec.Command("networksetup", "-getmacaddress", deviceName).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not read the permanent address of %s: %w", deviceName, err)
+	}
+
+	// The output looks like "Ethernet Address: 01:23:45:67:89:ab (Device: en0)".
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("unexpected networksetup output for %s: %q", deviceName, out)
+	}
+	return rotator.MAC(fields[2]), nil
+}
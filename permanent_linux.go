@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// permanentMac asks ethtool for the address burned into the hardware, which
+// the kernel keeps regardless of what the device currently uses.
+func permanentMac(deviceName string) (rotator.MAC, error) {
+	out, err := exec.Command("ethtool", "-P", deviceName).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not read the permanent address of %s: %w", deviceName, err)
+	}
+
+	_, addr, ok := strings.Cut(string(out), ": ")
+	if !ok {
+		return "", fmt.Errorf("unexpected ethtool output for %s: %q", deviceName, out)
+	}
+	return rotator.MAC(strings.TrimSpace(addr)), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+func permanentMac(deviceName string) (rotator.MAC, error) {
+	return "", fmt.Errorf("the permanent address of %s cannot be read on this platform", deviceName)
+}
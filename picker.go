@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// candidateDevices are those with an Ethernet-style address to rotate.
+func candidateDevices() ([]net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 && len(iface.HardwareAddr) == 6 {
+			candidates = append(candidates, iface)
+		}
+	}
+	return candidates, nil
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func isFlagSet(flagSet *flag.FlagSet, name string) bool {
+	set := false
+	flagSet.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// pickDevicesIfUnset asks which devices to rotate when run interactively
+// without a -device-name from any source, rather than silently rotating a
+// default that might not exist. The choice is added to the command line so
+// that reloads and daemonizing keep it.
+func pickDevicesIfUnset(flagSet *flag.FlagSet, flags *flags) error {
+	if isFlagSet(flagSet, "device-name") || !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	candidates, err := candidateDevices()
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return errors.New("there are no devices with addresses to rotate")
+	}
+
+	deviceNames, err := pickDevices(os.Stdin, os.Stderr, candidates)
+	if err != nil {
+		return err
+	}
+	flags.deviceNames = deviceNames
+	flags.splitMacvlans()
+	os.Args = append(os.Args, "-device-name", strings.Join(deviceNames, ","))
+	return nil
+}
+
+func pickDevices(in io.Reader, out io.Writer, candidates []net.Interface) ([]string, error) {
+	fmt.Fprintln(out, "No -device-name was given. Which devices should be rotated?")
+	for i, iface := range candidates {
+		state := "down"
+		if iface.Flags&net.FlagUp != 0 {
+			state = "up"
+		}
+		fmt.Fprintf(out, "  %d) %s: %s, %s, currently %s\n", i+1, iface.Name, deviceKind(iface.Name), state, iface.HardwareAddr)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "Enter one or more numbers, separated by commas: ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("no devices were picked")
+		}
+
+		deviceNames, err := parsePicks(scanner.Text(), candidates)
+		if err == nil {
+			return deviceNames, nil
+		}
+		fmt.Fprintln(out, err)
+	}
+}
+
+func parsePicks(line string, candidates []net.Interface) ([]string, error) {
+	var deviceNames []string
+	for _, pick := range parseList(line) {
+		n, err := strconv.Atoi(pick)
+		if err != nil || n < 1 || len(candidates) < n {
+			return nil, fmt.Errorf("%q is not one of the numbers listed", pick)
+		}
+		deviceNames = append(deviceNames, candidates[n-1].Name)
+	}
+	if len(deviceNames) == 0 {
+		return nil, errors.New("pick at least one device")
+	}
+	return parseDeviceNames(strings.Join(deviceNames, ","))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const defaultPlanCount = 10
+
+// runPlan prints the upcoming rotations the daemon would perform with the
+// given flags, without touching the device or the saved schedule, or with
+// -simulate plays them out on an accelerated clock.
+func runPlan(args []string) error {
+	flagSet := flag.NewFlagSet("plan", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	var count uint
+	var seed int64
+	var sim simulation
+
+	flagSet.UintVar(
+		&count,
+		"count",
+		defaultPlanCount,
+		"the number of upcoming rotations to show",
+	)
+	flagSet.Int64Var(
+		&seed,
+		"seed",
+		0,
+		"the random seed to project with; 0 picks and prints a fresh one",
+	)
+	flagSet.DurationVar(
+		&sim.span,
+		"simulate",
+		0,
+		"play out this long a span of rotations, such as 72h, in a few seconds, including failures and retries, rather than projecting -count of them",
+	)
+	flagSet.Float64Var(
+		&sim.failRate,
+		"fail-rate",
+		0,
+		"the proportion of changes that fail when simulating",
+	)
+	flagSet.DurationVar(
+		&sim.triggerEvery,
+		"trigger-every",
+		0,
+		"how often a trigger requests an early rotation when simulating; 0 never does",
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	for i, deviceName := range flags.deviceNames {
+		if 0 < i {
+			fmt.Println()
+		}
+		if sim.span != 0 {
+			if err := printSimulation(rng, *flags, deviceName, seed, sim); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := printPlan(rng, *flags, deviceName, seed, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printPlan(rng *rand.Rand, flags flags, deviceName string, seed int64, count uint) error {
+	if flags.dailyMac {
+		return printDailyPlan(flags, deviceName, count)
+	}
+
+	at := time.Now()
+	state, err := loadDeviceState(flags.stateDir, deviceName)
+	if err != nil {
+		return err
+	}
+	if flags.cycleSecs == 0 {
+		when := "on startup and on triggers"
+		if !flags.rotateOnStart {
+			when = "on triggers"
+		}
+		fmt.Printf("%s has no timer, so it rotates only %s\n", deviceName, when)
+		return nil
+	}
+
+	switch {
+	case at.Before(state.NextRotation):
+		at = state.NextRotation
+	case !flags.rotateOnStart:
+		at = at.Add(rotator.NextGap(rng, flags.schedule, flags.cycleSecs, flags.variance))
+	}
+
+	fmt.Printf("projected rotations for %s with seed %d:\n\n", deviceName, seed)
+	if flags.schedule == rotator.ScheduleLease {
+		if leaseAt, err := rotator.NextLeaseRotation(deviceName); err == nil {
+			at = leaseAt
+		}
+		fmt.Println("(later lease-aligned rotations depend on the DHCP server, so they are")
+		fmt.Println("projected as if on a bounded schedule)")
+		fmt.Println()
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "#\tTIME\tVENDOR\tMAC\tCOMMAND")
+
+	newSetMacCmd := chooseSetMacCmd(flags)
+	for i := uint(1); i <= count; i++ {
+		vendor, mac := rotator.RandomMAC(rng, flags.vendors)
+		prog, args := newSetMacCmd(deviceName, mac)
+
+		fmt.Fprintf(
+			out,
+			"%d\t%s\t%s\t%s\t%s %s\n",
+			i,
+			at.Format(time.RFC3339),
+			vendor,
+			mac,
+			prog,
+			strings.Join(args, " "),
+		)
+
+		at = at.Add(rotator.NextGap(rng, flags.schedule, flags.cycleSecs, flags.variance))
+	}
+
+	return out.Flush()
+}
+
+// printDailyPlan lists the addresses that -daily-mac will give the device at
+// each coming midnight, which unlike random ones are known in advance to
+// whoever has the key. Those for each network of -daily-per-network depend on
+// the network joined, so are left out.
+func printDailyPlan(flags flags, deviceName string, count uint) error {
+	settings := flags.settings()
+	path := dailyKeyPath(flags.stateDir, settings)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("the daemon creates the -daily-key-file on its first daily rotation, but it cannot be read yet: %w", err)
+	}
+	key, err := loadKey(path, dailyKeyLabel, keyMustExist)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("daily addresses for %s:\n\n", deviceName)
+	if flags.dailyPerNetwork {
+		fmt.Println("(with -daily-per-network, each network has its own address, so these are")
+		fmt.Println("those off any wireless network)")
+		fmt.Println()
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "#\tFROM\tVENDOR\tMAC")
+	day := time.Now()
+	for i := uint(1); i <= count; i++ {
+		vendor, mac := rotator.DailyMAC(key, day, deviceName, "", settings.vendors)
+		from := "now"
+		if i != 1 {
+			from = day.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%d\t%s\t%s\t%s\n", i, from, vendor, mac)
+		day = rotator.NextMidnight(day)
+	}
+	return out.Flush()
+}
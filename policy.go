@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// The actions a -policy can decide on.
+const (
+	policyRotate = "rotate"
+	policySkip   = "skip"
+)
+
+// The generators a -policy can choose between, as -mac-pool, -slap, and
+// -daily-mac would.
+const (
+	policyRandom = "random"
+	policyDaily  = "daily"
+	policyPool   = "pool"
+	policySLAP   = "slap"
+)
+
+// policyInput is what a -policy is given on stdin to decide on a due
+// rotation with.
+type policyInput struct {
+	Device       string       `json:"device"`
+	Mac          rotator.MAC  `json:"mac"`
+	SSID         string       `json:"ssid,omitempty"`
+	BSSID        string       `json:"bssid,omitempty"`
+	Trust        networkTrust `json:"trust,omitempty"`
+	Trigger      string       `json:"trigger"`
+	Time         time.Time    `json:"time"`
+	RxBytes      uint64       `json:"rx_bytes"`
+	TxBytes      uint64       `json:"tx_bytes"`
+	LastRotation *time.Time   `json:"last_rotation,omitempty"`
+	CycleSecs    uint         `json:"cycle_secs"`
+}
+
+// policyDecision is what a -policy answers on stdout. Everything but the
+// action can be left out, keeping the settings as they are.
+type policyDecision struct {
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+
+	// Vendors replaces the vendors to generate the address from, as
+	// -vendors would.
+	Vendors []string `json:"vendors,omitempty"`
+
+	// Generator chooses how to generate the address: random, impersonating
+	// the vendors; daily, derived for the day as -daily-mac does; pool, from
+	// the -mac-pool; or slap, in the -slap quadrant, or the AAI one without.
+	Generator string `json:"generator,omitempty"`
+
+	// NextSecs is how long to wait until the next rotation, or until asking
+	// again after a skip, instead of the schedule's pick.
+	NextSecs uint `json:"next_secs,omitempty"`
+}
+
+// askPolicy runs the -policy executable with the rotation's context as JSON
+// on stdin, which can be written in whatever language suits the site's
+// rules, such as Lua or Python with a #! line.
+func (r *rotation) askPolicy(ctx context.Context, settings settings, trigger string) (policyDecision, error) {
+	input := policyInput{
+		Device:    r.deviceName,
+		Trigger:   trigger,
+		Time:      time.Now(),
+		CycleSecs: settings.cycleSecs,
+	}
+	input.Mac, _ = rotator.CurrentMAC(r.deviceName)
+	if n, err := currentNetwork(r.deviceName); err == nil && n.associated() {
+		input.SSID, input.BSSID = n.ssid, n.bssid
+		if profile, ok := findNetworkProfile(settings.networkProfiles, n); ok {
+			input.Trust = profile.trust
+		}
+	}
+	if t, err := readTraffic(r.deviceName); err == nil {
+		input.RxBytes, input.TxBytes = t.rxBytes, t.txBytes
+	}
+	r.mu.Lock()
+	if !r.status.lastChange.IsZero() {
+		lastChange := r.status.lastChange
+		input.LastRotation = &lastChange
+	}
+	r.mu.Unlock()
+
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return policyDecision{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.hookTimeoutSecs)*time.Second)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, settings.policy)
+	cmd.Stdin = bytes.NewReader(encoded)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return policyDecision{}, fmt.Errorf("timed out after %d seconds", settings.hookTimeoutSecs)
+	}
+	if err != nil {
+		if trimmed := strings.TrimSpace(stderr.String()); trimmed != "" {
+			return policyDecision{}, fmt.Errorf("%w: %s", err, trimmed)
+		}
+		return policyDecision{}, err
+	}
+
+	var decision policyDecision
+	if err := json.Unmarshal(out, &decision); err != nil {
+		return policyDecision{}, fmt.Errorf("the policy did not answer with a decision: %w", err)
+	}
+	switch decision.Action {
+	case policyRotate, policySkip:
+	default:
+		return policyDecision{}, fmt.Errorf("unknown policy action %q", decision.Action)
+	}
+	switch decision.Generator {
+	case "", policyRandom, policyDaily, policyPool, policySLAP:
+	default:
+		return policyDecision{}, fmt.Errorf("unknown policy generator %q", decision.Generator)
+	}
+	return decision, nil
+}
+
+// applyPolicy asks the -policy about a due rotation, if there is one,
+// reporting whether to go ahead and with which settings. A policy that fails
+// is warned about and the rotation goes ahead as it would have without one,
+// so a broken script cannot stop rotations altogether.
+func (r *rotation) applyPolicy(ctx context.Context, settings settings, trigger string) (settings, bool) {
+	if settings.policy == "" {
+		return settings, true
+	}
+
+	decision, err := r.askPolicy(ctx, settings, trigger)
+	if err != nil {
+		r.logger.Warn("the policy failed, so rotating as usual", "path", settings.policy, "err", err)
+		return settings, true
+	}
+	r.logger.Debug("the policy decided", "action", decision.Action, "reason", decision.Reason)
+
+	if decision.NextSecs != 0 {
+		r.mu.Lock()
+		r.policyNext = time.Duration(decision.NextSecs) * time.Second
+		r.mu.Unlock()
+	}
+	if decision.Action == policySkip {
+		r.logger.Info("not rotating", "reason", "the policy skipped it", "policy_reason", decision.Reason)
+		return settings, false
+	}
+
+	if len(decision.Vendors) != 0 {
+		vendors, err := rotator.ParseVendors(strings.Join(decision.Vendors, ","))
+		if err != nil {
+			r.logger.Warn("ignoring the policy's vendors", "err", err)
+		} else {
+			settings.vendors = vendors
+		}
+	}
+	if decision.Generator != "" {
+		settings = r.withPolicyGenerator(settings, decision.Generator)
+	}
+	return settings, true
+}
+
+// withPolicyGenerator switches the settings over to the generator, leaving
+// them be if it is the pool and there is no -mac-pool to draw from.
+func (r *rotation) withPolicyGenerator(settings settings, generator string) settings {
+	if generator == policyPool && len(settings.macPool) == 0 {
+		r.logger.Warn("ignoring the policy's generator, as there is no -mac-pool", "generator", generator)
+		return settings
+	}
+
+	slap := settings.slap
+	if slap == "" {
+		slap = rotator.SLAPAdministrative
+	}
+	settings.dailyMac = generator == policyDaily
+	if generator != policyPool {
+		settings.macPool = nil
+	}
+	settings.slap = ""
+	if generator == policySLAP {
+		settings.slap = slap
+	}
+	return settings
+}
+
+// takePolicyNext gives the wait the policy last asked for, once.
+func (r *rotation) takePolicyNext() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := r.policyNext
+	r.policyNext = 0
+	return next
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/template"
+	"time"
+)
+
+const (
+	controlPolkitSocketPerm = 0o666
+
+	polkitAction       = "com.gitlab.louis-jackman.rotate-mac-address.control"
+	polkitActionsDir   = "/usr/share/polkit-1/actions"
+	polkitRulesPath    = "/etc/polkit-1/rules.d/50-rotate-mac-address.rules"
+	defaultPolkitGroup = "wheel"
+	polkitFilePerm     = 0o644
+
+	// polkitCheckTimeout gives up on a client that has not answered polkit's
+	// authentication prompt in time, leaving enough of controlTimeout to
+	// tell it so.
+	polkitCheckTimeout = 25 * time.Second
+)
+
+// readOnlyControlVerbs are answered for anyone who can connect. That is only
+// the status, and without the original addresses for anyone but root and the
+// daemon's own user; the history and watch go through polkit as well, as they
+// give away addresses that the devices no longer have.
+var readOnlyControlVerbs = []string{"status"}
+
+func needsControlAuthorization(verb string) bool {
+	return !slices.Contains(readOnlyControlVerbs, verb)
+}
+
+// polkitPolicy lets active local sessions of administrators control the
+// daemon, as polkit does for most actions.
+var polkitPolicy = template.Must(template.New("policy").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE policyconfig PUBLIC
+ "-//freedesktop//DTD PolicyKit Policy Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/PolicyKit/1/policyconfig.dtd">
+<policyconfig>
+  <action id="{{.Action}}">
+    <description>Control the MAC address rotation daemon</description>
+    <message>Authentication is required to rotate, pause, resume, or restore MAC addresses, or to see their history</message>
+    <defaults>
+      <allow_any>auth_admin</allow_any>
+      <allow_inactive>auth_admin</allow_inactive>
+      <allow_active>auth_admin_keep</allow_active>
+    </defaults>
+  </action>
+</policyconfig>
+`))
+
+// polkitRules lets the group's members control the daemon without
+// authenticating at all.
+var polkitRules = template.Must(template.New("rules").Parse(`polkit.addRule(function(action, subject) {
+    if (action.id == "{{.Action}}" && subject.isInGroup("{{.Group}}")) {
+        return polkit.Result.YES;
+    }
+});
+`))
+
+type polkitFile struct {
+	path     string
+	template *template.Template
+}
+
+// runInstallPolkit installs the polkit action that -control-polkit asks to
+// authorize, and a rule letting a group use it without a password.
+func runInstallPolkit(args []string) error {
+	flagSet := flag.NewFlagSet("install-polkit", flag.ExitOnError)
+
+	var group string
+	var printOnly bool
+
+	flagSet.StringVar(
+		&group,
+		"group",
+		defaultPolkitGroup,
+		"the group whose members can control the daemon without a password; empty to always ask",
+	)
+	flagSet.BoolVar(
+		&printOnly,
+		"print",
+		false,
+		"print the policy and rules instead of installing them",
+	)
+	flagSet.Parse(args)
+
+	data := struct{ Action, Group string }{polkitAction, group}
+	files := []polkitFile{{filepath.Join(polkitActionsDir, polkitAction+".policy"), polkitPolicy}}
+	if group != "" {
+		files = append(files, polkitFile{polkitRulesPath, polkitRules})
+	}
+
+	for _, file := range files {
+		if printOnly {
+			fmt.Printf("# %s\n", file.path)
+			if err := file.template.Execute(os.Stdout, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		out, err := os.OpenFile(file.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, polkitFilePerm)
+		if err != nil {
+			return err
+		}
+		err = file.template.Execute(out, data)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s\n", file.path)
+	}
+	if !printOnly {
+		fmt.Println("start the daemon with -control-polkit to have it ask polkit")
+	}
+	return nil
+}
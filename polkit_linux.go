@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// controlPeer identifies who is connecting by the credentials the kernel
+// gives for the socket's other end, rather than anything they claim.
+func controlPeer(conn net.Conn) (*syscall.Ucred, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("not a Unix socket connection")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not identify who sent the request: %w", err)
+	}
+	return cred, nil
+}
+
+func privilegedPeer(cred *syscall.Ucred) bool {
+	return cred.Uid == 0 || int(cred.Uid) == os.Geteuid()
+}
+
+// controlPeerPrivileged reports whether root or the daemon's own user is
+// connecting.
+func controlPeerPrivileged(conn net.Conn) bool {
+	cred, err := controlPeer(conn)
+	return err == nil && privilegedPeer(cred)
+}
+
+// authorizeControl lets root and the daemon's own user through, and asks
+// polkit about anyone else connecting. Cancelling the context gives up on
+// polkit, as does it taking longer than polkitCheckTimeout.
+func authorizeControl(ctx context.Context, conn net.Conn) error {
+	cred, err := controlPeer(conn)
+	if err != nil {
+		return err
+	}
+	if privilegedPeer(cred) {
+		return nil
+	}
+
+	// Giving the process's start time as well keeps a process that is
+	// replaced under the same PID from being mistaken for it.
+	subject := fmt.Sprintf("%d,%s,%d", cred.Pid, processStartTime(cred.Pid), cred.Uid)
+	ctx, cancel := context.WithTimeout(ctx, polkitCheckTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "pkcheck", "--action-id", polkitAction, "--process", subject, "--allow-user-interaction")
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("polkit did not authorize the request within %s", polkitCheckTimeout)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return errors.New("not authorized by polkit")
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 2:
+		return errors.New("the polkit authentication was dismissed")
+	default:
+		return fmt.Errorf("could not ask polkit: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+}
+
+// processStartTime is the 22nd field of the process's stat file, which
+// follows its name in parentheses that can themselves hold spaces.
+func processStartTime(pid int32) string {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "0"
+	}
+	end := strings.LastIndexByte(string(stat), ')')
+	if end == -1 {
+		return "0"
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return "0"
+	}
+	if _, err := strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return "0"
+	}
+	return fields[19]
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+func authorizeControl(context.Context, net.Conn) error {
+	return errors.New("polkit authorization is only supported on Linux")
+}
+
+func controlPeerPrivileged(net.Conn) bool {
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// poolStrategy decides which address of a -mac-pool comes next.
+type poolStrategy string
+
+const (
+	poolRandom     poolStrategy = "random"
+	poolShuffle                 = "shuffle"
+	poolRoundRobin              = "round-robin"
+)
+
+func parsePoolStrategy(value string) (poolStrategy, error) {
+	switch strategy := poolStrategy(value); strategy {
+	case poolRandom, poolShuffle, poolRoundRobin:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown pool strategy %q", value)
+	}
+}
+
+// readMacPool reads a file of addresses, one per line, to rotate between
+// instead of generating them, such as those with DHCP reservations.
+func readMacPool(path string) ([]rotator.MAC, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pool []rotator.MAC
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addr, err := net.ParseMAC(line)
+		if err != nil || len(addr) != 6 {
+			return nil, fmt.Errorf("%s:%d: %q is not an Ethernet address", path, lineNo, line)
+		}
+		pool = append(pool, rotator.MAC(addr.String()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("%s has no addresses", path)
+	}
+	return pool, nil
+}
+
+// pickFromPool gives the next address under the strategy, advancing the
+// position kept in the device's state so that restarts carry on where they
+// left off. Shuffling draws each address once per pass through the pool, in
+// an order given by a seed kept alongside the position.
+func pickFromPool(rng *rand.Rand, pool []rotator.MAC, strategy poolStrategy, state *deviceState) rotator.MAC {
+	switch strategy {
+	case poolShuffle:
+		if state.PoolSeed == 0 || len(pool) <= state.PoolPosition {
+			state.PoolSeed = rng.Int63() | 1
+			state.PoolPosition = 0
+		}
+		order := rand.New(rand.NewSource(state.PoolSeed)).Perm(len(pool))
+		mac := pool[order[state.PoolPosition]]
+		state.PoolPosition++
+		return mac
+	case poolRoundRobin:
+		mac := pool[state.PoolPosition%len(pool)]
+		state.PoolPosition = (state.PoolPosition + 1) % len(pool)
+		return mac
+	default:
+		return pool[rng.Intn(len(pool))]
+	}
+}
+
+// applyNextMac gives the device its next address, from the pool if there is
+// one, in the SLAP quadrant if one is given, derived for the day with
+// -daily-mac, and impersonating a vendor otherwise.
+func (r *rotation) applyNextMac(ctx context.Context, settings settings, state *deviceState) macChange {
+	if len(settings.macPool) == 0 && settings.slap == "" && !settings.dailyMac {
+		return setMac(ctx, r.logger, r.rng, r.deviceName, settings.vendors, r.setter(settings))
+	}
+
+	previous, err := rotator.CurrentMAC(r.deviceName)
+	if err != nil {
+		r.logger.Debug("could not read the current MAC address", "err", err)
+	}
+
+	if settings.dailyMac {
+		iface, err := net.InterfaceByName(r.deviceName)
+		if err != nil {
+			return &failedMacChange{err, previous}
+		}
+		generator, err := r.dailyGenerator(settings)
+		if err != nil {
+			return &failedMacChange{err, previous}
+		}
+		mac, err := r.setter(settings).SetGenerated(ctx, r.logger, generator, *iface)
+		if err != nil {
+			return &failedMacChange{err, previous}
+		}
+		return &successfulMacChange{rotator.VendorOf(mac), mac, previous}
+	}
+
+	if settings.slap != "" {
+		iface, err := net.InterfaceByName(r.deviceName)
+		if err != nil {
+			return &failedMacChange{err, previous}
+		}
+		generator := rotator.SLAPGenerator{Quadrant: settings.slap, CID: settings.slapCID, Rand: r.rng}
+		mac, err := r.setter(settings).SetGenerated(ctx, r.logger, generator, *iface)
+		if err != nil {
+			return &failedMacChange{err, previous}
+		}
+		return &successfulMacChange{rotator.VendorLocal, mac, previous}
+	}
+
+	// Addresses that lost the device its connectivity are passed over,
+	// unless the whole pool has.
+	mac := pickFromPool(r.rng, settings.macPool, settings.poolStrategy, state)
+	for tries := 1; state.isBadMac(mac) && tries < len(settings.macPool); tries++ {
+		mac = pickFromPool(r.rng, settings.macPool, settings.poolStrategy, state)
+	}
+	if err := r.setter(settings).Apply(ctx, r.logger, r.deviceName, mac); err != nil {
+		return &failedMacChange{err, previous}
+	}
+	return &successfulMacChange{rotator.VendorOf(mac), mac, previous}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// A preset bundles settings that make sense together under one name, for
+// those who would rather not learn every flag. Its values only fill in flags
+// that were not set in any other way.
+type preset struct {
+	name    string
+	summary string
+	values  [][2]string
+}
+
+var presets = []preset{
+	{
+		name:    "home",
+		summary: "twice a day, waiting for Wi-Fi to disassociate rather than dropping it",
+		values: [][2]string{
+			{"cycle-secs", "43200"},
+			{"association-policy", "wait"},
+		},
+	},
+	{
+		name:    "travel",
+		summary: "hourly and on each new network or wake, with a new hostname and lease, and faster behind captive portals",
+		values: [][2]string{
+			{"cycle-secs", "3600"},
+			{"rotate-on-network-change", "true"},
+			{"rotate-on-wake", "true"},
+			{"aggressive-on", "captive"},
+			{"association-policy", "reassociate"},
+			{"hostname-pattern", defaultPanicHostnamePattern},
+			{"dhcp-renew", "true"},
+			{"flush-neighbors", "true"},
+		},
+	},
+	{
+		name:    "paranoid",
+		summary: "unpredictably every 15 minutes and on every association, link change, and wake, renewing everything tied to the address, and taking devices down rather than leaving a stale address",
+		values: [][2]string{
+			{"cycle-secs", "900"},
+			{"schedule", "poisson"},
+			{"rotate-on-link-down", "true"},
+			{"rotate-on-network-change", "true"},
+			{"rotate-on-wake", "true"},
+			{"rotate-per-association", "true"},
+			{"aggressive-on", "untrusted"},
+			{"association-policy", "reassociate"},
+			{"hostname-pattern", defaultPanicHostnamePattern},
+			{"dhcp-renew", "true"},
+			{"flush-neighbors", "true"},
+			{"regenerate-ipv6", "true"},
+			{"on-give-up", "down"},
+		},
+	},
+}
+
+func parsePreset(value string) (string, error) {
+	names := make([]string, len(presets))
+	for i, preset := range presets {
+		if preset.name == value {
+			return value, nil
+		}
+		names[i] = preset.name
+	}
+	last := len(names) - 1
+	return "", fmt.Errorf("unknown profile %q; use %s, or %s", value, strings.Join(names[:last], ", "), names[last])
+}
+
+// presetsUsage lists the presets for the -profile flag's help.
+func presetsUsage() string {
+	descriptions := make([]string, len(presets))
+	for i, preset := range presets {
+		descriptions[i] = preset.name + ", " + preset.summary
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// applyPreset fills in the flags that the preset sets but nothing else has.
+func applyPreset(flagSet *flag.FlagSet, name string) error {
+	for _, preset := range presets {
+		if preset.name != name {
+			continue
+		}
+		for _, value := range preset.values {
+			if isFlagSet(flagSet, value[0]) {
+				continue
+			}
+			if err := flagSet.Set(value[0], value[1]); err != nil {
+				return fmt.Errorf("the %s profile: %s: %w", name, value[0], err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// checkPrivileges fails up front with what is needed, rather than letting
+// every rotation fail with permission errors until the daemon gives up. Dry
+// runs change nothing, so need nothing, escalated commands get their
+// privileges per command, and the helper has them for the daemon.
+func checkPrivileges(flags flags) error {
+	if flags.dryRun || flags.escalate != escalateNever || flags.helperSocket != "" {
+		return nil
+	}
+	if err := missingPrivileges(); err != nil {
+		return &rotator.ExitError{Code: rotator.ExitPrivileges, Err: err}
+	}
+	return nil
+}
+
+// checkTools fails up front if the commands that set addresses are missing,
+// rather than at the first rotation, perhaps half an hour after boot.
+func checkTools(flags flags) error {
+	if flags.dryRun || flags.helperSocket != "" {
+		return nil
+	}
+
+	progs := []string{}
+	if flags.escalate != escalateNever {
+		progs = append(progs, string(flags.escalate))
+	}
+	switch flags.backend.resolve() {
+	case backendUCI:
+		progs = append(progs, "uci", "ubus")
+	case backendConnMan:
+		prog, _ := rotator.DefaultSetCommand()(defaultDeviceName, rotator.PrefixIntel)
+		progs = append(progs, "connmanctl", prog)
+	default:
+		prog, _ := rotator.DefaultSetCommand()(defaultDeviceName, rotator.PrefixIntel)
+		progs = append(progs, prog)
+	}
+
+	for _, prog := range progs {
+		if _, err := exec.LookPath(prog); err != nil {
+			return &rotator.ExitError{
+				Code: rotator.ExitMissingTool,
+				Err:  fmt.Errorf("%s is needed to change MAC addresses: %w", prog, err),
+			}
+		}
+	}
+	return nil
+}
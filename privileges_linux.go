@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const capNetAdmin = 12
+
+// capabilities reads the process's capability sets, keyed by their names in
+// /proc such as CapEff.
+func capabilities() (map[string]uint64, error) {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sets := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.HasPrefix(key, "Cap") {
+			continue
+		}
+		if set, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64); err == nil {
+			sets[key] = set
+		}
+	}
+	return sets, scanner.Err()
+}
+
+func hasCapability(sets map[string]uint64, set string, capability uint) bool {
+	return sets[set]&(1<<capability) != 0
+}
+
+func missingPrivileges() error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+	if sets, err := capabilities(); err == nil && hasCapability(sets, "CapEff", capNetAdmin) {
+		return nil
+	}
+
+	return errors.New(
+		"changing MAC addresses needs root or the CAP_NET_ADMIN capability; " +
+			"run with sudo, or grant the capability with `setcap cap_net_admin+eip` on this executable",
+	)
+}
+
+// runPrivileged passes CAP_NET_ADMIN on to the command when running
+// unprivileged with just that capability, as it would otherwise be lost on
+// exec.
+func runPrivileged(cmd *exec.Cmd) error {
+	if os.Geteuid() != 0 {
+		if sets, err := capabilities(); err == nil && hasCapability(sets, "CapPrm", capNetAdmin) {
+			cmd.SysProcAttr = &syscall.SysProcAttr{AmbientCaps: []uintptr{capNetAdmin}}
+		}
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,20 @@
+//go:build unix && !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func missingPrivileges() error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+	return errors.New("changing MAC addresses needs root; run with sudo")
+}
+
+func runPrivileged(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+const tokenElevation = 20
+
+func missingPrivileges() error {
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return err
+	}
+	defer token.Close()
+
+	var elevated uint32
+	var size uint32
+	err = syscall.GetTokenInformation(
+		token,
+		tokenElevation,
+		(*byte)(unsafe.Pointer(&elevated)),
+		uint32(unsafe.Sizeof(elevated)),
+		&size,
+	)
+	if err != nil {
+		return err
+	}
+	if elevated == 0 {
+		return errors.New("changing MAC addresses needs administrator rights; run from an elevated prompt")
+	}
+	return nil
+}
+
+func runPrivileged(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
@@ -0,0 +1,21 @@
+package main
+
+// randomiseProbes has the device scan from random addresses of its own
+// between associations, as probe requests would otherwise broadcast its real
+// address between rotations for anyone listening to pick up.
+func (r *rotation) randomiseProbes(flags flags) {
+	if !flags.probeRandomization {
+		return
+	}
+	if flags.dryRun {
+		r.logger.Info("would randomise the addresses of probe requests")
+		return
+	}
+
+	how, err := randomiseProbes(r.deviceName)
+	if err != nil {
+		r.logger.Warn("could not randomise the addresses of probe requests", "err", err)
+		return
+	}
+	r.logger.Info("randomised the addresses of probe requests", "by", how)
+}
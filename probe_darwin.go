@@ -0,0 +1,7 @@
+package main
+
+// randomiseProbes has nothing to do, as macOS already scans from random
+// addresses, leaving nothing to configure.
+func randomiseProbes(string) (string, error) {
+	return "macOS", nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const iwdConfig = "/etc/iwd/main.conf"
+
+// randomiseProbes asks wpa_supplicant to randomise the addresses of scans and
+// of the GAS queries it makes before associating. iwd randomises scans by
+// default, so it is only checked for having that turned off.
+func randomiseProbes(deviceName string) (string, error) {
+	conn, err := dialWpa(deviceName)
+	if err != nil {
+		if _, statErr := os.Stat("/var/lib/iwd"); statErr == nil {
+			return "iwd", checkIwdRandomisation()
+		}
+		return "", fmt.Errorf("neither wpa_supplicant nor iwd manages the device: %w", err)
+	}
+	defer conn.Close()
+
+	for _, cmd := range []string{"SET preassoc_mac_addr 1", "SET gas_rand_mac_addr 1"} {
+		reply, err := conn.request(cmd)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(reply) != "OK" {
+			return "", fmt.Errorf("wpa_supplicant refused %q: %s", cmd, strings.TrimSpace(reply))
+		}
+	}
+	return "wpa_supplicant", nil
+}
+
+func checkIwdRandomisation() error {
+	file, err := os.Open(iwdConfig)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && section == "[Scan]" && strings.TrimSpace(key) == "DisableMacAddressRandomization" && strings.TrimSpace(value) == "true" {
+			return fmt.Errorf("iwd has DisableMacAddressRandomization=true under [Scan] in %s; remove it and restart iwd", iwdConfig)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func randomiseProbes(string) (string, error) {
+	return "", errors.New("probe requests can only be randomised on Linux and macOS")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	defaultCaptiveProbeURL     = "http://connectivitycheck.gstatic.com/generate_204"
+	captiveProbeTimeout        = 10 * time.Second
+	captiveProbeSettleTime     = 5 * time.Second
+	defaultAggressiveCycleSecs = 10 * 60
+)
+
+// aggressiveWhen decides on which networks to switch to the aggressive
+// profile: a shorter cycle on a less predictable schedule, drawing from every
+// vendor. Networks on neither the trusted nor the known lists count as
+// untrusted.
+type aggressiveWhen string
+
+const (
+	aggressiveNever     aggressiveWhen = "never"
+	aggressiveCaptive                  = "captive"
+	aggressiveUntrusted                = "untrusted"
+)
+
+func parseAggressiveWhen(value string) (aggressiveWhen, error) {
+	switch when := aggressiveWhen(value); when {
+	case aggressiveNever, aggressiveCaptive, aggressiveUntrusted:
+		return when, nil
+	default:
+		return "", fmt.Errorf("unknown network kind %q", value)
+	}
+}
+
+func (settings settings) aggressive() settings {
+	settings.cycleSecs = settings.aggressiveCycleSecs
+	settings.schedule = settings.aggressiveSchedule
+	settings.vendors = rotator.Vendors
+	return settings
+}
+
+// behindCaptivePortal probes an address that answers with an empty 204 on the
+// open internet, which captive portals intercept with a redirect or a login
+// page.
+func behindCaptivePortal(ctx context.Context, probeURL string) (bool, error) {
+	_, captive, err := probeCaptivePortal(ctx, probeURL)
+	return captive, err
+}
+
+func (flags flags) knows(n network) bool {
+	if trust := flags.networkTrustOf(n); trust != trustUnset {
+		return trust != trustUntrusted
+	}
+	for _, known := range flags.knownNetworks {
+		if known == n.ssid || (n.bssid != "" && strings.EqualFold(known, n.bssid)) {
+			return true
+		}
+	}
+	return flags.trusts(n)
+}
+
+// isAggressiveOn works out whether the network calls for the aggressive
+// profile under the current flags.
+func isAggressiveOn(ctx context.Context, flags flags, current network) bool {
+	if !current.associated() || flags.aggressiveWhen == aggressiveNever {
+		return false
+	}
+	if flags.aggressiveWhen == aggressiveUntrusted && !flags.knows(current) {
+		return true
+	}
+
+	// Give DHCP a moment before probing through the new network.
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(captiveProbeSettleTime):
+	}
+
+	captive, err := behindCaptivePortal(ctx, flags.captiveProbeURL)
+	return err == nil && captive
+}
+
+// watchProfileTrigger switches a device to the aggressive profile when it
+// joins a captive or unknown network, rotating it for the new network
+// straight away, and reverts when it is back on a known network.
+func watchProfileTrigger(ctx context.Context, d *daemon, r *rotation) error {
+	return watchNetworks(ctx, r.deviceName, func(current network) {
+		if !current.associated() {
+			return
+		}
+
+		aggressive := isAggressiveOn(ctx, d.currentFlags(), current)
+		if !r.setAggressive(aggressive) {
+			return
+		}
+
+		if aggressive {
+			r.requestRotation("it joined " + current.String() + ", which calls for the aggressive profile")
+		} else {
+			r.logger.Info("reverting to the normal profile", "network", current)
+		}
+	})
+}
+
+// setAggressive reports whether that changed anything.
+func (r *rotation) setAggressive(aggressive bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := r.status.aggressive != aggressive
+	r.status.aggressive = aggressive
+	return changed
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// The protobuf wire format, as far as the messages in proto/rotator.proto
+// need it.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errBadProto = errors.New("malformed protobuf message")
+
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) tag(field int, wireType int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wireType))
+}
+
+// Zero values are left out, as proto3 does.
+
+func (e *protoEncoder) varint(field int, value uint64) {
+	if value != 0 {
+		e.tag(field, wireVarint)
+		e.buf = binary.AppendUvarint(e.buf, value)
+	}
+}
+
+func (e *protoEncoder) bool(field int, value bool) {
+	if value {
+		e.varint(field, 1)
+	}
+}
+
+func (e *protoEncoder) bytes(field int, value []byte) {
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *protoEncoder) string(field int, value string) {
+	if value != "" {
+		e.bytes(field, []byte(value))
+	}
+}
+
+// timestamp encodes a google.protobuf.Timestamp.
+func (e *protoEncoder) timestamp(field int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	var ts protoEncoder
+	ts.varint(1, uint64(t.Unix()))
+	ts.varint(2, uint64(t.Nanosecond()))
+	e.bytes(field, ts.buf)
+}
+
+// protoField is one field of a decoded message, with either its varint value
+// or its bytes depending on the wire type.
+type protoField struct {
+	number int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeProto(msg []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(msg) != 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errBadProto
+		}
+		msg = msg[n:]
+
+		field := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			field.varint, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, errBadProto
+			}
+			msg = msg[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return nil, errBadProto
+			}
+			field.bytes = msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+		case wireFixed64:
+			if len(msg) < 8 {
+				return nil, errBadProto
+			}
+			msg = msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return nil, errBadProto
+			}
+			msg = msg[4:]
+		default:
+			return nil, errBadProto
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
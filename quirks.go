@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// resetMethod is how to reset a device whose driver only takes a new address
+// once the hardware restarts.
+type resetMethod string
+
+const (
+	resetNone         resetMethod = "none"
+	resetReloadModule             = "reload-module"
+	resetUSBRebind                = "usb-rebind"
+)
+
+func parseResetMethod(value string) (resetMethod, error) {
+	switch method := resetMethod(value); method {
+	case resetNone, resetReloadModule, resetUSBRebind:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unknown reset method %q", value)
+	}
+}
+
+// parseResetMethods reads a comma-separated list of device=method pairs,
+// where a method without a device applies to every device not listed.
+func parseResetMethods(value string) (map[string]resetMethod, error) {
+	methods := make(map[string]resetMethod)
+	for _, item := range parseList(value) {
+		deviceName, methodName, ok := strings.Cut(item, "=")
+		if !ok {
+			deviceName, methodName = "", item
+		}
+		method, err := parseResetMethod(strings.TrimSpace(methodName))
+		if err != nil {
+			return nil, err
+		}
+		methods[strings.TrimSpace(deviceName)] = method
+	}
+	return methods, nil
+}
+
+// quirkyDrivers are those of common USB chipsets that accept a new address
+// without error but keep using the old one until they are reset.
+var quirkyDrivers = map[string]resetMethod{
+	"ax88179_178a": resetUSBRebind,
+	"mt7601u":      resetReloadModule,
+	"8812au":       resetReloadModule,
+	"8821cu":       resetReloadModule,
+	"88x2bu":       resetReloadModule,
+}
+
+// resetMethodFor is the method given for the device, or else for every
+// device, or else the one its driver is known to need.
+func resetMethodFor(methods map[string]resetMethod, deviceName string) resetMethod {
+	if method, ok := methods[deviceName]; ok {
+		return method
+	}
+	if method, ok := methods[""]; ok {
+		return method
+	}
+	if method, ok := quirkyDrivers[deviceDriver(deviceName)]; ok {
+		return method
+	}
+	return resetNone
+}
+
+// resetDevice resets the device, if it needs it, just before its address is
+// changed, waiting for it to come back.
+func (r *rotation) resetDevice(ctx context.Context, settings settings) error {
+	method := resetMethodFor(settings.resetMethods, r.deviceName)
+	if method == resetNone {
+		return nil
+	}
+
+	logger := r.logger.With("reset_method", method)
+	if settings.dryRun {
+		logger.Info("would reset the device before changing its address")
+		return nil
+	}
+
+	var err error
+	switch method {
+	case resetReloadModule:
+		err = reloadModule(r.deviceName)
+	case resetUSBRebind:
+		err = rebindUSB(r.deviceName)
+	}
+	if err != nil {
+		return fmt.Errorf("could not reset the device with %s: %w", method, err)
+	}
+	if err := waitForDevice(ctx, r.deviceName); err != nil {
+		return err
+	}
+	logger.Info("reset the device before changing its address")
+	return nil
+}
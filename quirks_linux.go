@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	deviceReturnTimeout  = 10 * time.Second
+	deviceReturnInterval = 200 * time.Millisecond
+)
+
+// reloadModule unloads and reloads the device's driver, which resets every
+// device using it.
+func reloadModule(deviceName string) error {
+	module, err := os.Readlink(filepath.Join("/sys/class/net", deviceName, "device", "driver", "module"))
+	if err != nil {
+		return fmt.Errorf("the driver of %s is not a loadable module", deviceName)
+	}
+
+	moduleName := filepath.Base(module)
+	if err := modprobe("-r", moduleName); err != nil {
+		return err
+	}
+	return modprobe(moduleName)
+}
+
+func modprobe(args ...string) error {
+	if out, err := exec.Command("modprobe", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("modprobe: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// rebindUSB unbinds the USB device behind the network device from the USB
+// core and binds it again, which resets just that device.
+func rebindUSB(deviceName string) error {
+	iface, err := filepath.EvalSymlinks(filepath.Join("/sys/class/net", deviceName, "device"))
+	if err != nil {
+		return err
+	}
+	if subsystem, err := os.Readlink(filepath.Join(iface, "subsystem")); err != nil || filepath.Base(subsystem) != "usb" {
+		return fmt.Errorf("%s is not a USB device", deviceName)
+	}
+
+	// The network device belongs to an interface such as 1-2:1.0 of the USB
+	// device 1-2.
+	usbDevice, _, _ := strings.Cut(filepath.Base(iface), ":")
+
+	const driverDir = "/sys/bus/usb/drivers/usb"
+	if err := os.WriteFile(filepath.Join(driverDir, "unbind"), []byte(usbDevice), 0o200); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(driverDir, "bind"), []byte(usbDevice), 0o200)
+}
+
+// waitForDevice waits for the device to reappear after being reset.
+func waitForDevice(ctx context.Context, deviceName string) error {
+	deadline := time.Now().Add(deviceReturnTimeout)
+	for {
+		if _, err := net.InterfaceByName(deviceName); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not come back within %s of being reset", deviceName, deviceReturnTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(deviceReturnInterval):
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+var errResetUnsupported = errors.New("devices can only be reset on Linux")
+
+func reloadModule(string) error {
+	return errResetUnsupported
+}
+
+func rebindUSB(string) error {
+	return errResetUnsupported
+}
+
+func waitForDevice(context.Context, string) error {
+	return nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	remoteConfigTimeout = 30 * time.Second
+	remoteConfigMaxSize = 1 << 20
+	remoteConfigCache   = "remote-config.cache"
+
+	defaultConfigRefreshSecs = 15 * 60
+)
+
+// parseConfigKey reads the Ed25519 public key that -config-url signatures are
+// checked against, in base64, either raw or in the PKIX form that
+// `openssl pkey -pubout -outform DER` gives.
+func parseConfigKey(value string) (ed25519.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("the key is not base64: %w", err)
+	}
+	if len(der) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(der), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("the key is neither a raw Ed25519 key nor a PKIX one: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("the key is not an Ed25519 one")
+	}
+	return edKey, nil
+}
+
+// cachedConfig is the last copy of the -config-url that was fetched, kept in
+// the state dir so that the policy still applies when the server cannot be
+// reached, and so that unchanged copies need not be downloaded again.
+type cachedConfig struct {
+	URL       string `json:"url"`
+	ETag      string `json:"etag,omitempty"`
+	Body      []byte `json:"body"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+func readCachedConfig(stateDir, configURL string) (cachedConfig, bool) {
+	path := filepath.Join(stateDir, remoteConfigCache)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cachedConfig{}, false
+	}
+	if data, err = openState(path, data); err != nil {
+		return cachedConfig{}, false
+	}
+	var cached cachedConfig
+	if err := json.Unmarshal(data, &cached); err != nil || cached.URL != configURL {
+		return cachedConfig{}, false
+	}
+	return cached, true
+}
+
+func writeCachedConfig(stateDir string, cached cachedConfig) error {
+	if err := os.MkdirAll(stateDir, stateDirPerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(stateDir, remoteConfigCache)
+	if data, err = sealState(path, data); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, stateFilePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// remoteConfigFetcher downloads a -config-url, checking its signature if
+// there is a key to check it against.
+type remoteConfigFetcher struct {
+	url      string
+	key      ed25519.PublicKey
+	stateDir string
+	client   *http.Client
+}
+
+func newRemoteConfigFetcher(flags flags) (*remoteConfigFetcher, error) {
+	u, err := url.Parse(flags.configURL)
+	if err != nil {
+		return nil, fmt.Errorf("-config-url: %w", err)
+	}
+	switch {
+	case u.Scheme != "https" && u.Scheme != "http":
+		return nil, fmt.Errorf("-config-url must be an HTTPS URL, not %q", flags.configURL)
+	case u.Scheme == "http" && flags.configURLKey == nil:
+		return nil, errors.New("-config-url must be HTTPS unless a -config-url-key verifies what it serves")
+	}
+	return &remoteConfigFetcher{
+		url:      flags.configURL,
+		key:      flags.configURLKey,
+		stateDir: flags.stateDir,
+		client:   &http.Client{Timeout: remoteConfigTimeout},
+	}, nil
+}
+
+// fetch gives the config, and whether it differs from the cached copy. When
+// the server cannot be reached, or serves something that fails its
+// signature, the cached copy is used instead if there is one.
+func (f *remoteConfigFetcher) fetch(ctx context.Context) (config, bool, error) {
+	cached, haveCache := readCachedConfig(f.stateDir, f.url)
+	if haveCache && f.verify(cached.Body, cached.Signature) != nil {
+		haveCache = false
+	}
+
+	fetched, err := f.download(ctx, cached, haveCache)
+	if err != nil {
+		if !haveCache {
+			return config{}, false, fmt.Errorf("could not fetch the -config-url: %w", err)
+		}
+		slog.Warn("could not fetch the -config-url, so the cached copy applies", "url", f.url, "err", err)
+		fetched = cached
+	}
+
+	changed := !haveCache || !bytes.Equal(fetched.Body, cached.Body)
+	if changed || fetched.ETag != cached.ETag {
+		if err := writeCachedConfig(f.stateDir, fetched); err != nil {
+			slog.Warn("could not cache the -config-url", "url", f.url, "err", err)
+		}
+	}
+
+	c, err := parseConfig(f.url, string(fetched.Body))
+	return c, changed, err
+}
+
+func (f *remoteConfigFetcher) download(ctx context.Context, cached cachedConfig, haveCache bool) (cachedConfig, error) {
+	etag := ""
+	if haveCache {
+		etag = cached.ETag
+	}
+	body, etag, notModified, err := f.get(ctx, f.url, etag)
+	if err != nil {
+		return cachedConfig{}, err
+	}
+	if notModified {
+		return cached, nil
+	}
+
+	fetched := cachedConfig{URL: f.url, ETag: etag, Body: body}
+	if f.key != nil {
+		encoded, _, _, err := f.get(ctx, f.url+".sig", "")
+		if err != nil {
+			return cachedConfig{}, fmt.Errorf("could not fetch the signature: %w", err)
+		}
+		fetched.Signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil {
+			return cachedConfig{}, fmt.Errorf("the signature is not base64: %w", err)
+		}
+	}
+	if err := f.verify(fetched.Body, fetched.Signature); err != nil {
+		return cachedConfig{}, err
+	}
+	return fetched, nil
+}
+
+func (f *remoteConfigFetcher) get(ctx context.Context, target, etag string) ([]byte, string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+	req.Header.Set("User-Agent", "rotate-mac-address")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if etag != "" {
+			return nil, etag, true, nil
+		}
+		fallthrough
+	default:
+		return nil, "", false, fmt.Errorf("%s responded with %s", target, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, remoteConfigMaxSize+1))
+	if err != nil {
+		return nil, "", false, err
+	}
+	if remoteConfigMaxSize < len(body) {
+		return nil, "", false, fmt.Errorf("%s is larger than %d bytes", target, remoteConfigMaxSize)
+	}
+	return body, resp.Header.Get("ETag"), false, nil
+}
+
+func (f *remoteConfigFetcher) verify(body, signature []byte) error {
+	if f.key == nil {
+		return nil
+	}
+	if !ed25519.Verify(f.key, body, signature) {
+		return errors.New("the config does not match its signature")
+	}
+	return nil
+}
+
+// loadRemoteConfig fetches the -config-url when parsing flags.
+func loadRemoteConfig(flags flags) (config, error) {
+	fetcher, err := newRemoteConfigFetcher(flags)
+	if err != nil {
+		return config{}, err
+	}
+	c, _, err := fetcher.fetch(context.Background())
+	return c, err
+}
+
+// refreshRemoteConfig fetches the -config-url periodically, reloading the
+// flags whenever it changes, so that a fleet's policy can be changed
+// centrally without visiting each machine.
+func refreshRemoteConfig(ctx context.Context, d *daemon, initial flags) {
+	fetcher, err := newRemoteConfigFetcher(initial)
+	if err != nil {
+		slog.Error("cannot refresh the -config-url", "err", err)
+		return
+	}
+	last, _ := loadRemoteConfigCache(initial)
+
+	ticker := time.NewTicker(time.Duration(initial.configRefreshSecs) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, changed, err := fetcher.fetch(ctx)
+		if err == nil && !changed {
+			continue
+		}
+		if err == nil {
+			var reloaded flags
+			if reloaded, err = reloadFlags(); err == nil {
+				logConfigChanges(fetcher.url, last, current)
+				last = current
+				d.reload(ctx, reloaded)
+				continue
+			}
+		}
+		slog.Error("could not refresh the -config-url", "url", fetcher.url, "err", err)
+	}
+}
+
+func loadRemoteConfigCache(flags flags) (config, bool) {
+	cached, ok := readCachedConfig(flags.stateDir, flags.configURL)
+	if !ok {
+		return config{}, false
+	}
+	c, err := parseConfig(flags.configURL, string(cached.Body))
+	return c, err == nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealedConfigCacheRoundTrips(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv(envName("config"), os.DevNull)
+	t.Cleanup(func() { stateKey = nil })
+
+	keyFile := filepath.Join(t.TempDir(), "state.key")
+	secret := make([]byte, stateKeySize)
+	rand.Read(secret)
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(secret)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte("cycle-secs = 1234\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/config.toml.sig" {
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, body))))
+			return
+		}
+		w.Write(body)
+	}))
+	args := []string{
+		"-state-dir", stateDir,
+		"-state-key-file", keyFile,
+		"-config-url", server.URL + "/config.toml",
+		"-config-url-key", base64.StdEncoding.EncodeToString(public),
+	}
+
+	parse := func() flags {
+		t.Helper()
+		stateKey = nil
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags := defineFlags(flagSet)
+		if err := parseFlags(flagSet, flags, args); err != nil {
+			t.Fatal(err)
+		}
+		return *flags
+	}
+
+	if flags := parse(); flags.cycleSecs != 1234 {
+		t.Fatalf("got a cycle of %d seconds from the -config-url, want 1234", flags.cycleSecs)
+	}
+	cache, err := os.ReadFile(filepath.Join(stateDir, remoteConfigCache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sealed sealedState
+	if err := json.Unmarshal(cache, &sealed); err != nil || sealed.Sealing != stateSealing {
+		t.Fatalf("the cache was not sealed: %s", cache)
+	}
+
+	// With the server gone, the sealed cache is all there is.
+	server.Close()
+	if flags := parse(); flags.cycleSecs != 1234 {
+		t.Errorf("got a cycle of %d seconds from the cache, want 1234", flags.cycleSecs)
+	}
+}
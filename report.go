@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	reportTimeout       = 10 * time.Second
+	reportMaxBatch      = 100
+	reportMaxBacklog    = 1000
+	reportMaxRetryDelay = 10 * time.Minute
+
+	defaultReportBatchSecs = 60
+)
+
+// machineIDPaths hold an identifier that stays the same across reboots and
+// hostname changes, unlike the hostname, which may be rotated too.
+var machineIDPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// defaultReportID identifies the machine to a fleet server when no
+// -report-id is given.
+func defaultReportID() string {
+	for _, path := range machineIDPaths {
+		if id, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(id)) != "" {
+			return strings.TrimSpace(string(id))
+		}
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// fleetReport is the JSON payload posted, summarising the changes since the
+// last one.
+type fleetReport struct {
+	ID        string           `json:"id"`
+	Version   string           `json:"version"`
+	SentAt    time.Time        `json:"sent_at"`
+	Rotations []reportRotation `json:"rotations"`
+	Failures  int              `json:"failures"`
+}
+
+// reportRotation is a change as a fleet server sees it: a history entry
+// without the address the device had beforehand, which for the first change
+// is its permanent one, the very address rotating is there to keep from
+// leaving the machine.
+type reportRotation struct {
+	At      time.Time      `json:"at"`
+	Device  string         `json:"device"`
+	Mac     rotator.MAC    `json:"mac,omitempty"`
+	Vendor  rotator.Vendor `json:"vendor,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Trigger string         `json:"trigger,omitempty"`
+}
+
+func newReportRotation(entry historyEntry) reportRotation {
+	return reportRotation{
+		At:      entry.At,
+		Device:  entry.Device,
+		Mac:     entry.Mac,
+		Vendor:  entry.Vendor,
+		Error:   entry.Error,
+		Trigger: entry.Trigger,
+	}
+}
+
+// fleetReporter batches changes to post to a fleet server, so that whoever
+// runs many machines can check that they are all rotating.
+type fleetReporter struct {
+	url    string
+	token  string
+	id     string
+	every  time.Duration
+	client *http.Client
+}
+
+func newFleetReporter(flags flags) (*fleetReporter, error) {
+	parsed, err := url.Parse(flags.reportURL)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case parsed.Scheme != "http" && parsed.Scheme != "https":
+		return nil, fmt.Errorf("-report-url must be an https:// address, not %q", flags.reportURL)
+	case parsed.Scheme == "http" && !flags.reportInsecure:
+		return nil, errors.New("-report-url must be https:// unless -report-insecure allows sending the -report-token and changes unencrypted")
+	}
+	if flags.reportBatchSecs == 0 {
+		return nil, errors.New("-report-batch-secs must be positive")
+	}
+
+	id := flags.reportID
+	if id == "" {
+		id = defaultReportID()
+	}
+	return &fleetReporter{
+		url:    flags.reportURL,
+		token:  flags.reportToken,
+		id:     id,
+		every:  time.Duration(flags.reportBatchSecs) * time.Second,
+		client: &http.Client{Timeout: reportTimeout},
+	}, nil
+}
+
+// serveReports posts the changes in batches every so often, holding on to
+// them while the server cannot be reached and backing off until it can. The
+// last batch is sent once ctx ends, which the returned channel is closed
+// after.
+func serveReports(ctx context.Context, d *daemon, reporter *fleetReporter) <-chan struct{} {
+	entries, unsubscribe := d.history.subscribe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer unsubscribe()
+
+		var backlog []historyEntry
+		delay := reporter.every
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				flushCtx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+				if _, err := reporter.flush(flushCtx, backlog); err != nil {
+					slog.Warn("could not send the last report to the fleet server", "url", redactURL(reporter.url), "err", err)
+				}
+				cancel()
+				return
+			case entry := <-entries:
+				backlog = append(backlog, entry)
+				if reportMaxBacklog < len(backlog) {
+					slog.Warn("the fleet server has not been reachable for a while, so the oldest changes were dropped from its report", "dropped", len(backlog)-reportMaxBacklog)
+					backlog = backlog[len(backlog)-reportMaxBacklog:]
+				}
+				continue
+			case <-timer.C:
+			}
+
+			if len(backlog) == 0 {
+				timer.Reset(reporter.every)
+				continue
+			}
+			var err error
+			if backlog, err = reporter.flush(ctx, backlog); err != nil {
+				delay = min(delay*2, max(reporter.every, reportMaxRetryDelay))
+				slog.Warn("could not report to the fleet server", "url", redactURL(reporter.url), "err", err, "retry_in", delay)
+			} else {
+				delay = reporter.every
+			}
+			timer.Reset(delay)
+		}
+	}()
+	return done
+}
+
+// flush posts the backlog in batches of reportMaxBatch, giving what is left
+// to retry. Batches that the server rejects outright are dropped rather than
+// holding up the rest.
+func (reporter *fleetReporter) flush(ctx context.Context, backlog []historyEntry) ([]historyEntry, error) {
+	for 0 < len(backlog) {
+		batch := backlog[:min(len(backlog), reportMaxBatch)]
+		retry, err := reporter.post(ctx, batch)
+		if err != nil && retry {
+			return backlog, err
+		}
+		if err != nil {
+			slog.Warn("the fleet server rejected a report, so it was dropped", "url", redactURL(reporter.url), "err", err, "changes", len(batch))
+		}
+		backlog = backlog[len(batch):]
+	}
+	return nil, nil
+}
+
+// post sends a batch, reporting whether a failure is worth retrying.
+func (reporter *fleetReporter) post(ctx context.Context, batch []historyEntry) (bool, error) {
+	report := fleetReport{
+		ID:      reporter.id,
+		Version: readBuildInfo().Version,
+		SentAt:  time.Now(),
+	}
+	for _, entry := range batch {
+		report.Rotations = append(report.Rotations, newReportRotation(entry))
+		if entry.Error != "" {
+			report.Failures++
+		}
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reporter.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rotate-mac-address")
+	if reporter.token != "" {
+		req.Header.Set("Authorization", "Bearer "+reporter.token)
+	}
+
+	resp, err := reporter.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || 500 <= resp.StatusCode:
+		return true, fmt.Errorf("answered %s", resp.Status)
+	default:
+		return false, fmt.Errorf("answered %s", resp.Status)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportsLeaveOutPreviousAddresses(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		read, _ := io.ReadAll(req.Body)
+		body = string(read)
+	}))
+	defer server.Close()
+
+	reporter, err := newFleetReporter(flags{reportURL: server.URL, reportBatchSecs: 1, reportInsecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := historyEntry{At: time.Now(), Device: "rma-test0", Mac: "02:00:00:00:00:02", Previous: "00:1b:77:12:34:56"}
+	if _, err := reporter.post(context.Background(), []historyEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "02:00:00:00:00:02") || strings.Contains(body, "00:1b:77:12:34:56") {
+		t.Errorf("the report should give the new address but not the previous one: %s", body)
+	}
+}
+
+func TestReportsNeedHTTPS(t *testing.T) {
+	if _, err := newFleetReporter(flags{reportURL: "http://fleet.example.com/", reportBatchSecs: 1}); err == nil {
+		t.Error("an http:// -report-url was allowed without -report-insecure")
+	}
+	if _, err := newFleetReporter(flags{reportURL: "https://fleet.example.com/", reportBatchSecs: 1}); err != nil {
+		t.Errorf("an https:// -report-url was refused: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// restoreTarget is which address to put back on a device when its rotation
+// stops.
+type restoreTarget string
+
+const (
+	restoreNothing   restoreTarget = ""
+	restoreOriginal                = "original"
+	restorePermanent               = "permanent"
+)
+
+func parseRestoreTarget(value string) (restoreTarget, error) {
+	switch target := restoreTarget(value); target {
+	case restoreNothing, restoreOriginal, restorePermanent:
+		return target, nil
+	default:
+		return "", fmt.Errorf("unknown address to restore %q", value)
+	}
+}
+
+// recordAddresses notes the addresses the device had before any rotation. An
+// original address saved by an earlier run is kept, as the device is probably
+// still wearing a random one from that run.
+func (r *rotation) recordAddresses(state *deviceState) {
+	if state.OriginalMac == "" {
+		mac, err := rotator.CurrentMAC(r.deviceName)
+		if err != nil {
+			r.logger.Warn("could not record the original MAC address", "err", err)
+		}
+		state.OriginalMac = mac
+	}
+
+	if state.PermanentMac == "" {
+		if mac, err := permanentMac(r.deviceName); err == nil {
+			state.PermanentMac = mac
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.originalMac = state.OriginalMac
+	r.permanentMac = state.PermanentMac
+}
+
+func (r *rotation) restore(ctx context.Context, target restoreTarget, reason string) error {
+	if target == restoreNothing {
+		return nil
+	}
+
+	// A macvlan child has nothing to go back to but not existing.
+	settings := r.currentSettings()
+	if _, ok := settings.macvlanParents[r.deviceName]; ok {
+		return r.removeMacvlan(ctx, settings, reason)
+	}
+
+	var mac rotator.MAC
+	switch target {
+	case restoreOriginal:
+		r.mu.Lock()
+		mac = r.originalMac
+		r.mu.Unlock()
+		if mac == "" {
+			return errors.New("the original MAC address was never recorded")
+		}
+	case restorePermanent:
+		r.mu.Lock()
+		mac = r.permanentMac
+		r.mu.Unlock()
+		if mac == "" {
+			var err error
+			if mac, err = permanentMac(r.deviceName); err != nil {
+				return err
+			}
+		}
+	}
+
+	previous, _ := rotator.CurrentMAC(r.deviceName)
+	err := r.setter(settings).Apply(ctx, r.logger, r.deviceName, mac)
+	r.audit.recordRestore(r.deviceName, previous, mac, reason, err)
+	if err != nil {
+		return err
+	}
+	r.logger.Info("restored the MAC address", "target", target, "new_mac", mac)
+	return nil
+}
+
+// runRestore puts back the saved addresses of the given devices, or of every
+// device with saved state if none are given, from a fresh process. With -to
+// a time, the addresses are those the audit log says the devices had then.
+func runRestore(args []string) error {
+	flagSet := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+
+	target := restoreTarget(restoreOriginal)
+	var at time.Time
+	flagSet.Func(
+		"to",
+		"the MAC address to put back: original (default), permanent, or the one a device had at a time in the -audit-log, such as \"2024-06-01 14:00\"",
+		func(value string) (err error) {
+			if target, err = parseRestoreTarget(value); err == nil {
+				at = time.Time{}
+				return nil
+			}
+			if at, err = parseHistoryTime(value); err != nil {
+				return fmt.Errorf("%q is neither original, permanent, nor a time such as 2006-01-02 14:32", value)
+			}
+			return nil
+		},
+	)
+
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	deviceNames := flagSet.Args()
+	if len(deviceNames) == 0 {
+		var err error
+		if deviceNames, err = savedDeviceNames(flags.stateDir); err != nil {
+			return err
+		}
+		if len(deviceNames) == 0 {
+			return fmt.Errorf("no devices have saved state in %s", flags.stateDir)
+		}
+	}
+
+	var errs []error
+	for _, deviceName := range deviceNames {
+		var err error
+		if at.IsZero() {
+			err = restoreSaved(*flags, deviceName, target)
+		} else {
+			err = restoreAt(*flags, deviceName, at)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", deviceName, err))
+		}
+	}
+	if len(errs) != 0 {
+		return &rotator.ExitError{Code: rotator.ExitRestoreFailed, Err: errors.Join(errs...)}
+	}
+	return nil
+}
+
+func restoreSaved(flags flags, deviceName string, target restoreTarget) error {
+	state, err := loadDeviceState(flags.stateDir, deviceName)
+	if err != nil {
+		return err
+	}
+
+	mac := state.OriginalMac
+	if target == restorePermanent {
+		mac = state.PermanentMac
+		if mac == "" {
+			if mac, err = permanentMac(deviceName); err != nil {
+				return err
+			}
+		}
+	}
+	if mac == "" {
+		return fmt.Errorf("no %s MAC address was saved", target)
+	}
+	return applyRestore(flags, deviceName, mac, string(target))
+}
+
+// restoreAt puts back the address the device had at a time, such as one a
+// DHCP reservation or captive portal session was bound to.
+func restoreAt(flags flags, deviceName string, at time.Time) error {
+	records, err := queryAuditLog(auditLogPath(flags), historyQuery{devices: []string{deviceName}})
+	if err != nil {
+		return err
+	}
+	entries := make([]historyEntry, len(records))
+	for i, record := range records {
+		entries[i] = record.historyEntry()
+	}
+
+	entry, ok := macAt(entries, deviceName, at)
+	if !ok {
+		return fmt.Errorf("the -audit-log does not say what the MAC address was at %s", at.Local().Format(time.DateTime))
+	}
+	return applyRestore(flags, deviceName, entry.Mac, at.Local().Format(time.DateTime))
+}
+
+func applyRestore(flags flags, deviceName string, mac rotator.MAC, target string) error {
+	logger := slog.With("device", deviceName)
+	previous, _ := rotator.CurrentMAC(deviceName)
+	setter := rotator.Setter{Command: chooseSetMacCmd(flags), Runner: rotator.ExecRunner{RunCmd: runPrivileged}, DryRun: flags.dryRun}
+	err := setter.Apply(context.Background(), logger, deviceName, mac)
+	newAuditLog(flags).recordRestore(deviceName, previous, mac, "of the restore command", err)
+	if err != nil {
+		return err
+	}
+	logger.Info("restored the MAC address", "target", target, "new_mac", mac)
+	return nil
+}
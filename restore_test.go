@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRestoreSkipsTheRemoteConfigCache(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv(envName("config"), os.DevNull)
+
+	files := map[string]string{
+		"rma-test0.json":     `{"next_rotation":"0001-01-01T00:00:00Z","original_mac":"02:00:00:00:00:01"}`,
+		remoteConfigCache:    `{"url":"https://example.com/config.toml","body":""}`,
+		"remote-config.json": `{"url":"https://example.com/config.toml","body":""}`,
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(stateDir, name), []byte(contents), stateFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deviceNames, err := savedDeviceNames(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"rma-test0"}; !slices.Equal(deviceNames, want) {
+		t.Errorf("got devices %v, want %v", deviceNames, want)
+	}
+
+	if err := runRestore([]string{"-dry-run", "-state-dir", stateDir}); err != nil {
+		t.Errorf("restoring failed: %v", err)
+	}
+}
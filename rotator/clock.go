@@ -0,0 +1,48 @@
+package rotator
+
+import "time"
+
+// Clock tells a Rotator the time and waits for it, so that a fake one can play
+// out a schedule faster than the real one would.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the default Clock, the machine's own.
+var SystemClock Clock = systemClock{}
+
+// AcceleratedClock is a Clock running Speed times faster than the machine's
+// own from Start, for playing out days of a schedule in seconds. Its waits
+// are real ones, shortened, so triggers and cancellation behave as they
+// would at real speed.
+type AcceleratedClock struct {
+	Start time.Time
+	Speed float64
+
+	began time.Time
+}
+
+// NewAcceleratedClock starts an AcceleratedClock now.
+func NewAcceleratedClock(start time.Time, speed float64) *AcceleratedClock {
+	return &AcceleratedClock{Start: start, Speed: speed, began: time.Now()}
+}
+
+func (c *AcceleratedClock) Now() time.Time {
+	elapsed := time.Duration(float64(time.Since(c.began)) * c.Speed)
+	return c.Start.Add(elapsed).Round(0)
+}
+
+func (c *AcceleratedClock) After(d time.Duration) <-chan time.Time {
+	return time.After(time.Duration(float64(d) / c.Speed))
+}
@@ -0,0 +1,163 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// maxRejectedAttempts bounds how many addresses SetRandom and SetGenerated try
+// when the driver keeps rejecting them.
+const maxRejectedAttempts = 3
+
+// SetCommand builds the command that gives a device an address.
+type SetCommand func(deviceName string, mac MAC) (string, []string)
+
+func SetMacUnix(deviceName string, mac MAC) (string, []string) {
+	cmd := "ifconfig"
+	args := []string{deviceName, "ether", string(mac)}
+	return cmd, args
+}
+
+func SetMacLinux(deviceName string, mac MAC) (string, []string) {
+	cmd := "ip"
+	args := []string{"link", "set", "dev", deviceName, "addr", string(mac)}
+	return cmd, args
+}
+
+func SetMacLinuxIfconfig(deviceName string, mac MAC) (string, []string) {
+	cmd := "ifconfig"
+	args := []string{deviceName, "hw", "ether", string(mac)}
+	return cmd, args
+}
+
+// SetMacWindows sets the adapter's NetworkAddress property, which Windows only
+// applies once the adapter restarts.
+func SetMacWindows(deviceName string, mac MAC) (string, []string) {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+
+	value := strings.ToUpper(strings.ReplaceAll(string(mac), ":", ""))
+	script := fmt.Sprintf(
+		"Set-NetAdapterAdvancedProperty -Name %s -RegistryKeyword NetworkAddress -RegistryValue %s -ErrorAction Stop; Restart-NetAdapter -Name %s -ErrorAction Stop",
+		quote(deviceName),
+		quote(value),
+		quote(deviceName),
+	)
+
+	cmd := "powershell"
+	args := []string{"-NoProfile", "-NonInteractive", "-Command", script}
+	return cmd, args
+}
+
+// DefaultSetCommand is the one for this platform, falling back to ifconfig on
+// Linux systems with net-tools but not iproute2, as some minimal ones are.
+// Android counts as Linux, and has ip.
+func DefaultSetCommand() SetCommand {
+	switch runtime.GOOS {
+	case "linux", "android":
+		if _, err := exec.LookPath("ip"); err != nil {
+			if _, err := exec.LookPath("ifconfig"); err == nil {
+				return SetMacLinuxIfconfig
+			}
+		}
+		return SetMacLinux
+	case "windows":
+		return SetMacWindows
+	default:
+		return SetMacUnix
+	}
+}
+
+// Setter gives devices addresses by running commands.
+type Setter struct {
+	Command SetCommand
+
+	// Runner defaults to an ExecRunner.
+	Runner Runner
+
+	// DryRun logs the commands rather than running them.
+	DryRun bool
+}
+
+// Apply gives the device the address, classifying the failure as a SetError
+// if it could not. Cancelling the context kills the command.
+func (s Setter) Apply(ctx context.Context, logger *slog.Logger, deviceName string, mac MAC) error {
+	prog, args := s.Command(deviceName, mac)
+
+	if s.DryRun {
+		// Say what the real run would change, not just how.
+		argsStr := strings.Join(args, " ")
+		current, _ := CurrentMAC(deviceName)
+		logger.Info("would run a command", "command", prog+" "+argsStr, "current_mac", current, "new_mac", mac)
+		return nil
+	}
+
+	command := prog + " " + strings.Join(args, " ")
+	logger.Debug("running a command", "command", command)
+
+	runner := s.Runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	output, err := runner.Run(ctx, prog, args...)
+
+	trimmed := strings.TrimSpace(string(output))
+	logger.Debug("ran a command", "command", command, "output", trimmed, "err", err)
+	if err != nil {
+		return classifySetError(prog, err, trimmed)
+	}
+	return nil
+}
+
+// SetRandom gives the device a random address of one of the vendors. It
+// rerolls with another vendor when the driver rejects an address, as some
+// drivers and access points refuse particular prefixes, before giving up.
+func (s Setter) SetRandom(ctx context.Context, logger *slog.Logger, rng *rand.Rand, deviceName string, vendors []VendorPrefix) (Vendor, MAC, error) {
+	untried := slices.Clone(vendors)
+	for attempt := 1; ; attempt++ {
+		vendor, addr := RandomMAC(rng, untried)
+
+		err := s.Apply(ctx, logger, deviceName, addr)
+		if err == nil {
+			return vendor, addr, nil
+		}
+		if KindOf(err) != FailureRejected || maxRejectedAttempts <= attempt {
+			return "", "", err
+		}
+
+		logger.Warn("the driver rejected the address, so trying another", "new_mac", addr, "vendor", vendor, "err", err)
+		if 1 < len(untried) {
+			untried = slices.DeleteFunc(untried, func(v VendorPrefix) bool { return v.Vendor == vendor })
+		}
+	}
+}
+
+// SetGenerated gives the device an address from the generator, asking it for
+// another when the driver rejects one, as SetRandom does.
+func (s Setter) SetGenerated(ctx context.Context, logger *slog.Logger, generator MACGenerator, iface net.Interface) (MAC, error) {
+	for attempt := 1; ; attempt++ {
+		hardwareAddr, err := generator.Generate(ctx, iface)
+		if err != nil {
+			return "", fmt.Errorf("could not generate an address: %w", err)
+		}
+		addr := MAC(hardwareAddr.String())
+
+		err = s.Apply(ctx, logger, iface.Name, addr)
+		if err == nil {
+			return addr, nil
+		}
+		if KindOf(err) != FailureRejected || maxRejectedAttempts <= attempt {
+			return "", err
+		}
+
+		logger.Warn("the driver rejected the address, so trying another", "new_mac", addr, "err", err)
+	}
+}
@@ -0,0 +1,115 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestSetterRunsTheCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command SetCommand
+		want    []string
+	}{
+		{"linux", SetMacLinux, []string{"ip", "link", "set", "dev", "rma-test0", "addr", "00:1b:77:12:34:56"}},
+		{"linux ifconfig", SetMacLinuxIfconfig, []string{"ifconfig", "rma-test0", "hw", "ether", "00:1b:77:12:34:56"}},
+		{"unix", SetMacUnix, []string{"ifconfig", "rma-test0", "ether", "00:1b:77:12:34:56"}},
+		{"windows", SetMacWindows, []string{
+			"powershell", "-NoProfile", "-NonInteractive", "-Command",
+			"Set-NetAdapterAdvancedProperty -Name 'rma-test0' -RegistryKeyword NetworkAddress -RegistryValue '001B77123456' -ErrorAction Stop; Restart-NetAdapter -Name 'rma-test0' -ErrorAction Stop",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &RecordingRunner{}
+			setter := Setter{Command: test.command, Runner: runner}
+			if err := setter.Apply(context.Background(), discardLogger, "rma-test0", "00:1b:77:12:34:56"); err != nil {
+				t.Fatal(err)
+			}
+
+			commands := runner.Commands()
+			if len(commands) != 1 || !slices.Equal(commands[0], test.want) {
+				t.Errorf("ran %q, want only %q", commands, test.want)
+			}
+		})
+	}
+}
+
+func TestSetterQuotesWindowsAdapterNames(t *testing.T) {
+	runner := &RecordingRunner{}
+	setter := Setter{Command: SetMacWindows, Runner: runner}
+	if err := setter.Apply(context.Background(), discardLogger, "Bob's Wi-Fi", "00:1b:77:12:34:56"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Set-NetAdapterAdvancedProperty -Name 'Bob''s Wi-Fi' -RegistryKeyword NetworkAddress -RegistryValue '001B77123456' -ErrorAction Stop; Restart-NetAdapter -Name 'Bob''s Wi-Fi' -ErrorAction Stop"
+	if script := runner.Commands()[0][4]; script != want {
+		t.Errorf("ran %q, want %q", script, want)
+	}
+}
+
+func TestSetterDryRunRunsNothing(t *testing.T) {
+	runner := &RecordingRunner{}
+	setter := Setter{Command: SetMacLinux, Runner: runner, DryRun: true}
+	if err := setter.Apply(context.Background(), discardLogger, "rma-test0", "00:1b:77:12:34:56"); err != nil {
+		t.Fatal(err)
+	}
+	if commands := runner.Commands(); len(commands) != 0 {
+		t.Errorf("a dry run ran %q", commands)
+	}
+}
+
+func TestSetRandomRerollsRejectedAddresses(t *testing.T) {
+	runner := &RecordingRunner{
+		Err:    errors.New("exit status 2"),
+		Output: []byte("RTNETLINK answers: Invalid argument"),
+	}
+	setter := Setter{Command: SetMacLinux, Runner: runner}
+
+	rng := rand.New(rand.NewSource(1))
+	_, _, err := setter.SetRandom(context.Background(), discardLogger, rng, "rma-test0", Vendors)
+	if KindOf(err) != FailureRejected {
+		t.Fatalf("got %v, want a rejection", err)
+	}
+
+	commands := runner.Commands()
+	if len(commands) != maxRejectedAttempts {
+		t.Fatalf("made %d attempts, want %d", len(commands), maxRejectedAttempts)
+	}
+	var tried []Vendor
+	for _, command := range commands {
+		mac := MAC(command[len(command)-1])
+		vendor := VendorOf(mac)
+		if vendor == "" {
+			t.Fatalf("tried %s, which is from none of the vendors", mac)
+		}
+		if slices.Contains(tried, vendor) {
+			t.Errorf("tried %s from %s again after it was rejected", mac, vendor)
+		}
+		tried = append(tried, vendor)
+	}
+}
+
+func TestSetRandomDoesNotRerollOtherFailures(t *testing.T) {
+	runner := &RecordingRunner{
+		Err:    errors.New("exit status 2"),
+		Output: []byte("RTNETLINK answers: Operation not permitted"),
+	}
+	setter := Setter{Command: SetMacLinux, Runner: runner}
+
+	rng := rand.New(rand.NewSource(1))
+	_, _, err := setter.SetRandom(context.Background(), discardLogger, rng, "rma-test0", Vendors)
+	if KindOf(err) != FailurePermission {
+		t.Fatalf("got %v, want a permission failure", err)
+	}
+	if commands := runner.Commands(); len(commands) != 1 {
+		t.Errorf("made %d attempts, want only the one", len(commands))
+	}
+}
@@ -0,0 +1,59 @@
+package rotator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// DailyMAC derives the address a device has on the day under the key: an
+// address of one of the vendors, drawn with the HMAC-SHA256 of the date, the
+// device's name, and the network, if given, as the seed. The address stays the
+// same all day, so DHCP leases and captive portal sign-ins last, but nothing
+// links one day's to the next without the key.
+func DailyMAC(key []byte, day time.Time, deviceName, network string, vendors []VendorPrefix) (Vendor, MAC) {
+	if len(vendors) == 0 {
+		vendors = Vendors
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(day.Format(time.DateOnly) + "\x00" + deviceName + "\x00" + network))
+	seed := binary.BigEndian.Uint64(mac.Sum(nil))
+
+	// math/rand's sequences for a seed never change, so neither do the
+	// addresses.
+	return RandomMAC(rand.New(rand.NewSource(int64(seed))), vendors)
+}
+
+// NextMidnight is the start of the day after the time's, in its location.
+func NextMidnight(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+}
+
+// DailyGenerator is a MACGenerator of each day's DailyMAC, for rotating at
+// midnight.
+type DailyGenerator struct {
+	Key     []byte
+	Vendors []VendorPrefix
+
+	// Network, such as an SSID, gives each network its own address for the
+	// day too.
+	Network string
+
+	// Clock defaults to the SystemClock, in local time.
+	Clock Clock
+}
+
+func (g DailyGenerator) Generate(_ context.Context, iface net.Interface) (net.HardwareAddr, error) {
+	clock := g.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	_, mac := DailyMAC(g.Key, clock.Now(), iface.Name, g.Network, g.Vendors)
+	return net.ParseMAC(string(mac))
+}
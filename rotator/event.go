@@ -0,0 +1,49 @@
+package rotator
+
+import "time"
+
+// EventKind says what happened to a device's address.
+type EventKind string
+
+const (
+	EventRotated  EventKind = "rotated"
+	EventFailed   EventKind = "failed"
+	EventRestored EventKind = "restored"
+)
+
+// eventBuffer is how many events a Rotator holds for a slow reader before it
+// starts dropping them.
+const eventBuffer = 16
+
+// Event is a change of a device's address, or a failure to change it, for
+// embedding programs to react to, say by updating DNS or a UI, without
+// scraping logs.
+type Event struct {
+	At       time.Time
+	Kind     EventKind
+	Device   string
+	Previous MAC
+	MAC      MAC
+	Vendor   Vendor
+
+	// Err is why the change failed, for EventFailed.
+	Err error
+}
+
+// Events delivers an Event for each rotation, failure, and restoration. It is
+// buffered, and events are dropped rather than holding up rotations when the
+// reader falls behind, or when nothing reads them. It is never closed, so
+// stop reading once Run has returned.
+func (r *Rotator) Events() <-chan Event {
+	return r.events
+}
+
+func (r *Rotator) emit(event Event) {
+	event.At = r.options.Clock.Now()
+	event.Device = r.options.Device
+
+	select {
+	case r.events <- event:
+	default:
+	}
+}
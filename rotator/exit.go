@@ -0,0 +1,65 @@
+package rotator
+
+import "errors"
+
+// The rotate-mac-address command's exit codes, which tell the causes of its
+// failures apart for wrapper scripts, and for service managers deciding
+// whether restarting could help, such as with systemd's
+// RestartPreventExitStatus=.
+const (
+	// ExitFailure is any failure not covered by the others.
+	ExitFailure = 1
+
+	// ExitUsage is for bad flags or configuration, as the flag package
+	// gives for flags it cannot parse.
+	ExitUsage = 2
+
+	ExitPrivileges      = 3
+	ExitMissingDevice   = 4
+	ExitMissingTool     = 5
+	ExitTooManyFailures = 6
+	ExitRestoreFailed   = 7
+)
+
+// ExitError is an error with the exit code it should end the command with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (err *ExitError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *ExitError) Unwrap() error {
+	return err.Err
+}
+
+// ExitCode picks the exit code for an error: that of an ExitError within it,
+// or else ExitTooManyFailures for a TooManyFailuresError, or else one for the
+// kind of failure setting an address ran into, with nil exiting 0.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	var tooMany *TooManyFailuresError
+	if errors.As(err, &tooMany) {
+		return ExitTooManyFailures
+	}
+
+	switch KindOf(err) {
+	case FailurePermission:
+		return ExitPrivileges
+	case FailureMissingDevice:
+		return ExitMissingDevice
+	case FailureMissingTool:
+		return ExitMissingTool
+	default:
+		return ExitFailure
+	}
+}
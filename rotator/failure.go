@@ -0,0 +1,129 @@
+package rotator
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// FailureKind is what went wrong with a command setting an address, as far as
+// can be told from how it failed.
+type FailureKind string
+
+const (
+	FailureUnknown       FailureKind = ""
+	FailureMissingTool   FailureKind = "missing tool"
+	FailurePermission    FailureKind = "permission denied"
+	FailureBusy          FailureKind = "device busy"
+	FailureRejected      FailureKind = "address rejected"
+	FailureMissingDevice FailureKind = "missing device"
+)
+
+// failureSigns are what each kind of failure says about itself across ip,
+// ifconfig, PowerShell, sudo, and doas, lower-cased.
+var failureSigns = []struct {
+	kind  FailureKind
+	signs []string
+}{
+	{FailurePermission, []string{"operation not permitted", "permission denied", "must be root", "access is denied", "a password is required", "not permitted"}},
+	{FailureBusy, []string{"device or resource busy", "resource busy"}},
+	{FailureMissingDevice, []string{"cannot find device", "no such device", "does not exist", "no msft_netadapter objects found", "interface not found"}},
+	{FailureRejected, []string{"invalid argument", "cannot assign requested address", "can't assign requested address", "operation not supported", "not supported"}},
+}
+
+// SetError is a failed command setting an address, classified so that it can
+// come with a hint at what to do about it.
+type SetError struct {
+	Kind   FailureKind
+	Prog   string
+	Err    error
+	Output string
+}
+
+func (err *SetError) Error() string {
+	if err.Output == "" {
+		return err.Err.Error()
+	}
+	return err.Err.Error() + ": " + err.Output
+}
+
+func (err *SetError) Unwrap() error {
+	return err.Err
+}
+
+// Hint suggests what to do about the failure, if anything comes to mind.
+func (err *SetError) Hint() string {
+	switch err.Kind {
+	case FailureMissingTool:
+		return "install " + err.Prog + ", or put it on the PATH"
+	case FailurePermission:
+		return "run as root, or as a user with CAP_NET_ADMIN on Linux, or with -escalate"
+	case FailureBusy:
+		return "the driver will not change the address while the device is in use; take it down first, or stop whatever holds it"
+	case FailureRejected:
+		return "the driver rejected the address; some only accept certain vendors, which -vendors can narrow down to, and some cannot change addresses at all"
+	case FailureMissingDevice:
+		return "the device is missing; check -device-name, or use -max-errs 0 to keep waiting for it to come back"
+	default:
+		return ""
+	}
+}
+
+func classifySetError(prog string, err error, output string) *SetError {
+	classified := &SetError{Prog: prog, Err: err, Output: output}
+	if errors.Is(err, exec.ErrNotFound) {
+		classified.Kind = FailureMissingTool
+		return classified
+	}
+
+	lowered := strings.ToLower(output)
+	for _, failure := range failureSigns {
+		for _, sign := range failure.signs {
+			if strings.Contains(lowered, sign) {
+				classified.Kind = failure.kind
+				return classified
+			}
+		}
+	}
+	return classified
+}
+
+// Hint is the hint for a failure, if it is one that has any.
+func Hint(err error) string {
+	var classified *SetError
+	if errors.As(err, &classified) {
+		return classified.Hint()
+	}
+	return ""
+}
+
+// KindOf finds what kind of failure an error is, if it is one that setting an
+// address ran into.
+func KindOf(err error) FailureKind {
+	var classified *SetError
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+	return FailureUnknown
+}
+
+// TooManyFailuresError is a rotation giving up after too many failures in a
+// row, keeping each of them for errors.Is and errors.As to look through.
+type TooManyFailuresError struct {
+	Errs []error
+}
+
+func (err *TooManyFailuresError) Error() string {
+	if len(err.Errs) == 0 {
+		return "too many MAC change errors occurred"
+	}
+	msg := "too many MAC change errors occurred:\n" + errors.Join(err.Errs...).Error()
+	if hint := Hint(err.Errs[len(err.Errs)-1]); hint != "" {
+		msg += "\nhint: " + hint
+	}
+	return msg
+}
+
+func (err *TooManyFailuresError) Unwrap() []error {
+	return err.Errs
+}
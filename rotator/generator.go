@@ -0,0 +1,61 @@
+package rotator
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"slices"
+)
+
+// MACGenerator picks the addresses that a Rotator gives a device, for
+// programs wanting, say, an address per SSID, one from a pool, or one that a
+// policy decides.
+type MACGenerator interface {
+	Generate(ctx context.Context, iface net.Interface) (net.HardwareAddr, error)
+}
+
+// GeneratorFunc lets a plain function be a MACGenerator.
+type GeneratorFunc func(ctx context.Context, iface net.Interface) (net.HardwareAddr, error)
+
+func (f GeneratorFunc) Generate(ctx context.Context, iface net.Interface) (net.HardwareAddr, error) {
+	return f(ctx, iface)
+}
+
+// VendorGenerator is the default MACGenerator, generating addresses with
+// RandomMAC that start with the prefix of one of its Vendors, or of any of the
+// package's Vendors if it has none.
+type VendorGenerator struct {
+	Vendors []VendorPrefix
+
+	// Rand defaults to one seeded with the time of each call.
+	Rand *rand.Rand
+}
+
+func (g VendorGenerator) Generate(_ context.Context, _ net.Interface) (net.HardwareAddr, error) {
+	vendors := g.Vendors
+	if len(vendors) == 0 {
+		vendors = Vendors
+	}
+	rng := g.Rand
+	if rng == nil {
+		rng = newTimeSeededRand()
+	}
+
+	_, mac := RandomMAC(rng, vendors)
+	return net.ParseMAC(string(mac))
+}
+
+// VendorOf names the vendor whose prefix the address starts with, or returns
+// an empty Vendor if it is none of the package's Vendors or VirtualVendors.
+func VendorOf(mac MAC) Vendor {
+	addr, err := net.ParseMAC(string(mac))
+	if err != nil {
+		return ""
+	}
+	for _, vendorPrefix := range slices.Concat(Vendors, VirtualVendors) {
+		if prefixMatches(vendorPrefix.Prefix, addr) {
+			return vendorPrefix.Vendor
+		}
+	}
+	return ""
+}
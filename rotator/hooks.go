@@ -0,0 +1,66 @@
+package rotator
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks let an embedding program take over parts of each rotation while Run
+// keeps the loop, the count of failures in a row, and the giving up after too
+// many. Each left nil does what Run does without it.
+type Hooks struct {
+	// First waits until the first rotation is due, where Run would otherwise
+	// rotate straight away.
+	First func(ctx context.Context) error
+
+	// Prepare is asked whether each due rotation should go ahead. When it
+	// should not, Prepare itself waits for whatever should come first, such
+	// as the device appearing or the next rotation being due, before it is
+	// asked again.
+	Prepare func(ctx context.Context) (bool, error)
+
+	// Change makes the change in place of the Generator and SetCommand, given
+	// the failures in a row before it, and gives the address the device had
+	// and the one it was given.
+	Change func(ctx context.Context, errs []error) (previous, mac MAC, err error)
+
+	// Next waits until the next rotation is due after a change, in place of
+	// the Schedule.
+	Next func(ctx context.Context) error
+
+	// Retry waits until retrying after the given failures in a row, in place
+	// of backing off by RetryDelay.
+	Retry func(ctx context.Context, failures int) error
+}
+
+// SetMaxErrs changes Options' MaxErrs and MaxErrsWindow while Run runs,
+// from the next change onwards, such as when a program's settings are
+// reloaded.
+func (r *Rotator) SetMaxErrs(maxErrs uint, window time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.options.MaxErrs = maxErrs
+	r.options.MaxErrsWindow = window
+}
+
+func (r *Rotator) maxErrs() (uint, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.options.MaxErrs, r.options.MaxErrsWindow
+}
+
+// ageOutErrs forgets the errors that occurred longer ago than the window, if
+// there is one, so that sporadic failures spread over a long time, such as
+// from a dock being unplugged now and then, do not add up to giving up.
+func ageOutErrs(errs []error, failedAt []time.Time, now time.Time, window time.Duration) ([]error, []time.Time) {
+	if window == 0 {
+		return errs, failedAt
+	}
+
+	cutoff := now.Add(-window)
+	expired := 0
+	for expired < len(failedAt) && failedAt[expired].Before(cutoff) {
+		expired++
+	}
+	return errs[expired:], failedAt[expired:]
+}
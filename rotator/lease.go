@@ -0,0 +1,205 @@
+package rotator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rotations are aligned to leaseRenewalLead before a lease's renewal, so that
+// the client's re-request comes from the new address, unless that is less than
+// minLeaseGap away.
+const (
+	leaseRenewalLead = 30 * time.Second
+	minLeaseGap      = time.Minute
+)
+
+var errNoLease = errors.New("no DHCP lease was found")
+
+type leaseReader func(deviceName string) (time.Time, error)
+
+// leaseReaders cover dhclient, dhcpcd, and sd-dhcp as used by both
+// NetworkManager's internal client and systemd-networkd.
+var leaseReaders = []leaseReader{
+	readDhclientRenewal,
+	readDhcpcdRenewal,
+	readSdDhcpRenewal,
+}
+
+// leaseRenewal finds when the device's current DHCP lease is due for renewal.
+func leaseRenewal(deviceName string) (time.Time, error) {
+	var errs []error
+	for _, read := range leaseReaders {
+		renewal, err := read(deviceName)
+		if err == nil {
+			return renewal, nil
+		}
+		if !errors.Is(err, errNoLease) {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return time.Time{}, errNoLease
+	}
+	return time.Time{}, errors.Join(errs...)
+}
+
+// NextLeaseRotation is when to rotate so as to come just before the device's
+// DHCP lease is renewed. It fails if there is no upcoming renewal to align with.
+func NextLeaseRotation(deviceName string) (time.Time, error) {
+	renewal, err := leaseRenewal(deviceName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	at := renewal.Add(-leaseRenewalLead)
+	if time.Until(at) < minLeaseGap {
+		return time.Time{}, fmt.Errorf("the lease renewal at %s is too close to align with", renewal.Format(time.RFC3339))
+	}
+	return at, nil
+}
+
+func firstExisting(paths ...string) (string, bool) {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// readDhclientRenewal takes the renewal time of the last lease in dhclient's
+// lease file, in either its default UTC form or its epoch form.
+func readDhclientRenewal(deviceName string) (time.Time, error) {
+	path, ok := firstExisting(
+		"/var/lib/dhcp/dhclient."+deviceName+".leases",
+		"/var/lib/dhclient/dhclient-"+deviceName+".leases",
+		"/var/lib/dhclient/dhclient."+deviceName+".leases",
+		"/var/lib/dhcp/dhclient.leases",
+	)
+	if !ok {
+		return time.Time{}, errNoLease
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	var renewal time.Time
+	inDevice := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ";")
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) == 2 && fields[0] == "interface":
+			inDevice = strings.Trim(fields[1], `"`) == deviceName
+		case inDevice && len(fields) == 3 && fields[0] == "renew" && fields[1] == "epoch":
+			secs, err := strconv.ParseInt(fields[2], 10, 64)
+			if err == nil {
+				renewal = time.Unix(secs, 0)
+			}
+		case inDevice && len(fields) == 4 && fields[0] == "renew":
+			at, err := time.Parse("2006/01/02 15:04:05", fields[2]+" "+fields[3])
+			if err == nil {
+				renewal = at
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	if renewal.IsZero() {
+		return time.Time{}, errNoLease
+	}
+	return renewal, nil
+}
+
+// readDhcpcdRenewal combines the timers dhcpcd reports for the lease with when
+// it was written, as dhcpcd keeps leases in a binary format.
+func readDhcpcdRenewal(deviceName string) (time.Time, error) {
+	path, ok := firstExisting(
+		"/var/lib/dhcpcd/"+deviceName+".lease",
+		"/var/db/dhcpcd/"+deviceName+".lease",
+		"/var/lib/dhcpcd5/dhcpcd-"+deviceName+".lease",
+	)
+	if !ok {
+		return time.Time{}, errNoLease
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	out, err := exec.Command("dhcpcd", "-U", deviceName).Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	vars := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			vars[key] = strings.Trim(value, `'"`)
+		}
+	}
+
+	return renewalFromTimers(info.ModTime(), vars["dhcp_renewal_time"], vars["dhcp_lease_time"])
+}
+
+// readSdDhcpRenewal reads the key-value lease files of sd-dhcp, the client
+// inside both NetworkManager and systemd-networkd.
+func readSdDhcpRenewal(deviceName string) (time.Time, error) {
+	paths, _ := filepath.Glob("/var/lib/NetworkManager/internal-*-" + deviceName + ".lease")
+	if iface, err := net.InterfaceByName(deviceName); err == nil {
+		paths = append(paths, "/run/systemd/netif/leases/"+strconv.Itoa(iface.Index))
+	}
+
+	path, ok := firstExisting(paths...)
+	if !ok {
+		return time.Time{}, errNoLease
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	vars := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			vars[key] = value
+		}
+	}
+
+	return renewalFromTimers(info.ModTime(), vars["T1"], vars["LIFETIME"])
+}
+
+// renewalFromTimers prefers the server's explicit renewal timer, and otherwise
+// uses the standard default of half the lease time.
+func renewalFromTimers(acquired time.Time, renewalSecs string, leaseSecs string) (time.Time, error) {
+	if secs, err := strconv.ParseUint(renewalSecs, 10, 32); err == nil {
+		return acquired.Add(time.Duration(secs) * time.Second), nil
+	}
+	if secs, err := strconv.ParseUint(leaseSecs, 10, 32); err == nil {
+		return acquired.Add(time.Duration(secs) * time.Second / 2), nil
+	}
+	return time.Time{}, errNoLease
+}
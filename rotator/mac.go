@@ -0,0 +1,211 @@
+// Package rotator rotates the MAC addresses of network devices on an interval,
+// with a bit of variation added, for embedding in programs of their own as
+// well as running as the rotate-mac-address daemon.
+package rotator
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Vendor is the maker that a generated address claims to be from.
+type Vendor string
+
+const (
+	VendorIntel          Vendor = "Intel"
+	VendorHewlettPackard Vendor = "HP"
+	VendorFoxconn        Vendor = "Foxconn"
+	VendorCisco          Vendor = "Cisco"
+	VendorAmd            Vendor = "AMD"
+)
+
+// MAC is an address in colon-separated hexadecimal form, or the start of one.
+type MAC string
+
+const (
+	PrefixIntel          MAC = "00:1b:77"
+	PrefixHewlettPackard MAC = "00:1b:78"
+	PrefixFoxconn        MAC = "00:01:6c"
+	PrefixCisco          MAC = "00:10:29"
+	PrefixAmd            MAC = "00:0c:87"
+)
+
+// VendorPrefix is an organisationally unique identifier that a vendor's own
+// addresses start with.
+type VendorPrefix struct {
+	Vendor Vendor
+	Prefix MAC
+}
+
+// Vendors are those that addresses are generated for by default.
+var Vendors = []VendorPrefix{
+	{VendorIntel, PrefixIntel},
+	{VendorHewlettPackard, PrefixHewlettPackard},
+	{VendorFoxconn, PrefixFoxconn},
+	{VendorCisco, PrefixCisco},
+	{VendorAmd, PrefixAmd},
+}
+
+// ParseVendors picks the Vendors or VirtualVendors named in a comma-separated
+// list, ignoring case. Items can also be prefixes of vendors of one's own,
+// optionally named, such as acme=70:b3:d5:4a:3; see ParsePrefix.
+func ParseVendors(value string) ([]VendorPrefix, error) {
+	var picked []VendorPrefix
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, vendorPrefix := range slices.Concat(Vendors, VirtualVendors) {
+			if strings.EqualFold(name, string(vendorPrefix.Vendor)) {
+				picked = append(picked, vendorPrefix)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		vendor, prefix, named := strings.Cut(name, "=")
+		if !named {
+			prefix = vendor
+		}
+		if _, _, err := ParsePrefix(MAC(prefix)); err != nil {
+			if !named && !strings.ContainsAny(name, ":-./") {
+				return nil, fmt.Errorf("unknown vendor %q", name)
+			}
+			return nil, err
+		}
+		picked = append(picked, VendorPrefix{Vendor(vendor), MAC(strings.ToLower(prefix))})
+	}
+	return picked, nil
+}
+
+// ParsePrefix reads a prefix of whole hexadecimal digits, such as 00:1b:77 for
+// an MA-L assignment (an OUI), 70:b3:d5:4 for an MA-M, or 70:b3:d5:4a:3 for an
+// MA-S, or of any number of bits, such as 02:00:00/20. It gives the prefix
+// padded with zeros to a whole address, along with its length in bits.
+func ParsePrefix(prefix MAC) (net.HardwareAddr, int, error) {
+	digits, lengthStr, hasLength := strings.Cut(string(prefix), "/")
+	digits = strings.NewReplacer(":", "", "-", "", ".", "").Replace(digits)
+
+	const maxDigits = 12
+	if digits == "" || maxDigits < len(digits) {
+		return nil, 0, fmt.Errorf("prefix %q must have between 1 and %d hexadecimal digits", prefix, maxDigits)
+	}
+	addr, err := hex.DecodeString(digits + strings.Repeat("0", maxDigits-len(digits)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("prefix %q is not hexadecimal", prefix)
+	}
+
+	bits := 4 * len(digits)
+	if hasLength {
+		length, err := strconv.Atoi(lengthStr)
+		if err != nil || length < 0 || bits < length {
+			return nil, 0, fmt.Errorf("prefix %q must be at most as long as its %d bits of digits", prefix, bits)
+		}
+		bits = length
+	}
+
+	for i := range addr {
+		addr[i] &= prefixMask(bits, i)
+	}
+	if 8 <= bits && addr[0]&0x01 != 0 {
+		return nil, 0, fmt.Errorf("prefix %q is for multicast addresses", prefix)
+	}
+	return addr, bits, nil
+}
+
+// prefixMask has the bits of the octet at the index that fall within a
+// prefix of the length.
+func prefixMask(bits, index int) byte {
+	covered := min(max(bits-8*index, 0), 8)
+	return ^byte(0xff >> covered)
+}
+
+func pickVendor(rng *rand.Rand, vendors []VendorPrefix) (Vendor, MAC) {
+	n := rng.Intn(len(vendors))
+	vendorPrefix := vendors[n]
+	return vendorPrefix.Vendor, vendorPrefix.Prefix
+}
+
+// RandomMAC generates an address starting with the prefix of one of the given
+// vendors, with the bits after the prefix random. Addresses stay unicast even
+// with prefixes too short to say so.
+func RandomMAC(rng *rand.Rand, vendors []VendorPrefix) (Vendor, MAC) {
+	vendor, prefix := pickVendor(rng, vendors)
+
+	// Prefixes were checked as vendors were picked, so an invalid one
+	// can only come from a caller's own; leave it all to chance.
+	addr, bits, err := ParsePrefix(prefix)
+	if err != nil {
+		addr, bits = make(net.HardwareAddr, 6), 0
+	}
+
+	for i := range addr {
+		keep := prefixMask(bits, i)
+		addr[i] = addr[i]&keep | byte(rng.Intn(256))&^keep
+	}
+	if bits < 8 {
+		addr[0] &^= 0x01
+	}
+	return vendor, MAC(addr.String())
+}
+
+func prefixMatches(prefix MAC, addr net.HardwareAddr) bool {
+	prefixAddr, bits, err := ParsePrefix(prefix)
+	if err != nil || len(addr) != len(prefixAddr) {
+		return false
+	}
+	for i := range addr {
+		if addr[i]&prefixMask(bits, i) != prefixAddr[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixBits is how long a prefix is, or the whole address if it is invalid.
+func prefixBits(prefix MAC) int {
+	if _, bits, err := ParsePrefix(prefix); err == nil {
+		return bits
+	}
+	return 0
+}
+
+// AddressCount is how many distinct addresses RandomMAC can generate for the
+// vendors, not counting those that two vendors' prefixes share.
+func AddressCount(vendors []VendorPrefix) float64 {
+	prefixes := make(map[MAC]bool)
+	count := 0.0
+	for _, vendorPrefix := range vendors {
+		if prefixes[vendorPrefix.Prefix] {
+			continue
+		}
+		prefixes[vendorPrefix.Prefix] = true
+
+		// The unicast bit is fixed too when the prefix leaves it open.
+		bits := prefixBits(vendorPrefix.Prefix)
+		free := 48 - bits
+		if bits < 8 {
+			free--
+		}
+		count += math.Exp2(float64(free))
+	}
+	return count
+}
+
+// CurrentMAC reads the address that the device has right now.
+func CurrentMAC(deviceName string) (MAC, error) {
+	iface, err := net.InterfaceByName(deviceName)
+	if err != nil {
+		return "", err
+	}
+	return MAC(iface.HardwareAddr.String()), nil
+}
@@ -0,0 +1,111 @@
+package rotator
+
+import (
+	"log/slog"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// Option sets one of a Rotator's Options, for New. Options left unset keep
+// their defaults, so that knobs added later do not break existing callers.
+type Option func(*Options)
+
+// New makes a Rotator for the device, configured by the options.
+func New(device string, opts ...Option) (*Rotator, error) {
+	options := Options{Device: device}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return NewRotator(options)
+}
+
+// WithCycle sets the time between rotations, to the second.
+func WithCycle(cycle time.Duration) Option {
+	return func(options *Options) {
+		options.CycleSecs = uint(cycle / time.Second)
+	}
+}
+
+func WithVariance(variance float64) Option {
+	return func(options *Options) {
+		options.Variance = variance
+	}
+}
+
+func WithSchedule(schedule Schedule) Option {
+	return func(options *Options) {
+		options.Schedule = schedule
+	}
+}
+
+// WithVendorFilter keeps only those of the package's Vendors that keep
+// reports true for.
+func WithVendorFilter(keep func(VendorPrefix) bool) Option {
+	return func(options *Options) {
+		options.Vendors = slices.DeleteFunc(slices.Clone(Vendors), func(v VendorPrefix) bool {
+			return !keep(v)
+		})
+	}
+}
+
+func WithGenerator(generator MACGenerator) Option {
+	return func(options *Options) {
+		options.Generator = generator
+	}
+}
+
+// WithSetter sets the command, runner, and dry-run mode from the setter.
+func WithSetter(setter Setter) Option {
+	return func(options *Options) {
+		options.SetCommand = setter.Command
+		options.Runner = setter.Runner
+		options.DryRun = setter.DryRun
+	}
+}
+
+func WithMaxErrs(maxErrs uint) Option {
+	return func(options *Options) {
+		options.MaxErrs = maxErrs
+	}
+}
+
+// WithMaxErrsWindow stops counting failures longer ago than the window
+// towards MaxErrs.
+func WithMaxErrsWindow(window time.Duration) Option {
+	return func(options *Options) {
+		options.MaxErrsWindow = window
+	}
+}
+
+func WithHooks(hooks Hooks) Option {
+	return func(options *Options) {
+		options.Hooks = hooks
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(options *Options) {
+		options.Logger = logger
+	}
+}
+
+func WithClock(clock Clock) Option {
+	return func(options *Options) {
+		options.Clock = clock
+	}
+}
+
+func WithRand(rng *rand.Rand) Option {
+	return func(options *Options) {
+		options.Rand = rng
+	}
+}
+
+// WithSeed gives the Rotator a Rand of its own seeded with the seed, for
+// repeatable schedules and addresses without sharing a Rand.
+func WithSeed(seed int64) Option {
+	return func(options *Options) {
+		options.Rand = NewLockedRand(seed)
+	}
+}
@@ -0,0 +1,45 @@
+package rotator
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedSource guards a source with a mutex, as math/rand's own sources are
+// not safe for concurrent use.
+type lockedSource struct {
+	mu     sync.Mutex
+	source rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source.Seed(seed)
+}
+
+// NewLockedRand is a Rand seeded with the seed that is safe to share between
+// goroutines, such as between Rotators rotating devices concurrently or with
+// whatever generates addresses alongside them, which a Rand from rand.New is
+// not. Its Read is the exception, which nothing here uses.
+func NewLockedRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{source: rand.NewSource(seed).(rand.Source64)})
+}
+
+// newTimeSeededRand is what each Rand defaults to, unless one is given.
+func newTimeSeededRand() *rand.Rand {
+	return NewLockedRand(time.Now().UnixNano())
+}
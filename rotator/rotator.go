@@ -0,0 +1,262 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Options configure a Rotator. Only Device is needed; the rest default to
+// what their zero values say.
+type Options struct {
+	Device string
+
+	// CycleSecs is the seconds between rotations, around which Schedule
+	// spaces them; 0 turns the timer off, leaving only RotateNow.
+	CycleSecs uint
+	Variance  float64
+
+	// Schedule defaults to ScheduleBounded.
+	Schedule Schedule
+
+	// Generator defaults to a VendorGenerator of Vendors, which in turn
+	// default to all of the package's Vendors.
+	Generator MACGenerator
+	Vendors   []VendorPrefix
+
+	// SetCommand defaults to DefaultSetCommand, and Runner to an ExecRunner.
+	SetCommand SetCommand
+	Runner     Runner
+	DryRun     bool
+
+	// MaxErrs is the failures in a row after which Run gives up; 0 keeps
+	// retrying forever, backing off between attempts. Failures longer ago
+	// than MaxErrsWindow, if there is one, stop counting.
+	MaxErrs       uint
+	MaxErrsWindow time.Duration
+
+	// Logger defaults to slog's default logger, and Clock to SystemClock.
+	Logger *slog.Logger
+	Clock  Clock
+
+	// LookupInterface defaults to net.InterfaceByName. Faking it, along with
+	// the Runner and Clock, plays out a schedule without a real device.
+	LookupInterface func(name string) (*net.Interface, error)
+
+	// Rand defaults to one seeded with the time; seeding one of one's own
+	// makes the schedule and addresses repeatable. One shared between
+	// Rotators, or used elsewhere while they run, must be safe for
+	// concurrent use, as those from NewLockedRand are.
+	Rand *rand.Rand
+
+	// Hooks take over parts of each rotation, for programs adding their own
+	// behaviour to Run's.
+	Hooks Hooks
+}
+
+// Rotator rotates a single device's address until its context is cancelled.
+type Rotator struct {
+	mu        sync.Mutex
+	options   Options
+	setter    Setter
+	logger    *slog.Logger
+	rng       *rand.Rand
+	rotateNow chan struct{}
+	events    chan Event
+	original  MAC
+}
+
+// NewRotator notes the device's address as it is now, for Restore to put
+// back later, or as it first rotates if the device is missing until then.
+func NewRotator(options Options) (*Rotator, error) {
+	if options.Device == "" {
+		return nil, errors.New("a Rotator needs a device")
+	}
+	if options.Schedule == "" {
+		options.Schedule = ScheduleBounded
+	}
+	if _, err := ParseSchedule(string(options.Schedule)); err != nil {
+		return nil, err
+	}
+	for _, vendorPrefix := range options.Vendors {
+		if _, _, err := ParsePrefix(vendorPrefix.Prefix); err != nil {
+			return nil, fmt.Errorf("vendor %s: %w", vendorPrefix.Vendor, err)
+		}
+	}
+	if options.SetCommand == nil {
+		options.SetCommand = DefaultSetCommand()
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	if options.Clock == nil {
+		options.Clock = SystemClock
+	}
+	if options.LookupInterface == nil {
+		options.LookupInterface = net.InterfaceByName
+	}
+
+	var original MAC
+	if iface, err := options.LookupInterface(options.Device); err == nil {
+		original = MAC(iface.HardwareAddr.String())
+	}
+
+	rng := options.Rand
+	if rng == nil {
+		rng = newTimeSeededRand()
+	}
+	if options.Generator == nil {
+		options.Generator = VendorGenerator{Vendors: options.Vendors, Rand: rng}
+	}
+
+	return &Rotator{
+		options: options,
+		setter: Setter{
+			Command: options.SetCommand,
+			Runner:  options.Runner,
+			DryRun:  options.DryRun,
+		},
+		logger:    options.Logger.With("device", options.Device),
+		rng:       rng,
+		rotateNow: make(chan struct{}, 1),
+		events:    make(chan Event, eventBuffer),
+		original:  original,
+	}, nil
+}
+
+// Run rotates straight away, then on the schedule, until the context is
+// cancelled, returning its error, or until too many changes fail in a row,
+// returning a TooManyFailuresError. Its Hooks can change each step.
+func (r *Rotator) Run(ctx context.Context) error {
+	hooks := r.options.Hooks
+	if hooks.First != nil {
+		if err := hooks.First(ctx); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	var failedAt []time.Time
+	for {
+		if hooks.Prepare != nil {
+			proceed, err := hooks.Prepare(ctx)
+			if err != nil {
+				return err
+			}
+			if !proceed {
+				continue
+			}
+		}
+
+		maxErrs, window := r.maxErrs()
+		errs, failedAt = ageOutErrs(errs, failedAt, r.options.Clock.Now(), window)
+		change := r.change
+		if hooks.Change != nil {
+			change = hooks.Change
+		}
+		previous, mac, err := change(ctx, errs)
+
+		// A change cut short by stopping is no failure of the device's.
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			errs = append(errs, err)
+			failedAt = append(failedAt, r.options.Clock.Now())
+			r.emit(Event{Kind: EventFailed, Previous: previous, Err: err})
+			if maxErrs != 0 && maxErrs <= uint(len(errs)) {
+				return &TooManyFailuresError{errs}
+			}
+
+			retry := r.retry
+			if hooks.Retry != nil {
+				retry = hooks.Retry
+			}
+			if err := retry(ctx, len(errs)); err != nil {
+				return err
+			}
+			continue
+		}
+		errs, failedAt = nil, nil
+		r.emit(Event{Kind: EventRotated, Previous: previous, MAC: mac, Vendor: VendorOf(mac)})
+
+		next := r.next
+		if hooks.Next != nil {
+			next = hooks.Next
+		}
+		if err := next(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// change gives the device an address from the Generator.
+func (r *Rotator) change(ctx context.Context, errs []error) (previous, mac MAC, err error) {
+	iface, err := r.options.LookupInterface(r.options.Device)
+	if err == nil {
+		previous = MAC(iface.HardwareAddr.String())
+		r.mu.Lock()
+		if r.original == "" {
+			r.original = previous
+		}
+		r.mu.Unlock()
+		mac, err = r.setter.SetGenerated(ctx, r.logger, r.options.Generator, *iface)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("could not change the MAC address", "err", err, "hint", Hint(err), "consecutive_errors", len(errs)+1)
+		}
+		return previous, "", err
+	}
+	r.logger.Info("changed the MAC address", "new_mac", mac, "vendor", VendorOf(mac))
+	return previous, mac, nil
+}
+
+// next waits out the schedule, or for RotateNow without a cycle.
+func (r *Rotator) next(ctx context.Context) error {
+	var due time.Time
+	if r.options.CycleSecs != 0 {
+		due = nextRotation(r.logger, r.options.Clock, r.rng, r.options.Device, r.options.Schedule, r.options.CycleSecs, r.options.Variance)
+	}
+	return waitUntil(ctx, r.logger, r.options.Clock, due, r.rotateNow)
+}
+
+// retry backs off after failures, or until RotateNow.
+func (r *Rotator) retry(ctx context.Context, failures int) error {
+	retryAt := r.options.Clock.Now().Add(RetryDelay(r.rng, failures))
+	return waitUntil(ctx, r.logger, r.options.Clock, retryAt, r.rotateNow)
+}
+
+// RotateNow cuts the current wait short. Requests made while one is already
+// pending are coalesced.
+func (r *Rotator) RotateNow() {
+	select {
+	case r.rotateNow <- struct{}{}:
+	default:
+	}
+}
+
+// Restore puts back the address the device had when the Rotator was made.
+// Stop Run first, or its next rotation undoes this.
+func (r *Rotator) Restore(ctx context.Context) error {
+	r.mu.Lock()
+	original := r.original
+	r.mu.Unlock()
+	if original == "" {
+		return errors.New("the address to restore is unknown, as the device was missing until now")
+	}
+
+	previous, _ := CurrentMAC(r.options.Device)
+	if err := r.setter.Apply(ctx, r.logger, r.options.Device, original); err != nil {
+		r.emit(Event{Kind: EventFailed, Previous: previous, MAC: original, Err: err})
+		return err
+	}
+	r.logger.Info("restored the MAC address", "new_mac", original)
+	r.emit(Event{Kind: EventRestored, Previous: previous, MAC: original})
+	return nil
+}
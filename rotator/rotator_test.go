@@ -0,0 +1,104 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+)
+
+func missingInterface(name string) (*net.Interface, error) {
+	return nil, errors.New("no such device")
+}
+
+func TestRunGivesUpAfterMaxErrs(t *testing.T) {
+	var streaks []int
+	r, err := NewRotator(Options{
+		Device:          "rma-test0",
+		MaxErrs:         3,
+		LookupInterface: missingInterface,
+		Hooks: Hooks{
+			Change: func(ctx context.Context, errs []error) (MAC, MAC, error) {
+				streaks = append(streaks, len(errs))
+				return "", "", errors.New("rejected")
+			},
+			Retry: func(context.Context, int) error { return nil },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tooMany *TooManyFailuresError
+	if err := r.Run(context.Background()); !errors.As(err, &tooMany) || len(tooMany.Errs) != 3 {
+		t.Fatalf("got %v, want a TooManyFailuresError of 3 errors", err)
+	}
+	if want := []int{0, 1, 2}; !slices.Equal(streaks, want) {
+		t.Errorf("Change was given streaks of %v, want %v", streaks, want)
+	}
+}
+
+func TestRunFollowsItsHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var steps []string
+	prepared := 0
+	r, err := NewRotator(Options{
+		Device:          "rma-test0",
+		MaxErrs:         1,
+		LookupInterface: missingInterface,
+		Hooks: Hooks{
+			First: func(context.Context) error {
+				steps = append(steps, "first")
+				return nil
+			},
+			Prepare: func(context.Context) (bool, error) {
+				prepared++
+				steps = append(steps, "prepare")
+				// Skipping the first due rotation leaves it to Prepare to
+				// wait, and asks it again.
+				return prepared != 1, nil
+			},
+			Change: func(ctx context.Context, errs []error) (MAC, MAC, error) {
+				steps = append(steps, "change")
+				return "02:00:00:00:00:01", "02:00:00:00:00:02", nil
+			},
+			Next: func(context.Context) error {
+				steps = append(steps, "next")
+				if len(steps) == 8 {
+					cancel()
+					return ctx.Err()
+				}
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want the context's cancellation", err)
+	}
+	want := []string{"first", "prepare", "prepare", "change", "next", "prepare", "change", "next"}
+	if !slices.Equal(steps, want) {
+		t.Errorf("got steps %v, want %v", steps, want)
+	}
+
+	events := []EventKind{}
+	for len(r.Events()) != 0 {
+		events = append(events, (<-r.Events()).Kind)
+	}
+	if want := []EventKind{EventRotated, EventRotated}; !slices.Equal(events, want) {
+		t.Errorf("got events %v, want %v", events, want)
+	}
+}
+
+func TestTooManyFailuresErrorWithoutErrs(t *testing.T) {
+	var err error = &TooManyFailuresError{}
+	if got, want := err.Error(), "too many MAC change errors occurred"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
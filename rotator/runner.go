@@ -0,0 +1,65 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"slices"
+	"sync"
+)
+
+// Runner runs the commands that give devices addresses, returning what they
+// wrote to stdout and stderr. Swap in a fake to check the commands a Setter
+// runs without needing root.
+type Runner interface {
+	Run(ctx context.Context, prog string, args ...string) ([]byte, error)
+}
+
+// ExecRunner is the default Runner, running commands for real, killing them
+// if the context is cancelled.
+type ExecRunner struct {
+	// RunCmd defaults to exec.Cmd's Run, but can set up the command first, as
+	// the daemon does to pass its capabilities on.
+	RunCmd func(cmd *exec.Cmd) error
+}
+
+func (r ExecRunner) Run(ctx context.Context, prog string, args ...string) ([]byte, error) {
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, prog, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	run := r.RunCmd
+	if run == nil {
+		run = (*exec.Cmd).Run
+	}
+	err := run(cmd)
+	return output.Bytes(), err
+}
+
+// RecordingRunner is a fake Runner, noting each command's program and
+// arguments rather than running it and then failing with Err, if set, as
+// though the command wrote Output.
+type RecordingRunner struct {
+	Err    error
+	Output []byte
+
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func (r *RecordingRunner) Run(_ context.Context, prog string, args ...string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.commands = append(r.commands, append([]string{prog}, args...))
+	return r.Output, r.Err
+}
+
+// Commands are those run so far, each starting with its program.
+func (r *RecordingRunner) Commands() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.commands)
+}
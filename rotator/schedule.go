@@ -0,0 +1,175 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const wallClockCheckInterval = 15 * time.Second
+
+// SuspendSkewThreshold is how far the wall clock must jump ahead of the
+// monotonic one for the machine to count as having been suspended.
+const SuspendSkewThreshold = 5 * time.Second
+
+// Schedule decides how far apart rotations are spaced around the cycle.
+//
+// A bounded schedule keeps gaps close to the cycle, which is predictable but
+// leaves a rhythm an observer can pick out. The wide and Poisson schedules
+// trade that predictability away: the former draws from a broad uniform range,
+// and the latter makes rotations memoryless, so the time since the last
+// rotation says nothing about when the next will come.
+//
+// A lease schedule ignores the cycle where it can, instead rotating just
+// before the device's DHCP lease is renewed so that the change coincides with
+// a natural re-request. It falls back to a bounded schedule when there is no
+// lease to go by.
+type Schedule string
+
+const (
+	ScheduleBounded Schedule = "bounded"
+	ScheduleWide    Schedule = "wide"
+	SchedulePoisson Schedule = "poisson"
+	ScheduleLease   Schedule = "lease"
+)
+
+const (
+	wideSpread       = .9
+	minPoissonGap    = 60
+	maxPoissonCycles = 4
+)
+
+type gapFunc func(rng *rand.Rand, cycleSecs uint, variance float64) float64
+
+func variate(rng *rand.Rand, seconds uint, variance float64) float64 {
+	delta := (rng.Float64() - .5) * variance
+	return float64(seconds) + (float64(seconds) * delta)
+}
+
+func boundedGap(rng *rand.Rand, cycleSecs uint, variance float64) float64 {
+	return variate(rng, cycleSecs, variance)
+}
+
+var schedules = map[Schedule]gapFunc{
+	ScheduleBounded: boundedGap,
+	ScheduleLease:   boundedGap,
+	ScheduleWide: func(rng *rand.Rand, cycleSecs uint, _ float64) float64 {
+		return variate(rng, cycleSecs, wideSpread*2)
+	},
+	SchedulePoisson: func(rng *rand.Rand, cycleSecs uint, _ float64) float64 {
+		mean := float64(cycleSecs)
+		gap := rng.ExpFloat64() * mean
+		return math.Max(minPoissonGap, math.Min(gap, mean*maxPoissonCycles))
+	},
+}
+
+const (
+	firstRetryDelay = 5 * time.Second
+	maxRetryDelay   = 5 * time.Minute
+)
+
+// RetryDelay is how long to wait before retrying after the given number of
+// consecutive failures, doubling each time up to maxRetryDelay. Only the
+// second half of each delay is random, so that every retry still backs off
+// but devices failing together do not retry in lockstep.
+func RetryDelay(rng *rand.Rand, failures int) time.Duration {
+	delay := maxRetryDelay
+	if shift := failures - 1; shift < 16 {
+		delay = min(firstRetryDelay<<shift, maxRetryDelay)
+	}
+	return delay/2 + time.Duration(rng.Int63n(int64(delay/2)+1))
+}
+
+// ParseSchedule reads a schedule by its name, such as "poisson".
+func ParseSchedule(value string) (Schedule, error) {
+	mode := Schedule(value)
+	if _, ok := schedules[mode]; !ok {
+		return "", fmt.Errorf("unknown schedule %q", value)
+	}
+	return mode, nil
+}
+
+// NextGap is how long to wait until the next rotation under a schedule,
+// treating a lease schedule as bounded.
+func NextGap(rng *rand.Rand, mode Schedule, cycleSecs uint, variance float64) time.Duration {
+	secs := schedules[mode](rng, cycleSecs, variance)
+	return time.Second * time.Duration(math.Round(secs))
+}
+
+// NextRotation is when to rotate the device next, aligning with its DHCP lease
+// renewal under a lease schedule if it can.
+func NextRotation(logger *slog.Logger, rng *rand.Rand, deviceName string, mode Schedule, cycleSecs uint, variance float64) time.Time {
+	return nextRotation(logger, SystemClock, rng, deviceName, mode, cycleSecs, variance)
+}
+
+func nextRotation(logger *slog.Logger, clock Clock, rng *rand.Rand, deviceName string, mode Schedule, cycleSecs uint, variance float64) time.Time {
+	if mode == ScheduleLease {
+		at, err := NextLeaseRotation(deviceName)
+		if err == nil {
+			logger.Info("aligning the next rotation with the DHCP lease renewal")
+			return at
+		}
+		logger.Warn("falling back to a bounded schedule", "err", err)
+	}
+
+	return clock.Now().Add(NextGap(rng, mode, cycleSecs, variance))
+}
+
+// WaitUntil waits until the wall clock reaches due, returning early with the
+// context's error if it is cancelled or with nil if interrupt fires. A zero due
+// time waits for either of those alone.
+//
+// A timer alone measures with the monotonic clock, which stops while the
+// machine is suspended; a rotation that came due during a suspend would
+// otherwise be delayed by however long the machine slept. Waiting in short
+// chunks and comparing against the wall clock lets an overdue rotation fire
+// promptly on resume.
+func WaitUntil(ctx context.Context, logger *slog.Logger, due time.Time, interrupt <-chan struct{}) error {
+	return waitUntil(ctx, logger, SystemClock, due, interrupt)
+}
+
+func waitUntil(ctx context.Context, logger *slog.Logger, clock Clock, due time.Time, interrupt <-chan struct{}) error {
+	if due.IsZero() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-interrupt:
+			return nil
+		}
+	}
+	due = due.Round(0)
+
+	for {
+		remaining := due.Sub(clock.Now())
+		if remaining <= 0 {
+			break
+		}
+
+		chunk := min(remaining, wallClockCheckInterval)
+		before := clock.Now().Round(0)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-interrupt:
+			return nil
+		case <-clock.After(chunk):
+		}
+
+		skew := clock.Now().Round(0).Sub(before) - chunk
+		if SuspendSkewThreshold < skew {
+			logger.Info(
+				"the wall clock jumped while waiting, probably due to a suspend",
+				"skew_secs", int(skew/time.Second),
+			)
+		}
+	}
+
+	if overdue := clock.Now().Sub(due); SuspendSkewThreshold < overdue {
+		logger.Info("rotation is overdue; rotating now", "overdue_secs", int(overdue/time.Second))
+	}
+	return nil
+}
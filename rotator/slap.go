@@ -0,0 +1,122 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+// SLAPQuadrant is one of the quadrants that IEEE 802c's Structured Local
+// Address Plan divides locally administered addresses into, told apart by the
+// second hexadecimal digit of the address.
+type SLAPQuadrant string
+
+const (
+	// SLAPAdministrative is the AAI quadrant, for addresses assigned by a
+	// local administrator, as random ones are.
+	SLAPAdministrative SLAPQuadrant = "aai"
+
+	// SLAPExtended is the ELI quadrant, for addresses starting with a
+	// Company ID that the IEEE assigned to an organisation.
+	SLAPExtended SLAPQuadrant = "eli"
+
+	// SLAPStandard is the SAI quadrant, for addresses assigned by protocols
+	// following a standard.
+	SLAPStandard SLAPQuadrant = "sai"
+)
+
+// slapDigits are the second hexadecimal digit of each quadrant's addresses:
+// locally administered and unicast, with the quadrant's Y and Z bits.
+var slapDigits = map[SLAPQuadrant]byte{
+	SLAPAdministrative: 0x2,
+	SLAPExtended:       0xa,
+	SLAPStandard:       0xe,
+}
+
+// VendorLocal is the Vendor of locally administered addresses, which no
+// vendor has.
+const VendorLocal Vendor = "locally administered"
+
+func ParseSLAPQuadrant(value string) (SLAPQuadrant, error) {
+	quadrant := SLAPQuadrant(strings.ToLower(value))
+	if _, ok := slapDigits[quadrant]; !ok {
+		return "", fmt.Errorf("unknown SLAP quadrant %q; use aai, eli, or sai", value)
+	}
+	return quadrant, nil
+}
+
+// ParseCID reads a Company ID for the ELI quadrant, which is three octets
+// with an A as its second hexadecimal digit.
+func ParseCID(value string) (MAC, error) {
+	addr, err := net.ParseMAC(value + ":00:00:00")
+	if err != nil || len(addr) != 6 {
+		return "", fmt.Errorf("%q is not a Company ID of three octets", value)
+	}
+	if addr[0]&0x0f != slapDigits[SLAPExtended] {
+		return "", fmt.Errorf("the Company ID %q is not in the ELI quadrant, whose second digit is A", value)
+	}
+	return MAC(addr[:3].String()), nil
+}
+
+// SLAPAddressCount is how many addresses RandomSLAPMAC can generate in the
+// quadrant: all but the four bits giving the quadrant are random, apart from
+// the CID of ELI addresses.
+func SLAPAddressCount(quadrant SLAPQuadrant) float64 {
+	if quadrant == SLAPExtended {
+		return 1 << 24
+	}
+	return 1 << 44
+}
+
+// RandomSLAPMAC generates an address in the quadrant, which for ELI must
+// start with the CID, which the others ignore.
+func RandomSLAPMAC(rng *rand.Rand, quadrant SLAPQuadrant, cid MAC) (MAC, error) {
+	addr := make(net.HardwareAddr, 6)
+	for i := range addr {
+		addr[i] = byte(rng.Intn(256))
+	}
+
+	if quadrant == SLAPExtended {
+		prefix, err := net.ParseMAC(string(cid) + ":00:00:00")
+		if err != nil || cid == "" {
+			return "", fmt.Errorf("the ELI quadrant needs a Company ID to start with")
+		}
+		copy(addr, prefix[:3])
+		return MAC(addr.String()), nil
+	}
+
+	digit, ok := slapDigits[quadrant]
+	if !ok {
+		return "", fmt.Errorf("unknown SLAP quadrant %q", quadrant)
+	}
+	addr[0] = addr[0]&0xf0 | digit
+	return MAC(addr.String()), nil
+}
+
+// SLAPGenerator is a MACGenerator of addresses in a SLAP quadrant, for
+// deployments that administer local addresses rather than impersonating
+// vendors.
+type SLAPGenerator struct {
+	Quadrant SLAPQuadrant
+
+	// CID is the Company ID that ELI addresses start with.
+	CID MAC
+
+	// Rand defaults to one seeded with the time of each call.
+	Rand *rand.Rand
+}
+
+func (g SLAPGenerator) Generate(_ context.Context, _ net.Interface) (net.HardwareAddr, error) {
+	rng := g.Rand
+	if rng == nil {
+		rng = newTimeSeededRand()
+	}
+
+	mac, err := RandomSLAPMAC(rng, g.Quadrant, g.CID)
+	if err != nil {
+		return nil, err
+	}
+	return net.ParseMAC(string(mac))
+}
@@ -0,0 +1,54 @@
+package rotator
+
+const (
+	VendorQEMU       Vendor = "QEMU"
+	VendorVMware     Vendor = "VMware"
+	VendorHyperV     Vendor = "Hyper-V"
+	VendorVirtualBox Vendor = "VirtualBox"
+	VendorXen        Vendor = "Xen"
+)
+
+const (
+	PrefixQEMU       MAC = "52:54:00"
+	PrefixVMware     MAC = "00:50:56:00/26"
+	PrefixHyperV     MAC = "00:15:5d"
+	PrefixVirtualBox MAC = "08:00:27"
+	PrefixXen        MAC = "00:16:3e"
+)
+
+// VirtualVendors are hypervisors, whose virtual devices have addresses from
+// ranges of their own. They are never impersonated by default, as they only
+// make sense on their own virtual devices. VMware's range is the part of its
+// OUI set aside for addresses assigned by hand.
+var VirtualVendors = []VendorPrefix{
+	{VendorQEMU, PrefixQEMU},
+	{VendorVMware, PrefixVMware},
+	{VendorHyperV, PrefixHyperV},
+	{VendorVirtualBox, PrefixVirtualBox},
+	{VendorXen, PrefixXen},
+}
+
+// IsVirtual reports whether the prefix is within one of the VirtualVendors.
+func IsVirtual(prefix MAC) bool {
+	addr, bits, err := ParsePrefix(prefix)
+	if err != nil {
+		return false
+	}
+	for _, vendorPrefix := range VirtualVendors {
+		if prefixBits(vendorPrefix.Prefix) <= bits && prefixMatches(vendorPrefix.Prefix, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// VirtualVendor gives the VendorPrefix of the hypervisor, if it is one of the
+// VirtualVendors.
+func VirtualVendor(vendor Vendor) (VendorPrefix, bool) {
+	for _, vendorPrefix := range VirtualVendors {
+		if vendorPrefix.Vendor == vendor {
+			return vendorPrefix, true
+		}
+	}
+	return VendorPrefix{}, false
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// schedulerCheckInterval bounds how long the scheduler trusts its timer, so
+// that it notices the wall clock jumping past due times during a suspend,
+// which timers do not count.
+const schedulerCheckInterval = 15 * time.Second
+
+const defaultMaxParallelChanges = 8
+
+// scheduler wakes every device's rotation from a single timer, and bounds how
+// many changes run at once, so that rotating hundreds of devices neither
+// keeps hundreds of timers going nor runs hundreds of commands at the same
+// moment.
+type scheduler struct {
+	clock rotator.Clock
+
+	mu      sync.Mutex
+	waits   waitHeap
+	changed chan struct{}
+
+	changes chan struct{}
+}
+
+func newScheduler(clock rotator.Clock, maxParallelChanges uint) *scheduler {
+	return &scheduler{
+		clock:   clock,
+		changed: make(chan struct{}, 1),
+		changes: make(chan struct{}, max(maxParallelChanges, 1)),
+	}
+}
+
+// run fires the waits as they come due, until the context is cancelled.
+func (s *scheduler) run(ctx context.Context) {
+	for {
+		wait := schedulerCheckInterval
+		s.mu.Lock()
+		if 0 < len(s.waits) {
+			wait = min(s.waits[0].due.Sub(s.clock.Now()), wait)
+		}
+		s.mu.Unlock()
+
+		before := s.clock.Now().Round(0)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed:
+			continue
+		case <-s.clock.After(max(wait, 0)):
+		}
+
+		now := s.clock.Now().Round(0)
+		if skew := now.Sub(before) - max(wait, 0); rotator.SuspendSkewThreshold < skew {
+			slog.Info("the wall clock jumped while waiting, probably due to a suspend", "skew_secs", int(skew/time.Second))
+		}
+		s.fire(now)
+	}
+}
+
+func (s *scheduler) fire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for 0 < len(s.waits) && !now.Before(s.waits[0].due) {
+		close(heap.Pop(&s.waits).(*schedulerWait).done)
+	}
+}
+
+// waitUntil is rotator.WaitUntil on the scheduler's timer, with a zero time
+// waiting for the interrupt alone.
+func (s *scheduler) waitUntil(ctx context.Context, due time.Time, interrupt <-chan struct{}) error {
+	if due.IsZero() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-interrupt:
+			return nil
+		}
+	}
+
+	// Comparing by the wall clock counts time spent suspended.
+	wait := &schedulerWait{due: due.Round(0), done: make(chan struct{})}
+	s.mu.Lock()
+	heap.Push(&s.waits, wait)
+	earliest := s.waits[0] == wait
+	s.mu.Unlock()
+	if earliest {
+		select {
+		case s.changed <- struct{}{}:
+		default:
+		}
+	}
+
+	select {
+	case <-wait.done:
+		return nil
+	case <-ctx.Done():
+		s.cancel(wait)
+		return ctx.Err()
+	case <-interrupt:
+		s.cancel(wait)
+		return nil
+	}
+}
+
+func (s *scheduler) cancel(wait *schedulerWait) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if wait.index != -1 {
+		heap.Remove(&s.waits, wait.index)
+	}
+}
+
+// startChange waits for one of the changes allowed at once to come free,
+// giving what frees it again.
+func (s *scheduler) startChange(ctx context.Context) (func(), error) {
+	select {
+	case s.changes <- struct{}{}:
+		return func() { <-s.changes }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type schedulerWait struct {
+	due   time.Time
+	done  chan struct{}
+	index int
+}
+
+// waitHeap is a container/heap of waits, soonest first.
+type waitHeap []*schedulerWait
+
+func (h waitHeap) Len() int {
+	return len(h)
+}
+
+func (h waitHeap) Less(i, j int) bool {
+	return h[i].due.Before(h[j].due)
+}
+
+func (h waitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waitHeap) Push(x any) {
+	wait := x.(*schedulerWait)
+	wait.index = len(*h)
+	*h = append(*h, wait)
+}
+
+func (h *waitHeap) Pop() any {
+	old := *h
+	wait := old[len(old)-1]
+	old[len(old)-1] = nil
+	wait.index = -1
+	*h = old[:len(old)-1]
+	return wait
+}
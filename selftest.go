@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	selfTestDevice = "rmatest0"
+	selfTestPeer   = "rmatest1"
+)
+
+// selfTest is a throwaway network namespace holding a veth pair, in which this
+// executable rotates and restores an address as it would a real device's.
+type selfTest struct {
+	namespace  string
+	executable string
+	dir        string
+	verbose    bool
+}
+
+// runSelfTest checks the binary against the running kernel end to end, from
+// generating an address through setting, verifying, and restoring it, without
+// going near a real interface: everything happens to a veth pair in a network
+// namespace of its own, which is deleted afterwards.
+func runSelfTest(args []string) error {
+	flagSet := flag.NewFlagSet("self-test", flag.ExitOnError)
+
+	var t selfTest
+	flagSet.BoolVar(
+		&t.verbose,
+		"v",
+		false,
+		"show the log of each step, not only of those that fail",
+	)
+	flagSet.Parse(args)
+
+	if runtime.GOOS != "linux" {
+		return errors.New("self-test needs Linux's network namespaces")
+	}
+	if os.Geteuid() != 0 {
+		return errors.New("self-test must run as root, to create a network namespace")
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		return errors.New("self-test needs ip, from iproute2")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find this executable to test: %w", err)
+	}
+	t.executable = executable
+
+	if t.dir, err = os.MkdirTemp("", "rotate-mac-address-self-test-"); err != nil {
+		return err
+	}
+	defer os.RemoveAll(t.dir)
+
+	// An empty config file keeps the system's own out of the test.
+	if err := os.WriteFile(t.config(), nil, 0o600); err != nil {
+		return err
+	}
+
+	t.namespace = "rotate-mac-address-self-test-" + randomHex(4)
+	if out, err := exec.Command("ip", "netns", "add", t.namespace).CombinedOutput(); err != nil {
+		return fmt.Errorf("could not create a network namespace: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	defer exec.Command("ip", "netns", "delete", t.namespace).Run()
+
+	original, err := t.createVeth()
+	fmt.Println(selfTestResult("create a veth pair", err, "%s and %s in %s, %s at %s", selfTestDevice, selfTestPeer, t.namespace, selfTestDevice, original))
+	if err != nil {
+		return err
+	}
+
+	generated, err := t.rotate(original)
+	fmt.Println(selfTestResult("generate and set an address", err, "%s announces itself as %s", generated, rotator.VendorOf(generated)))
+	if err != nil {
+		return err
+	}
+
+	err = t.verifyState(original)
+	fmt.Println(selfTestResult("save the original address", err, "%s kept in the state directory", original))
+	if err != nil {
+		return err
+	}
+
+	err = t.restore(original)
+	fmt.Println(selfTestResult("restore the original address", err, "%s is back at %s", selfTestDevice, original))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("the self-test passed")
+	return nil
+}
+
+func selfTestResult(name string, err error, format string, args ...any) string {
+	if err != nil {
+		return fmt.Sprintf("FAIL  %s: %v", name, err)
+	}
+	return fmt.Sprintf("PASS  %s: %s", name, fmt.Sprintf(format, args...))
+}
+
+func (t selfTest) config() string {
+	return filepath.Join(t.dir, configName)
+}
+
+func (t selfTest) stateDir() string {
+	return filepath.Join(t.dir, "state")
+}
+
+func (t selfTest) ip(args ...string) (string, error) {
+	out, err := exec.Command("ip", append([]string{"-n", t.namespace}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ip %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (t selfTest) createVeth() (rotator.MAC, error) {
+	if _, err := t.ip("link", "add", selfTestDevice, "type", "veth", "peer", "name", selfTestPeer); err != nil {
+		return "", err
+	}
+	for _, deviceName := range []string{selfTestDevice, selfTestPeer} {
+		if _, err := t.ip("link", "set", deviceName, "up"); err != nil {
+			return "", err
+		}
+	}
+	return t.currentMac()
+}
+
+// currentMac reads the device's address from the kernel, through ip, as the
+// namespace is not this process's own.
+func (t selfTest) currentMac() (rotator.MAC, error) {
+	out, err := t.ip("-o", "link", "show", "dev", selfTestDevice)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	i := slices.Index(fields, "link/ether")
+	if i < 0 || i+1 == len(fields) {
+		return "", fmt.Errorf("ip did not show an address for %s", selfTestDevice)
+	}
+	addr, err := net.ParseMAC(fields[i+1])
+	if err != nil {
+		return "", err
+	}
+	return rotator.MAC(addr.String()), nil
+}
+
+// run runs this executable in the namespace with the environment's settings
+// left out, so that only the test's flags apply.
+func (t selfTest) run(command string, args ...string) error {
+	args = append([]string{
+		"netns", "exec", t.namespace, t.executable, command,
+		"-config", t.config(),
+		"-state-dir", t.stateDir(),
+		"-control-socket", "",
+	}, args...)
+	cmd := exec.Command("ip", args...)
+
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, envPrefix) {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	out, err := cmd.CombinedOutput()
+	if t.verbose || err != nil {
+		os.Stderr.Write(out)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", command, err)
+	}
+	return nil
+}
+
+func (t selfTest) rotate(original rotator.MAC) (rotator.MAC, error) {
+	if err := t.run("once", "-device-name", selfTestDevice); err != nil {
+		return "", err
+	}
+	mac, err := t.currentMac()
+	if err != nil {
+		return "", err
+	}
+	if mac == original {
+		return "", fmt.Errorf("%s still has its original address, %s", selfTestDevice, original)
+	}
+	addr, err := net.ParseMAC(string(mac))
+	if err != nil {
+		return "", err
+	}
+	if addr[0]&1 != 0 {
+		return "", fmt.Errorf("%s was given %s, a multicast address", selfTestDevice, mac)
+	}
+	return mac, nil
+}
+
+func (t selfTest) verifyState(original rotator.MAC) error {
+	state, err := loadDeviceState(t.stateDir(), selfTestDevice)
+	if err != nil {
+		return err
+	}
+	if state.OriginalMac != original {
+		return fmt.Errorf("the state directory kept %s as the original address rather than %s", orDash(string(state.OriginalMac)), original)
+	}
+	return nil
+}
+
+func (t selfTest) restore(original rotator.MAC) error {
+	if err := t.run("restore", selfTestDevice); err != nil {
+		return err
+	}
+	mac, err := t.currentMac()
+	if err != nil {
+		return err
+	}
+	if mac != original {
+		return fmt.Errorf("%s is at %s rather than %s", selfTestDevice, mac, original)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	serviceName        = "rotate-mac-address"
+	serviceDisplayName = "Rotate MAC Address"
+	serviceDescription = "Rotates the MAC addresses of network adapters on an interval."
+)
+
+// The service control manager's API, which the standard library lacks.
+var (
+	advapi32                         = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW  = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerEx = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus             = advapi32.NewProc("SetServiceStatus")
+)
+
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	errorCallNotImplemented    = 120
+	errorServiceSpecificError  = 1066
+	serviceStopWaitHintMillis  = 30 * 1000
+	serviceStartWaitHintMillis = 10 * 1000
+)
+
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+func init() {
+	commands = append(
+		commands,
+		command{"run-service", "", "", runService},
+		command{"install-service", "[flags]", "install and start a Windows service with the flags", runInstallService},
+		command{"start-service", "", "start the Windows service", runStartService},
+		command{"stop-service", "", "stop the Windows service", runStopService},
+		command{"uninstall-service", "", "stop and remove the Windows service", runUninstallService},
+	)
+}
+
+// service is the state shared with the callbacks the service control manager
+// calls on its own threads.
+var service struct {
+	args   []string
+	handle uintptr
+	stop   context.CancelFunc
+	err    error
+}
+
+// runService is what the service control manager runs; it is not meant to be
+// run by hand.
+func runService(args []string) error {
+	name, err := syscall.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return err
+	}
+
+	service.args = args
+	table := []serviceTableEntry{
+		{name, syscall.NewCallback(serviceMain)},
+		{nil, 0},
+	}
+
+	// This blocks until the service has stopped.
+	ok, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))
+	if ok == 0 {
+		return fmt.Errorf("could not connect to the service control manager: %w", err)
+	}
+	return service.err
+}
+
+func serviceMain(argc uintptr, argv uintptr) uintptr {
+	name, _ := syscall.UTF16PtrFromString(serviceName)
+	service.handle, _, _ = procRegisterServiceCtrlHandlerEx.Call(
+		uintptr(unsafe.Pointer(name)),
+		syscall.NewCallback(serviceHandler),
+		0,
+	)
+	if service.handle == 0 {
+		return 0
+	}
+	setServiceStatus(serviceStartPending, 0, serviceStartWaitHintMillis)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	service.stop = cancel
+
+	flagSet := flag.NewFlagSet("run-service", flag.ContinueOnError)
+	flags, err := loadFlags(flagSet, service.args)
+	if err == nil {
+		err = checkPrivileges(flags)
+	}
+	if err == nil {
+		err = checkTools(flags)
+	}
+	if err == nil {
+		// There is no console to log to.
+		os.MkdirAll(filepath.Dir(flags.daemonLog), stateDirPerm)
+
+		var logFile *os.File
+		logFile, err = os.OpenFile(flags.daemonLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, stateFilePerm)
+		if err == nil {
+			defer logFile.Close()
+			err = setUpLogging(logFile, flags)
+		}
+		if err == nil {
+			if closeEventLog, eventLogErr := setUpEventLog(); eventLogErr != nil {
+				slog.Warn("not reporting to the event log", "err", eventLogErr)
+			} else {
+				defer closeEventLog()
+			}
+
+			setServiceStatus(serviceRunning, 0, 0)
+			if err = runDaemonUntil(ctx, flags); err != nil {
+				slog.Error("exiting", "err", err)
+			}
+		}
+	}
+
+	var exitCode uint32
+	if err != nil {
+		service.err = err
+		exitCode = 1
+	}
+	setServiceStatus(serviceStopped, exitCode, 0)
+	return 0
+}
+
+func serviceHandler(control uintptr, eventType uintptr, eventData uintptr, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		setServiceStatus(serviceStopPending, 0, serviceStopWaitHintMillis)
+		service.stop()
+		return 0
+	case serviceControlInterrogate:
+		return 0
+	default:
+		return errorCallNotImplemented
+	}
+}
+
+func setServiceStatus(state uint32, exitCode uint32, waitHintMillis uint32) {
+	status := serviceStatus{
+		serviceType:  serviceWin32OwnProcess,
+		currentState: state,
+		waitHint:     waitHintMillis,
+	}
+	if state == serviceRunning {
+		status.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	}
+	if exitCode != 0 {
+		status.win32ExitCode = errorServiceSpecificError
+		status.serviceSpecificExitCode = exitCode
+	}
+	procSetServiceStatus.Call(service.handle, uintptr(unsafe.Pointer(&status)))
+}
+
+// runInstallService registers a service running the daemon with the given
+// flags, starting automatically at boot, then starts it.
+func runInstallService(args []string) error {
+	flagSet := flag.NewFlagSet("install-service", flag.ExitOnError)
+	flags := defineFlags(flagSet)
+	if err := parseFlags(flagSet, flags, args); err != nil {
+		return err
+	}
+
+	executable, err := installedExecutable()
+	if err != nil {
+		return err
+	}
+
+	binPath := []string{syscall.EscapeArg(executable), "run-service"}
+	for _, arg := range serviceArgs(flagSet, args) {
+		binPath = append(binPath, syscall.EscapeArg(arg))
+	}
+
+	err = runSc(
+		"create", serviceName,
+		"binPath=", strings.Join(binPath, " "),
+		"start=", "auto",
+		"DisplayName=", serviceDisplayName,
+	)
+	if err != nil {
+		return err
+	}
+	if err := runSc("description", serviceName, serviceDescription); err != nil {
+		return err
+	}
+	if err := registerEventSource(); err != nil {
+		return err
+	}
+
+	// Restart after crashes, as systemd and launchd are told to elsewhere.
+	if err := runSc("failure", serviceName, "reset=", "86400", "actions=", "restart/60000"); err != nil {
+		return err
+	}
+
+	return runStartService(nil)
+}
+
+func runStartService([]string) error {
+	return runSc("start", serviceName)
+}
+
+func runStopService([]string) error {
+	return runSc("stop", serviceName)
+}
+
+// runUninstallService lets the service finish stopping, and so restore
+// addresses with -restore-on-exit, before removing it.
+func runUninstallService([]string) error {
+	if err := runSc("stop", serviceName); err == nil {
+		waitForServiceStop()
+	}
+	if err := runSc("delete", serviceName); err != nil {
+		return err
+	}
+	return unregisterEventSource()
+}
+
+func waitForServiceStop() {
+	deadline := time.Now().Add(serviceStopWaitHintMillis * time.Millisecond)
+	for time.Now().Before(deadline) {
+		out, err := exec.Command("sc.exe", "query", serviceName).Output()
+		if err != nil || strings.Contains(string(out), "STOPPED") {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func runSc(args ...string) error {
+	cmd := exec.Command("sc.exe", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sc.exe %s: %w", args[0], err)
+	}
+	return nil
+}
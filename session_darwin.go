@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var hidIdleTimePattern = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// sessionInUse asks IOKit how long since the keyboard or mouse was last
+// touched, as macOS has no lock state to ask for without cgo. Locking the
+// screen and walking away counts once idleFor passes.
+func sessionInUse(idleFor time.Duration) (bool, error) {
+	out, err := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+	if err != nil {
+		return false, err
+	}
+
+	match := hidIdleTimePattern.FindSubmatch(out)
+	if match == nil {
+		return false, errors.New("ioreg does not give the HIDIdleTime")
+	}
+	// HIDIdleTime is in nanoseconds.
+	idle, err := strconv.ParseInt(string(match[1]), 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return time.Duration(idle) < idleFor, nil
+}
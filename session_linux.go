@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphicalSessionTypes are the logind session types with a screen to lock,
+// leaving out terminals, which never report being idle.
+var graphicalSessionTypes = []string{"x11", "wayland", "mir"}
+
+// sessionInUse asks logind whether any graphical session is unlocked and has
+// not been idle for idleFor. Desktops only tell logind once their own idle
+// delay passes, so shorter thresholds than that act as the delay itself.
+func sessionInUse(idleFor time.Duration) (bool, error) {
+	out, err := exec.Command("loginctl", "list-sessions", "--no-legend").Output()
+	if err != nil {
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		props, err := sessionProperties(fields[0])
+		if err != nil {
+			return false, err
+		}
+		if props["Class"] != "user" || props["Active"] != "yes" || !slices.Contains(graphicalSessionTypes, props["Type"]) {
+			continue
+		}
+		if props["LockedHint"] == "yes" {
+			continue
+		}
+		if props["IdleHint"] == "yes" {
+			// IdleSinceHint is in microseconds since the epoch.
+			if since, err := strconv.ParseInt(props["IdleSinceHint"], 10, 64); err == nil && idleFor <= time.Since(time.UnixMicro(since)) {
+				continue
+			}
+		}
+		return true, nil
+	}
+	return false, scanner.Err()
+}
+
+func sessionProperties(id string) (map[string]string, error) {
+	out, err := exec.Command(
+		"loginctl", "show-session", id,
+		"-p", "Class", "-p", "Type", "-p", "Active",
+		"-p", "LockedHint", "-p", "IdleHint", "-p", "IdleSinceHint",
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[key] = value
+		}
+	}
+	return props, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// sessionInUse is unsupported, as -defer-while-active is rejected here.
+func sessionInUse(idleFor time.Duration) (bool, error) {
+	return false, errors.New("asking whether the session is in use is only supported on Linux and macOS")
+}
@@ -0,0 +1,63 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals lets a daemon with no other control channel be driven by
+// signals: SIGUSR1 rotates every device immediately, so that scripts can force
+// a new identity without a restart; SIGHUP reloads the flags; SIGUSR2 logs the
+// status of each device; and SIGTSTP pauses every device until SIGCONT, which
+// is what job control sends anyway.
+func handleSignals(ctx context.Context, d *daemon) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(
+		signals,
+		syscall.SIGUSR1,
+		syscall.SIGUSR2,
+		syscall.SIGHUP,
+		syscall.SIGTSTP,
+		syscall.SIGCONT,
+	)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				switch sig {
+				case syscall.SIGUSR1:
+					d.rotateAll("SIGUSR1 was received")
+				case syscall.SIGUSR2:
+					d.logStatus()
+				case syscall.SIGHUP:
+					reload(ctx, d)
+				case syscall.SIGTSTP:
+					d.control(ctx, []string{"pause"})
+				case syscall.SIGCONT:
+					d.control(ctx, []string{"resume"})
+				}
+			}
+		}
+	}()
+}
+
+func reload(ctx context.Context, d *daemon) {
+	flags, err := reloadFlags()
+	if err != nil {
+		slog.Error("received SIGHUP but could not reload the flags", "err", err)
+		return
+	}
+
+	slog.Info("received SIGHUP; reloaded the flags")
+	d.reload(ctx, flags)
+}
@@ -0,0 +1,6 @@
+package main
+
+import "context"
+
+// handleSignals does nothing on Windows, which lacks SIGUSR1, SIGUSR2 and SIGHUP.
+func handleSignals(context.Context, *daemon) {}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// simulationRealTime is how long a simulation takes to play out, however
+// long a span it covers.
+const simulationRealTime = 3 * time.Second
+
+// simulation is what a plan plays out on an accelerated clock, against a
+// stand-in for the device rather than the real one.
+type simulation struct {
+	span         time.Duration
+	failRate     float64
+	triggerEvery time.Duration
+}
+
+// simulatedDevice stands in for a device, taking the addresses that the
+// rotator sets unless it fails them at random.
+type simulatedDevice struct {
+	name     string
+	rng      *rand.Rand
+	failRate float64
+
+	mu      sync.Mutex
+	mac     net.HardwareAddr
+	pending net.HardwareAddr
+}
+
+func (d *simulatedDevice) lookup(string) (*net.Interface, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &net.Interface{Name: d.name, HardwareAddr: d.mac}, nil
+}
+
+// command notes the address it is asked to set, for Run to take.
+func (d *simulatedDevice) command(newSetMacCmd rotator.SetCommand) rotator.SetCommand {
+	return func(deviceName string, mac rotator.MAC) (string, []string) {
+		d.mu.Lock()
+		d.pending, _ = net.ParseMAC(string(mac))
+		d.mu.Unlock()
+		return newSetMacCmd(deviceName, mac)
+	}
+}
+
+func (d *simulatedDevice) Run(context.Context, string, ...string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.rng.Float64() < d.failRate {
+		return []byte("simulated failure"), errors.New("exit status 1")
+	}
+	d.mac = d.pending
+	return nil, nil
+}
+
+// printSimulation plays out the span of the device's rotations in a few
+// seconds, failing changes at the given rate and requesting early rotations
+// as often as given, to show how the schedule, triggers, and backing off
+// after failures come together.
+func printSimulation(rng *rand.Rand, flags flags, deviceName string, seed int64, sim simulation) error {
+	if flags.schedule == rotator.ScheduleLease {
+		return errors.New("lease schedules depend on the DHCP server, so cannot be simulated")
+	}
+
+	start := time.Now()
+	speed := float64(sim.span) / float64(simulationRealTime)
+	clock := rotator.NewAcceleratedClock(start, speed)
+
+	_, mac := rotator.RandomMAC(rng, flags.vendors)
+	initial, _ := net.ParseMAC(string(mac))
+	device := &simulatedDevice{name: deviceName, rng: rng, failRate: sim.failRate, mac: initial}
+
+	r, err := rotator.NewRotator(rotator.Options{
+		Device:          deviceName,
+		CycleSecs:       flags.cycleSecs,
+		Variance:        flags.variance,
+		Schedule:        flags.schedule,
+		Vendors:         flags.vendors,
+		SetCommand:      device.command(chooseSetMacCmd(flags)),
+		Runner:          device,
+		MaxErrs:         flags.maxErrs,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Clock:           clock,
+		LookupInterface: device.lookup,
+		Rand:            rng,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), simulationRealTime)
+	defer cancel()
+
+	if sim.triggerEvery != 0 {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-clock.After(sim.triggerEvery):
+					r.RotateNow()
+				}
+			}
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	fmt.Printf("simulated rotations for %s over %s with seed %d:\n\n", deviceName, sim.span, seed)
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "#\tTIME\tEVENT\tVENDOR\tMAC")
+
+	rotations, failures := 0, 0
+	for i := 1; ; i++ {
+		var event rotator.Event
+		select {
+		case event = <-r.Events():
+		case err := <-done:
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			fmt.Printf("\n%d rotations and %d failures", rotations, failures)
+			var tooMany *rotator.TooManyFailuresError
+			if errors.As(err, &tooMany) {
+				fmt.Printf(", giving up at %s after %d failures in a row", clock.Now().Format(time.RFC3339), len(tooMany.Errs))
+			}
+			fmt.Println()
+			return nil
+		}
+
+		switch event.Kind {
+		case rotator.EventRotated:
+			rotations++
+			fmt.Fprintf(out, "%d\t%s\t%s\t%s\t%s\n", i, event.At.Format(time.RFC3339), event.Kind, event.Vendor, event.MAC)
+		case rotator.EventFailed:
+			failures++
+			fmt.Fprintf(out, "%d\t%s\t%s\t-\t-\n", i, event.At.Format(time.RFC3339), event.Kind)
+		}
+	}
+}
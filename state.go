@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const (
+	stateDirPerm  = 0o700
+	stateFilePerm = 0o600
+)
+
+// deviceState is what survives a restart for a single device, so that a
+// restarted daemon carries on with the existing schedule rather than
+// rotating immediately, and so that the device's own addresses can be put
+// back even after the daemon has died.
+type deviceState struct {
+	NextRotation time.Time   `json:"next_rotation"`
+	OriginalMac  rotator.MAC `json:"original_mac,omitempty"`
+	PermanentMac rotator.MAC `json:"permanent_mac,omitempty"`
+
+	// PoolPosition and PoolSeed are how far through the -mac-pool the
+	// device has got, and the order it is going through it in when
+	// shuffling.
+	PoolPosition int   `json:"pool_position,omitempty"`
+	PoolSeed     int64 `json:"pool_seed,omitempty"`
+
+	// BadMacs are the addresses that lost the device its connectivity and
+	// were rolled back, the latest last, for not trying again.
+	BadMacs []rotator.MAC `json:"bad_macs,omitempty"`
+}
+
+// notDeviceStates are JSON files in the state directory that hold no device's
+// state, such as the -config-url cache from before it was renamed.
+var notDeviceStates = []string{"remote-config.json"}
+
+// savedDeviceNames lists the devices with saved state.
+func savedDeviceNames(stateDir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(stateDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	deviceNames := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if slices.Contains(notDeviceStates, filepath.Base(path)) {
+			continue
+		}
+		deviceNames = append(deviceNames, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	return deviceNames, nil
+}
+
+func deviceStatePath(stateDir string, deviceName string) string {
+	return filepath.Join(stateDir, deviceName+".json")
+}
+
+func loadDeviceState(stateDir string, deviceName string) (deviceState, error) {
+	var state deviceState
+
+	path := deviceStatePath(stateDir, deviceName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	if data, err = openState(path, data); err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func saveDeviceState(stateDir string, deviceName string, state deviceState) error {
+	if err := os.MkdirAll(stateDir, stateDirPerm); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := deviceStatePath(stateDir, deviceName)
+	if data, err = sealState(path, data); err != nil {
+		return err
+	}
+
+	// Write then rename so a crash mid-write can't leave a truncated file
+	// behind.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, stateFilePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
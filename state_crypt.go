@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	stateSealing        = "aes-256-gcm"
+	stateKeySize        = 32
+	stateSaltFile       = "state.salt"
+	stateSaltSize       = 16
+	statePassphraseIter = 600_000
+)
+
+// stateKey, if set by -state-key-file, seals the state files at rest, as they
+// hold the devices' permanent addresses and the pool and schedule they are
+// on. It is kept rather than passed around, as the state is read and written
+// from all over.
+var stateKey []byte
+
+// sealedState is a sealed state file, which stays JSON so that it is still
+// recognisable as what it is.
+type sealedState struct {
+	Sealing string `json:"sealing"`
+	Nonce   []byte `json:"nonce"`
+	Sealed  []byte `json:"sealed"`
+}
+
+// loadStateKey reads the -state-key-file, which holds either a key of 32
+// hex-encoded bytes or a passphrase, stretched with PBKDF2 under a salt kept
+// in the state directory. Keeping the file itself out of the state
+// directory, such as on removable media or in a service manager's
+// credentials, is what makes sealing worth it.
+func loadStateKey(flags flags) error {
+	if flags.stateKeyFile == "" {
+		stateKey = nil
+		return nil
+	}
+
+	secret, err := os.ReadFile(flags.stateKeyFile)
+	if err != nil {
+		return fmt.Errorf("could not read the -state-key-file: %w", err)
+	}
+	trimmed := strings.TrimSpace(string(secret))
+	if trimmed == "" {
+		return fmt.Errorf("%s holds neither a key nor a passphrase", flags.stateKeyFile)
+	}
+	if key, err := hex.DecodeString(trimmed); err == nil && len(key) == stateKeySize {
+		stateKey = key
+		return nil
+	}
+
+	salt, err := loadStateSalt(flags.stateDir)
+	if err != nil {
+		return err
+	}
+	key, err := pbkdf2.Key(sha256.New, trimmed, salt, statePassphraseIter, stateKeySize)
+	if err != nil {
+		return err
+	}
+	stateKey = key
+	return nil
+}
+
+// loadStateSalt reads the salt that passphrases are stretched under, which
+// need not be secret, creating it on first use.
+func loadStateSalt(stateDir string) ([]byte, error) {
+	path := filepath.Join(stateDir, stateSaltFile)
+	salt, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		salt = make([]byte, stateSaltSize)
+		rand.Read(salt)
+		if err := os.MkdirAll(stateDir, stateDirPerm); err != nil {
+			return nil, err
+		}
+		return salt, os.WriteFile(path, salt, stateFilePerm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(salt) != stateSaltSize {
+		return nil, fmt.Errorf("%s is not a salt of %d bytes", path, stateSaltSize)
+	}
+	return salt, nil
+}
+
+// sealState encrypts a state file's contents if there is a stateKey. The
+// file's name is bound in, so that one device's state cannot be passed off as
+// another's.
+func sealState(path string, data []byte) ([]byte, error) {
+	if stateKey == nil {
+		return data, nil
+	}
+	aead, err := stateAEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return json.MarshalIndent(sealedState{
+		Sealing: stateSealing,
+		Nonce:   nonce,
+		Sealed:  aead.Seal(nil, nonce, data, []byte(filepath.Base(path))),
+	}, "", "  ")
+}
+
+// openState decrypts a state file's contents if they were sealed, and passes
+// them through otherwise, so that state from before -state-key-file is read
+// as it is, to be sealed when next saved.
+func openState(path string, data []byte) ([]byte, error) {
+	var sealed sealedState
+	if err := json.Unmarshal(data, &sealed); err != nil || sealed.Sealing == "" {
+		return data, nil
+	}
+	if sealed.Sealing != stateSealing {
+		return nil, fmt.Errorf("%s is sealed with %q, which is unknown", path, sealed.Sealing)
+	}
+	if stateKey == nil {
+		return nil, fmt.Errorf("%s is sealed, so needs the -state-key-file it was sealed with", path)
+	}
+
+	aead, err := stateAEAD()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%s has a nonce of the wrong size", path)
+	}
+	opened, err := aead.Open(nil, sealed.Nonce, sealed.Sealed, []byte(filepath.Base(path)))
+	if err != nil {
+		return nil, fmt.Errorf("could not unseal %s, so it was sealed with another key or has been changed", path)
+	}
+	return opened, nil
+}
+
+func stateAEAD() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(stateKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStatsDPrefix = "rotate_mac_address"
+	statsDGaugeInterval = 10 * time.Second
+)
+
+// statsD pushes metrics over UDP to a StatsD server, or to the Datadog
+// agent's DogStatsD with tags, for those who collect metrics that way rather
+// than by scraping.
+type statsD struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+}
+
+func newStatsD(flags flags) (*statsD, error) {
+	if _, _, err := net.SplitHostPort(flags.statsD); err != nil {
+		return nil, fmt.Errorf("-statsd must be a host:port, such as localhost:8125: %w", err)
+	}
+	conn, err := net.Dial("udp", flags.statsD)
+	if err != nil {
+		return nil, err
+	}
+	return &statsD{conn, strings.TrimSuffix(flags.statsDPrefix, "."), flags.statsDTags}, nil
+}
+
+// send writes a metric for a device, which DogStatsD tags and plain StatsD
+// has in the name. Losing the odd datagram is StatsD's way, so errors are
+// only logged.
+func (s *statsD) send(name, deviceName, value, kind string) {
+	var line string
+	if s.tags {
+		line = fmt.Sprintf("%s.%s:%s|%s|#device:%s", s.prefix, name, value, kind, deviceName)
+	} else {
+		// VLAN devices such as eth0.100 would otherwise nest a level deeper.
+		line = fmt.Sprintf("%s.%s.%s:%s|%s", s.prefix, strings.ReplaceAll(deviceName, ".", "_"), name, value, kind)
+	}
+	if _, err := s.conn.Write([]byte(line)); err != nil {
+		slog.Debug("could not send a metric to StatsD", "metric", line, "err", err)
+	}
+}
+
+// serveStatsD counts each change and failure as it happens, and reports how
+// long until each device's next rotation every so often.
+func serveStatsD(ctx context.Context, d *daemon, s *statsD) {
+	entries, unsubscribe := d.history.subscribe()
+
+	go func() {
+		defer unsubscribe()
+		defer s.conn.Close()
+
+		ticker := time.NewTicker(statsDGaugeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry := <-entries:
+				if entry.Error != "" {
+					s.send("failures", entry.Device, "1", "c")
+				} else {
+					s.send("rotations", entry.Device, "1", "c")
+				}
+			case <-ticker.C:
+				for _, status := range d.statuses() {
+					s.send("consecutive_errors", status.deviceName, fmt.Sprint(status.consecutiveErrs), "g")
+					if !status.nextRotation.IsZero() {
+						secs := max(0, time.Until(status.nextRotation).Seconds())
+						s.send("seconds_to_next_rotation", status.deviceName, fmt.Sprintf("%.0f", secs), "g")
+					}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// status is a snapshot of how the rotation of a device is getting on.
+type status struct {
+	deviceName      string
+	mac             rotator.MAC
+	originalMac     rotator.MAC
+	vendor          rotator.Vendor
+	lastChange      time.Time
+	nextRotation    time.Time
+	consecutiveErrs int
+	changes         int
+	failures        int
+	trustedNetwork  network
+	network         network
+	aggressive      bool
+	paused          bool
+
+	// ipv4 is the device's IPv4 address as checked after its last change,
+	// with a warning if it did not carry over.
+	ipv4        string
+	ipv4Warning string
+}
+
+func (r *rotation) recordChange(change macChange, errs []error, trigger string) {
+	r.mu.Lock()
+	entry := historyEntry{At: time.Now(), Device: r.deviceName, Trigger: trigger}
+	switch change := change.(type) {
+	case *successfulMacChange:
+		entry.Previous = change.previous
+		if entry.Previous == "" {
+			entry.Previous = r.status.mac
+		}
+		r.status.mac = change.mac
+		r.status.vendor = change.vendor
+		r.status.lastChange = entry.At
+		entry.Mac = change.mac
+		entry.Vendor = change.vendor
+		r.status.changes++
+	case *failedMacChange:
+		entry.Previous = change.previous
+		entry.Error = change.err.Error()
+		r.status.failures++
+	}
+	r.status.consecutiveErrs = len(errs)
+	r.mu.Unlock()
+
+	if r.history != nil {
+		r.history.record(entry)
+	}
+	r.audit.record(newAuditRecord(entry))
+	events.emitChange(entry)
+}
+
+// recordNextRotation notes the start of a wait, which ends at the given time
+// or, if it is zero, with a trigger.
+func (r *rotation) recordNextRotation(at time.Time) {
+	r.mu.Lock()
+	r.status.nextRotation = at
+	r.mu.Unlock()
+
+	events.emitWait(r.deviceName, at)
+}
+
+func (r *rotation) currentStatus() status {
+	r.mu.Lock()
+	status := r.status
+	status.originalMac = r.originalMac
+	r.mu.Unlock()
+
+	status.deviceName = r.deviceName
+
+	// Before the first change, fall back to whatever the device has now.
+	if status.mac == "" {
+		if iface, err := net.InterfaceByName(r.deviceName); err == nil {
+			status.mac = rotator.MAC(iface.HardwareAddr.String())
+		}
+	}
+	return status
+}
+
+func (s status) String() string {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	nextIn := "unscheduled"
+	if !s.nextRotation.IsZero() {
+		nextIn = fmt.Sprintf("%ds", max(0, time.Until(s.nextRotation)/time.Second))
+	}
+
+	vendor := s.vendor
+	if vendor == "" {
+		vendor = "unknown"
+	}
+
+	formatted := fmt.Sprintf(
+		"device=%s mac=%s vendor=%s last_change=%s next_rotation=%s next_rotation_in=%s consecutive_errors=%d changes=%d failures=%d",
+		s.deviceName,
+		s.mac,
+		vendor,
+		formatTime(s.lastChange),
+		formatTime(s.nextRotation),
+		nextIn,
+		s.consecutiveErrs,
+		s.changes,
+		s.failures,
+	)
+	if s.originalMac != "" {
+		formatted += " original_mac=" + string(s.originalMac)
+	}
+	if s.paused {
+		formatted += " paused=true"
+	}
+	if s.aggressive {
+		formatted += " profile=aggressive"
+	}
+	if s.trustedNetwork.associated() {
+		formatted += fmt.Sprintf(" trusted_network=%q", s.trustedNetwork)
+	}
+	if s.ipv4 != "" {
+		formatted += " ipv4=" + s.ipv4
+	}
+	if s.ipv4Warning != "" {
+		formatted += fmt.Sprintf(" ipv4_warning=%q", s.ipv4Warning)
+	}
+	return formatted
+}
+
+// logAttrs uses the same keys as String.
+func (s status) logAttrs() []any {
+	attrs := []any{
+		"device", s.deviceName,
+		"mac", s.mac,
+		"vendor", s.vendor,
+		"last_change", s.lastChange,
+		"next_rotation", s.nextRotation,
+		"consecutive_errors", s.consecutiveErrs,
+		"changes", s.changes,
+		"failures", s.failures,
+	}
+	if s.originalMac != "" {
+		attrs = append(attrs, "original_mac", s.originalMac)
+	}
+	if s.paused {
+		attrs = append(attrs, "paused", true)
+	}
+	if s.aggressive {
+		attrs = append(attrs, "profile", "aggressive")
+	}
+	if s.trustedNetwork.associated() {
+		attrs = append(attrs, "trusted_network", s.trustedNetwork.String())
+	}
+	if s.ipv4 != "" {
+		attrs = append(attrs, "ipv4", s.ipv4)
+	}
+	if s.ipv4Warning != "" {
+		attrs = append(attrs, "ipv4_warning", s.ipv4Warning)
+	}
+	return attrs
+}
+
+// MarshalJSON uses the same keys as String.
+func (s status) MarshalJSON() ([]byte, error) {
+	optionalTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	profile := "normal"
+	if s.aggressive {
+		profile = "aggressive"
+	}
+
+	var trustedNetwork *string
+	if s.trustedNetwork.associated() {
+		formatted := s.trustedNetwork.String()
+		trustedNetwork = &formatted
+	}
+
+	return json.Marshal(struct {
+		Device            string         `json:"device"`
+		Mac               rotator.MAC    `json:"mac"`
+		OriginalMac       rotator.MAC    `json:"original_mac,omitempty"`
+		Vendor            rotator.Vendor `json:"vendor,omitempty"`
+		LastChange        *time.Time     `json:"last_change"`
+		NextRotation      *time.Time     `json:"next_rotation"`
+		ConsecutiveErrors int            `json:"consecutive_errors"`
+		Changes           int            `json:"changes"`
+		Failures          int            `json:"failures"`
+		Paused            bool           `json:"paused"`
+		Profile           string         `json:"profile"`
+		TrustedNetwork    *string        `json:"trusted_network"`
+		IPv4              string         `json:"ipv4,omitempty"`
+		IPv4Warning       string         `json:"ipv4_warning,omitempty"`
+	}{
+		s.deviceName,
+		s.mac,
+		s.originalMac,
+		s.vendor,
+		optionalTime(s.lastChange),
+		optionalTime(s.nextRotation),
+		s.consecutiveErrs,
+		s.changes,
+		s.failures,
+		s.paused,
+		profile,
+		trustedNetwork,
+		s.ipv4,
+		s.ipv4Warning,
+	})
+}
+
+func (d *daemon) statuses() []status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statuses := make([]status, 0, len(d.rotations))
+	for _, running := range d.rotations {
+		statuses = append(statuses, running.rotation.currentStatus())
+	}
+
+	slices.SortFunc(statuses, func(a, b status) int {
+		return cmp.Compare(a.deviceName, b.deviceName)
+	})
+	return statuses
+}
+
+func (d *daemon) logStatus() {
+	for _, status := range d.statuses() {
+		slog.Info("status", status.logAttrs()...)
+	}
+}
+
+// reportedStatus is a status as reported by the daemon in JSON.
+type reportedStatus struct {
+	Device            string         `json:"device"`
+	Mac               rotator.MAC    `json:"mac"`
+	OriginalMac       rotator.MAC    `json:"original_mac,omitempty"`
+	Vendor            rotator.Vendor `json:"vendor,omitempty"`
+	LastChange        time.Time      `json:"last_change"`
+	NextRotation      time.Time      `json:"next_rotation"`
+	ConsecutiveErrors int            `json:"consecutive_errors"`
+	Changes           int            `json:"changes"`
+	Failures          int            `json:"failures"`
+	Paused            bool           `json:"paused"`
+	Profile           string         `json:"profile"`
+	TrustedNetwork    string         `json:"trusted_network,omitempty"`
+	IPv4              string         `json:"ipv4,omitempty"`
+	IPv4Warning       string         `json:"ipv4_warning,omitempty"`
+}
+
+// requestStatuses asks the daemon for the statuses of the given devices, or
+// of all of them if none are given.
+func requestStatuses(socket string, deviceNames []string) ([]reportedStatus, error) {
+	lines, err := requestControl(socket, append([]string{"status", controlJSON}, deviceNames...))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]reportedStatus, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &statuses[i]); err != nil {
+			return nil, fmt.Errorf("unexpected status %q: %w", line, err)
+		}
+	}
+	return statuses, nil
+}
+
+// runStatus prints how the running daemon's devices are getting on.
+func runStatus(args []string) error {
+	flagSet := flag.NewFlagSet("status", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(flagSet.Output(), "Usage: status [-socket path] [-o text|json] [device...]")
+		flagSet.PrintDefaults()
+	}
+
+	var socket string
+	var output string
+
+	flagSet.StringVar(
+		&socket,
+		"socket",
+		defaultControlSocket,
+		"the daemon's control socket",
+	)
+	flagSet.StringVar(
+		&output,
+		"o",
+		"text",
+		"the output format: text or json",
+	)
+	flagSet.Parse(args)
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	// Pass the daemon's JSON on as it is, so that times it has no record of
+	// stay null.
+	if output == "json" {
+		lines, err := requestControl(socket, append([]string{"status", controlJSON}, flagSet.Args()...))
+		if err != nil {
+			return err
+		}
+		statuses := make([]json.RawMessage, len(lines))
+		for i, line := range lines {
+			statuses[i] = json.RawMessage(line)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	}
+
+	statuses, err := requestStatuses(socket, flagSet.Args())
+	if err != nil {
+		return err
+	}
+
+	for i, s := range statuses {
+		if 0 < i {
+			fmt.Println()
+		}
+		if err := printStatus(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printStatus(s reportedStatus) error {
+	ago := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return fmt.Sprintf("%s (%s ago)", t.Local().Format(time.DateTime), time.Since(t).Round(time.Second))
+	}
+
+	vendor := s.Vendor
+	if vendor == "" {
+		vendor = "unknown vendor"
+	}
+
+	next := "unscheduled"
+	switch {
+	case s.Paused:
+		next = "paused"
+	case !s.NextRotation.IsZero():
+		next = fmt.Sprintf("%s (in %s)", s.NextRotation.Local().Format(time.DateTime), formatCountdown(time.Until(s.NextRotation)))
+	}
+
+	var notes []string
+	if s.Profile != "normal" {
+		notes = append(notes, s.Profile+" profile")
+	}
+	if s.TrustedNetwork != "" {
+		notes = append(notes, "trusted network "+s.TrustedNetwork)
+	}
+
+	fmt.Println(s.Device)
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(out, "  MAC address:\t%s (%s)\n", s.Mac, vendor)
+	if s.OriginalMac != "" {
+		fmt.Fprintf(out, "  original MAC address:\t%s\n", s.OriginalMac)
+	}
+	if s.IPv4 != "" {
+		fmt.Fprintf(out, "  IPv4 address:\t%s\n", s.IPv4)
+	}
+	if s.IPv4Warning != "" {
+		fmt.Fprintf(out, "  IPv4 warning:\t%s\n", s.IPv4Warning)
+	}
+	fmt.Fprintf(out, "  last change:\t%s\n", ago(s.LastChange))
+	fmt.Fprintf(out, "  next rotation:\t%s\n", next)
+	fmt.Fprintf(out, "  changes:\t%d, with %d failures, %d of them in a row\n", s.Changes, s.Failures, s.ConsecutiveErrors)
+	if len(notes) != 0 {
+		fmt.Fprintf(out, "  notes:\t%s\n", strings.Join(notes, ", "))
+	}
+	return out.Flush()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultStatusBarRefreshSecs = 1
+
+// statusBarFormat is what a status bar expects a custom module's command to
+// print, a line per update.
+type statusBarFormat string
+
+const (
+	statusBarWaybar     statusBarFormat = "waybar"
+	statusBarI3StatusRs                 = "i3status-rs"
+	statusBarPolybar                    = "polybar"
+	statusBarText                       = "text"
+)
+
+func parseStatusBarFormat(value string) (statusBarFormat, error) {
+	switch format := statusBarFormat(value); format {
+	case statusBarWaybar, statusBarI3StatusRs, statusBarPolybar, statusBarText:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown status bar format %q; use waybar, i3status-rs, polybar, or text", value)
+	}
+}
+
+// The states a status bar can style differently, named as waybar's CSS
+// classes.
+const (
+	statusBarOk      = "ok"
+	statusBarPaused  = "paused"
+	statusBarFailing = "failing"
+	statusBarStopped = "stopped"
+)
+
+// waybarModule is the JSON of a waybar custom module with "return-type":
+// "json".
+type waybarModule struct {
+	Text    string `json:"text"`
+	Tooltip string `json:"tooltip"`
+	Class   string `json:"class"`
+	Alt     string `json:"alt"`
+}
+
+// i3StatusRsBlock is the JSON of an i3status-rust custom block with json =
+// true.
+type i3StatusRsBlock struct {
+	Text      string `json:"text"`
+	ShortText string `json:"short_text"`
+	State     string `json:"state"`
+}
+
+var i3StatusRsStates = map[string]string{
+	statusBarOk:      "Good",
+	statusBarPaused:  "Idle",
+	statusBarFailing: "Critical",
+	statusBarStopped: "Warning",
+}
+
+// polybarColours are the foreground colours of polybar's %{F} tags, where
+// the default is left for the usual state.
+var polybarColours = map[string]string{
+	statusBarPaused:  "#888888",
+	statusBarFailing: "#e06c75",
+	statusBarStopped: "#e5c07b",
+}
+
+// runStatusBar prints each device's address and countdown to its next
+// rotation for a status bar's custom module, updating every second so that the
+// identity in use is always in sight.
+func runStatusBar(args []string) error {
+	flagSet := flag.NewFlagSet("statusbar", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(flagSet.Output(), "Usage: statusbar [-socket path] [-format waybar|i3status-rs|polybar|text] [-once] [device...]")
+		flagSet.PrintDefaults()
+	}
+
+	var socket string
+	format := statusBarWaybar
+	var refreshSecs uint
+	var once bool
+
+	flagSet.StringVar(
+		&socket,
+		"socket",
+		defaultControlSocket,
+		"the daemon's control socket",
+	)
+	flagSet.Func(
+		"format",
+		"what to print: waybar (default) or i3status-rs JSON, polybar's formatted text, or plain text, as with i3blocks",
+		func(value string) (err error) {
+			format, err = parseStatusBarFormat(value)
+			return err
+		},
+	)
+	flagSet.UintVar(
+		&refreshSecs,
+		"refresh-secs",
+		defaultStatusBarRefreshSecs,
+		"the seconds between each update",
+	)
+	flagSet.BoolVar(
+		&once,
+		"once",
+		false,
+		"print a single update and exit, for bars that run the command on an interval",
+	)
+	flagSet.Parse(args)
+	if refreshSecs == 0 {
+		return errors.New("-refresh-secs must be at least 1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(time.Duration(refreshSecs) * time.Second)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		// A daemon that is not running yet, or is restarting, is shown as
+		// such rather than ending the module.
+		statuses, err := requestStatuses(socket, flagSet.Args())
+		line, err := formatStatusBar(format, statuses, err)
+		if err != nil {
+			return err
+		}
+		if line != last || once {
+			if _, err := fmt.Println(line); err != nil {
+				return err
+			}
+			last = line
+		}
+		if once {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func formatStatusBar(format statusBarFormat, statuses []reportedStatus, pollErr error) (string, error) {
+	state := statusBarOk
+	var texts, shortTexts, tooltips []string
+	if pollErr != nil {
+		state = statusBarStopped
+		texts = []string{"not rotating"}
+		shortTexts = texts
+		tooltips = []string{pollErr.Error()}
+	}
+	for _, s := range statuses {
+		next := "unscheduled"
+		switch {
+		case s.Paused:
+			next = "paused"
+		case s.TrustedNetwork != "":
+			next = "trusted"
+		case !s.NextRotation.IsZero():
+			next = formatCountdown(time.Until(s.NextRotation))
+		}
+
+		switch {
+		case 0 < s.ConsecutiveErrors:
+			state = statusBarFailing
+		case s.Paused && state == statusBarOk:
+			state = statusBarPaused
+		}
+
+		vendor := string(s.Vendor)
+		if vendor == "" {
+			vendor = "unknown"
+		}
+		tooltip := fmt.Sprintf("%s: %s (%s), next rotation: %s", s.Device, s.Mac, vendor, next)
+		if 0 < s.ConsecutiveErrors {
+			tooltip += fmt.Sprintf(", %d failed in a row", s.ConsecutiveErrors)
+		}
+
+		texts = append(texts, fmt.Sprintf("%s %s %s", s.Device, s.Mac, next))
+		shortTexts = append(shortTexts, fmt.Sprintf("%s %s", s.Device, next))
+		tooltips = append(tooltips, tooltip)
+	}
+	text := strings.Join(texts, "  ")
+
+	switch format {
+	case statusBarWaybar:
+		encoded, err := json.Marshal(waybarModule{
+			Text:    text,
+			Tooltip: strings.Join(tooltips, "\n"),
+			Class:   state,
+			Alt:     state,
+		})
+		return string(encoded), err
+	case statusBarI3StatusRs:
+		encoded, err := json.Marshal(i3StatusRsBlock{
+			Text:      text,
+			ShortText: strings.Join(shortTexts, "  "),
+			State:     i3StatusRsStates[state],
+		})
+		return string(encoded), err
+	case statusBarPolybar:
+		if colour, ok := polybarColours[state]; ok {
+			text = "%{F" + colour + "}" + text + "%{F-}"
+		}
+		return text, nil
+	default:
+		return text, nil
+	}
+}
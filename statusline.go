@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	statusLineInterval     = time.Second
+	statusLineSeparator    = " | "
+	defaultStatusLineWidth = 80
+
+	ansiClearLine = "\r\x1b[K"
+)
+
+// liveStatus, if set, keeps a line at the bottom of the terminal counting
+// down to each device's next rotation, so that the long quiet between log
+// lines does not look like a hang.
+var liveStatus *statusLine
+
+// statusLine is where the log goes while the line is drawn, clearing the line
+// for each record and drawing it again beneath.
+type statusLine struct {
+	mu     sync.Mutex
+	out    io.Writer
+	colour bool
+	width  int
+	line   string
+}
+
+// setUpStatusLine gives where to log, which is through the status line when
+// running in the foreground with the log and nothing else on a terminal.
+func setUpStatusLine(flags flags) io.Writer {
+	switch {
+	case !flags.statusLine, flags.daemon, flags.logFile != "", flags.output != outputNone:
+	case flags.logTarget != "" && flags.logTarget != "stderr":
+	case !isTerminal(os.Stderr), os.Getenv("TERM") == "dumb":
+	default:
+		liveStatus = &statusLine{
+			out:    os.Stderr,
+			colour: os.Getenv("NO_COLOR") == "",
+			width:  terminalWidth(),
+		}
+		return liveStatus
+	}
+	return os.Stderr
+}
+
+// terminalWidth is taken from $COLUMNS, as the standard library cannot ask
+// the terminal itself.
+func terminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && 0 < width {
+		return width
+	}
+	return defaultStatusLineWidth
+}
+
+func (s *statusLine) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.line != "" {
+		io.WriteString(s.out, ansiClearLine)
+	}
+	n, err := s.out.Write(p)
+	if s.line != "" {
+		io.WriteString(s.out, s.line)
+	}
+	return n, err
+}
+
+func (s *statusLine) draw(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.line = line
+	io.WriteString(s.out, ansiClearLine+line)
+}
+
+// serveStatusLine redraws the line every second until ctx ends, when it is
+// cleared, which the returned channel is closed after.
+func serveStatusLine(ctx context.Context, d *daemon, s *statusLine) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer s.draw("")
+
+		ticker := time.NewTicker(statusLineInterval)
+		defer ticker.Stop()
+
+		for {
+			s.draw(s.render(d.statuses()))
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return done
+}
+
+// render describes each device in as many as fit in the terminal's width,
+// red while failing and dimmed while paused or on a trusted network.
+func (s *statusLine) render(statuses []status) string {
+	// Some terminals wrap on writing to the last column, so it is left free.
+	room := s.width - 1
+
+	var line strings.Builder
+	for i, status := range statuses {
+		vendor := string(status.vendor)
+		if vendor == "" {
+			vendor = "unknown"
+		}
+
+		next := "unscheduled"
+		switch {
+		case status.paused:
+			next = "paused"
+		case status.trustedNetwork.associated():
+			next = "on a trusted network"
+		case !status.nextRotation.IsZero():
+			next = "next in " + formatCountdown(time.Until(status.nextRotation))
+		}
+
+		details := fmt.Sprintf(" %s %s, %s", orDash(string(status.mac)), vendor, next)
+		if 0 < status.consecutiveErrs {
+			details += fmt.Sprintf(", %d failed", status.consecutiveErrs)
+		}
+
+		separator := ""
+		if i != 0 {
+			separator = statusLineSeparator
+		}
+		more := ""
+		if i+1 < len(statuses) {
+			more = fmt.Sprintf("%s+%d more", statusLineSeparator, len(statuses)-i-1)
+		}
+		length := len(separator) + len(status.deviceName) + len(details)
+		if room < length+len(more) {
+			if i != 0 {
+				fmt.Fprintf(&line, "%s+%d more", statusLineSeparator, len(statuses)-i)
+				break
+			}
+			details = details[:max(0, min(len(details), room-len(status.deviceName)))]
+		}
+		room -= length
+
+		switch {
+		case !s.colour:
+			line.WriteString(separator + status.deviceName + details)
+		case 0 < status.consecutiveErrs:
+			line.WriteString(separator + ansiRed + status.deviceName + details + ansiReset)
+		case status.paused, status.trustedNetwork.associated():
+			line.WriteString(separator + ansiDim + status.deviceName + details + ansiReset)
+		default:
+			line.WriteString(separator + ansiBold + status.deviceName + ansiReset + details)
+		}
+	}
+	return line.String()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// sessionSummary tallies what the daemon did while it ran, for logging as it
+// stops, which gives an idea of its health from the logs alone.
+type sessionSummary struct {
+	mu      sync.Mutex
+	started time.Time
+	devices map[string]*deviceSummary
+}
+
+type deviceSummary struct {
+	rotations  int
+	failures   int
+	vendors    map[rotator.Vendor]int
+	lastChange time.Time
+	longestGap time.Duration
+}
+
+// serveSummary tallies every change from now on.
+func serveSummary(ctx context.Context, d *daemon) *sessionSummary {
+	summary := &sessionSummary{started: time.Now(), devices: make(map[string]*deviceSummary)}
+	entries, unsubscribe := d.history.subscribe()
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry := <-entries:
+				summary.add(entry)
+			}
+		}
+	}()
+	return summary
+}
+
+func (summary *sessionSummary) add(entry historyEntry) {
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+
+	device, ok := summary.devices[entry.Device]
+	if !ok {
+		device = &deviceSummary{vendors: make(map[rotator.Vendor]int)}
+		summary.devices[entry.Device] = device
+	}
+	if entry.Error != "" {
+		device.failures++
+		return
+	}
+
+	device.rotations++
+	if entry.Vendor != "" {
+		device.vendors[entry.Vendor]++
+	}
+	if !device.lastChange.IsZero() {
+		device.longestGap = max(device.longestGap, entry.At.Sub(device.lastChange))
+	}
+	device.lastChange = entry.At
+}
+
+// log writes the summary, a line for the whole session and one for each
+// device that was changed or failed to be.
+func (summary *sessionSummary) log() {
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+
+	rotations, failures := 0, 0
+	for _, device := range summary.devices {
+		rotations += device.rotations
+		failures += device.failures
+	}
+	slog.Info(
+		"summary of the session",
+		"uptime", time.Since(summary.started).Round(time.Second),
+		"rotations", rotations,
+		"failures", failures,
+	)
+
+	for _, name := range slices.Sorted(maps.Keys(summary.devices)) {
+		device := summary.devices[name]
+		attrs := []any{
+			"device", name,
+			"rotations", device.rotations,
+			"failures", device.failures,
+			"vendors", orDash(formatVendorCounts(device.vendors)),
+		}
+		if device.longestGap != 0 {
+			attrs = append(attrs, "longest_gap", device.longestGap.Round(time.Second))
+		}
+		slog.Info("summary of the device's session", attrs...)
+	}
+}
+
+// formatVendorCounts lists the vendors most used first, as Intel:3,Realtek:1.
+func formatVendorCounts(counts map[rotator.Vendor]int) string {
+	vendors := slices.Collect(maps.Keys(counts))
+	slices.SortFunc(vendors, func(a, b rotator.Vendor) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+
+	formatted := make([]string, len(vendors))
+	for i, vendor := range vendors {
+		formatted[i] = fmt.Sprintf("%s:%d", vendor, counts[vendor])
+	}
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	syslogFacilityDaemon = 3
+	syslogTimeout        = 10 * time.Second
+	syslogAppName        = "rotate-mac-address"
+)
+
+// localSyslogSockets are where syslog daemons listen on Linux, macOS, and the
+// BSDs respectively.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// The syslog severities that each log level maps to.
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case slog.LevelError <= level:
+		return 3
+	case slog.LevelWarn <= level:
+		return 4
+	case slog.LevelInfo <= level:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// syslogSink sends each message written to it to a syslog daemon: the local
+// one for syslog:// or syslog:///path/to/socket, or a remote one over UDP for
+// syslog://host, TCP for syslog+tcp://host, or TLS for syslog+tls://host.
+// Remote messages are framed as RFC 5424, counting octets over streams as RFC
+// 5425 does; local ones use the older format that every local daemon
+// understands.
+type syslogSink struct {
+	target *url.URL
+
+	mu       sync.Mutex
+	conn     net.Conn
+	severity int
+	hostname string
+}
+
+func newSyslogSink(target *url.URL) (*syslogSink, error) {
+	switch target.Scheme {
+	case "syslog":
+	case "syslog+tcp", "syslog+tls":
+		if target.Hostname() == "" {
+			return nil, fmt.Errorf("%s needs a host", target.Scheme)
+		}
+	default:
+		return nil, fmt.Errorf("unknown log target %q", target)
+	}
+
+	hostname, _ := os.Hostname()
+	sink := &syslogSink{target: target, hostname: hostname}
+
+	// Fail up front if the daemon cannot be reached at all.
+	if err := sink.dial(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *syslogSink) local() bool {
+	return sink.target.Scheme == "syslog" && sink.target.Host == ""
+}
+
+func (sink *syslogSink) stream() bool {
+	return sink.target.Scheme != "syslog"
+}
+
+func (sink *syslogSink) dial() error {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+
+	if sink.local() {
+		paths := localSyslogSockets
+		if sink.target.Path != "" {
+			paths = []string{sink.target.Path}
+		}
+
+		var errs []error
+		for _, path := range paths {
+			for _, network := range []string{"unixgram", "unix"} {
+				conn, err := dialer.Dial(network, path)
+				if err == nil {
+					sink.conn = conn
+					return nil
+				}
+				errs = append(errs, err)
+			}
+		}
+		return fmt.Errorf("could not reach the local syslog daemon: %w", errors.Join(errs...))
+	}
+
+	network, port := "udp", "514"
+	switch sink.target.Scheme {
+	case "syslog+tcp":
+		network = "tcp"
+	case "syslog+tls":
+		network, port = "tcp", "6514"
+	}
+	if sink.target.Port() != "" {
+		port = sink.target.Port()
+	}
+	address := net.JoinHostPort(sink.target.Hostname(), port)
+
+	var conn net.Conn
+	var err error
+	if sink.target.Scheme == "syslog+tls" {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    &tls.Config{ServerName: sink.target.Hostname()},
+		}
+		conn, err = tlsDialer.DialContext(context.Background(), network, address)
+	} else {
+		conn, err = dialer.Dial(network, address)
+	}
+	if err != nil {
+		return fmt.Errorf("could not reach the syslog daemon at %s: %w", address, err)
+	}
+	sink.conn = conn
+	return nil
+}
+
+// Write sends a single message, at the severity set by the handler beforehand.
+func (sink *syslogSink) Write(p []byte) (int, error) {
+	msg := sink.format(p)
+
+	// Reconnect once, in case the daemon restarted.
+	for attempt := 0; ; attempt++ {
+		if sink.conn == nil {
+			if err := sink.dial(); err != nil {
+				return 0, err
+			}
+		}
+		sink.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err := sink.conn.Write(msg); err == nil {
+			return len(p), nil
+		} else if 0 < attempt {
+			return 0, err
+		}
+		sink.conn.Close()
+		sink.conn = nil
+	}
+}
+
+func (sink *syslogSink) format(p []byte) []byte {
+	p = trimNewline(p)
+	priority := syslogFacilityDaemon*8 + sink.severity
+	now := time.Now()
+
+	if sink.local() {
+		return fmt.Appendf(nil, "<%d>%s %s[%d]: %s", priority, now.Format(time.Stamp), syslogAppName, os.Getpid(), p)
+	}
+
+	msg := fmt.Appendf(
+		nil,
+		"<%d>1 %s %s %s %d - - %s",
+		priority,
+		now.Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(sink.hostname),
+		syslogAppName,
+		os.Getpid(),
+		p,
+	)
+	if sink.stream() {
+		msg = append(fmt.Appendf(nil, "%d ", len(msg)), msg...)
+	}
+	return msg
+}
+
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func trimNewline(p []byte) []byte {
+	if 0 < len(p) && p[len(p)-1] == '\n' {
+		return p[:len(p)-1]
+	}
+	return p
+}
+
+// syslogHandler formats records with another handler, then passes them on to
+// the sink at the severity of their level.
+type syslogHandler struct {
+	inner slog.Handler
+	sink  *syslogSink
+}
+
+func newSyslogHandler(sink *syslogSink, newHandler func(io.Writer, *slog.HandlerOptions) slog.Handler, options *slog.HandlerOptions) slog.Handler {
+	// The syslog header already carries the time.
+	withoutTime := *options
+	withoutTime.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+		if len(groups) == 0 && attr.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return attr
+	}
+	return &syslogHandler{newHandler(sink, &withoutTime), sink}
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+
+	h.sink.severity = syslogSeverity(record.Level)
+	err := h.inner.Handle(ctx, record)
+	if err != nil {
+		// There is nowhere better left to report it.
+		fmt.Fprintf(os.Stderr, "could not log to syslog: %s\n", err)
+	}
+	return err
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{h.inner.WithAttrs(attrs), h.sink}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{h.inner.WithGroup(name), h.sink}
+}
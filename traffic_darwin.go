@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// readTraffic parses the link-level row of netstat's interface statistics,
+// whose columns are Name, Mtu, Network, Address, Ipkts, Ierrs, Ibytes, Opkts,
+// Oerrs, Obytes, and Coll.
+func readTraffic(deviceName string) (traffic, error) {
+	out, err := exec.Command("netstat", "-ibn", "-I", deviceName).Output()
+	if err != nil {
+		return traffic{}, err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[0] != deviceName || !strings.HasPrefix(fields[2], "<Link#") {
+			continue
+		}
+
+		var t traffic
+		values := []*uint64{&t.rxPackets, nil, &t.rxBytes, &t.txPackets, nil, &t.txBytes}
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			if *value, err = strconv.ParseUint(fields[4+i], 10, 64); err != nil {
+				return traffic{}, err
+			}
+		}
+		return t, nil
+	}
+	return traffic{}, fmt.Errorf("netstat reported no statistics for %s", deviceName)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func readTraffic(deviceName string) (traffic, error) {
+	dir := filepath.Join("/sys/class/net", deviceName, "statistics")
+
+	var t traffic
+	counters := []struct {
+		name  string
+		value *uint64
+	}{
+		{"rx_bytes", &t.rxBytes},
+		{"tx_bytes", &t.txBytes},
+		{"rx_packets", &t.rxPackets},
+		{"tx_packets", &t.txPackets},
+	}
+
+	for _, counter := range counters {
+		data, err := os.ReadFile(filepath.Join(dir, counter.name))
+		if err != nil {
+			return traffic{}, err
+		}
+		*counter.value, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return traffic{}, err
+		}
+	}
+	return t, nil
+}
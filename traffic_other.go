@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func readTraffic(string) (traffic, error) {
+	return traffic{}, errors.New("traffic statistics cannot be read on this platform")
+}
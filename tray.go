@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultTrayRefreshSecs = 5
+
+// trayAction is a menu item of the tray, sending a request to the daemon.
+type trayAction struct {
+	label string
+	words []string
+}
+
+var trayActions = []trayAction{
+	{"Rotate Now", []string{"rotate"}},
+	{"Pause", []string{"pause"}},
+	{"Resume", []string{"resume"}},
+	{"Restore", []string{"restore"}},
+}
+
+// trayOptions are what each platform's tray needs to show the daemon and
+// send it requests.
+type trayOptions struct {
+	socket     string
+	refresh    time.Duration
+	executable string
+	pluginDir  string
+}
+
+// ctlArgs gives the arguments for the executable's ctl command to send the
+// daemon a request, for menu items to run.
+func (options trayOptions) ctlArgs(words []string) []string {
+	return append([]string{"ctl", "-socket", options.socket}, words...)
+}
+
+// runTray shows the running daemon's devices from the desktop with a menu to
+// rotate, pause, resume, or restore them, for those who never open a terminal.
+// The daemon runs as root, and the tray as the user, talking to it over the
+// control socket.
+func runTray(args []string) error {
+	flagSet := flag.NewFlagSet("tray", flag.ExitOnError)
+
+	var options trayOptions
+	var refreshSecs uint
+
+	flagSet.StringVar(
+		&options.socket,
+		"socket",
+		defaultControlSocket,
+		"the daemon's control socket",
+	)
+	flagSet.UintVar(
+		&refreshSecs,
+		"refresh-secs",
+		defaultTrayRefreshSecs,
+		"the seconds between each poll of the daemon",
+	)
+	flagSet.StringVar(
+		&options.pluginDir,
+		"install-plugin",
+		"",
+		"on macOS, write a SwiftBar or xbar plugin running the tray into this plugin directory",
+	)
+	flagSet.Parse(args)
+	if refreshSecs == 0 {
+		return errors.New("-refresh-secs must be at least 1")
+	}
+	options.refresh = time.Duration(refreshSecs) * time.Second
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find this executable for the menu to run: %w", err)
+	}
+	options.executable = executable
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return runTrayApp(ctx, options)
+}
+
+// trayTitle sums up the devices in a line, with a line of detail each for a
+// tooltip or menu.
+func trayTitle(statuses []reportedStatus, pollErr error) (string, []string) {
+	if pollErr != nil {
+		return "not rotating", []string{pollErr.Error()}
+	}
+
+	var titles, details []string
+	for _, s := range statuses {
+		next := "unscheduled"
+		switch {
+		case s.Paused:
+			next = "paused"
+		case s.TrustedNetwork != "":
+			next = "on a trusted network"
+		case !s.NextRotation.IsZero():
+			next = "next in " + formatCountdown(time.Until(s.NextRotation))
+		}
+
+		vendor := string(s.Vendor)
+		if vendor == "" {
+			vendor = "unknown"
+		}
+		detail := fmt.Sprintf("%s: %s (%s), %s", s.Device, s.Mac, vendor, next)
+		if 0 < s.ConsecutiveErrors {
+			detail += fmt.Sprintf(", %d failed in a row", s.ConsecutiveErrors)
+		}
+
+		titles = append(titles, fmt.Sprintf("%s %s", s.Mac, strings.TrimPrefix(next, "next in ")))
+		details = append(details, detail)
+	}
+	return strings.Join(titles, "  "), details
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runTrayApp prints the menu of a SwiftBar or xbar plugin, which is how a
+// menu bar item can be had without Cocoa; they run it again on each refresh.
+// With -install-plugin, it writes that plugin instead.
+func runTrayApp(_ context.Context, options trayOptions) error {
+	if options.pluginDir != "" {
+		return installTrayPlugin(options)
+	}
+	if os.Getenv("SWIFTBAR") == "" && os.Getenv("XBARDarkMode") == "" {
+		return errors.New(`on macOS, the tray runs as a SwiftBar or xbar plugin; write one with -install-plugin "$HOME/Library/Application Support/SwiftBar/Plugins"`)
+	}
+
+	statuses, err := requestStatuses(options.socket, nil)
+	title, details := trayTitle(statuses, err)
+	fmt.Println(title)
+	fmt.Println("---")
+	for _, detail := range details {
+		fmt.Println(detail)
+	}
+	if err != nil {
+		return nil
+	}
+
+	fmt.Println("---")
+	for _, action := range trayActions {
+		params := []string{"bash=" + strconv.Quote(options.executable)}
+		for i, arg := range options.ctlArgs(action.words) {
+			params = append(params, fmt.Sprintf("param%d=%s", i+1, strconv.Quote(arg)))
+		}
+		fmt.Printf("%s | %s terminal=false refresh=true\n", action.label, strings.Join(params, " "))
+	}
+	return nil
+}
+
+// installTrayPlugin writes a plugin running the tray, named so that SwiftBar
+// and xbar refresh it every -refresh-secs.
+func installTrayPlugin(options trayOptions) error {
+	name := fmt.Sprintf("rotate-mac-address.%ds.sh", int(options.refresh.Seconds()))
+	path := filepath.Join(options.pluginDir, name)
+	script := fmt.Sprintf("#!/bin/sh\nexec %s tray -socket %s\n", shellQuote(options.executable), shellQuote(options.socket))
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		return err
+	}
+	fmt.Println("wrote", path)
+	return nil
+}
@@ -0,0 +1,90 @@
+//go:build !darwin
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runTrayApp shows an icon with yad, which takes the icon, tooltip, and menu
+// to show on its stdin, as the standard library has no tray of its own.
+func runTrayApp(ctx context.Context, options trayOptions) error {
+	if options.pluginDir != "" {
+		return errors.New("-install-plugin is only for macOS")
+	}
+	if isWindows() {
+		return errors.New("the tray is not supported on Windows")
+	}
+	if _, err := exec.LookPath("yad"); err != nil {
+		return errors.New("the tray needs yad, which most distributions package, to show its icon")
+	}
+
+	// Clicking the icon opens the menu too, rather than quitting.
+	cmd := exec.Command("yad", "--notification", "--listen", "--command=menu", "--image=network-wireless", "--text=rotate-mac-address")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start yad: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	var items []string
+	for _, action := range trayActions {
+		words := []string{shellQuote(options.executable)}
+		for _, arg := range options.ctlArgs(action.words) {
+			words = append(words, shellQuote(arg))
+		}
+		items = append(items, action.label+"!"+strings.Join(words, " "))
+	}
+	items = append(items, "Quit!quit")
+	fmt.Fprintf(stdin, "menu:%s\n", strings.Join(items, "|"))
+
+	ticker := time.NewTicker(options.refresh)
+	defer ticker.Stop()
+
+	for {
+		updateTray(stdin, options.socket)
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(stdin, "quit")
+			stdin.Close()
+			<-exited
+			return nil
+		case err := <-exited:
+			// Quitting from the menu ends the tray.
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+func updateTray(stdin io.Writer, socket string) {
+	statuses, err := requestStatuses(socket, nil)
+	title, details := trayTitle(statuses, err)
+
+	icon := "network-wireless"
+	if err != nil {
+		icon = "network-offline"
+	}
+	for _, s := range statuses {
+		if 0 < s.ConsecutiveErrors {
+			icon = "network-error"
+		}
+	}
+
+	// Each command takes a line, so the details share one.
+	fmt.Fprintf(stdin, "icon:%s\n", icon)
+	fmt.Fprintf(stdin, "tooltip:%s\n", strings.Join(append([]string{title}, details...), "; "))
+}
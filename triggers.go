@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// A trigger watches for some event and requests early rotations of the
+// devices it concerns, until its context is cancelled. It either watches on
+// behalf of the whole daemon or runs once for each device.
+type trigger struct {
+	name        string
+	enabled     func(flags flags) bool
+	watch       func(ctx context.Context, d *daemon) error
+	watchDevice func(ctx context.Context, d *daemon, r *rotation) error
+}
+
+var triggers = []trigger{
+	{
+		name:    "link",
+		enabled: func(flags flags) bool { return flags.rotateOnLinkDown },
+		watch:   watchLinkTrigger,
+	},
+	{
+		name:    "wake",
+		enabled: func(flags flags) bool { return flags.rotateOnWake },
+		watch:   watchWakeTrigger,
+	},
+	{
+		name:        "network",
+		enabled:     func(flags flags) bool { return flags.rotateOnNetworkChange },
+		watchDevice: watchNetworkTrigger,
+	},
+	{
+		name:        "association",
+		enabled:     func(flags flags) bool { return flags.rotatePerAssociation },
+		watchDevice: watchAssociationTrigger,
+	},
+	{
+		name:        "trust",
+		enabled:     func(flags flags) bool { return flags.hasTrustedNetworks() },
+		watchDevice: watchTrustTrigger,
+	},
+	{
+		name:        "profile",
+		enabled:     func(flags flags) bool { return flags.aggressiveWhen != aggressiveNever },
+		watchDevice: watchProfileTrigger,
+	},
+	{
+		name:        "netprofile",
+		enabled:     func(flags flags) bool { return len(flags.networkProfiles) != 0 },
+		watchDevice: watchNetworkProfileTrigger,
+	},
+	{
+		name:        "traffic",
+		enabled:     func(flags flags) bool { return flags.rotateAfterBytes != 0 || flags.rotateAfterPackets != 0 },
+		watchDevice: watchTrafficTrigger,
+	},
+	// Macvlan children go missing each time they are replaced.
+	{
+		name:        "device",
+		enabled:     func(flags flags) bool { return flags.missingDevice == missingDeviceWait && !flags.macvlan },
+		watchDevice: watchDeviceTrigger,
+	},
+}
+
+// startTriggers starts any newly enabled triggers, and must be called with
+// the lock held. Triggers keep running once started, so they should check the
+// current flags again whenever they fire in case they have since been turned
+// off by a reload.
+func (d *daemon) startTriggers(ctx context.Context) {
+	for _, trigger := range triggers {
+		if !trigger.enabled(d.flags) {
+			continue
+		}
+
+		if trigger.watchDevice == nil {
+			if !d.startedTriggers[trigger.name] {
+				d.startedTriggers[trigger.name] = true
+				d.goTrigger(ctx, trigger.name, func(ctx context.Context) error {
+					return trigger.watch(ctx, d)
+				})
+			}
+			continue
+		}
+
+		for deviceName, running := range d.rotations {
+			if !running.startedTriggers[trigger.name] {
+				running.startedTriggers[trigger.name] = true
+				d.goTrigger(running.ctx, deviceName+" "+trigger.name, func(ctx context.Context) error {
+					return trigger.watchDevice(ctx, d, running.rotation)
+				})
+			}
+		}
+	}
+}
+
+func (d *daemon) goTrigger(ctx context.Context, name string, watch func(context.Context) error) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		err := watch(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("a trigger stopped", "trigger", name, "err", err)
+		}
+	}()
+}
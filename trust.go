@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// trusts reports whether rotation should be suspended on the network, which is
+// matched by either its SSID or its BSSID.
+func (flags flags) trusts(n network) bool {
+	if !n.associated() {
+		return false
+	}
+	if trust := flags.networkTrustOf(n); trust != trustUnset {
+		return trust == trustTrusted
+	}
+
+	for _, trusted := range flags.trustedNetworks {
+		if trusted == n.ssid || (n.bssid != "" && strings.EqualFold(trusted, n.bssid)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchTrustTrigger suspends the rotation of a device while it is on one of
+// the trusted networks, where the device wears its permanent address instead.
+// Trust lasts until the device associates with some other network, rather
+// than ending with every brief disassociation.
+func watchTrustTrigger(ctx context.Context, d *daemon, r *rotation) error {
+	return watchNetworks(ctx, r.deviceName, func(current network) {
+		if !current.associated() {
+			return
+		}
+
+		if d.currentFlags().trusts(current) {
+			if r.trust(current) {
+				r.logger.Info("suspending rotation while on a trusted network", "network", current)
+				r.wake()
+			}
+		} else if r.trust(network{}) {
+			r.requestRotation("it left the trusted networks for " + current.String())
+		}
+	})
+}
+
+// trust marks the device as on a trusted network, or clears it with an empty
+// network, and reports whether that changed anything.
+func (r *rotation) trust(n network) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := r.status.trustedNetwork.associated() != n.associated()
+	r.status.trustedNetwork = n
+	return changed
+}
+
+func (r *rotation) trustedNetwork() (network, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status.trustedNetwork, r.status.trustedNetwork.associated()
+}
+
+// restorePermanentMac puts the hardware's own address back, for networks that
+// know the device by it.
+func (r *rotation) restorePermanentMac(ctx context.Context, settings settings) error {
+	mac, err := permanentMac(r.deviceName)
+	if err != nil {
+		return err
+	}
+
+	previous, _ := rotator.CurrentMAC(r.deviceName)
+	err = r.setter(settings).Apply(ctx, r.logger, r.deviceName, mac)
+	r.audit.recordRestore(r.deviceName, previous, mac, "it is on a trusted network", err)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.status.mac = mac
+	r.status.vendor = ""
+	r.mu.Unlock()
+
+	r.logger.Info("restored the MAC address", "target", restorePermanent, "new_mac", mac)
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultTUIRefreshSecs = 5
+	tuiHistoryLines       = 10
+)
+
+// The escapes for VT100-style terminals that the TUI draws with.
+const (
+	ansiAlternateScreen = "\x1b[?1049h"
+	ansiMainScreen      = "\x1b[?1049l"
+	ansiHideCursor      = "\x1b[?25l"
+	ansiShowCursor      = "\x1b[?25h"
+	ansiClear           = "\x1b[H\x1b[2J"
+	ansiBold            = "\x1b[1m"
+	ansiReset           = "\x1b[0m"
+)
+
+// The colours starting table rows are all the same length, so that they
+// throw each row's alignment out by the same amount.
+const (
+	ansiPlain = "\x1b[39m"
+	ansiRed   = "\x1b[31m"
+	ansiDim   = "\x1b[02m"
+)
+
+// runTUI shows a live table of the running daemon's devices and their recent
+// changes, polled from its control socket, until interrupted.
+func runTUI(args []string) error {
+	flagSet := flag.NewFlagSet("tui", flag.ExitOnError)
+
+	var socket string
+	var refreshSecs uint
+
+	flagSet.StringVar(
+		&socket,
+		"socket",
+		defaultControlSocket,
+		"the daemon's control socket",
+	)
+	flagSet.UintVar(
+		&refreshSecs,
+		"refresh-secs",
+		defaultTUIRefreshSecs,
+		"the seconds between each poll of the daemon; countdowns tick in between",
+	)
+	flagSet.Parse(args)
+	if refreshSecs == 0 {
+		return errors.New("-refresh-secs must be at least 1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Print(ansiAlternateScreen + ansiHideCursor)
+	defer fmt.Print(ansiShowCursor + ansiMainScreen)
+
+	// Check the daemon can be reached before taking over the screen for long.
+	statuses, entries, err := pollDaemon(socket)
+	if err != nil {
+		return err
+	}
+	polled := time.Now()
+
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	var pollErr error
+	for {
+		if time.Duration(refreshSecs)*time.Second <= time.Since(polled) {
+			polled = time.Now()
+			if statuses, entries, pollErr = pollDaemon(socket); pollErr != nil {
+				statuses, entries = nil, nil
+			}
+		}
+
+		var screen strings.Builder
+		drawTUI(&screen, statuses, entries, pollErr)
+		fmt.Print(ansiClear + screen.String())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func pollDaemon(socket string) ([]reportedStatus, []historyEntry, error) {
+	statuses, err := requestStatuses(socket, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines, err := requestControl(socket, []string{"history", controlJSON})
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := make([]historyEntry, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			return nil, nil, fmt.Errorf("unexpected history entry %q: %w", line, err)
+		}
+	}
+	return statuses, entries, nil
+}
+
+func drawTUI(out io.Writer, statuses []reportedStatus, entries []historyEntry, pollErr error) {
+	fmt.Fprintf(out, "%srotate-mac-address%s  %s  (Ctrl-C to quit)\n\n", ansiBold, ansiReset, time.Now().Format(time.TimeOnly))
+	if pollErr != nil {
+		fmt.Fprintf(out, "%s%s%s\n\n", ansiRed, pollErr, ansiReset)
+	}
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, ansiPlain+"DEVICE\tMAC\tVENDOR\tNEXT\tERRORS\tPROFILE")
+	for _, s := range statuses {
+		next := "unscheduled"
+		if s.Paused {
+			next = "paused"
+		} else if !s.NextRotation.IsZero() {
+			next = formatCountdown(time.Until(s.NextRotation))
+		}
+
+		vendor := s.Vendor
+		if vendor == "" {
+			vendor = "unknown"
+		}
+
+		profile := s.Profile
+		if s.TrustedNetwork != "" {
+			profile = "trusted " + s.TrustedNetwork
+		}
+
+		colour := ansiPlain
+		if 0 < s.ConsecutiveErrors {
+			colour = ansiRed
+		} else if s.Paused {
+			colour = ansiDim
+		}
+		fmt.Fprintf(table, "%s%s\t%s\t%s\t%s\t%d\t%s%s\n", colour, s.Device, s.Mac, vendor, next, s.ConsecutiveErrors, profile, ansiReset)
+	}
+	table.Flush()
+
+	fmt.Fprintf(out, "\n%sRecent changes%s\n", ansiBold, ansiReset)
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "none yet")
+	}
+	recent := slices.Clone(entries[max(0, len(entries)-tuiHistoryLines):])
+	slices.Reverse(recent)
+
+	table = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, entry := range recent {
+		if entry.Error != "" {
+			fmt.Fprintf(table, "%s%s\t%s\t%s%s\n", ansiRed, entry.At.Local().Format(time.DateTime), entry.Device, entry.Error, ansiReset)
+		} else {
+			fmt.Fprintf(table, "%s%s\t%s\t%s\t%s\n", ansiPlain, entry.At.Local().Format(time.DateTime), entry.Device, entry.Mac, entry.Vendor)
+		}
+	}
+	table.Flush()
+}
+
+func formatCountdown(d time.Duration) string {
+	d = max(0, d).Round(time.Second)
+	if time.Hour <= d {
+		return fmt.Sprintf("%dh%02dm%02ds", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
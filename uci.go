@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// setBackend picks how addresses are set: directly with ip or ifconfig, on
+// OpenWrt through UCI, so that netifd applies them rather than putting back
+// its own whenever it brings an interface up, or around ConnMan, so that it
+// is not reconnecting as they change.
+type setBackend string
+
+const (
+	backendAuto    setBackend = "auto"
+	backendDirect             = "direct"
+	backendUCI                = "uci"
+	backendConnMan            = "connman"
+)
+
+func parseSetBackend(value string) (setBackend, error) {
+	switch backend := setBackend(value); backend {
+	case backendAuto, backendDirect, backendUCI, backendConnMan:
+		return backend, nil
+	default:
+		return "", fmt.Errorf("unknown backend %q", value)
+	}
+}
+
+// openwrtRelease is only found on OpenWrt.
+const openwrtRelease = "/etc/openwrt_release"
+
+// uciWaitSecs is how long netifd is given to apply an address after reloading.
+const uciWaitSecs = 10
+
+// resolve settles auto on UCI on OpenWrt, on ConnMan where it is running, and
+// on setting addresses directly everywhere else.
+func (backend setBackend) resolve() setBackend {
+	if backend != backendAuto {
+		return backend
+	}
+	if _, err := os.Stat(openwrtRelease); err == nil {
+		if _, err := exec.LookPath("uci"); err == nil {
+			return backendUCI
+		}
+	}
+	if connmanRunning() {
+		return backendConnMan
+	}
+	return backendDirect
+}
+
+// uciSection finds the section of /etc/config/network configuring the device:
+// its device section since OpenWrt 21.02, the interface section naming it
+// before then, or the interface section of that name, such as wan. Without
+// any, it names a device section to add.
+func uciSection(deviceName string) (string, bool) {
+	output, _ := exec.Command("uci", "-q", "show", "network").Output()
+
+	types := make(map[string]string)
+	var byDevice, byInterface string
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "network."), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, "'")
+		section, option, isOption := strings.Cut(key, ".")
+		switch {
+		case !isOption:
+			types[section] = value
+		case value != deviceName:
+		case option == "name" && types[section] == "device" && byDevice == "":
+			byDevice = section
+		case (option == "device" || option == "ifname") && types[section] == "interface" && byInterface == "":
+			byInterface = section
+		}
+	}
+
+	switch {
+	case byDevice != "":
+		return byDevice, true
+	case byInterface != "":
+		return byInterface, true
+	case types[deviceName] == "interface":
+		return deviceName, true
+	}
+
+	// UCI section names are limited to letters, digits, and underscores.
+	name := strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, deviceName)
+	return "rotate_mac_" + name, false
+}
+
+// setMacUCI sets the device's macaddr in UCI, and has netifd apply it,
+// waiting until it has.
+func setMacUCI(deviceName string, mac rotator.MAC) (string, []string) {
+	section, exists := uciSection(deviceName)
+	key := "network." + section
+
+	script := []string{"set -e"}
+	if !exists {
+		script = append(script, "uci set "+key+"=device", "uci set "+key+".name="+shellQuote(deviceName))
+	}
+	script = append(
+		script,
+		"uci set "+key+".macaddr="+string(mac),
+		"uci commit network",
+		"ubus call network reload",
+		fmt.Sprintf(
+			"for i in $(seq %d); do grep -qix %s /sys/class/net/%s/address && exit 0; sleep 1; done",
+			uciWaitSecs,
+			string(mac),
+			shellQuote(deviceName),
+		),
+		"echo 'netifd did not apply the address' >&2",
+		"exit 1",
+	)
+	return "sh", []string{"-c", strings.Join(script, "\n")}
+}
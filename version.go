@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// These are set when building releases, with:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Otherwise, they are filled in from the build information that Go embeds.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && embedded.Main.Version != "(devel)" {
+			info.Version = embedded.Main.Version
+		}
+		for _, setting := range embedded.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
+
+func (info buildInfo) String() string {
+	s := programName + " " + info.Version
+	if info.Commit != "" {
+		s += "\ncommit: " + info.Commit
+		if info.Modified {
+			s += " (modified)"
+		}
+	}
+	if info.BuildDate != "" {
+		s += "\nbuilt: " + info.BuildDate
+	}
+	return s + "\ngo: " + info.GoVersion + " " + info.Platform
+}
+
+func runVersion(args []string) error {
+	flagSet := flag.NewFlagSet("version", flag.ExitOnError)
+
+	var output string
+	flagSet.StringVar(
+		&output,
+		"o",
+		"text",
+		"the output format: text or json",
+	)
+	flagSet.Parse(args)
+
+	info := readBuildInfo()
+	switch output {
+	case "text":
+		fmt.Println(info)
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+// vmVendorPolicy is how generated addresses take into account that a device
+// is virtual, as an Intel address on a virtio device gives itself away.
+type vmVendorPolicy string
+
+const (
+	vmVendorsIgnore vmVendorPolicy = "ignore"
+	vmVendorsMatch                 = "match"
+	vmVendorsAvoid                 = "avoid"
+)
+
+func parseVMVendorPolicy(value string) (vmVendorPolicy, error) {
+	switch policy := vmVendorPolicy(value); policy {
+	case vmVendorsIgnore, vmVendorsMatch, vmVendorsAvoid:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown VM vendor policy %q", value)
+	}
+}
+
+// virtualDrivers are those of the paravirtual devices of hypervisors.
+// VirtualBox emulates physical devices, so its are only told apart by their
+// addresses.
+var virtualDrivers = map[string]rotator.Vendor{
+	"virtio_net": rotator.VendorQEMU,
+	"vmxnet3":    rotator.VendorVMware,
+	"hv_netvsc":  rotator.VendorHyperV,
+	"vif":        rotator.VendorXen,
+}
+
+// hypervisorOf finds the hypervisor of a virtual device, by the range its
+// permanent address is from, or else by its driver, or else by the range of
+// its current address.
+func hypervisorOf(deviceName string) (rotator.Vendor, bool) {
+	if vendor, ok := virtualVendorOf(permanentMac(deviceName)); ok {
+		return vendor, true
+	}
+	if vendor, ok := virtualDrivers[deviceDriver(deviceName)]; ok {
+		return vendor, true
+	}
+	return virtualVendorOf(rotator.CurrentMAC(deviceName))
+}
+
+func virtualVendorOf(mac rotator.MAC, err error) (rotator.Vendor, bool) {
+	if err != nil {
+		return "", false
+	}
+	vendor := rotator.VendorOf(mac)
+	_, ok := rotator.VirtualVendor(vendor)
+	return vendor, ok
+}
+
+// vendorsForDevice gives the vendors to generate the device's next address
+// from under the VM vendor policy.
+func (r *rotation) vendorsForDevice(settings settings) []rotator.VendorPrefix {
+	switch settings.vmVendors {
+	case vmVendorsMatch:
+		vendor, ok := hypervisorOf(r.deviceName)
+		if !ok {
+			return settings.vendors
+		}
+		vendorPrefix, _ := rotator.VirtualVendor(vendor)
+		r.logger.Debug("generating an address in the hypervisor's range", "hypervisor", vendor)
+		return []rotator.VendorPrefix{vendorPrefix}
+	case vmVendorsAvoid:
+		physical := slices.DeleteFunc(slices.Clone(settings.vendors), func(v rotator.VendorPrefix) bool {
+			return rotator.IsVirtual(v.Prefix)
+		})
+		if len(physical) == 0 {
+			return rotator.Vendors
+		}
+		return physical
+	default:
+		return settings.vendors
+	}
+}
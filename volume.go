@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const trafficPollInterval = 5 * time.Second
+
+// trafficLimitReached says why the traffic since the baseline calls for a
+// rotation, if it does.
+func trafficLimitReached(flags flags, since traffic) (string, bool) {
+	switch {
+	case flags.rotateAfterBytes != 0 && flags.rotateAfterBytes <= since.bytes():
+		return fmt.Sprintf("it transferred %d bytes", since.bytes()), true
+	case flags.rotateAfterPackets != 0 && flags.rotateAfterPackets <= since.packets():
+		return fmt.Sprintf("it transferred %d packets", since.packets()), true
+	default:
+		return "", false
+	}
+}
+
+// watchTrafficTrigger rotates a device once it has carried -rotate-after-bytes
+// or -rotate-after-packets since its last change, as the more it sends under
+// one address, the more there is to link to it.
+func watchTrafficTrigger(ctx context.Context, d *daemon, r *rotation) error {
+	lastChange := r.currentStatus().lastChange
+	baseline, _ := readTraffic(r.deviceName)
+	requested := false
+
+	ticker := time.NewTicker(trafficPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current, err := readTraffic(r.deviceName)
+		if err != nil {
+			continue
+		}
+
+		// Count from each change, and from scratch when the counters go
+		// backwards, as they do when a device is unplugged and returns.
+		if change := r.currentStatus().lastChange; !change.Equal(lastChange) ||
+			current.bytes() < baseline.bytes() || current.packets() < baseline.packets() {
+			lastChange = change
+			baseline = current
+			requested = false
+			continue
+		}
+
+		since := traffic{
+			rxBytes:   current.rxBytes - baseline.rxBytes,
+			txBytes:   current.txBytes - baseline.txBytes,
+			rxPackets: current.rxPackets - baseline.rxPackets,
+			txPackets: current.txPackets - baseline.txPackets,
+		}
+		if reason, ok := trafficLimitReached(d.currentFlags(), since); ok && !requested {
+			r.requestRotation(reason)
+			requested = true
+		}
+	}
+}
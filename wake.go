@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/louis.jackman/rotate-mac-address/rotator"
+)
+
+const wakePollInterval = 5 * time.Second
+
+// watchWakeTrigger rotates every device just after the machine resumes, since
+// waking in a new place with the pre-sleep identity is exactly when it is most
+// linkable.
+func watchWakeTrigger(ctx context.Context, d *daemon) error {
+	return watchWakes(ctx, func() {
+		if d.currentFlags().rotateOnWake {
+			d.rotateAll("the machine woke from sleep")
+		}
+	})
+}
+
+// watchClockJumps notices resumes by the wall clock jumping ahead of the
+// monotonic clock, which stops during a suspend. It needs no help from the OS,
+// so it serves wherever there is no better way to be told.
+func watchClockJumps(ctx context.Context, onWake func()) error {
+	ticker := time.NewTicker(wakePollInterval)
+	defer ticker.Stop()
+
+	before := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		wallElapsed := now.Round(0).Sub(before.Round(0))
+		if rotator.SuspendSkewThreshold < wallElapsed-now.Sub(before) {
+			onWake()
+		}
+		before = now
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"strings"
+)
+
+const prepareForSleepMatch = "type='signal',interface='org.freedesktop.login1.Manager',member='PrepareForSleep'"
+
+// watchWakes follows logind's PrepareForSleep signal, which is false once the
+// machine has resumed, where dbus-monitor is available to hear it.
+func watchWakes(ctx context.Context, onWake func()) error {
+	if _, err := exec.LookPath("dbus-monitor"); err != nil {
+		return watchClockJumps(ctx, onWake)
+	}
+
+	cmd := exec.CommandContext(ctx, "dbus-monitor", "--system", prepareForSleepMatch)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	inSignal := false
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "signal ") {
+			inSignal = strings.Contains(line, "member=PrepareForSleep")
+		} else if inSignal && line == "boolean false" {
+			inSignal = false
+			onWake()
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
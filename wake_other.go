@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "context"
+
+// watchWakes watches the clocks, as the OS notifications for resuming are out
+// of reach without cgo.
+func watchWakes(ctx context.Context, onWake func()) error {
+	return watchClockJumps(ctx, onWake)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the flags whenever the config file changes, as SIGHUP
+// does, for configuration management that edits the file without signalling
+// the daemon. It polls, as change notifications need a different API on
+// each platform.
+func watchConfig(ctx context.Context, d *daemon, path string) {
+	lastModTime, lastSize := statConfig(path)
+	last, _ := readConfig(path)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, size := statConfig(path)
+		if modTime.Equal(lastModTime) && size == lastSize {
+			continue
+		}
+		lastModTime, lastSize = modTime, size
+
+		current, err := readConfig(path)
+		if err == nil {
+			var flags flags
+			if flags, err = reloadFlags(); err == nil {
+				logConfigChanges(path, last, current)
+				last = current
+				d.reload(ctx, flags)
+				continue
+			}
+		}
+		slog.Error("the config file changed but could not be reloaded", "path", path, "err", err)
+	}
+}
+
+func statConfig(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
+
+// secretSettings have their values kept out of the log.
+var secretSettings = []string{"api-token", "webhook-secret", "mqtt", "report-token", "otlp-headers"}
+
+func loggableConfigValue(v configValue) string {
+	if slices.Contains(secretSettings, strings.ReplaceAll(v.key, "_", "-")) {
+		return "<redacted>"
+	}
+	return v.value
+}
+
+// configKey identifies a setting across tables, so that the same key can be
+// compared between two versions of a file.
+func configKey(v configValue) string {
+	if len(v.table) == 0 {
+		return v.key
+	}
+	return "[" + formatConfigTable(v.table) + "]." + v.key
+}
+
+// logConfigChanges logs each setting that was added, changed, or removed, in
+// the order of the file.
+func logConfigChanges(path string, old, current config) {
+	oldValues := make(map[string]string)
+	for _, v := range old.values {
+		oldValues[configKey(v)] = v.value
+	}
+
+	changed := false
+	for _, v := range current.values {
+		key := configKey(v)
+		oldValue, existed := oldValues[key]
+		delete(oldValues, key)
+
+		switch {
+		case !existed:
+			slog.Info("a setting was added to the config file", "path", path, "setting", key, "value", loggableConfigValue(v))
+		case oldValue != v.value:
+			slog.Info(
+				"a setting changed in the config file",
+				"path", path,
+				"setting", key,
+				"from", loggableConfigValue(configValue{key: v.key, value: oldValue}),
+				"to", loggableConfigValue(v),
+			)
+		default:
+			continue
+		}
+		changed = true
+	}
+	for _, v := range old.values {
+		if _, removed := oldValues[configKey(v)]; removed {
+			slog.Info("a setting was removed from the config file", "path", path, "setting", configKey(v))
+			changed = true
+		}
+	}
+
+	if !changed {
+		slog.Info("reloaded the config file, which has the same settings as before", "path", path)
+	}
+}
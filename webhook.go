@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	webhookTimeout      = 10 * time.Second
+	webhookAttempts     = 4
+	webhookRetryDelay   = 2 * time.Second
+	webhookSignatureKey = "X-Rotate-Mac-Address-Signature-256"
+)
+
+// The kinds of webhook event.
+const (
+	webhookRotated = "rotated"
+	webhookFailed  = "failed"
+	webhookAborted = "aborted"
+)
+
+// webhookEvent is the JSON payload posted. Text is a summary for chat
+// services such as Slack, which show it without further configuration.
+type webhookEvent struct {
+	Event string `json:"event"`
+	Text  string `json:"text"`
+	historyEntry
+}
+
+func newWebhookEvent(entry historyEntry) webhookEvent {
+	switch {
+	case entry.Error != "":
+		return webhookEvent{
+			webhookFailed,
+			fmt.Sprintf("%s could not be rotated: %s", entry.Device, entry.Error),
+			entry,
+		}
+	case entry.Previous != "":
+		return webhookEvent{
+			webhookRotated,
+			fmt.Sprintf("%s changed from %s to %s of vendor %s", entry.Device, entry.Previous, entry.Mac, entry.Vendor),
+			entry,
+		}
+	default:
+		return webhookEvent{
+			webhookRotated,
+			fmt.Sprintf("%s changed to %s of vendor %s", entry.Device, entry.Mac, entry.Vendor),
+			entry,
+		}
+	}
+}
+
+type webhooks struct {
+	urls   []string
+	secret string
+	client *http.Client
+}
+
+func newWebhooks(urls []string, secret string) (*webhooks, error) {
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("webhooks must be http:// or https:// addresses, not %q", rawURL)
+		}
+	}
+	return &webhooks{urls, secret, &http.Client{Timeout: webhookTimeout}}, nil
+}
+
+// serveWebhooks posts every change, successful or not, to each webhook.
+func serveWebhooks(ctx context.Context, d *daemon, hooks *webhooks) {
+	entries, unsubscribe := d.history.subscribe()
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry := <-entries:
+				hooks.post(ctx, newWebhookEvent(entry))
+			}
+		}
+	}()
+}
+
+// abort tells each webhook that the daemon has given up, waiting a while for
+// them to hear it.
+func (hooks *webhooks) abort(err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	hooks.post(ctx, webhookEvent{
+		Event:        webhookAborted,
+		Text:         "stopped rotating MAC addresses: " + err.Error(),
+		historyEntry: historyEntry{At: time.Now(), Error: err.Error()},
+	})
+}
+
+// post sends an event to every webhook at once, retrying each a few times if
+// it fails in a way that could pass, and waits for them all to finish.
+func (hooks *webhooks) post(ctx context.Context, event webhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("could not encode a webhook event", "err", err)
+		return
+	}
+
+	var signature string
+	if hooks.secret != "" {
+		mac := hmac.New(sha256.New, []byte(hooks.secret))
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	var wg sync.WaitGroup
+	for _, hookURL := range hooks.urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			delay := webhookRetryDelay
+			for attempt := 1; ; attempt++ {
+				retry, err := hooks.postOnce(ctx, hookURL, body, signature)
+				if err == nil {
+					return
+				}
+				if !retry || attempt == webhookAttempts {
+					slog.Warn("could not post to a webhook", "webhook", redactURL(hookURL), "err", err)
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				delay *= 2
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// postOnce posts the body, reporting whether a failure is worth retrying.
+func (hooks *webhooks) postOnce(ctx context.Context, hookURL string, body []byte, signature string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rotate-mac-address")
+	if signature != "" {
+		req.Header.Set(webhookSignatureKey, signature)
+	}
+
+	resp, err := hooks.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || 500 <= resp.StatusCode:
+		return true, fmt.Errorf("answered %s", resp.Status)
+	default:
+		return false, fmt.Errorf("answered %s", resp.Status)
+	}
+}
+
+// redactURL hides any credentials in a URL, which chat services often put
+// in the path, for logging.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/..."
+}
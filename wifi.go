@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const networkPollInterval = 5 * time.Second
+
+// network identifies the wireless network a device is associated with; it is
+// empty when the device is not associated.
+type network struct {
+	ssid  string
+	bssid string
+}
+
+func (n network) associated() bool {
+	return n != network{}
+}
+
+func (n network) String() string {
+	if !n.associated() {
+		return "no network"
+	}
+	if n.bssid == "" {
+		return n.ssid
+	}
+	return n.ssid + " (" + n.bssid + ")"
+}
+
+// pollNetworks reports the network a device is associated with each time it
+// changes, for platforms without association events.
+func pollNetworks(ctx context.Context, deviceName string, onChange func(network)) error {
+	ticker := time.NewTicker(networkPollInterval)
+	defer ticker.Stop()
+
+	var last network
+	first := true
+	failing := false
+
+	for {
+		current, err := currentNetwork(deviceName)
+		if err != nil && !failing {
+			slog.Warn("could not check the wireless network", "device", deviceName, "err", err)
+		}
+		failing = err != nil
+
+		if err == nil && (first || current != last) {
+			last = current
+			first = false
+			onChange(current)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchNetworkTrigger rotates a device whenever it joins a different wireless
+// network from the one it was last on, giving each network its own identity.
+func watchNetworkTrigger(ctx context.Context, d *daemon, r *rotation) error {
+	var joined network
+
+	return watchNetworks(ctx, r.deviceName, func(current network) {
+		if !current.associated() {
+			return
+		}
+
+		previous := joined
+		joined = current
+		if !previous.associated() || previous.ssid == current.ssid {
+			return
+		}
+
+		if d.currentFlags().rotateOnNetworkChange {
+			r.requestRotation("it joined " + current.String())
+		}
+	})
+}
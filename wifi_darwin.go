@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+func currentNetwork(deviceName string) (network, error) {
+	out, err := exec.Command("networksetup", "-getairportnetwork", deviceName).Output()
+	if err != nil {
+		return network{}, err
+	}
+
+	ssid, ok := strings.CutPrefix(strings.TrimSpace(string(out)), "Current Wi-Fi Network: ")
+	if !ok {
+		return network{}, nil
+	}
+	return network{ssid: ssid}, nil
+}
+
+// watchNetworks polls, as CoreWLAN's notifications are out of reach without
+// cgo.
+func watchNetworks(ctx context.Context, deviceName string, onChange func(network)) error {
+	return pollNetworks(ctx, deviceName, onChange)
+}
+
+// disassociate power-cycles the adapter, which leaves it unassociated for long
+// enough to change its address before it automatically rejoins.
+func disassociate(deviceName string) error {
+	for _, state := range []string{"off", "on"} {
+		err := exec.Command("networksetup", "-setairportpower", deviceName, state).Run()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reassociate(deviceName string, previous network) error {
+	return exec.Command("networksetup", "-setairportnetwork", deviceName, previous.ssid).Run()
+}
+
+// holdAssociation cannot stop macOS rejoining networks short of powering the
+// adapter off, which would lose the network to rejoin.
+func holdAssociation(string) bool {
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// currentNetwork asks wpa_supplicant, falling back to iw for setups such as
+// iwd that lack it.
+func currentNetwork(deviceName string) (network, error) {
+	if conn, err := dialWpa(deviceName); err == nil {
+		defer conn.Close()
+		return conn.network()
+	}
+
+	out, err := exec.Command("iw", "dev", deviceName, "link").Output()
+	if err != nil {
+		return network{}, err
+	}
+
+	var current network
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "Connected to "); ok {
+			current.bssid, _, _ = strings.Cut(rest, " ")
+		} else if ssid, ok := strings.CutPrefix(line, "SSID: "); ok {
+			current.ssid = ssid
+		}
+	}
+	return current, nil
+}
+
+// watchNetworks follows wpa_supplicant's association events where it is
+// running, and polls otherwise.
+func watchNetworks(ctx context.Context, deviceName string, onChange func(network)) error {
+	events, err := dialWpa(deviceName)
+	if err != nil {
+		return pollNetworks(ctx, deviceName, onChange)
+	}
+	defer events.Close()
+
+	if err := events.attach(); err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		events.Close()
+	}()
+
+	report := func() error {
+		current, err := currentNetwork(deviceName)
+		if err == nil {
+			onChange(current)
+		}
+		return err
+	}
+	if err := report(); err != nil {
+		return err
+	}
+
+	for {
+		event, err := events.readEvent()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(event, "CTRL-EVENT-CONNECTED") ||
+			strings.HasPrefix(event, "CTRL-EVENT-DISCONNECTED") {
+			if err := report(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func disassociate(deviceName string) error {
+	if conn, err := dialWpa(deviceName); err == nil {
+		defer conn.Close()
+		_, err := conn.request("DISCONNECT")
+		return err
+	}
+	return exec.Command("iw", "dev", deviceName, "disconnect").Run()
+}
+
+// reassociate relies on whatever manages the connection to rejoin when
+// wpa_supplicant is not there to ask.
+func reassociate(deviceName string, _ network) error {
+	conn, err := dialWpa(deviceName)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	_, err = conn.request("RECONNECT")
+	return err
+}
+
+// holdAssociation stops wpa_supplicant from rejoining a network of its own
+// accord until reassociate is called, reporting whether it could.
+func holdAssociation(deviceName string) bool {
+	conn, err := dialWpa(deviceName)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	_, err = conn.request("DISCONNECT")
+	return err == nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+var errNoWifiSupport = errors.New("wireless networks cannot be inspected on this platform")
+
+func currentNetwork(string) (network, error) {
+	return network{}, errNoWifiSupport
+}
+
+func watchNetworks(context.Context, string, func(network)) error {
+	return errNoWifiSupport
+}
+
+func disassociate(string) error {
+	return errNoWifiSupport
+}
+
+func reassociate(string, network) error {
+	return errNoWifiSupport
+}
+
+func holdAssociation(string) bool {
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+func currentNetwork(deviceName string) (network, error) {
+	out, err := exec.Command("netsh", "wlan", "show", "interfaces").Output()
+	if err != nil {
+		return network{}, err
+	}
+
+	var current network
+	inDevice := false
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "Name":
+			inDevice = value == deviceName
+		case "SSID":
+			if inDevice {
+				current.ssid = value
+			}
+		case "BSSID":
+			if inDevice {
+				current.bssid = value
+			}
+		}
+	}
+	return current, nil
+}
+
+func watchNetworks(ctx context.Context, deviceName string, onChange func(network)) error {
+	return pollNetworks(ctx, deviceName, onChange)
+}
+
+func disassociate(deviceName string) error {
+	return exec.Command("netsh", "wlan", "disconnect", "interface="+deviceName).Run()
+}
+
+// reassociate assumes the profile is named after the SSID, as Windows does by
+// default.
+func reassociate(deviceName string, previous network) error {
+	return exec.Command(
+		"netsh", "wlan", "connect",
+		"name="+previous.ssid,
+		"interface="+deviceName,
+	).Run()
+}
+
+// holdAssociation leaves Windows to rejoin networks as it will.
+func holdAssociation(string) bool {
+	return false
+}
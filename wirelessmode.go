@@ -0,0 +1,67 @@
+package main
+
+import "fmt"
+
+// wirelessMode is what a wireless device is doing, which decides whether and
+// how it can be rotated. Association only applies to stations.
+type wirelessMode string
+
+const (
+	modeStation wirelessMode = "station"
+	modeAP                   = "ap"
+	modeMonitor              = "monitor"
+	modeOther                = "other"
+)
+
+// apModePolicy is what to do about rotations of devices running as access
+// points, which drop every client when their addresses change.
+type apModePolicy string
+
+const (
+	apModeSkip    apModePolicy = "skip"
+	apModeRestart              = "restart"
+)
+
+func parseAPModePolicy(value string) (apModePolicy, error) {
+	switch policy := apModePolicy(value); policy {
+	case apModeSkip, apModeRestart:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown AP mode policy %q", value)
+	}
+}
+
+// modeSkipReason says why the device should not be rotated in its current
+// mode, if it should not.
+func modeSkipReason(settings settings, mode wirelessMode) string {
+	switch {
+	case mode == modeMonitor:
+		return "the device is in monitor mode, where taking it down to change its address would interrupt the capture, for an address it never sends"
+	case mode == modeAP && settings.apMode == apModeSkip:
+		return "the device is running an access point, which would drop every client; pass -ap-mode restart to restart it through hostapd around the change"
+	}
+	return ""
+}
+
+// pauseAccessPoint disables the device's access point for the change, if it
+// runs one, as hostapd keeps its own idea of the address otherwise. It gives
+// what enables the access point again.
+func (r *rotation) pauseAccessPoint(settings settings, mode wirelessMode) (func(), error) {
+	if mode != modeAP {
+		return func() {}, nil
+	}
+	if settings.dryRun {
+		r.logger.Info("would restart the access point around the change")
+		return func() {}, nil
+	}
+
+	if err := toggleAccessPoint(r.deviceName, false); err != nil {
+		return nil, err
+	}
+	r.logger.Info("disabled the access point for the change")
+	return func() {
+		if err := toggleAccessPoint(r.deviceName, true); err != nil {
+			r.logger.Error("could not enable the access point again", "err", err)
+		}
+	}, nil
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var wpaCtrlDirs = []string{"/run/wpa_supplicant", "/var/run/wpa_supplicant"}
+
+const wpaRequestTimeout = 5 * time.Second
+
+var wpaConnCount atomic.Uint64
+
+// wpaConn speaks wpa_supplicant's control protocol: datagrams over a Unix
+// socket per interface, with replies sent back to the client's bound path.
+type wpaConn struct {
+	conn  *net.UnixConn
+	local string
+}
+
+func dialWpa(deviceName string) (*wpaConn, error) {
+	local := filepath.Join(
+		os.TempDir(),
+		fmt.Sprintf("rotate-mac-address-%d-%d", os.Getpid(), wpaConnCount.Add(1)),
+	)
+	laddr := &net.UnixAddr{Name: local, Net: "unixgram"}
+
+	var errs []error
+	for _, dir := range wpaCtrlDirs {
+		raddr := &net.UnixAddr{Name: filepath.Join(dir, deviceName), Net: "unixgram"}
+		conn, err := net.DialUnix("unixgram", laddr, raddr)
+		if err == nil {
+			return &wpaConn{conn, local}, nil
+		}
+		os.Remove(local)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("could not reach wpa_supplicant for %s: %w", deviceName, errors.Join(errs...))
+}
+
+func (c *wpaConn) Close() error {
+	defer os.Remove(c.local)
+	return c.conn.Close()
+}
+
+func (c *wpaConn) request(cmd string) (string, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(wpaRequestTimeout)); err != nil {
+		return "", err
+	}
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write([]byte(cmd)); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return "", err
+		}
+
+		// Unsolicited events start with their priority, such as "<3>".
+		reply := string(buf[:n])
+		if !strings.HasPrefix(reply, "<") {
+			return reply, nil
+		}
+	}
+}
+
+// attach subscribes to events, after which readEvent should be used.
+func (c *wpaConn) attach() error {
+	reply, err := c.request("ATTACH")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(reply) != "OK" {
+		return fmt.Errorf("wpa_supplicant refused to attach: %s", reply)
+	}
+	return nil
+}
+
+func (c *wpaConn) readEvent() (string, error) {
+	buf := make([]byte, 4096)
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	event := string(buf[:n])
+	if end := strings.IndexByte(event, '>'); strings.HasPrefix(event, "<") && 0 < end {
+		event = event[end+1:]
+	}
+	return event, nil
+}
+
+func parseWpaStatus(reply string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(reply, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+func (c *wpaConn) network() (network, error) {
+	reply, err := c.request("STATUS")
+	if err != nil {
+		return network{}, err
+	}
+
+	status := parseWpaStatus(reply)
+	if status["wpa_state"] != "COMPLETED" {
+		return network{}, nil
+	}
+	return network{ssid: status["ssid"], bssid: status["bssid"]}, nil
+}